@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/benchmark"
+)
+
+func main() {
+	os.Exit(benchmark.Run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -6,6 +6,8 @@ require (
 	github.com/gammazero/deque v0.2.1
 	github.com/redis/go-redis/v9 v9.5.1
 	github.com/rs/zerolog v1.32.0
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/term v0.19.0
 )
 
 require (
@@ -0,0 +1,57 @@
+package integration_tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+)
+
+func TestACLIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s, cli := startServer(t, server.WithRequirePass("secret"))
+	ctx := context.Background()
+
+	err := cli.Ping(ctx).Err()
+	IsTrue(t, err != nil && strings.HasPrefix(err.Error(), "NOAUTH"), "err=%v", err)
+
+	admin := redis.NewClient(&redis.Options{Addr: s.Addr(), Password: "secret"})
+	defer admin.Close()
+	NoError(t, admin.Ping(ctx).Err())
+	EqualO(t, admin.Do(ctx, "ACL", "WHOAMI").Val(), any("default"))
+
+	NoError(t, admin.Do(ctx, "ACL", "SETUSER", "reader", "on", ">pw", "~cache:*", "+@read", "&news").Err())
+	NoError(t, admin.Set(ctx, "cache:1", "v", 0).Err())
+	NoError(t, admin.Set(ctx, "secret", "v", 0).Err())
+
+	reader := redis.NewClient(&redis.Options{Addr: s.Addr(), Username: "reader", Password: "pw"})
+	defer reader.Close()
+	EqualO(t, reader.Get(ctx, "cache:1").Val(), "v")
+
+	err = reader.Get(ctx, "secret").Err()
+	EqualO(t, err.Error(), "NOPERM No permissions to access a key")
+	err = reader.Set(ctx, "cache:1", "w", 0).Err()
+	EqualO(t, err.Error(), "NOPERM User reader has no permissions to run the 'set' command")
+	err = reader.Do(ctx, "ACL", "SETUSER", "reader", "+@all").Err()
+	EqualO(t, err.Error(), "NOPERM User reader has no permissions to run the 'acl' command")
+
+	wrong := redis.NewClient(&redis.Options{Addr: s.Addr(), Username: "reader", Password: "wrong"})
+	defer wrong.Close()
+	err = wrong.Ping(ctx).Err()
+	IsTrue(t, err != nil && strings.HasPrefix(err.Error(), "WRONGPASS"), "err=%v", err)
+
+	log, err := admin.Do(ctx, "ACL", "LOG").Slice()
+	NoError(t, err)
+	IsTrue(t, len(log) >= 4, "log=%v", log)
+
+	// the replication commands are checked too
+	err = cli.Do(ctx, "PSYNC", "?", "-1").Err()
+	IsTrue(t, err != nil && strings.HasPrefix(err.Error(), "NOAUTH"), "err=%v", err)
+}
@@ -0,0 +1,90 @@
+package integration_tests
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestClientIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s, cli := startServer(t)
+	ctx := context.Background()
+	// a single connection, so that the IDs are stable
+	conn := cli.Conn()
+	defer conn.Close()
+
+	id, err := conn.ClientID(ctx).Result()
+	NoError(t, err)
+	NoError(t, conn.ClientSetName(ctx, "tester").Err())
+	EqualO(t, conn.ClientGetName(ctx).Val(), "tester")
+
+	info, err := conn.ClientInfo(ctx).Result()
+	NoError(t, err)
+	EqualO(t, info.ID, id)
+	EqualO(t, info.Name, "tester")
+	EqualO(t, info.LAddr, s.Addr())
+
+	// a raw connection, so that it is not reconnected once it is killed
+	victim, err := net.Dial("tcp", s.Addr())
+	NoError(t, err)
+	defer victim.Close()
+	rd := bufio.NewReader(victim)
+	_, err = victim.Write([]byte("*1\r\n$4\r\nPING\r\n"))
+	NoError(t, err)
+	line, err := rd.ReadString('\n')
+	NoError(t, err)
+	EqualO(t, line, "+PONG\r\n")
+
+	list, err := conn.ClientList(ctx).Result()
+	NoError(t, err)
+	EqualO(t, strings.Count(list, "\n"), 2)
+	IsTrue(t, strings.Contains(list, "name=tester") && strings.Contains(list, "cmd=ping"), "list=%q", list)
+
+	killed, err := conn.ClientKillByFilter(ctx, "ADDR", victim.LocalAddr().String()).Result()
+	NoError(t, err)
+	EqualO(t, killed, int64(1))
+	victim.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = rd.ReadString('\n')
+	IsTrue(t, err != nil, "the killed connection should be closed")
+
+	// writes wait for the pause to end, reads do not
+	NoError(t, cli.Do(ctx, "CLIENT", "PAUSE", "300", "WRITE").Err())
+	start := time.Now()
+	err = cli.Get(ctx, "k").Err()
+	IsTrue(t, err == redis.Nil, "err=%v", err)
+	IsTrue(t, time.Since(start) < 200*time.Millisecond, "reads should not be paused, took %v", time.Since(start))
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	IsTrue(t, time.Since(start) >= 200*time.Millisecond, "writes should be paused, took %v", time.Since(start))
+
+	NoError(t, cli.Do(ctx, "CLIENT", "PAUSE", "10000").Err())
+	NoError(t, cli.Do(ctx, "CLIENT", "UNPAUSE").Err())
+	start = time.Now()
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	IsTrue(t, time.Since(start) < time.Second, "should be unpaused, took %v", time.Since(start))
+
+	list, err = cli.Do(ctx, "CLIENT", "LIST", "ID", strconv.FormatInt(id, 10)).Text()
+	NoError(t, err)
+	EqualO(t, strings.Count(list, "\n"), 1)
+
+	// CLIENT REPLY SKIP is not replied to, nor is the command after it
+	raw, err := net.Dial("tcp", s.Addr())
+	NoError(t, err)
+	defer raw.Close()
+	_, err = raw.Write([]byte("*3\r\n$6\r\nCLIENT\r\n$5\r\nREPLY\r\n$4\r\nSKIP\r\n*2\r\n$4\r\nECHO\r\n$1\r\na\r\n*2\r\n$4\r\nECHO\r\n$1\r\nb\r\n"))
+	NoError(t, err)
+	line, err = bufio.NewReader(raw).ReadString('\n')
+	NoError(t, err)
+	EqualO(t, line, "$1\r\n")
+}
@@ -0,0 +1,93 @@
+package integration_tests
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/cluster"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+)
+
+// busPort reads the cluster bus port of the node from CLUSTER NODES.
+func busPort(t testing.TB, cli *redis.Client) string {
+	nodes, err := cli.ClusterNodes(context.Background()).Result()
+	NoError(t, err)
+	for _, line := range strings.Split(nodes, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 2 && strings.Contains(fields[2], "myself") {
+			_, port, _ := strings.Cut(fields[1], "@")
+			return port
+		}
+	}
+	t.Fatalf("myself not in CLUSTER NODES: %q", nodes)
+	return ""
+}
+
+func TestClusterIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	ctx := context.Background()
+
+	var addrs []string
+	var clis []*redis.Client
+	for i := 0; i < 3; i++ {
+		s, cli := startServer(t, server.WithCluster("localhost:0"))
+		addrs = append(addrs, s.Addr())
+		clis = append(clis, cli)
+	}
+
+	third := cluster.SlotCount / 3
+	NoError(t, clis[0].ClusterAddSlotsRange(ctx, 0, third-1).Err())
+	NoError(t, clis[1].ClusterAddSlotsRange(ctx, third, 2*third-1).Err())
+	NoError(t, clis[2].ClusterAddSlotsRange(ctx, 2*third, cluster.SlotCount-1).Err())
+	for i := 1; i < 3; i++ {
+		host, port, _ := net.SplitHostPort(addrs[i])
+		NoError(t, clis[0].Do(ctx, "CLUSTER", "MEET", host, port, busPort(t, clis[i])).Err())
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for _, cli := range clis {
+		for {
+			info, err := cli.ClusterInfo(ctx).Result()
+			NoError(t, err)
+			if strings.Contains(info, "cluster_state:ok") && strings.Contains(info, "cluster_known_nodes:3") {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("cluster did not converge, info=%q", info)
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	// nodes redirect keys they do not serve
+	err := clis[0].Get(ctx, "foo").Err()
+	IsTrue(t, err != nil && err.Error() == fmt.Sprintf("MOVED 12182 %s", addrs[2]), "err=%v", err)
+
+	cc := redis.NewClusterClient(&redis.ClusterOptions{Addrs: addrs})
+	t.Cleanup(func() {
+		cc.Close()
+	})
+
+	for i := 0; i < 100; i++ {
+		key := "key" + strconv.Itoa(i)
+		NoError(t, cc.Set(ctx, key, strconv.Itoa(i), 0).Err())
+		Equal(t, V(cc.Get(ctx, key).Result()), V(strconv.Itoa(i), nil))
+	}
+	IsTrue(t, cc.Get(ctx, "{user}.a").Err() == redis.Nil, "")
+	NoError(t, cc.Del(ctx, "{user}.a", "{user}.b").Err())
+
+	// keys in different slots cannot be used together
+	err = clis[0].Del(ctx, "a", "b").Err()
+	IsTrue(t, err != nil && strings.HasPrefix(err.Error(), "CROSSSLOT"), "err=%v", err)
+}
@@ -0,0 +1,43 @@
+package integration_tests
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestCommandIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	_, cli := startServer(t)
+	ctx := context.Background()
+
+	// parsed like go-redis' cluster client does, to route commands by key and to replicas
+	infos, err := cli.Command(ctx).Result()
+	NoError(t, err)
+	get, ok := infos["get"]
+	IsTrue(t, ok, "get should be described, infos=%v", infos)
+	EqualO(t, get.Arity, int8(2))
+	IsTrue(t, get.ReadOnly, "get should be readonly")
+	EqualO(t, get.FirstKeyPos, int8(1))
+	IsFalse(t, infos["set"].ReadOnly, "set should not be readonly")
+	EqualO(t, infos["exists"].LastKeyPos, int8(-1))
+
+	count, err := cli.Do(ctx, "COMMAND", "COUNT").Int()
+	NoError(t, err)
+	EqualO(t, count, len(infos))
+
+	keys, err := cli.CommandGetKeys(ctx, "DEL", "a", "b").Result()
+	NoError(t, err)
+	Equal(t, []any{keys}, []any{[]string{"a", "b"}})
+
+	list, err := cli.CommandList(ctx, nil).Result()
+	NoError(t, err)
+	EqualO(t, len(list), count)
+
+	err = cli.Do(ctx, "GET").Err()
+	EqualO(t, err.Error(), "ERR wrong number of arguments for 'get' command")
+}
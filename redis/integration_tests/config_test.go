@@ -0,0 +1,67 @@
+package integration_tests
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+)
+
+func TestConfigIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	st := store.New()
+	file := filepath.Join(t.TempDir(), "redis.conf")
+	NoError(t, os.WriteFile(file, []byte("# test config\nmaxmemory-policy allkeys-lru\n"), 0o600))
+	cfg := config.New()
+	NoError(t, cfg.ParseArgs([]string{file, "--maxmemory", "10mb"}))
+
+	_, cli := startServer(t, server.WithConfig(cfg), server.WithStore(st))
+	ctx := context.Background()
+
+	// the given values are applied on startup
+	EqualO(t, st.EvictionPolicy(), store.AllKeysLRU)
+	values, err := cli.ConfigGet(ctx, "maxmemory*").Result()
+	NoError(t, err)
+	EqualO(t, values, map[string]string{"maxmemory": "10mb", "maxmemory-policy": "allkeys-lru", "maxmemory-samples": "5"})
+
+	NoError(t, cli.ConfigSet(ctx, "maxmemory-policy", "volatile-ttl").Err())
+	EqualO(t, st.EvictionPolicy(), store.VolatileTTL)
+	err = cli.ConfigSet(ctx, "maxmemory-policy", "sometimes").Err()
+	IsTrue(t, err != nil && strings.HasPrefix(err.Error(), "ERR CONFIG SET failed (possibly related to argument 'maxmemory-policy')"), "err=%v", err)
+	EqualO(t, st.EvictionPolicy(), store.VolatileTTL)
+	err = cli.ConfigSet(ctx, "port", "1").Err()
+	IsTrue(t, err != nil && strings.Contains(err.Error(), "can't set immutable config"), "err=%v", err)
+
+	// snapshots are saved to dir/dbfilename
+	dir := t.TempDir()
+	NoError(t, cli.ConfigSet(ctx, "dir", dir).Err())
+	NoError(t, cli.ConfigSet(ctx, "dbfilename", "dump.rdb").Err())
+	NoError(t, cli.Save(ctx).Err())
+	_, err = os.Stat(filepath.Join(dir, "dump.rdb"))
+	NoError(t, err)
+	err = cli.ConfigSet(ctx, "dbfilename", "../dump.rdb").Err()
+	IsTrue(t, err != nil && strings.Contains(err.Error(), "dbfilename can't be a path, just a filename"), "err=%v", err)
+
+	// requirepass applies to new connections
+	NoError(t, cli.ConfigSet(ctx, "requirepass", "secret").Err())
+	NoError(t, cli.Do(ctx, "AUTH", "secret").Err())
+
+	NoError(t, cli.ConfigRewrite(ctx).Err())
+	data, err := os.ReadFile(file)
+	NoError(t, err)
+	EqualO(t, string(data), "# test config\nmaxmemory-policy volatile-ttl\n# Generated by CONFIG REWRITE\nmaxmemory 10mb\nrequirepass secret\ndir "+dir+"\ndbfilename dump.rdb\n")
+
+	cli.Get(ctx, "missing")
+	IsTrue(t, st.Stats().KeyspaceMisses.Load() > 0, "misses should be counted")
+	NoError(t, cli.ConfigResetStat(ctx).Err())
+	EqualO(t, st.Stats().KeyspaceMisses.Load(), int64(0))
+}
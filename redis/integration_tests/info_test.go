@@ -0,0 +1,65 @@
+package integration_tests
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+)
+
+// infoField returns the value of the field in INFO.
+func infoField(t *testing.T, cli *redis.Client, section, field string) string {
+	t.Helper()
+
+	report, err := cli.Info(context.Background(), section).Result()
+	NoError(t, err)
+	for _, line := range strings.Split(report, "\r\n") {
+		if value, ok := strings.CutPrefix(line, field+":"); ok {
+			return value
+		}
+	}
+	t.Fatalf("no %s in INFO %s: %q", field, section, report)
+	return ""
+}
+
+func TestInfoIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s, cli := startServer(t, server.WithConfig(config.New()))
+	ctx := context.Background()
+
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	NoError(t, cli.Set(ctx, "expiring", "v", time.Hour).Err())
+	cli.Get(ctx, "k")
+	cli.Get(ctx, "missing")
+
+	other := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer other.Close()
+	NoError(t, other.Ping(ctx).Err())
+
+	EqualO(t, infoField(t, cli, "clients", "connected_clients"), "2")
+	EqualO(t, infoField(t, cli, "keyspace", "db0"), "keys=2,expires=1,avg_ttl=0")
+	EqualO(t, infoField(t, cli, "stats", "keyspace_hits"), "1")
+	EqualO(t, infoField(t, cli, "stats", "keyspace_misses"), "1")
+	_, port, _ := strings.Cut(s.Addr(), ":")
+	EqualO(t, infoField(t, cli, "server", "tcp_port"), port)
+	EqualO(t, infoField(t, cli, "replication", "role"), "master")
+
+	processed, err := strconv.Atoi(infoField(t, cli, "stats", "total_commands_processed"))
+	NoError(t, err)
+	IsTrue(t, processed >= 5, "processed=%d", processed)
+
+	NoError(t, cli.ConfigResetStat(ctx).Err())
+	EqualO(t, infoField(t, cli, "stats", "keyspace_hits"), "0")
+	// INFO itself is counted once it has been handled
+	EqualO(t, infoField(t, cli, "stats", "total_commands_processed"), "2")
+}
@@ -10,13 +10,9 @@ import (
 
 	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
-	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
 )
 
 func setup(t testing.TB) func() {
-	store.ResetSingleton()
-
-	// TODO: instead of a global singleton, let the store be associated with a server / router?
 	router, err := server.New("localhost:6379")
 	if err != nil {
 		t.Errorf("error init server: %v", err)
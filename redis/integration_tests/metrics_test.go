@@ -0,0 +1,57 @@
+package integration_tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+)
+
+// scrape returns the body of the path on the metrics server.
+func scrape(t *testing.T, s *server.Server, path string) string {
+	t.Helper()
+
+	resp, err := http.Get("http://" + s.MetricsAddr() + path)
+	NoError(t, err)
+	defer resp.Body.Close()
+	EqualO(t, resp.StatusCode, http.StatusOK)
+	body, err := io.ReadAll(resp.Body)
+	NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s, cli := startServer(t, server.WithMetrics("localhost:0"))
+	ctx := context.Background()
+
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	NoError(t, cli.RPush(ctx, "l", "a", "b").Err())
+	cli.Get(ctx, "k")
+	cli.Get(ctx, "k")
+
+	EqualO(t, scrape(t, s, "/healthz"), "ok\n")
+
+	body := scrape(t, s, "/metrics")
+	for _, line := range []string{
+		`redis_command_calls_total{command="get"} 2`,
+		`redis_command_calls_total{command="set"} 1`,
+		`redis_command_duration_seconds_count{command="get"} 2`,
+		`redis_command_duration_seconds_bucket{command="get",le="+Inf"} 2`,
+		`redis_connected_clients 1`,
+		`redis_keys 2`,
+		`redis_keys_by_type{type="list"} 1`,
+		`redis_keys_by_type{type="string"} 1`,
+		`# TYPE redis_expiry_cycle_duration_seconds histogram`,
+		`# TYPE redis_rdb_save_duration_seconds histogram`,
+	} {
+		IsTrue(t, strings.Contains(body, line+"\n"), "missing %q in:\n%s", line, body)
+	}
+}
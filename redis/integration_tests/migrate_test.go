@@ -0,0 +1,48 @@
+package integration_tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+)
+
+func TestMigrateIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	_, source := startServer(t, server.WithStore(store.New()))
+	target, _ := startServer(t, server.WithStore(store.New()), server.WithRequirePass("secret"))
+	dest := redis.NewClient(&redis.Options{Addr: target.Addr(), Password: "secret"})
+	defer dest.Close()
+	ctx := context.Background()
+
+	NoError(t, source.Set(ctx, "k1", "v1", time.Hour).Err())
+	NoError(t, source.RPush(ctx, "k2", "a", "b").Err())
+
+	payload, err := source.Dump(ctx, "k1").Result()
+	NoError(t, err)
+	NoError(t, dest.Restore(ctx, "dumped", time.Minute, payload).Err())
+	EqualO(t, dest.Get(ctx, "dumped").Val(), "v1")
+	EqualO(t, dest.Restore(ctx, "dumped", 0, payload).Err().Error(), "BUSYKEY Target key name already exists.")
+	NoError(t, dest.RestoreReplace(ctx, "dumped", 0, payload).Err())
+
+	host, port, _ := net.SplitHostPort(target.Addr())
+	err = source.Do(ctx, "MIGRATE", host, port, "k1", "0", "1000").Err()
+	EqualO(t, err.Error(), "ERR Target instance replied with error: NOAUTH Authentication required.")
+
+	NoError(t, source.Do(ctx, "MIGRATE", host, port, "k1", "0", "1000", "COPY", "AUTH", "secret").Err())
+	EqualO(t, source.Exists(ctx, "k1").Val(), int64(1))
+	EqualO(t, dest.Get(ctx, "k1").Val(), "v1")
+
+	NoError(t, source.Do(ctx, "MIGRATE", host, port, "", "0", "1000", "REPLACE", "AUTH2", "default", "secret", "KEYS", "k1", "k2").Err())
+	EqualO(t, source.Exists(ctx, "k1", "k2").Val(), int64(0))
+	EqualO(t, dest.LRange(ctx, "k2", 0, -1).Val(), []string{"a", "b"})
+}
@@ -0,0 +1,47 @@
+package integration_tests
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestMonitorIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s, cli := startServer(t)
+	ctx := context.Background()
+	// connects before monitoring, so that its setup is not streamed
+	NoError(t, cli.Ping(ctx).Err())
+
+	conn, err := net.Dial("tcp", s.Addr())
+	NoError(t, err)
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	_, err = conn.Write([]byte("*1\r\n$7\r\nMONITOR\r\n"))
+	NoError(t, err)
+	line, err := rd.ReadString('\n')
+	NoError(t, err)
+	EqualO(t, line, "+OK\r\n")
+
+	NoError(t, cli.Set(ctx, "k", "hello world", 0).Err())
+	// admin commands are not streamed
+	NoError(t, cli.Do(ctx, "CLIENT", "LIST").Err())
+	NoError(t, cli.Get(ctx, "k").Err())
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err = rd.ReadString('\n')
+	NoError(t, err)
+	IsTrue(t, strings.HasPrefix(line, "+") && strings.HasSuffix(line, `] "set" "k" "hello world"`+"\r\n"), "line=%q", line)
+	IsTrue(t, strings.Contains(line, " [0 127.0.0.1:"), "line=%q", line)
+	line, err = rd.ReadString('\n')
+	NoError(t, err)
+	IsTrue(t, strings.HasSuffix(line, `] "get" "k"`+"\r\n"), "line=%q", line)
+}
@@ -0,0 +1,97 @@
+package integration_tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+)
+
+func receive(t *testing.T, sub *redis.PubSub) *redis.Message {
+	t.Helper()
+
+	select {
+	case m := <-sub.Channel():
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for message")
+		return nil
+	}
+}
+
+func TestPubSubIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	_, cli := startServer(t)
+	ctx := context.Background()
+
+	sub := cli.Subscribe(ctx, "news")
+	defer sub.Close()
+	_, err := sub.Receive(ctx)
+	NoError(t, err)
+	psub := cli.PSubscribe(ctx, "n*")
+	defer psub.Close()
+	_, err = psub.Receive(ctx)
+	NoError(t, err)
+
+	EqualO(t, cli.Publish(ctx, "news", "hello").Val(), int64(2))
+	m := receive(t, sub)
+	EqualO(t, []string{m.Channel, m.Payload}, []string{"news", "hello"})
+	m = receive(t, psub)
+	EqualO(t, []string{m.Pattern, m.Channel, m.Payload}, []string{"n*", "news", "hello"})
+
+	EqualO(t, cli.PubSubNumSub(ctx, "news").Val(), map[string]int64{"news": 1})
+	EqualO(t, cli.PubSubNumPat(ctx).Val(), int64(1))
+	NoError(t, sub.Ping(ctx))
+}
+
+func TestKeyspaceNotificationsIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s := store.New()
+	s.Notifier().SetClasses(pubsub.Keyspace | pubsub.Keyevent | pubsub.All)
+	_, cli := startServer(t, server.WithStore(s))
+	ctx := context.Background()
+
+	events := cli.PSubscribe(ctx, "__keyevent@0__:*")
+	defer events.Close()
+	_, err := events.Receive(ctx)
+	NoError(t, err)
+	space := cli.Subscribe(ctx, "__keyspace@0__:k")
+	defer space.Close()
+	_, err = space.Receive(ctx)
+	NoError(t, err)
+
+	expect := func(event, key string) {
+		t.Helper()
+		m := receive(t, events)
+		EqualO(t, []string{m.Channel, m.Payload}, []string{"__keyevent@0__:" + event, key})
+	}
+
+	NoError(t, cli.Set(ctx, "k", "1", 0).Err())
+	expect("set", "k")
+	EqualO(t, receive(t, space).Payload, "set")
+	NoError(t, cli.Incr(ctx, "k").Err())
+	expect("incrby", "k")
+	NoError(t, cli.LPush(ctx, "l", "a").Err())
+	expect("lpush", "l")
+	NoError(t, cli.Del(ctx, "k", "l", "missing").Err())
+	expect("del", "k")
+	expect("del", "l")
+
+	NoError(t, cli.Set(ctx, "e", "1", 50*time.Millisecond).Err())
+	expect("set", "e")
+	expect("expire", "e")
+	// found by active expiry
+	expect("expired", "e")
+}
@@ -0,0 +1,135 @@
+package integration_tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+)
+
+func startServer(t testing.TB, opts ...server.Option) (*server.Server, *redis.Client) {
+	s, err := server.New("localhost:0", opts...)
+	if err != nil {
+		t.Fatalf("error init server: %v", err)
+	}
+	go func() {
+		// ignore errors
+		s.Serve()
+	}()
+
+	cli := redis.NewClient(&redis.Options{Addr: s.Addr()})
+
+	t.Cleanup(func() {
+		cli.Close()
+		s.Stop()
+	})
+
+	return s, cli
+}
+
+// replicate makes the replica replicate from master, returning once it is connected.
+func replicate(t *testing.T, replicaCli *redis.Client, master *server.Server) {
+	t.Helper()
+
+	ctx := context.Background()
+	host, port, _ := net.SplitHostPort(master.Addr())
+	NoError(t, replicaCli.Do(ctx, "REPLICAOF", host, port).Err())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		role, err := replicaCli.Do(ctx, "ROLE").Slice()
+		NoError(t, err)
+		if role[3] == "connected" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("replica did not connect, role=%v", role)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestReplicationIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	master, masterCli := startServer(t, server.WithStore(store.New()))
+	_, replicaCli := startServer(t, server.WithStore(store.New()))
+	ctx := context.Background()
+
+	replicate(t, replicaCli, master)
+
+	NoError(t, masterCli.Set(ctx, "k", "v", 0).Err())
+	Equal(t, V(masterCli.Do(ctx, "WAIT", 1, 1000).Int64()), V(int64(1), nil))
+	Equal(t, V(replicaCli.Get(ctx, "k").Result()), V("v", nil))
+
+	role, err := masterCli.Do(ctx, "ROLE").Slice()
+	NoError(t, err)
+	EqualO(t, role[0], any("master"))
+	EqualO(t, len(role[2].([]any)), 1)
+
+	// writes that the master rejects are not propagated
+	HasError(t, masterCli.Do(ctx, "SET", "k2", "v", "EX", "-1").Err())
+	HasError(t, masterCli.LPush(ctx, "k", "x").Err())
+	after, err := masterCli.Do(ctx, "ROLE").Slice()
+	NoError(t, err)
+	EqualO(t, after[1], role[1])
+	EqualO(t, replicaCli.Exists(ctx, "k2").Val(), int64(0))
+
+	err = replicaCli.Set(ctx, "k", "v", 0).Err()
+	HasError(t, err)
+	IsTrue(t, err != nil && err.Error() == "READONLY You can't write against a read only replica.", "err=%v", err)
+
+	NoError(t, replicaCli.Do(ctx, "REPLICAOF", "NO", "ONE").Err())
+	NoError(t, replicaCli.Set(ctx, "k", "v", 0).Err())
+}
+
+func TestReplicaScriptsIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	master, masterCli := startServer(t, server.WithStore(store.New()))
+	_, replicaCli := startServer(t, server.WithStore(store.New()))
+	ctx := context.Background()
+	replicate(t, replicaCli, master)
+
+	done := make(chan struct{})
+	writes := make(chan int)
+	go func() {
+		n := 0
+		defer func() { writes <- n }()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if masterCli.Set(ctx, "k", n, 0).Err() != nil {
+				return
+			}
+			n++
+		}
+	}()
+
+	// the master's writes wait for the scripts, which must not wait for the replication stream in turn
+	script := "for i = 1, 1000 do redis.pcall('SET', 'x', i); redis.call('ROLE') end return redis.pcall('SET', 'x', 0)"
+	for range 20 {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err := replicaCli.Eval(ctx, script, nil).Err()
+		cancel()
+		IsTrue(t, err != nil && err.Error() == "READONLY You can't write against a read only replica.", "err=%v", err)
+	}
+	close(done)
+	n := <-writes
+
+	Equal(t, V(masterCli.Do(ctx, "WAIT", 1, 5000).Int64()), V(int64(1), nil))
+	Equal(t, V(replicaCli.Get(ctx, "k").Int()), V(n-1, nil))
+}
@@ -0,0 +1,109 @@
+package integration_tests
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/scripting"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+)
+
+// rateLimit allows ARGV[1] requests for the key, replying with the number of requests left.
+const rateLimit = `
+local n = redis.call('INCR', KEYS[1])
+if n > tonumber(ARGV[1]) then
+	return redis.error_reply('LIMITED too many requests')
+end
+return tonumber(ARGV[1]) - n
+`
+
+func TestScriptingIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	_, cli := startServer(t, server.WithStore(store.New()), server.WithConfig(config.New()))
+	ctx := context.Background()
+
+	for _, left := range []int64{1, 0} {
+		n, err := cli.Eval(ctx, rateLimit, []string{"limit:user"}, 2).Int64()
+		NoError(t, err)
+		EqualO(t, n, left)
+	}
+	err := cli.Eval(ctx, rateLimit, []string{"limit:user"}, 2).Err()
+	EqualO(t, err.Error(), "LIMITED too many requests")
+	EqualO(t, cli.Get(ctx, "limit:user").Val(), "3")
+
+	sha, err := cli.ScriptLoad(ctx, "return {KEYS[1], ARGV[1]}").Result()
+	NoError(t, err)
+	EqualO(t, cli.ScriptExists(ctx, sha, "nope").Val(), []bool{true, false})
+	values, err := cli.EvalSha(ctx, sha, []string{"k"}, "a").Slice()
+	NoError(t, err)
+	EqualO(t, values, []any{"k", "a"})
+
+	err = cli.Eval(ctx, "return redis.call('SUBSCRIBE', 'ch')", nil).Err()
+	EqualO(t, err.Error(), "ERR This Redis command is not allowed from script script: "+scripting.Sha1Hex("return redis.call('SUBSCRIBE', 'ch')"))
+
+	// other clients are replied to with BUSY, once the script has run for the threshold
+	NoError(t, cli.ConfigSet(ctx, "busy-reply-threshold", "20").Err())
+	conn := cli.Conn()
+	defer conn.Close()
+	done := make(chan error)
+	go func() {
+		done <- conn.Eval(ctx, "while true do end", nil).Err()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := cli.Get(ctx, "limit:user").Err()
+		if err != nil && strings.HasPrefix(err.Error(), "BUSY") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("commands were never BUSY, err=%v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	NoError(t, cli.ScriptKill(ctx).Err())
+	err = <-done
+	IsTrue(t, err != nil && strings.HasPrefix(err.Error(), "ERR Script killed by user"), "err=%v", err)
+	EqualO(t, cli.Get(ctx, "limit:user").Val(), "3")
+}
+
+func TestFunctionsIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	st := store.New()
+	_, cli := startServer(t, server.WithStore(st), server.WithConfig(config.New()))
+	ctx := context.Background()
+
+	lib := "#!lua name=limits\nredis.register_function('limit', function(KEYS, ARGV)\n" + rateLimit + "end)"
+	name, err := cli.FunctionLoad(ctx, lib).Result()
+	NoError(t, err)
+	EqualO(t, name, "limits")
+	n, err := cli.FCall(ctx, "limit", []string{"limit:user"}, 2).Int64()
+	NoError(t, err)
+	EqualO(t, n, int64(1))
+	err = cli.FCallRo(ctx, "limit", []string{"limit:user"}, 2).Err()
+	EqualO(t, err.Error(), "ERR Can not execute a script with write flag using *_ro command.")
+	libs, err := cli.FunctionList(ctx, redis.FunctionListQuery{}).Result()
+	NoError(t, err)
+	EqualO(t, len(libs), 1)
+	EqualO(t, libs[0].Functions[0].Name, "limit")
+
+	// the libraries are in the snapshot, so they survive a restart
+	restarted := store.New()
+	NoError(t, restarted.LoadSnapshot(st.Snapshot()))
+	_, cli = startServer(t, server.WithStore(restarted), server.WithConfig(config.New()))
+	n, err = cli.FCall(ctx, "limit", []string{"limit:user"}, 2).Int64()
+	NoError(t, err)
+	EqualO(t, n, int64(0))
+}
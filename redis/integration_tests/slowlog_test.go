@@ -0,0 +1,54 @@
+package integration_tests
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+)
+
+func TestSlowLogIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	_, cli := startServer(t, server.WithConfig(config.New()))
+	ctx := context.Background()
+	// logs every command
+	NoError(t, cli.ConfigSet(ctx, "slowlog-log-slower-than", "0").Err())
+	NoError(t, cli.Do(ctx, "SLOWLOG", "RESET").Err())
+	// a connection of its own, to be named
+	conn := cli.Conn()
+	defer conn.Close()
+	NoError(t, conn.ClientSetName(ctx, "worker").Err())
+	NoError(t, conn.Set(ctx, "k", "v", 0).Err())
+
+	entries, err := cli.SlowLogGet(ctx, -1).Result()
+	NoError(t, err)
+	// other connections may be set up in between, with HELLO and CLIENT SETINFO
+	found := false
+	for _, e := range entries {
+		if len(e.Args) > 0 && e.Args[0] == "set" {
+			found = true
+			Equal(t, []any{e.Args}, []any{[]string{"set", "k", "v"}})
+			EqualO(t, e.ClientName, "worker")
+			IsTrue(t, e.ClientAddr != "", "the client address should be logged")
+		}
+	}
+	IsTrue(t, found, "SET should be logged, entries=%v", entries)
+
+	NoError(t, cli.ConfigSet(ctx, "slowlog-log-slower-than", "-1").Err())
+	n, err := cli.Do(ctx, "SLOWLOG", "LEN").Int()
+	NoError(t, err)
+	conn.Get(ctx, "k")
+	after, err := cli.Do(ctx, "SLOWLOG", "LEN").Int()
+	NoError(t, err)
+	EqualO(t, after, n)
+
+	NoError(t, cli.ConfigSet(ctx, "latency-monitor-threshold", "1").Err())
+	latest, err := cli.Do(ctx, "LATENCY", "LATEST").Slice()
+	NoError(t, err)
+	IsTrue(t, latest != nil, "LATENCY LATEST should reply with an array")
+}
@@ -0,0 +1,68 @@
+package integration_tests
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tlsconfig"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tlsconfig/tlstest"
+)
+
+func TestTLSIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	files := tlstest.Generate(t, "server")
+	s, cli := startServer(t, server.WithTLS("localhost:0", tlsconfig.Config{
+		CertFile:    files.ServerCert,
+		KeyFile:     files.ServerKey,
+		CAFile:      files.CACert,
+		AuthClients: tlsconfig.AuthClientsYes,
+	}))
+	ctx := context.Background()
+
+	secure := redis.NewClient(&redis.Options{Addr: s.TLSAddr(), TLSConfig: files.ClientConfig(t, true)})
+	defer secure.Close()
+	NoError(t, secure.Set(ctx, "k", "v", 0).Err())
+	// both listeners serve the same data
+	EqualO(t, cli.Get(ctx, "k").Val(), "v")
+
+	// clients must present a certificate
+	anonymous := redis.NewClient(&redis.Options{Addr: s.TLSAddr(), TLSConfig: files.ClientConfig(t, false), MaxRetries: -1})
+	defer anonymous.Close()
+	HasError(t, anonymous.Ping(ctx).Err())
+
+	// plaintext is not accepted on the TLS port
+	plain := redis.NewClient(&redis.Options{Addr: s.TLSAddr(), MaxRetries: -1})
+	defer plain.Close()
+	HasError(t, plain.Ping(ctx).Err())
+
+	// renews the certificates, the existing connection is unaffected
+	renewed := tlstest.Generate(t, "renewed")
+	for from, to := range map[string]string{
+		renewed.CACert:     files.CACert,
+		renewed.ServerCert: files.ServerCert,
+		renewed.ServerKey:  files.ServerKey,
+	} {
+		data, err := os.ReadFile(from)
+		NoError(t, err)
+		NoError(t, os.WriteFile(to, data, 0o600))
+	}
+	NoError(t, s.ReloadTLS())
+	NoError(t, secure.Ping(ctx).Err())
+
+	renewedCli := redis.NewClient(&redis.Options{Addr: s.TLSAddr(), TLSConfig: renewed.ClientConfig(t, true)})
+	defer renewedCli.Close()
+	EqualO(t, renewedCli.Get(ctx, "k").Val(), "v")
+
+	// client certificates signed by the old CA are no longer accepted
+	old := redis.NewClient(&redis.Options{Addr: s.TLSAddr(), TLSConfig: files.ClientConfig(t, true), MaxRetries: -1})
+	defer old.Close()
+	HasError(t, old.Ping(ctx).Err())
+}
@@ -0,0 +1,98 @@
+package integration_tests
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/info"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// rawConn is a connection that reads the exact replies (including push messages) that the server sends.
+type rawConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func dialRaw(t *testing.T, addr string) *rawConn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return &rawConn{conn: conn, rd: bufio.NewReader(conn)}
+}
+
+func (c *rawConn) send(t *testing.T, command string) {
+	t.Helper()
+
+	_, err := c.conn.Write([]byte(messages.NewArrayBulkString(strings.Split(command, " ")).Serialise()))
+	NoError(t, err)
+}
+
+func (c *rawConn) expect(t *testing.T, expected string) {
+	t.Helper()
+
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, len(expected))
+	_, err := io.ReadFull(c.rd, buf)
+	NoError(t, err)
+	EqualO(t, string(buf), expected)
+}
+
+// id returns the ID of the client of the connection.
+func (c *rawConn) id(t *testing.T) string {
+	t.Helper()
+
+	c.send(t, "CLIENT ID")
+	line, err := c.rd.ReadString('\n')
+	NoError(t, err)
+	return strings.TrimSuffix(strings.TrimPrefix(line, ":"), "\r\n")
+}
+
+func TestTrackingIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	s, cli := startServer(t)
+	ctx := context.Background()
+	ok := messages.NewSimpleString("OK").Serialise()
+
+	conn := dialRaw(t, s.Addr())
+	id := conn.id(t)
+	conn.send(t, "HELLO 3")
+	conn.expect(t, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n"+info.RedisVersion+"\r\n$5\r\nproto\r\n:3\r\n"+
+		"$2\r\nid\r\n:"+id+"\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n")
+	conn.send(t, "CLIENT TRACKING ON")
+	conn.expect(t, ok)
+	conn.send(t, "GET k")
+	conn.expect(t, "$-1\r\n")
+
+	// go-redis also speaks RESP3 now
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	conn.expect(t, ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n")
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	conn.send(t, "PING")
+	// the key is no longer tracked, until it is read again
+	conn.expect(t, "+PONG\r\n")
+
+	// RESP2 clients are sent the invalidations of the clients that redirect to them, on a channel
+	sub := dialRaw(t, s.Addr())
+	subID := sub.id(t)
+	sub.send(t, "SUBSCRIBE __redis__:invalidate")
+	sub.expect(t, "*3\r\n$9\r\nsubscribe\r\n$20\r\n__redis__:invalidate\r\n:1\r\n")
+	bcast := dialRaw(t, s.Addr())
+	bcast.send(t, "CLIENT TRACKING ON BCAST PREFIX user: REDIRECT "+subID)
+	bcast.expect(t, ok)
+
+	NoError(t, cli.Set(ctx, "post:1", "v", 0).Err())
+	NoError(t, cli.Set(ctx, "user:1", "v", 0).Err())
+	sub.expect(t, "*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$6\r\nuser:1\r\n")
+}
@@ -0,0 +1,54 @@
+package integration_tests
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+)
+
+func TestUnixSocketIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration")
+	}
+
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	// leaves a stale socket behind, like a server that did not shutdown cleanly
+	stale, err := net.Listen("unix", path)
+	NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s, err := server.New("", server.WithUnixSocket(path, 0o700))
+	NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve()
+	}()
+	EqualO(t, s.UnixAddr(), path)
+	EqualO(t, s.Addr(), "")
+
+	info, err := os.Stat(path)
+	NoError(t, err)
+	EqualO(t, info.Mode().Perm(), os.FileMode(0o700))
+
+	ctx := context.Background()
+	cli := redis.NewClient(&redis.Options{Network: "unix", Addr: path})
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+	EqualO(t, cli.Get(ctx, "k").Val(), "v")
+	cli.Close()
+
+	s.Stop()
+	<-done
+	_, err = os.Stat(path)
+	IsTrue(t, os.IsNotExist(err), "socket not removed: %v", err)
+
+	_, err = server.New("")
+	HasError(t, err)
+}
@@ -0,0 +1,311 @@
+// Package acl implements users, passwords and their permissions (AUTH and ACL).
+package acl
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const DefaultUser = "default"
+
+var noAuthErr = messages.GetErrorString("NOAUTH Authentication required.")
+
+// Commands describes the commands that users may be allowed to run.
+type Commands interface {
+	// Exists returns whether there is such a command.
+	Exists(command string) bool
+	// Categories returns the categories of the command, with the subcommand (if it has one).
+	Categories(command, subcommand string) []string
+	// Names returns the names of all commands.
+	Names() []string
+}
+
+// Request is what is checked before a command is run.
+type Request struct {
+	// Commands is the whole command, its name is in lowercase.
+	Commands []string
+	Keys     []string
+	// Write is set if the keys are written to (rather than read).
+	Write bool
+	// Access is set if the keys are read too, although they are written to (e.g. INCR replies with the value).
+	Access   bool
+	Channels []string
+	// ChannelPatterns is set if the channels are patterns (e.g. for PSUBSCRIBE).
+	ChannelPatterns bool
+}
+
+// ACL holds the users, and checks what clients may do.
+type ACL struct {
+	commands Commands
+
+	mu    sync.RWMutex
+	users map[string]*User
+	// file is where ACL LOAD and ACL SAVE read and write users, if set.
+	file string
+	log  denialLog
+}
+
+func New(commands Commands) *ACL {
+	return &ACL{
+		commands: commands,
+		users:    map[string]*User{DefaultUser: newDefaultUser()},
+	}
+}
+
+// SetFile sets the ACL file.
+func (a *ACL) SetFile(file string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.file = file
+}
+
+// SetUser creates (or modifies) the user, with the rules applied in order.
+// If any rule is invalid, the user is not changed.
+func (a *ACL) SetUser(name string, rules ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u, ok := a.users[name]
+	if ok {
+		u = u.clone()
+	} else {
+		u = newUser(name)
+	}
+	for _, rule := range rules {
+		if err := u.apply(rule, a.commands); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %w", rule, err)
+		}
+	}
+	a.users[name] = u
+	return nil
+}
+
+// SetRequirePass sets the password of the default user, or lets it authenticate without one if the password is empty.
+func (a *ACL) SetRequirePass(password string) error {
+	if password == "" {
+		return a.SetUser(DefaultUser, "nopass")
+	}
+	return a.SetUser(DefaultUser, "resetpass", ">"+password)
+}
+
+// User returns the user, or nil if there is no such user.
+func (a *ACL) User(name string) *User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.users[name]
+}
+
+// DelUser deletes the users, returning the number of users deleted.
+func (a *ACL) DelUser(names []string) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if slices.Contains(names, DefaultUser) {
+		return 0, fmt.Errorf("The '%s' user cannot be removed", DefaultUser)
+	}
+
+	count := int64(0)
+	for _, name := range names {
+		if _, ok := a.users[name]; ok {
+			delete(a.users, name)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Users returns the names of the users, sorted.
+func (a *ACL) Users() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ret := make([]string, 0, len(a.users))
+	for name := range a.users {
+		ret = append(ret, name)
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// List describes the users, sorted by name.
+func (a *ACL) List() []string {
+	ret := []string{}
+	for _, name := range a.Users() {
+		if u := a.User(name); u != nil {
+			ret = append(ret, u.Describe())
+		}
+	}
+	return ret
+}
+
+// Authenticate authenticates the client as the user, if the password is right.
+func (a *ACL) Authenticate(c *client.Client, username, password string) bool {
+	u := a.User(username)
+	if u == nil || !u.enabled || !u.checkPassword(password) {
+		a.log.add("auth", "AUTH", username, c)
+		return false
+	}
+
+	c.User = username
+	c.Authenticated = true
+	return true
+}
+
+// user returns the user that the client is authenticated as, or nil if it is not authenticated.
+func (a *ACL) user(c *client.Client) *User {
+	if !c.Authenticated {
+		// like a new connection, which is authenticated as the default user if it needs no password
+		if u := a.User(DefaultUser); u != nil && u.enabled && u.noPass {
+			c.User = DefaultUser
+			c.Authenticated = true
+			return u
+		}
+		return nil
+	}
+
+	u := a.User(c.User)
+	if u == nil {
+		// the user was deleted
+		c.Authenticated = false
+	}
+	return u
+}
+
+// Authorize returns the error reply if the client may not make the request, and false if it may.
+func (a *ACL) Authorize(c *client.Client, req Request) (string, bool) {
+	u := a.user(c)
+	if u == nil {
+		return noAuthErr, true
+	}
+
+	command := req.Commands[0]
+	subcommand := ""
+	if len(req.Commands) > 1 {
+		subcommand = strings.ToLower(req.Commands[1])
+	}
+	categories := a.commands.Categories(command, subcommand)
+	if !u.CanRun(command, subcommand, categories) {
+		name := command
+		if subcommand != "" && u.CanRun(command, "", categories) {
+			// denied by a rule for the subcommand
+			name += "|" + subcommand
+		}
+		a.log.add("command", name, u.Name, c)
+		return messages.GetErrorString(fmt.Sprintf("NOPERM User %s has no permissions to run the '%s' command", u.Name, name)), true
+	}
+
+	for _, key := range req.Keys {
+		if !u.CanAccessKey(key, req.Write) || req.Access && !u.CanAccessKey(key, false) {
+			a.log.add("key", key, u.Name, c)
+			return messages.GetErrorString("NOPERM No permissions to access a key"), true
+		}
+	}
+
+	for _, channel := range req.Channels {
+		if !u.CanAccessChannel(channel, req.ChannelPatterns) {
+			a.log.add("channel", channel, u.Name, c)
+			return messages.GetErrorString("NOPERM No permissions to access a channel"), true
+		}
+	}
+
+	return "", false
+}
+
+// parseFile parses users from an ACL file, which has a line per user (like ACL LIST).
+func (a *ACL) parseFile(data []byte) (map[string]*User, error) {
+	users := map[string]*User{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 1; scanner.Scan(); i++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: line should start with user keyword", a.file, i)
+		}
+
+		name := fields[1]
+		if _, ok := users[name]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicate user '%s' found", a.file, i, name)
+		}
+		u := newUser(name)
+		for _, rule := range fields[2:] {
+			if err := u.apply(rule, a.commands); err != nil {
+				return nil, fmt.Errorf("%s:%d: %s. Use ACL SETUSER to fix it", a.file, i, err)
+			}
+		}
+		users[name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, ok := users[DefaultUser]; !ok {
+		users[DefaultUser] = newDefaultUser()
+	}
+	return users, nil
+}
+
+var noFileErr = errors.New("This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration.")
+
+// Load replaces all users with the users in the ACL file.
+// If the file is invalid, no users are changed.
+func (a *ACL) Load() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == "" {
+		return noFileErr
+	}
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+	users, err := a.parseFile(data)
+	if err != nil {
+		return err
+	}
+
+	a.users = users
+	return nil
+}
+
+// Save writes all users to the ACL file.
+func (a *ACL) Save() error {
+	a.mu.RLock()
+	file := a.file
+	a.mu.RUnlock()
+	if file == "" {
+		return noFileErr
+	}
+
+	data := strings.Join(a.List(), "\n") + "\n"
+
+	// replaces the file atomically, so that it is never half-written
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
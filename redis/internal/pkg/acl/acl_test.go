@@ -0,0 +1,223 @@
+package acl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+type commands map[string][]string
+
+func (c commands) Exists(command string) bool {
+	_, ok := c[command]
+	return ok
+}
+
+func (c commands) Categories(command, subcommand string) []string {
+	if subcommand != "" {
+		if categories, ok := c[command+"|"+subcommand]; ok {
+			return categories
+		}
+	}
+	return c[command]
+}
+
+func (c commands) Names() []string {
+	ret := []string{}
+	for name := range c {
+		if !strings.Contains(name, "|") {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+var fakeCommands = commands{
+	"get":         {"read", "string", "fast"},
+	"set":         {"write", "string", "slow"},
+	"llen":        {"read", "list", "fast"},
+	"save":        {"admin", "slow", "dangerous"},
+	"config":      {"admin", "slow"},
+	"publish":     {"pubsub", "fast"},
+	"psubscribe":  {"pubsub", "slow"},
+	"acl":         {"slow"},
+	"acl|setuser": {"admin", "slow", "dangerous"},
+}
+
+func request(commands ...string) Request {
+	return Request{Commands: commands}
+}
+
+func TestAuthorize(t *testing.T) {
+	a := New(fakeCommands)
+	c := client.New("")
+
+	// the default user needs no password
+	_, denied := a.Authorize(c, request("save"))
+	IsFalse(t, denied, "")
+	EqualO(t, c.User, DefaultUser)
+
+	NoError(t, a.SetRequirePass("secret"))
+	// already authenticated
+	_, denied = a.Authorize(c, request("get"))
+	IsFalse(t, denied, "")
+
+	c = client.New("")
+	ret, _ := a.Authorize(c, request("get"))
+	EqualO(t, ret, noAuthErr)
+	IsFalse(t, a.Authenticate(c, DefaultUser, "wrong"), "")
+	IsTrue(t, a.Authenticate(c, DefaultUser, "secret"), "")
+	_, denied = a.Authorize(c, request("get"))
+	IsFalse(t, denied, "")
+
+	NoError(t, a.SetUser("alice", "on", ">p", "+@read", "-@dangerous", "+acl", "-acl|setuser", "~cache:*", "&news.*"))
+	IsTrue(t, a.Authenticate(c, "alice", "p"), "")
+	EqualO(t, c.User, "alice")
+
+	tests := []struct {
+		name     string
+		req      Request
+		expected string
+	}{
+		{"allowed", Request{Commands: []string{"get"}, Keys: []string{"cache:1"}}, ""},
+		{"command", request("set"), "-NOPERM User alice has no permissions to run the 'set' command\r\n"},
+		{"subcommand", request("acl", "SETUSER", "alice", "+@all"), "-NOPERM User alice has no permissions to run the 'acl|setuser' command\r\n"},
+		{"key", Request{Commands: []string{"get"}, Keys: []string{"cache:1", "secret"}}, "-NOPERM No permissions to access a key\r\n"},
+		{"channel", Request{Commands: []string{"publish"}, Channels: []string{"weather"}}, "-NOPERM No permissions to access a channel\r\n"},
+	}
+	NoError(t, a.SetUser("alice", "+publish"))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ret, denied := a.Authorize(c, test.req)
+			EqualO(t, denied, test.expected != "")
+			EqualO(t, ret, test.expected)
+		})
+	}
+
+	// deleted users are no longer authenticated
+	count, err := a.DelUser([]string{"alice", "bob"})
+	NoError(t, err)
+	EqualO(t, count, int64(1))
+	ret, _ = a.Authorize(c, request("get"))
+	EqualO(t, ret, noAuthErr)
+
+	_, err = a.DelUser([]string{DefaultUser})
+	HasError(t, err)
+}
+
+func TestSetUserIsAtomic(t *testing.T) {
+	a := New(fakeCommands)
+	NoError(t, a.SetUser("alice", "on", "+get"))
+
+	err := a.SetUser("alice", "+set", "+nope")
+	EqualO(t, err.Error(), "Error in ACL SETUSER modifier '+nope': Unknown command")
+	EqualO(t, a.User("alice").describeCommands(), "-@all +get")
+}
+
+func TestLog(t *testing.T) {
+	a := New(fakeCommands)
+	NoError(t, a.SetUser("alice", "on", "nopass", "+get"))
+	c := client.New("127.0.0.1:1234")
+	a.Authenticate(c, "alice", "")
+
+	a.Authorize(c, request("set"))
+	a.Authorize(c, request("set"))
+	a.Authorize(c, Request{Commands: []string{"get"}, Keys: []string{"k"}})
+	a.Authenticate(c, "bob", "p")
+
+	// most recent first
+	entries := a.log.entries
+	EqualO(t, len(entries), 3)
+	EqualO(t, []string{entries[0].reason, entries[0].object, entries[0].username}, []string{"auth", "AUTH", "bob"})
+	EqualO(t, []string{entries[1].reason, entries[1].object, entries[1].username}, []string{"key", "k", "alice"})
+	EqualO(t, []string{entries[2].reason, entries[2].object, entries[2].username}, []string{"command", "set", "alice"})
+	EqualO(t, entries[2].count, int64(2))
+	EqualO(t, entries[2].clientInfo, fmt.Sprintf("id=%d addr=127.0.0.1:1234 user=alice", c.ID))
+
+	ret, _ := a.Command(c, []string{"ACL", "LOG"})
+	IsTrue(t, strings.HasPrefix(ret, "*3\r\n*20\r\n$5\r\ncount\r\n:1\r\n$6\r\nreason\r\n$4\r\nauth\r\n"), "%q", ret)
+	ret, _ = a.Command(c, []string{"ACL", "LOG", "1"})
+	IsTrue(t, strings.HasPrefix(ret, "*1\r\n"), "%q", ret)
+
+	ret, _ = a.Command(c, []string{"ACL", "LOG", "RESET"})
+	EqualO(t, ret, okReply)
+	ret, _ = a.Command(c, []string{"ACL", "LOG"})
+	EqualO(t, ret, messages.NewArray([]messages.Message{}).Serialise())
+}
+
+func TestLoadSave(t *testing.T) {
+	a := New(fakeCommands)
+	file := filepath.Join(t.TempDir(), "users.acl")
+
+	HasError(t, a.Save())
+	a.SetFile(file)
+
+	NoError(t, a.SetUser("alice", "on", ">p", "~*", "+get"))
+	NoError(t, a.Save())
+	data, err := os.ReadFile(file)
+	NoError(t, err)
+	EqualO(t, string(data), strings.Join(a.List(), "\n")+"\n")
+
+	NoError(t, a.SetUser("bob", "on"))
+	NoError(t, a.Load())
+	EqualO(t, a.Users(), []string{"alice", DefaultUser})
+
+	// invalid files change nothing
+	NoError(t, os.WriteFile(file, []byte("user carol on\nuser dave +nope\n"), 0o644))
+	err = a.Load()
+	EqualO(t, err.Error(), file+":2: Unknown command. Use ACL SETUSER to fix it")
+	EqualO(t, a.Users(), []string{"alice", DefaultUser})
+
+	// the default user is created if it is not in the file
+	NoError(t, os.WriteFile(file, []byte("user carol on nopass +@all\n"), 0o644))
+	NoError(t, a.Load())
+	EqualO(t, a.Users(), []string{"carol", DefaultUser})
+	EqualO(t, a.User(DefaultUser).Describe(), newDefaultUser().Describe())
+}
+
+func TestCommand(t *testing.T) {
+	a := New(fakeCommands)
+	c := client.New("")
+	command := func(args ...string) string {
+		ret, ok := a.Command(c, append([]string{"ACL"}, args...))
+		IsTrue(t, ok, "")
+		return ret
+	}
+
+	EqualO(t, command("SETUSER", "alice", "on", "nopass", "~k*", "+get"), okReply)
+	EqualO(t, command("SETUSER", "alice", "+nope"), messages.GetErrorString("ERR Error in ACL SETUSER modifier '+nope': Unknown command"))
+	EqualO(t, command("USERS"), messages.NewArrayBulkString([]string{"alice", DefaultUser}).Serialise())
+	EqualO(t, command("LIST"), messages.NewArrayBulkString([]string{
+		"user alice on nopass ~k* resetchannels -@all +get",
+		"user default on nopass ~* &* +@all",
+	}).Serialise())
+	EqualO(t, command("GETUSER", "alice"), messages.NewArray([]messages.Message{
+		messages.NewBulkString("flags"), messages.NewArrayBulkString([]string{"on", "nopass"}),
+		messages.NewBulkString("passwords"), messages.NewArrayBulkString([]string{}),
+		messages.NewBulkString("commands"), messages.NewBulkString("-@all +get"),
+		messages.NewBulkString("keys"), messages.NewBulkString("~k*"),
+		messages.NewBulkString("channels"), messages.NewBulkString("resetchannels"),
+		messages.NewBulkString("selectors"), messages.NewArray([]messages.Message{}),
+	}).Serialise())
+	EqualO(t, command("GETUSER", "nobody"), messages.NewNullBulkString().Serialise())
+	EqualO(t, command("CAT", "list"), messages.NewArrayBulkString([]string{"llen"}).Serialise())
+	EqualO(t, command("CAT", "nope"), messages.GetErrorString("ERR Unknown category 'nope'"))
+	EqualO(t, command("WHOAMI"), messages.NewBulkString("").Serialise())
+	EqualO(t, command("DELUSER", "alice"), messages.NewInteger(1).Serialise())
+	EqualO(t, command("LOAD"), messages.GetErrorString("ERR "+noFileErr.Error()))
+
+	ret, _ := a.Auth(c, []string{"AUTH", "secret"})
+	IsTrue(t, strings.HasPrefix(ret, "-ERR AUTH <password> called without any password configured"), "%q", ret)
+	a.SetRequirePass("secret")
+	ret, _ = a.Auth(c, []string{"AUTH", "wrong"})
+	EqualO(t, ret, wrongPassErr)
+	ret, _ = a.Auth(c, []string{"AUTH", "secret"})
+	EqualO(t, ret, okReply)
+	EqualO(t, command("WHOAMI"), messages.NewBulkString(DefaultUser).Serialise())
+}
@@ -0,0 +1,169 @@
+package acl
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	AuthCommand = "AUTH"
+	ACLCommand  = "ACL"
+)
+
+var (
+	invalidArgNumErr = messages.GetErrorString("ERR wrong number of arguments for command")
+	wrongPassErr     = messages.GetErrorString("WRONGPASS invalid username-password pair or user is disabled.")
+	okReply          = messages.NewSimpleString("OK").Serialise()
+)
+
+// AUTH [username] password
+func (a *ACL) Auth(c *client.Client, commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], AuthCommand) {
+		return "", false
+	}
+
+	var username, password string
+	switch len(commands) {
+	case 2:
+		username, password = DefaultUser, commands[1]
+		if u := a.User(DefaultUser); u != nil && u.noPass {
+			return messages.GetErrorString("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"), true
+		}
+	case 3:
+		username, password = commands[1], commands[2]
+	default:
+		return invalidArgNumErr, true
+	}
+
+	if !a.Authenticate(c, username, password) {
+		return wrongPassErr, true
+	}
+	return okReply, true
+}
+
+// ACL subcommand [arguments ...]
+func (a *ACL) Command(c *client.Client, commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], ACLCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return invalidArgNumErr, true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "SETUSER":
+		if len(args) < 1 {
+			return invalidArgNumErr, true
+		}
+		if err := a.SetUser(args[0], args[1:]...); err != nil {
+			return messages.GetErrorString("ERR " + err.Error()), true
+		}
+		return okReply, true
+	case "GETUSER":
+		if len(args) != 1 {
+			return invalidArgNumErr, true
+		}
+		return a.getUser(args[0]), true
+	case "DELUSER":
+		if len(args) < 1 {
+			return invalidArgNumErr, true
+		}
+		count, err := a.DelUser(args)
+		if err != nil {
+			return messages.GetErrorString("ERR " + err.Error()), true
+		}
+		return messages.NewInteger(count).Serialise(), true
+	case "LIST":
+		return messages.NewArrayBulkString(a.List()).Serialise(), true
+	case "USERS":
+		return messages.NewArrayBulkString(a.Users()).Serialise(), true
+	case "WHOAMI":
+		return messages.NewBulkString(c.User).Serialise(), true
+	case "CAT":
+		return a.cat(args), true
+	case "LOG":
+		return a.logCommand(args), true
+	case "LOAD":
+		if err := a.Load(); err != nil {
+			log.Err(err).Msg("ACL LOAD")
+			return messages.GetErrorString("ERR " + err.Error()), true
+		}
+		return okReply, true
+	case "SAVE":
+		if err := a.Save(); err != nil {
+			log.Err(err).Msg("ACL SAVE")
+			return messages.GetErrorString("ERR There was an error trying to save the ACLs. Please check the server logs for more information"), true
+		}
+		return okReply, true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try ACL HELP."), true
+	}
+}
+
+func (a *ACL) getUser(name string) string {
+	u := a.User(name)
+	if u == nil {
+		return messages.NewNullBulkString().Serialise()
+	}
+
+	return messages.NewArray([]messages.Message{
+		messages.NewBulkString("flags"), messages.NewArrayBulkString(u.flags()),
+		messages.NewBulkString("passwords"), messages.NewArrayBulkString(slices.Clone(u.passwords)),
+		messages.NewBulkString("commands"), messages.NewBulkString(u.describeCommands()),
+		messages.NewBulkString("keys"), messages.NewBulkString(u.describeKeys()),
+		messages.NewBulkString("channels"), messages.NewBulkString(u.describeChannels()),
+		messages.NewBulkString("selectors"), messages.NewArray([]messages.Message{}),
+	}).Serialise()
+}
+
+// ACL CAT [category]
+func (a *ACL) cat(args []string) string {
+	switch len(args) {
+	case 0:
+		return messages.NewArrayBulkString(Categories).Serialise()
+	case 1:
+		category := strings.ToLower(args[0])
+		if !slices.Contains(Categories, category) {
+			return messages.GetErrorString("ERR Unknown category '" + args[0] + "'")
+		}
+		ret := []string{}
+		for _, name := range a.commands.Names() {
+			if slices.Contains(a.commands.Categories(name, ""), category) {
+				ret = append(ret, name)
+			}
+		}
+		slices.Sort(ret)
+		return messages.NewArrayBulkString(ret).Serialise()
+	default:
+		return invalidArgNumErr
+	}
+}
+
+// ACL LOG [count | RESET]
+func (a *ACL) logCommand(args []string) string {
+	count := 10
+	switch {
+	case len(args) == 0:
+	case len(args) > 1:
+		return invalidArgNumErr
+	case strings.EqualFold(args[0], "RESET"):
+		a.log.reset()
+		return okReply
+	default:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return messages.GetErrorString("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	return a.log.get(count).Serialise()
+}
@@ -0,0 +1,112 @@
+package acl
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	// same as redis' acllog-max-len
+	maxLogLen = 128
+	// similar denials within this window are counted in the same entry
+	logGroupWindow = 60 * time.Second
+)
+
+type logEntry struct {
+	count int64
+	// reason is one of "command", "key", "channel" or "auth".
+	reason   string
+	object   string
+	username string
+	// clientInfo describes the client that was denied most recently.
+	clientInfo string
+	id         int64
+	created    time.Time
+	updated    time.Time
+}
+
+func (e *logEntry) message(now time.Time) messages.Message {
+	return messages.NewArray([]messages.Message{
+		messages.NewBulkString("count"), messages.NewInteger(e.count),
+		messages.NewBulkString("reason"), messages.NewBulkString(e.reason),
+		messages.NewBulkString("context"), messages.NewBulkString("toplevel"),
+		messages.NewBulkString("object"), messages.NewBulkString(e.object),
+		messages.NewBulkString("username"), messages.NewBulkString(e.username),
+		messages.NewBulkString("age-seconds"), messages.NewBulkString(strconv.FormatFloat(now.Sub(e.created).Seconds(), 'f', 3, 64)),
+		messages.NewBulkString("client-info"), messages.NewBulkString(e.clientInfo),
+		messages.NewBulkString("entry-id"), messages.NewInteger(e.id),
+		messages.NewBulkString("timestamp-created"), messages.NewInteger(e.created.UnixMilli()),
+		messages.NewBulkString("timestamp-last-updated"), messages.NewInteger(e.updated.UnixMilli()),
+	})
+}
+
+// denialLog is the ACL LOG, of the most recent denials.
+type denialLog struct {
+	mu sync.Mutex
+	// entries are sorted from the most recent.
+	entries []*logEntry
+	nextID  int64
+}
+
+func clientInfo(c *client.Client) string {
+	return fmt.Sprintf("id=%d addr=%s user=%s", c.ID, c.Addr, c.User)
+}
+
+func (l *denialLog) add(reason, object, username string, c *client.Client) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for i, e := range l.entries {
+		if e.reason == reason && e.object == object && e.username == username && now.Sub(e.updated) < logGroupWindow {
+			e.count++
+			e.updated = now
+			e.clientInfo = clientInfo(c)
+			// moves it to the front
+			copy(l.entries[1:i+1], l.entries[:i])
+			l.entries[0] = e
+			return
+		}
+	}
+
+	e := &logEntry{
+		count:      1,
+		reason:     reason,
+		object:     object,
+		username:   username,
+		clientInfo: clientInfo(c),
+		id:         l.nextID,
+		created:    now,
+		updated:    now,
+	}
+	l.nextID++
+	l.entries = append([]*logEntry{e}, l.entries...)
+	if len(l.entries) > maxLogLen {
+		l.entries = l.entries[:maxLogLen]
+	}
+}
+
+func (l *denialLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = nil
+}
+
+// get returns up to count of the most recent entries.
+func (l *denialLog) get(count int) messages.Message {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	ret := []messages.Message{}
+	for _, e := range l.entries[:min(count, len(l.entries))] {
+		ret = append(ret, e.message(now))
+	}
+	return messages.NewArray(ret)
+}
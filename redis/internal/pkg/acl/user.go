@@ -0,0 +1,385 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/glob"
+)
+
+// https://redis.io/docs/latest/operate/oss_and_stack/management/security/acl/
+
+// Categories are the categories of commands, as in redis (even if no commands are in some of them).
+var Categories = []string{
+	"keyspace", "read", "write", "set", "sortedset", "list", "hash", "string", "bitmap", "hyperloglog",
+	"geo", "stream", "pubsub", "admin", "fast", "slow", "blocking", "dangerous", "connection", "transaction", "scripting",
+}
+
+// commandRule allows (or denies) a command, a subcommand, or a category of commands.
+type commandRule struct {
+	allow bool
+	// category is "all" for every command.
+	category   string
+	command    string
+	subcommand string
+}
+
+func (r commandRule) matches(command, subcommand string, categories []string) bool {
+	switch {
+	case r.category == "all":
+		return true
+	case r.category != "":
+		return slices.Contains(categories, r.category)
+	case r.command != command:
+		return false
+	default:
+		return r.subcommand == "" || strings.EqualFold(r.subcommand, subcommand)
+	}
+}
+
+func (r commandRule) String() string {
+	ret := "-"
+	if r.allow {
+		ret = "+"
+	}
+	if r.category != "" {
+		return ret + "@" + r.category
+	}
+	if r.subcommand != "" {
+		return ret + r.command + "|" + r.subcommand
+	}
+	return ret + r.command
+}
+
+// keyPattern is a pattern of keys that may be read and/or written.
+type keyPattern struct {
+	pattern     string
+	read, write bool
+}
+
+func (p keyPattern) String() string {
+	switch {
+	case p.read && p.write:
+		return "~" + p.pattern
+	case p.read:
+		return "%R~" + p.pattern
+	default:
+		return "%W~" + p.pattern
+	}
+}
+
+// User is an ACL user, it is immutable once it is added to the ACL.
+type User struct {
+	Name string
+
+	enabled bool
+	noPass  bool
+	// passwords are SHA-256 hashes, in hex
+	passwords []string
+
+	// commands are applied in order, the last rule that matches a command decides whether it is allowed.
+	commands []commandRule
+	keys     []keyPattern
+	// allChannels allows every channel, channels are patterns otherwise.
+	allChannels bool
+	channels    []string
+}
+
+// newUser returns a user that cannot do anything, until rules are applied.
+func newUser(name string) *User {
+	return &User{
+		Name:     name,
+		commands: []commandRule{{allow: false, category: "all"}},
+	}
+}
+
+// newDefaultUser returns the default user, which can do everything without a password.
+func newDefaultUser() *User {
+	u := newUser(DefaultUser)
+	for _, rule := range []string{"on", "nopass", "allkeys", "allchannels", "allcommands"} {
+		u.apply(rule, nil)
+	}
+	return u
+}
+
+func (u *User) clone() *User {
+	ret := *u
+	ret.passwords = slices.Clone(u.passwords)
+	ret.commands = slices.Clone(u.commands)
+	ret.keys = slices.Clone(u.keys)
+	ret.channels = slices.Clone(u.channels)
+	return &ret
+}
+
+func hashPassword(password string) string {
+	h := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(h[:])
+}
+
+func isHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	syntaxErr          = errors.New("Syntax error")
+	unknownCommandErr  = errors.New("Unknown command")
+	unknownCategoryErr = errors.New("Unknown category")
+	invalidHashErr     = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	noSuchPasswordErr  = errors.New("The password you are trying to remove from the user does not exist")
+)
+
+func (u *User) removePassword(hash string) error {
+	i := slices.Index(u.passwords, hash)
+	if i < 0 {
+		return noSuchPasswordErr
+	}
+	u.passwords = slices.Delete(u.passwords, i, i+1)
+	return nil
+}
+
+// apply applies a single rule (e.g. "+@read", "~cache:*") to the user.
+// commands is used to validate rules for commands, it may be nil when the rule is known to be valid.
+func (u *User) apply(rule string, commands Commands) error {
+	lower := strings.ToLower(rule)
+	switch lower {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.noPass = true
+		u.passwords = nil
+	case "resetpass":
+		u.noPass = false
+		u.passwords = nil
+	case "allkeys":
+		u.keys = []keyPattern{{pattern: "*", read: true, write: true}}
+	case "resetkeys":
+		u.keys = nil
+	case "allchannels":
+		u.allChannels = true
+		u.channels = nil
+	case "resetchannels":
+		u.allChannels = false
+		u.channels = nil
+	case "allcommands":
+		u.commands = []commandRule{{allow: true, category: "all"}}
+	case "nocommands":
+		u.commands = []commandRule{{allow: false, category: "all"}}
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "nocommands"} {
+			u.apply(r, nil)
+		}
+	case "sanitize-payload", "skip-sanitize-payload":
+		// payloads are always checked (see `rdb.RestoreItem`)
+	default:
+		return u.applyPattern(rule, commands)
+	}
+	return nil
+}
+
+func (u *User) applyPattern(rule string, commands Commands) error {
+	if rule == "" {
+		return syntaxErr
+	}
+
+	switch prefix, rest := rule[0], rule[1:]; prefix {
+	case '>':
+		hash := hashPassword(rest)
+		if !slices.Contains(u.passwords, hash) {
+			u.passwords = append(u.passwords, hash)
+		}
+		u.noPass = false
+	case '<':
+		return u.removePassword(hashPassword(rest))
+	case '#':
+		if !isHash(rest) {
+			return invalidHashErr
+		}
+		if !slices.Contains(u.passwords, rest) {
+			u.passwords = append(u.passwords, rest)
+		}
+		u.noPass = false
+	case '!':
+		if !isHash(rest) {
+			return invalidHashErr
+		}
+		return u.removePassword(rest)
+	case '~':
+		u.addKeys(keyPattern{pattern: rest, read: true, write: true})
+	case '%':
+		flags, pattern, ok := strings.Cut(rest, "~")
+		if !ok || flags == "" {
+			return syntaxErr
+		}
+		p := keyPattern{pattern: pattern}
+		for _, f := range strings.ToUpper(flags) {
+			switch f {
+			case 'R':
+				p.read = true
+			case 'W':
+				p.write = true
+			default:
+				return syntaxErr
+			}
+		}
+		u.addKeys(p)
+	case '&':
+		if u.allChannels {
+			return nil
+		}
+		if rest == "*" {
+			u.apply("allchannels", nil)
+		} else if !slices.Contains(u.channels, rest) {
+			u.channels = append(u.channels, rest)
+		}
+	case '+', '-':
+		return u.addCommand(prefix == '+', strings.ToLower(rest), commands)
+	default:
+		return syntaxErr
+	}
+	return nil
+}
+
+func (u *User) addKeys(p keyPattern) {
+	if slices.ContainsFunc(u.keys, func(k keyPattern) bool { return k.pattern == "*" && k.read && k.write }) {
+		// already allowed to access every key
+		return
+	}
+	if p.pattern == "*" && p.read && p.write {
+		u.keys = nil
+	}
+	u.keys = append(u.keys, p)
+}
+
+func (u *User) addCommand(allow bool, name string, commands Commands) error {
+	rule := commandRule{allow: allow}
+	if category, ok := strings.CutPrefix(name, "@"); ok {
+		if category != "all" && !slices.Contains(Categories, category) {
+			return unknownCategoryErr
+		}
+		rule.category = category
+	} else {
+		rule.command, rule.subcommand, _ = strings.Cut(name, "|")
+		if rule.command == "" || commands != nil && !commands.Exists(rule.command) {
+			return unknownCommandErr
+		}
+	}
+
+	if rule.category == "all" {
+		// overrides every rule before it
+		u.commands = nil
+	}
+	u.commands = append(u.commands, rule)
+	return nil
+}
+
+// CanRun returns whether the user may run the command (with the subcommand, if it has one), which is in the categories.
+func (u *User) CanRun(command, subcommand string, categories []string) bool {
+	allowed := false
+	for _, r := range u.commands {
+		if r.matches(command, subcommand, categories) {
+			allowed = r.allow
+		}
+	}
+	return allowed
+}
+
+// CanAccessKey returns whether the user may read (or write) the key.
+func (u *User) CanAccessKey(key string, write bool) bool {
+	for _, p := range u.keys {
+		if (write && p.write || !write && p.read) && glob.Match(p.pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanReadAllKeys returns whether the user may read every key, e.g. for the patterns of SORT that look up other keys.
+func (u *User) CanReadAllKeys() bool {
+	return slices.ContainsFunc(u.keys, func(p keyPattern) bool { return p.pattern == "*" && p.read })
+}
+
+// CanAccessChannel returns whether the user may publish or subscribe to the channel.
+// Patterns (for PSUBSCRIBE) must be the same as one of the user's patterns, rather than match it.
+func (u *User) CanAccessChannel(channel string, isPattern bool) bool {
+	if u.allChannels {
+		return true
+	}
+	for _, p := range u.channels {
+		if isPattern && p == channel || !isPattern && glob.Match(p, channel) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPassword returns whether the password is one of the user's passwords.
+func (u *User) checkPassword(password string) bool {
+	return u.noPass || slices.Contains(u.passwords, hashPassword(password))
+}
+
+// flags are the flags in ACL GETUSER.
+func (u *User) flags() []string {
+	ret := []string{"off"}
+	if u.enabled {
+		ret[0] = "on"
+	}
+	if u.noPass {
+		ret = append(ret, "nopass")
+	}
+	return ret
+}
+
+func (u *User) describeKeys() string {
+	ret := []string{}
+	for _, p := range u.keys {
+		ret = append(ret, p.String())
+	}
+	return strings.Join(ret, " ")
+}
+
+func (u *User) describeChannels() string {
+	if u.allChannels {
+		return "&*"
+	}
+	ret := []string{"resetchannels"}
+	for _, p := range u.channels {
+		ret = append(ret, "&"+p)
+	}
+	return strings.Join(ret, " ")
+}
+
+func (u *User) describeCommands() string {
+	ret := []string{}
+	for _, r := range u.commands {
+		ret = append(ret, r.String())
+	}
+	return strings.Join(ret, " ")
+}
+
+// Describe returns the rules that recreate the user, as in ACL LIST (and the ACL file).
+func (u *User) Describe() string {
+	parts := []string{"user", u.Name}
+	parts = append(parts, u.flags()...)
+	for _, hash := range u.passwords {
+		parts = append(parts, "#"+hash)
+	}
+	for _, s := range []string{u.describeKeys(), u.describeChannels(), u.describeCommands()} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
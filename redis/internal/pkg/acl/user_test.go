@@ -0,0 +1,115 @@
+package acl
+
+import (
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func apply(t *testing.T, u *User, rules ...string) {
+	t.Helper()
+	for _, rule := range rules {
+		NoError(t, u.apply(rule, fakeCommands))
+	}
+}
+
+func TestUserCommands(t *testing.T) {
+	u := newUser("alice")
+	IsFalse(t, u.CanRun("get", "", []string{"read", "string"}), "")
+
+	apply(t, u, "+@read", "-llen", "+config|get")
+	IsTrue(t, u.CanRun("get", "", []string{"read", "string"}), "")
+	IsFalse(t, u.CanRun("llen", "", []string{"read", "list"}), "")
+	IsFalse(t, u.CanRun("set", "", []string{"write", "string"}), "")
+	IsTrue(t, u.CanRun("config", "get", []string{"admin"}), "")
+	IsTrue(t, u.CanRun("config", "GET", []string{"admin"}), "")
+	IsFalse(t, u.CanRun("config", "set", []string{"admin"}), "")
+	EqualO(t, u.describeCommands(), "-@all +@read -llen +config|get")
+
+	apply(t, u, "allcommands", "-@dangerous")
+	IsTrue(t, u.CanRun("set", "", []string{"write", "string"}), "")
+	IsFalse(t, u.CanRun("save", "", []string{"admin", "dangerous"}), "")
+	EqualO(t, u.describeCommands(), "+@all -@dangerous")
+
+	for _, rule := range []string{"+nope", "+@nope", "-", "(+get)", "%X~*", "%~*", "#abc", "<nope"} {
+		HasError(t, u.apply(rule, fakeCommands))
+	}
+}
+
+func TestUserKeys(t *testing.T) {
+	u := newUser("alice")
+	IsFalse(t, u.CanAccessKey("k", false), "")
+
+	apply(t, u, "~cache:*", "%R~ro:*", "%W~wo:*")
+	IsTrue(t, u.CanAccessKey("cache:1", false), "")
+	IsTrue(t, u.CanAccessKey("cache:1", true), "")
+	IsTrue(t, u.CanAccessKey("ro:1", false), "")
+	IsFalse(t, u.CanAccessKey("ro:1", true), "")
+	IsFalse(t, u.CanAccessKey("wo:1", false), "")
+	IsTrue(t, u.CanAccessKey("wo:1", true), "")
+	IsFalse(t, u.CanAccessKey("other", false), "")
+	EqualO(t, u.describeKeys(), "~cache:* %R~ro:* %W~wo:*")
+
+	apply(t, u, "allkeys", "~more:*")
+	IsTrue(t, u.CanAccessKey("other", true), "")
+	EqualO(t, u.describeKeys(), "~*")
+
+	apply(t, u, "resetkeys")
+	IsFalse(t, u.CanAccessKey("other", false), "")
+}
+
+func TestUserChannels(t *testing.T) {
+	u := newUser("alice")
+	IsFalse(t, u.CanAccessChannel("news", false), "")
+	EqualO(t, u.describeChannels(), "resetchannels")
+
+	apply(t, u, "&news.*")
+	IsTrue(t, u.CanAccessChannel("news.sport", false), "")
+	IsFalse(t, u.CanAccessChannel("weather", false), "")
+	// patterns must be the same, not just match
+	IsTrue(t, u.CanAccessChannel("news.*", true), "")
+	IsFalse(t, u.CanAccessChannel("news.s*", true), "")
+	EqualO(t, u.describeChannels(), "resetchannels &news.*")
+
+	apply(t, u, "allchannels")
+	IsTrue(t, u.CanAccessChannel("*", true), "")
+	EqualO(t, u.describeChannels(), "&*")
+}
+
+func TestUserPasswords(t *testing.T) {
+	u := newUser("alice")
+	IsFalse(t, u.checkPassword(""), "")
+
+	apply(t, u, ">p1", ">p2", "#"+hashPassword("p3"))
+	IsTrue(t, u.checkPassword("p1"), "")
+	IsTrue(t, u.checkPassword("p3"), "")
+	IsFalse(t, u.checkPassword("p4"), "")
+
+	apply(t, u, "<p1", "!"+hashPassword("p3"))
+	IsFalse(t, u.checkPassword("p1"), "")
+	IsTrue(t, u.checkPassword("p2"), "")
+	IsFalse(t, u.checkPassword("p3"), "")
+
+	apply(t, u, "nopass")
+	IsTrue(t, u.checkPassword("anything"), "")
+	EqualO(t, u.flags(), []string{"off", "nopass"})
+
+	apply(t, u, "on", "reset")
+	IsFalse(t, u.checkPassword("anything"), "")
+	EqualO(t, u.flags(), []string{"off"})
+}
+
+func TestUserDescribe(t *testing.T) {
+	u := newDefaultUser()
+	EqualO(t, u.Describe(), "user default on nopass ~* &* +@all")
+
+	u = newUser("alice")
+	apply(t, u, "on", ">p", "~cache:*", "&news", "+@read", "-@dangerous")
+	described := u.Describe()
+	EqualO(t, described, "user alice on #"+hashPassword("p")+" ~cache:* resetchannels &news -@all +@read -@dangerous")
+
+	// the description recreates the user
+	users, err := New(fakeCommands).parseFile([]byte(described))
+	NoError(t, err)
+	EqualO(t, users["alice"].Describe(), described)
+}
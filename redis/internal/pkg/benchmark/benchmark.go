@@ -0,0 +1,285 @@
+// Package benchmark measures the throughput and latency of a server, like redis-benchmark.
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// randPlaceholder is replaced by a random key number in each request, if the keyspace is set.
+const randPlaceholder = "__rand_int__"
+
+const dialTimeout = 5 * time.Second
+
+// Config is how the tests are run.
+type Config struct {
+	// Network is "tcp" or "unix".
+	Network  string
+	Addr     string
+	User     string
+	Password string
+
+	Clients  int
+	Requests int
+	// Pipeline is the number of requests that each client sends at once.
+	Pipeline int
+	// Keyspace is the number of random keys used, or 0 to use the same key for every request.
+	Keyspace int
+	// DataSize is the size of the values in bytes.
+	DataSize int
+}
+
+// Test is a command to benchmark.
+type Test struct {
+	Name string
+	Args []string
+	// setup prepares the keys for the test (e.g. the list read by LRANGE).
+	setup func(cfg Config) [][]string
+}
+
+// listSize is the length of the list for the LRANGE tests.
+const listSize = 600
+
+func lrangeTest(n int) Test {
+	return Test{
+		Name: fmt.Sprintf("LRANGE_%d", n),
+		Args: []string{"LRANGE", "mylist", "0", fmt.Sprint(n - 1)},
+		setup: func(cfg Config) [][]string {
+			push := []string{"RPUSH", "mylist"}
+			for i := 0; i < listSize; i++ {
+				push = append(push, data(cfg.DataSize))
+			}
+			return [][]string{{"DEL", "mylist"}, push}
+		},
+	}
+}
+
+// Tests returns the tests that are run by default, in order.
+func Tests(cfg Config) []Test {
+	value := data(cfg.DataSize)
+	return []Test{
+		{Name: "PING_INLINE"},
+		{Name: "PING_MBULK", Args: []string{"PING"}},
+		{Name: "SET", Args: []string{"SET", "key:" + randPlaceholder, value}},
+		{Name: "GET", Args: []string{"GET", "key:" + randPlaceholder}},
+		{Name: "INCR", Args: []string{"INCR", "counter:" + randPlaceholder}},
+		{Name: "LPUSH", Args: []string{"LPUSH", "mylist", value}},
+		{Name: "RPUSH", Args: []string{"RPUSH", "mylist", value}},
+		lrangeTest(100),
+		lrangeTest(300),
+		lrangeTest(500),
+		lrangeTest(600),
+	}
+}
+
+// Select returns the tests with the names (e.g. "set" or "lrange_100"), where "ping" and "lrange" select every variant.
+func Select(tests []Test, names []string) []Test {
+	var ret []Test
+	for _, test := range tests {
+		for _, name := range names {
+			name = strings.ToUpper(strings.TrimSpace(name))
+			if test.Name == name || strings.HasPrefix(test.Name, name+"_") {
+				ret = append(ret, test)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func data(size int) string {
+	return strings.Repeat("x", size)
+}
+
+// Result is the outcome of a test.
+type Result struct {
+	Name     string
+	Requests int
+	Duration time.Duration
+	// Latencies are sorted.
+	Latencies []time.Duration
+}
+
+// Throughput returns the requests per second.
+func (r *Result) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// Percentile returns the latency that p percent of the requests were faster than (or as fast as).
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies))*p/100+0.5) - 1
+	return r.Latencies[min(max(i, 0), len(r.Latencies)-1)]
+}
+
+// Average returns the mean latency.
+func (r *Result) Average() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, l := range r.Latencies {
+		total += l
+	}
+	return total / time.Duration(len(r.Latencies))
+}
+
+// conn is a connection of a benchmark client.
+type conn struct {
+	conn net.Conn
+	rd   *messages.Reader
+}
+
+func dial(cfg Config) (*conn, error) {
+	nc, err := net.DialTimeout(cfg.Network, cfg.Addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{conn: nc, rd: messages.NewReader(nc)}
+
+	if cfg.Password != "" {
+		args := []string{"AUTH", cfg.Password}
+		if cfg.User != "" {
+			args = []string{"AUTH", cfg.User, cfg.Password}
+		}
+		if err := c.do(args); err != nil {
+			nc.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends a single command, returning the error reply (if any).
+func (c *conn) do(args []string) error {
+	if _, err := io.WriteString(c.conn, messages.NewArrayBulkString(args).Serialise()); err != nil {
+		return err
+	}
+	reply, err := c.rd.ReadMessage()
+	if err != nil {
+		return err
+	}
+	if e, ok := reply.(*messages.Error); ok {
+		return fmt.Errorf("Error from server: %w", e)
+	}
+	return nil
+}
+
+// request serialises the command, with a random key if there is a keyspace.
+func request(test Test, cfg Config, r *rand.Rand) string {
+	if len(test.Args) == 0 {
+		return "PING\r\n"
+	}
+	args := test.Args
+	if cfg.Keyspace > 0 {
+		args = slices.Clone(args)
+		for i, arg := range args {
+			if strings.Contains(arg, randPlaceholder) {
+				args[i] = strings.ReplaceAll(arg, randPlaceholder, fmt.Sprintf("%012d", r.IntN(cfg.Keyspace)))
+			}
+		}
+	}
+	return messages.NewArrayBulkString(args).Serialise()
+}
+
+// Bench runs the test with cfg.Clients connections, until cfg.Requests requests are replied to.
+func Bench(cfg Config, test Test) (*Result, error) {
+	conns := make([]*conn, 0, cfg.Clients)
+	defer func() {
+		for _, c := range conns {
+			c.conn.Close()
+		}
+	}()
+	for i := 0; i < cfg.Clients; i++ {
+		c, err := dial(cfg)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, c)
+	}
+	if test.setup != nil {
+		for _, args := range test.setup(cfg) {
+			if err := conns[0].do(args); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// the requests are claimed by the clients, a pipeline at a time
+	var remaining atomic.Int64
+	remaining.Store(int64(cfg.Requests))
+	latencies := make([][]time.Duration, len(conns))
+	errs := make([]error, len(conns))
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, c := range conns {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(uint64(start.UnixNano()), uint64(i)))
+			latencies[i], errs[i] = c.run(cfg, test, &remaining, r)
+		}()
+	}
+	wg.Wait()
+	duration := time.Since(start)
+
+	// every client usually fails the same way, so only the first error is returned
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := &Result{Name: test.Name, Requests: cfg.Requests, Duration: duration}
+	for _, l := range latencies {
+		result.Latencies = append(result.Latencies, l...)
+	}
+	slices.Sort(result.Latencies)
+	return result, nil
+}
+
+// run sends pipelines until there are no requests remaining, returning the latency of each request.
+func (c *conn) run(cfg Config, test Test, remaining *atomic.Int64, r *rand.Rand) ([]time.Duration, error) {
+	var latencies []time.Duration
+	var buf strings.Builder
+	for {
+		n := int(min(remaining.Add(-int64(cfg.Pipeline))+int64(cfg.Pipeline), int64(cfg.Pipeline)))
+		if n <= 0 {
+			return latencies, nil
+		}
+
+		buf.Reset()
+		for i := 0; i < n; i++ {
+			buf.WriteString(request(test, cfg, r))
+		}
+		sent := time.Now()
+		if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+			return latencies, err
+		}
+		for i := 0; i < n; i++ {
+			reply, err := c.rd.ReadMessage()
+			if err != nil {
+				return latencies, err
+			}
+			if e, ok := reply.(*messages.Error); ok {
+				return latencies, fmt.Errorf("Error from server: %w", e)
+			}
+			latencies = append(latencies, time.Since(sent))
+		}
+	}
+}
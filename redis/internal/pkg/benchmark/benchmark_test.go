@@ -0,0 +1,107 @@
+package benchmark
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/redistest"
+)
+
+func TestSelect(t *testing.T) {
+	names := func(tests []Test) []string {
+		var ret []string
+		for _, test := range tests {
+			ret = append(ret, test.Name)
+		}
+		return ret
+	}
+
+	tests := Tests(Config{})
+	EqualO(t, names(Select(tests, []string{"ping", " SET"})), []string{"PING_INLINE", "PING_MBULK", "SET"})
+	EqualO(t, names(Select(tests, []string{"lrange_100", "get"})), []string{"GET", "LRANGE_100"})
+	EqualO(t, names(Select(tests, []string{"lrange"})), []string{"LRANGE_100", "LRANGE_300", "LRANGE_500", "LRANGE_600"})
+	EqualO(t, names(Select(tests, []string{"nope"})), []string(nil))
+}
+
+func TestRequest(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	test := Test{Name: "SET", Args: []string{"SET", "key:" + randPlaceholder, "v"}}
+
+	EqualO(t, request(test, Config{}, r), "*3\r\n$3\r\nSET\r\n$16\r\nkey:__rand_int__\r\n$1\r\nv\r\n")
+	req := request(test, Config{Keyspace: 10}, r)
+	IsTrue(t, strings.HasPrefix(req, "*3\r\n$3\r\nSET\r\n$16\r\nkey:00000000000"), "req=%q", req)
+	EqualO(t, test.Args[1], "key:"+randPlaceholder)
+	EqualO(t, request(Test{Name: "PING_INLINE"}, Config{}, r), "PING\r\n")
+}
+
+func TestPercentile(t *testing.T) {
+	r := &Result{Requests: 4, Duration: 2 * time.Second, Latencies: []time.Duration{1, 2, 3, 10}}
+
+	EqualO(t, r.Throughput(), 2.0)
+	EqualO(t, r.Percentile(0), time.Duration(1))
+	EqualO(t, r.Percentile(50), time.Duration(2))
+	EqualO(t, r.Percentile(75), time.Duration(3))
+	EqualO(t, r.Percentile(99), time.Duration(10))
+	EqualO(t, r.Percentile(100), time.Duration(10))
+	EqualO(t, r.Average(), time.Duration(4))
+	EqualO(t, (&Result{}).Percentile(50), time.Duration(0))
+}
+
+func TestBench(t *testing.T) {
+	s := redistest.RunT(t)
+	cfg := Config{Network: "tcp", Addr: s.Addr(), Clients: 3, Requests: 100, Pipeline: 7, Keyspace: 5, DataSize: 4}
+
+	for _, test := range Select(Tests(cfg), []string{"set", "incr", "lrange_100"}) {
+		result, err := Bench(cfg, test)
+		NoError(t, err)
+		EqualO(t, len(result.Latencies), 100)
+		IsTrue(t, result.Throughput() > 0, "throughput=%v", result.Throughput())
+	}
+	// at most 5 keys of each
+	IsTrue(t, len(s.Keys()) <= 11, "keys=%v", s.Keys())
+	for _, key := range s.Keys() {
+		if strings.HasPrefix(key, "key:") {
+			Equal(t, V(s.Get(key)), V("xxxx", nil))
+		}
+	}
+	list, err := s.List("mylist")
+	NoError(t, err)
+	EqualO(t, len(list), listSize)
+
+	s.Set("key:"+randPlaceholder, "v")
+	_, err = Bench(Config{Network: "tcp", Addr: s.Addr(), Clients: 1, Requests: 1, Pipeline: 1}, Test{Name: "INCR", Args: []string{"INCR", "key:" + randPlaceholder}})
+	HasError(t, err)
+}
+
+func TestRun(t *testing.T) {
+	s := redistest.RunT(t)
+	host, port, _ := net.SplitHostPort(s.Addr())
+
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"-h", host, "-p", port, "-c", "2", "-n", "20", "-t", "ping,get", "--csv"}, &stdout, &stderr)
+	EqualO(t, code, 0)
+	records, err := csv.NewReader(&stdout).ReadAll()
+	NoError(t, err)
+	EqualO(t, len(records), 4)
+	EqualO(t, records[0], csvHeader)
+	EqualO(t, records[3][0], "GET")
+
+	stdout.Reset()
+	code = Run([]string{"-h", host, "-p", port, "-n", "10", "-t", "set"}, &stdout, &stderr)
+	EqualO(t, code, 0)
+	IsTrue(t, strings.Contains(stdout.String(), "====== SET ======\n  10 requests completed in"), "stdout=%q", stdout.String())
+
+	stdout.Reset()
+	code = Run([]string{"-h", host, "-p", port, "-n", "10", "-t", "get", "-q"}, &stdout, &stderr)
+	EqualO(t, code, 0)
+	IsTrue(t, strings.HasPrefix(stdout.String(), "GET: "), "stdout=%q", stdout.String())
+
+	EqualO(t, Run([]string{"-t", "nope"}, &stdout, &stderr), 2)
+	EqualO(t, Run([]string{"-P", "0"}, &stdout, &stderr), 2)
+}
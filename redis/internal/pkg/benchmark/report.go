@@ -0,0 +1,129 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func msec(d time.Duration) string {
+	return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+}
+
+// WriteText writes the result for humans, like redis-benchmark.
+func WriteText(w io.Writer, cfg Config, r *Result) {
+	fmt.Fprintf(w, "====== %s ======\n", r.Name)
+	fmt.Fprintf(w, "  %d requests completed in %.2f seconds\n", r.Requests, r.Duration.Seconds())
+	fmt.Fprintf(w, "  %d parallel clients\n", cfg.Clients)
+	fmt.Fprintf(w, "  %d bytes payload\n", cfg.DataSize)
+	fmt.Fprintf(w, "  pipeline: %d\n\n", cfg.Pipeline)
+	fmt.Fprintln(w, "Summary:")
+	fmt.Fprintf(w, "  throughput summary: %.2f requests per second\n", r.Throughput())
+	fmt.Fprintln(w, "  latency summary (msec):")
+	fmt.Fprintf(w, "  %9s %9s %9s %9s %9s %9s\n", "avg", "min", "p50", "p95", "p99", "max")
+	fmt.Fprintf(w, "  %9s %9s %9s %9s %9s %9s\n\n",
+		msec(r.Average()), msec(r.Percentile(0)), msec(r.Percentile(50)), msec(r.Percentile(95)), msec(r.Percentile(99)), msec(r.Percentile(100)))
+}
+
+// WriteQuiet writes the result in a line.
+func WriteQuiet(w io.Writer, r *Result) {
+	fmt.Fprintf(w, "%s: %.2f requests per second, p50=%s msec\n", r.Name, r.Throughput(), msec(r.Percentile(50)))
+}
+
+var csvHeader = []string{"test", "rps", "avg_latency_ms", "min_latency_ms", "p50_latency_ms", "p95_latency_ms", "p99_latency_ms", "max_latency_ms"}
+
+// WriteCSV writes the results with a header, like `redis-benchmark --csv`.
+func WriteCSV(w io.Writer, results []*Result) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, r := range results {
+		cw.Write([]string{
+			r.Name, strconv.FormatFloat(r.Throughput(), 'f', 2, 64),
+			msec(r.Average()), msec(r.Percentile(0)), msec(r.Percentile(50)), msec(r.Percentile(95)), msec(r.Percentile(99)), msec(r.Percentile(100)),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Run is the entrypoint of the `redis-benchmark` command.
+// Returns the exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("redis-benchmark", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	host := fs.String("h", "127.0.0.1", "server hostname")
+	port := fs.Int("p", 6379, "server port")
+	socket := fs.String("s", "", "server socket (overrides hostname and port)")
+	password := fs.String("a", "", "password to use when connecting to the server")
+	user := fs.String("user", "", "username to use when connecting to the server (needs -a)")
+	clients := fs.Int("c", 50, "number of parallel connections")
+	requests := fs.Int("n", 100000, "total number of requests of each test")
+	pipeline := fs.Int("P", 1, "number of requests that each connection pipelines")
+	keyspace := fs.Int("r", 0, "use random keys out of this many, instead of the same key for every request")
+	dataSize := fs.Int("d", 3, "size of the values in bytes")
+	tests := fs.String("t", "", "comma separated tests to run (default all), e.g. set,get,lrange_100")
+	quiet := fs.Bool("q", false, "only print the throughput (and p50 latency) of each test")
+	csvOutput := fs.Bool("csv", false, "print the results as CSV")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: redis-benchmark [options]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *clients < 1 || *requests < 1 || *pipeline < 1 || *keyspace < 0 || *dataSize < 0 {
+		fmt.Fprintln(stderr, "-c, -n and -P must be positive, and -r and -d cannot be negative")
+		return 2
+	}
+
+	cfg := Config{
+		Network: "tcp", Addr: net.JoinHostPort(*host, strconv.Itoa(*port)),
+		User: *user, Password: *password,
+		Clients: *clients, Requests: *requests, Pipeline: *pipeline,
+		Keyspace: *keyspace, DataSize: *dataSize,
+	}
+	if *socket != "" {
+		cfg.Network, cfg.Addr = "unix", *socket
+	}
+
+	selected := Tests(cfg)
+	if *tests != "" {
+		selected = Select(selected, strings.Split(*tests, ","))
+		if len(selected) == 0 {
+			fmt.Fprintf(stderr, "no such tests: %s\n", *tests)
+			return 2
+		}
+	}
+
+	var results []*Result
+	for _, test := range selected {
+		result, err := Bench(cfg, test)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", test.Name, err)
+			return 1
+		}
+		results = append(results, result)
+
+		switch {
+		case *csvOutput:
+			// written together at the end
+		case *quiet:
+			WriteQuiet(stdout, result)
+		default:
+			WriteText(stdout, cfg, result)
+		}
+	}
+
+	if *csvOutput {
+		if err := WriteCSV(stdout, results); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errInvalidArgs = errors.New("Invalid argument(s)")
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+// SplitArgs splits a line into arguments, like redis-cli.
+// Arguments may be "double quoted" (with escapes such as \n and \x41) or 'single quoted'.
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var arg strings.Builder
+		inDouble, inSingle := false, false
+		done := false
+		for !done {
+			if i == len(line) {
+				if inDouble || inSingle {
+					// unterminated quotes
+					return nil, errInvalidArgs
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDouble:
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' {
+					if b, err := strconv.ParseUint(line[i+2:i+4], 16, 8); err == nil {
+						arg.WriteByte(byte(b))
+						i += 3
+						break
+					}
+				}
+				if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg.WriteByte('\n')
+					case 'r':
+						arg.WriteByte('\r')
+					case 't':
+						arg.WriteByte('\t')
+					case 'b':
+						arg.WriteByte('\b')
+					case 'a':
+						arg.WriteByte('\a')
+					default:
+						arg.WriteByte(line[i])
+					}
+				} else if c == '"' {
+					// the closing quote must end the argument
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errInvalidArgs
+					}
+					done = true
+				} else {
+					arg.WriteByte(c)
+				}
+			case inSingle:
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg.WriteByte('\'')
+				} else if c == '\'' {
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errInvalidArgs
+					}
+					done = true
+				} else {
+					arg.WriteByte(c)
+				}
+			default:
+				switch {
+				case isSpace(c):
+					done = true
+				case c == '"':
+					inDouble = true
+				case c == '\'':
+					inSingle = true
+				default:
+					arg.WriteByte(c)
+				}
+			}
+			i++
+		}
+		args = append(args, arg.String())
+	}
+}
@@ -0,0 +1,232 @@
+// Package cli is a command line client, like redis-cli.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+var errUsage = errors.New("usage error")
+
+type options struct {
+	host     string
+	port     int
+	socket   string
+	user     string
+	password string
+	// raw prints the replies exactly as they were received.
+	raw      bool
+	repeat   int
+	interval time.Duration
+
+	pipe     bool
+	scan     bool
+	pattern  string
+	count    int
+	scanType string
+	stat     bool
+}
+
+func (o *options) addr() string {
+	if o.socket != "" {
+		return o.socket
+	}
+	return net.JoinHostPort(o.host, strconv.Itoa(o.port))
+}
+
+// client is the state shared by every mode.
+type client struct {
+	opts   *options
+	conn   *Conn
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// connect connects (and authenticates) if not connected yet.
+func (c *client) connect() error {
+	if c.conn != nil {
+		return nil
+	}
+	conn, err := Dial(c.opts.addr(), c.opts.socket)
+	if err != nil {
+		return fmt.Errorf("Could not connect to Redis at %s: %w", c.opts.addr(), err)
+	}
+	if c.opts.password != "" {
+		if err := conn.Auth(c.opts.user, c.opts.password); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	c.conn = conn
+	return nil
+}
+
+func (c *client) disconnect() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// print writes the reply for the user.
+func (c *client) print(reply messages.Message, raw []byte) {
+	if c.opts.raw {
+		c.stdout.Write(raw)
+		return
+	}
+	fmt.Fprintln(c.stdout, Format(reply))
+}
+
+// isStreaming returns whether the server keeps sending replies after the command (until the connection is closed).
+func isStreaming(args []string) bool {
+	switch strings.ToUpper(args[0]) {
+	case "MONITOR", "SUBSCRIBE", "PSUBSCRIBE":
+		return true
+	}
+	return false
+}
+
+// execute sends the command, printing its reply. Returns whether the command succeeded.
+func (c *client) execute(args []string) bool {
+	if err := c.connect(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return false
+	}
+
+	reply, raw, err := c.conn.Do(args...)
+	if err != nil {
+		fmt.Fprintf(c.stderr, "Error: %v\n", err)
+		c.disconnect()
+		return false
+	}
+	c.print(reply, raw)
+	if _, ok := reply.(*messages.Error); ok {
+		return false
+	}
+
+	if isStreaming(args) {
+		for {
+			reply, raw, err := c.conn.Read()
+			if err != nil {
+				c.disconnect()
+				return errors.Is(err, io.EOF)
+			}
+			c.print(reply, raw)
+		}
+	}
+	return true
+}
+
+func usage(fs *flag.FlagSet, w io.Writer) func() {
+	return func() {
+		fmt.Fprintln(w, "usage: redis-cli [options] [cmd [arg ...]]")
+		fs.PrintDefaults()
+		fmt.Fprintln(w, `
+examples:
+  redis-cli -p 6380 incr counter
+  redis-cli --raw get key
+  redis-cli --scan --pattern 'user:*'
+  rdb-dump --format resp | redis-cli --pipe
+
+When no command is given, redis-cli starts in interactive mode (type "help" for help).`)
+	}
+}
+
+func parseOptions(args []string, stderr io.Writer) (*options, []string, error) {
+	opts := &options{}
+	fs := flag.NewFlagSet("redis-cli", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = usage(fs, stderr)
+
+	fs.StringVar(&opts.host, "h", "127.0.0.1", "server hostname")
+	fs.IntVar(&opts.port, "p", 6379, "server port")
+	fs.StringVar(&opts.socket, "s", "", "server socket (overrides hostname and port)")
+	fs.StringVar(&opts.password, "a", "", "password to use when connecting to the server")
+	fs.StringVar(&opts.user, "user", "", "username to use when connecting to the server (needs -a)")
+	fs.BoolVar(&opts.raw, "raw", false, "print the replies exactly as they were received")
+	fs.IntVar(&opts.repeat, "r", 1, "execute the command this many times (-1 for forever)")
+	interval := fs.Float64("i", 0, "wait this many seconds between commands, and between --stat lines (default 1 for --stat)")
+	fs.BoolVar(&opts.pipe, "pipe", false, "send the commands in stdin (serialised with the protocol) to the server")
+	fs.BoolVar(&opts.scan, "scan", false, "list all keys using SCAN")
+	fs.StringVar(&opts.pattern, "pattern", "", "keys pattern when using --scan")
+	fs.IntVar(&opts.count, "count", 0, "COUNT hint when using --scan")
+	fs.StringVar(&opts.scanType, "type", "", "key type when using --scan")
+	fs.BoolVar(&opts.stat, "stat", false, "print rolling stats about the server")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	opts.interval = time.Duration(*interval * float64(time.Second))
+	if opts.stat {
+		if opts.interval == 0 {
+			opts.interval = time.Second
+		}
+		// stats are printed forever, unless -r is given
+		repeat := false
+		fs.Visit(func(f *flag.Flag) {
+			repeat = repeat || f.Name == "r"
+		})
+		if !repeat {
+			opts.repeat = -1
+		}
+	}
+	if opts.user != "" && opts.password == "" {
+		fmt.Fprintln(stderr, "--user needs a password (-a)")
+		return nil, nil, errUsage
+	}
+	return opts, fs.Args(), nil
+}
+
+// Run is the entrypoint of the `redis-cli` command.
+// Returns the exit code.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, args, err := parseOptions(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		// the error has been printed
+		return 2
+	}
+
+	c := &client{opts: opts, stdout: stdout, stderr: stderr}
+	defer c.disconnect()
+
+	switch {
+	case opts.pipe:
+		return c.runPipe(stdin)
+	case opts.scan:
+		return c.runScan()
+	case opts.stat:
+		return c.runStat()
+	case len(args) > 0:
+		return c.runCommand(args)
+	}
+	return c.runREPL(stdin)
+}
+
+// runCommand runs the command given in the arguments, repeating it with -r.
+func (c *client) runCommand(args []string) int {
+	code := 0
+	for i := 0; c.opts.repeat < 0 || i < c.opts.repeat; i++ {
+		if i > 0 {
+			time.Sleep(c.opts.interval)
+		}
+		if !c.execute(args) {
+			code = 1
+			if c.conn == nil {
+				// not worth repeating if the server is gone
+				break
+			}
+		}
+	}
+	return code
+}
@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/redistest"
+)
+
+// run runs the cli against the server, returning its exit code and output.
+func run(t *testing.T, s *redistest.Server, stdin string, args ...string) (int, string, string) {
+	host, port, err := net.SplitHostPort(s.Addr())
+	NoError(t, err)
+
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"-h", host, "-p", port}, args...)
+	code := Run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommand(t *testing.T) {
+	s := redistest.RunT(t)
+	s.Set("k", "v")
+	s.RPush("l", "a", "b")
+
+	Equal(t, V(run(t, s, "", "get", "k")), V(0, "\"v\"\n", ""))
+	Equal(t, V(run(t, s, "", "lrange", "l", "0", "-1")), V(0, "1) \"a\"\n2) \"b\"\n", ""))
+	Equal(t, V(run(t, s, "", "--raw", "lrange", "l", "0", "-1")), V(0, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", ""))
+	Equal(t, V(run(t, s, "", "-r", "3", "incr", "n")), V(0, "(integer) 1\n(integer) 2\n(integer) 3\n", ""))
+	Equal(t, V(run(t, s, "", "incr", "k")), V(1, "(error) value is not an integer or out of range\n", ""))
+
+	code, _, stderr := run(t, s, "", "-a", "wrong", "get", "k")
+	EqualO(t, code, 1)
+	IsTrue(t, strings.HasPrefix(stderr, "AUTH failed"), "stderr=%q", stderr)
+}
+
+func TestREPL(t *testing.T) {
+	s := redistest.RunT(t)
+
+	// stdin is not a terminal, so the lines are read as they are
+	stdin := "set k \"a b\"\nget k\nset k 'x\nhelp get\nquit\nget k\n"
+	code, stdout, stderr := run(t, s, stdin)
+	EqualO(t, code, 0)
+	EqualO(t, stdout, "OK\n\"a b\"\n\n  GET\n  summary: Returns the string value of a key.\n  group: string\n\n")
+	EqualO(t, stderr, "Invalid argument(s)\n")
+
+	c := &client{opts: &options{host: "unused"}}
+	r := &repl{client: c, docs: map[string]doc{"get": {summary: "Get."}, "getdel": {}, "set": {}}}
+	EqualO(t, r.complete("GE"), []string{"GET", "GETDEL"})
+	EqualO(t, r.complete("get k"), []string(nil))
+	EqualO(t, r.hint("get "), "Get.")
+	EqualO(t, r.hint("get"), "")
+	EqualO(t, r.hint("get k "), "")
+	EqualO(t, r.prompt(), "not connected> ")
+}
+
+func TestPipe(t *testing.T) {
+	s := redistest.RunT(t)
+	s.Set("s", "v")
+
+	var stdin strings.Builder
+	for i := 0; i < 100; i++ {
+		stdin.WriteString(messages.NewArrayBulkString([]string{"SET", fmt.Sprintf("k%d", i), "v"}).Serialise())
+	}
+	stdin.WriteString("INCR s\r\n")
+
+	code, stdout, _ := run(t, s, stdin.String(), "--pipe")
+	EqualO(t, code, 1)
+	IsTrue(t, strings.HasSuffix(stdout, "errors: 1, replies: 101\n"), "stdout=%q", stdout)
+	EqualO(t, len(s.Keys()), 101)
+}
+
+func TestScan(t *testing.T) {
+	s := redistest.RunT(t)
+	for i := 0; i < 30; i++ {
+		s.Set(fmt.Sprintf("user:%d", i), "v")
+	}
+	s.Set("other", "v")
+	s.RPush("user:list", "a")
+
+	code, stdout, _ := run(t, s, "", "--scan", "--pattern", "user:*", "--count", "4")
+	EqualO(t, code, 0)
+	EqualO(t, len(strings.Fields(stdout)), 31)
+	IsFalse(t, strings.Contains(stdout, "other"), "stdout=%q", stdout)
+
+	Equal(t, V(run(t, s, "", "--scan", "--type", "list")), V(0, "user:list\n", ""))
+}
+
+func TestStat(t *testing.T) {
+	s := redistest.RunT(t)
+	s.Seed(map[string]string{"a": "1", "b": "2"})
+
+	code, stdout, _ := run(t, s, "", "--stat", "-r", "2", "-i", "0.01")
+	EqualO(t, code, 0)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	EqualO(t, len(lines), 4)
+	EqualO(t, strings.Fields(lines[2])[0], "2")
+	// the INFO of the first line is counted in the second
+	EqualO(t, strings.Fields(lines[3])[4], "(+1)")
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const dialTimeout = 5 * time.Second
+
+// recorder keeps the bytes read through it, so that replies can be printed exactly as they were received.
+type recorder struct {
+	r   io.Reader
+	buf bytes.Buffer
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf.Write(p[:n])
+	return n, err
+}
+
+// Conn is a connection to a server.
+type Conn struct {
+	conn net.Conn
+	rec  *recorder
+	rd   *messages.Reader
+}
+
+// Dial connects to the server at addr, or at the unix socket if it is set.
+func Dial(addr, socket string) (*Conn, error) {
+	network := "tcp"
+	if socket != "" {
+		network, addr = "unix", socket
+	}
+	conn, err := net.DialTimeout(network, addr, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := &recorder{r: conn}
+	return &Conn{conn: conn, rec: rec, rd: messages.NewReader(rec)}, nil
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// Write sends a single command.
+func (c *Conn) Write(args ...string) error {
+	_, err := io.WriteString(c.conn, messages.NewArrayBulkString(args).Serialise())
+	return err
+}
+
+// Read reads a single reply, together with its exact bytes.
+func (c *Conn) Read() (messages.Message, []byte, error) {
+	before := c.rd.Consumed()
+	reply, err := c.rd.ReadMessage()
+	if err != nil {
+		return nil, nil, err
+	}
+	raw := bytes.Clone(c.rec.buf.Next(int(c.rd.Consumed() - before)))
+	return reply, raw, nil
+}
+
+// Do sends a command and reads its reply.
+func (c *Conn) Do(args ...string) (messages.Message, []byte, error) {
+	if err := c.Write(args...); err != nil {
+		return nil, nil, err
+	}
+	return c.Read()
+}
+
+// Auth authenticates the connection, with the default user if user is empty.
+func (c *Conn) Auth(user, password string) error {
+	args := []string{"AUTH", password}
+	if user != "" {
+		args = []string{"AUTH", user, password}
+	}
+	reply, _, err := c.Do(args...)
+	if err != nil {
+		return err
+	}
+	if e, ok := reply.(*messages.Error); ok {
+		return fmt.Errorf("AUTH failed: %w", e)
+	}
+	return nil
+}
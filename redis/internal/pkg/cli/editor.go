@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+const maxHistory = 1000
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// editor reads lines from a terminal in raw mode (so it echoes the line itself), with history, completion and hints.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history []string
+	// complete returns the candidates for a line that is only a command name.
+	complete func(prefix string) []string
+	// hint returns the text shown (dimmed) after the line.
+	hint func(line string) string
+
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func newEditor(in io.Reader, out io.Writer) *editor {
+	return &editor{in: bufio.NewReader(in), out: out}
+}
+
+// addHistory remembers the line, skipping repeats of the last line.
+func (e *editor) addHistory(line string) {
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+}
+
+// refresh redraws the line, with the cursor at pos.
+func (e *editor) refresh(showHint bool) {
+	var b strings.Builder
+	b.WriteString("\r" + e.prompt + string(e.buf))
+	if showHint && e.hint != nil && e.pos == len(e.buf) {
+		if hint := e.hint(string(e.buf)); hint != "" {
+			b.WriteString("\x1b[90m" + hint + "\x1b[0m")
+		}
+	}
+	b.WriteString("\x1b[0K\r")
+	if n := len([]rune(e.prompt)) + e.pos; n > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", n)
+	}
+	io.WriteString(e.out, b.String())
+}
+
+func (e *editor) set(line string) {
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+// ReadLine reads a line, returning io.EOF if the user quits with ctrl-c, or ctrl-d on an empty line.
+func (e *editor) ReadLine(prompt string) (string, error) {
+	e.prompt = prompt
+	e.buf, e.pos = nil, 0
+	// the line being edited is the last entry while browsing the history
+	history := append(append([]string{}, e.history...), "")
+	index := len(history) - 1
+	// the completions being cycled through by tab, starting with the typed line
+	var completions []string
+	completion := 0
+
+	e.refresh(true)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		if r == keyTab && e.complete != nil {
+			if completions == nil {
+				line := string(e.buf)
+				completions = append(e.complete(line), line)
+				completion = 0
+			}
+			if len(completions) == 1 {
+				io.WriteString(e.out, "\a")
+				completions = nil
+				continue
+			}
+			e.set(completions[completion])
+			completion = (completion + 1) % len(completions)
+			e.refresh(true)
+			continue
+		}
+		completions = nil
+
+		switch r {
+		case keyEnter, '\n':
+			e.pos = len(e.buf)
+			e.refresh(false)
+			io.WriteString(e.out, "\r\n")
+			return string(e.buf), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", io.EOF
+		case keyCtrlD:
+			if len(e.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.delete()
+		case keyBackspace, keyCtrlH:
+			if e.pos > 0 {
+				e.pos--
+				e.delete()
+			}
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.buf)
+		case keyCtrlB:
+			e.pos = max(e.pos-1, 0)
+		case keyCtrlF:
+			e.pos = min(e.pos+1, len(e.buf))
+		case keyCtrlP, keyCtrlN:
+			index = e.browse(history, index, r == keyCtrlP)
+		case keyCtrlU:
+			e.buf = e.buf[e.pos:]
+			e.pos = 0
+		case keyCtrlK:
+			e.buf = e.buf[:e.pos]
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.buf[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.buf[start-1] != ' ' {
+				start--
+			}
+			e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+			e.pos = start
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyEscape:
+			if !e.escape(history, &index) {
+				continue
+			}
+		default:
+			if !unicode.IsPrint(r) {
+				continue
+			}
+			e.buf = append(e.buf[:e.pos], append([]rune{r}, e.buf[e.pos:]...)...)
+			e.pos++
+		}
+		e.refresh(true)
+	}
+}
+
+// delete removes the rune under the cursor.
+func (e *editor) delete() {
+	if e.pos < len(e.buf) {
+		e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	}
+}
+
+// browse moves to the previous (or next) history entry, keeping edits to the entries until the line is read.
+func (e *editor) browse(history []string, index int, previous bool) int {
+	next := index + 1
+	if previous {
+		next = index - 1
+	}
+	if next < 0 || next >= len(history) {
+		return index
+	}
+	history[index] = string(e.buf)
+	e.set(history[next])
+	return next
+}
+
+// escape handles an escape sequence (e.g. the arrow keys), returning false if it is not supported.
+func (e *editor) escape(history []string, index *int) bool {
+	b, err := e.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return false
+	}
+	b, err = e.in.ReadByte()
+	if err != nil {
+		return false
+	}
+
+	if b >= '0' && b <= '9' {
+		// e.g. delete is ESC [ 3 ~
+		end, err := e.in.ReadByte()
+		if err != nil || end != '~' {
+			return false
+		}
+		switch b {
+		case '1', '7':
+			e.pos = 0
+		case '4', '8':
+			e.pos = len(e.buf)
+		case '3':
+			e.delete()
+		default:
+			return false
+		}
+		return true
+	}
+
+	switch b {
+	case 'A':
+		*index = e.browse(history, *index, true)
+	case 'B':
+		*index = e.browse(history, *index, false)
+	case 'C':
+		e.pos = min(e.pos+1, len(e.buf))
+	case 'D':
+		e.pos = max(e.pos-1, 0)
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	default:
+		return false
+	}
+	return true
+}
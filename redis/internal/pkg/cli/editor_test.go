@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"simple", "get k\r", "get k"},
+		{"backspace", "get kk\x7f\r", "get k"},
+		{"move", "et k\x01g\x05x\r", "get kx"},
+		{"arrows", "gt\x1b[De\x1b[C k\r", "get k"},
+		{"delete", "gxet\x01\x1b[C\x1b[3~\r", "get"},
+		{"kill", "set k v\x02\x0b\x01\x06\x06\x06\x06\x15\r", "k "},
+		{"delete_word", "set k  value\x17\x17v\r", "set v"},
+		{"history", "\x1b[A\x1b[A\x10\x1b[B\r", "incr n"},
+		{"history_edit", "\x1b[A\x7f\x7f\x1b[A\x1b[B\r", "incr"},
+		{"complete", "li\t\t\r", "LLEN"},
+		{"complete_cycle", "li\t\t\t\r", "li"},
+		{"no_complete", "get \t\r", "get "},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := newEditor(strings.NewReader(test.keys), io.Discard)
+			e.history = []string{"get k", "incr n"}
+			e.complete = func(prefix string) []string {
+				if prefix == "li" {
+					return []string{"LINDEX", "LLEN"}
+				}
+				return nil
+			}
+
+			line, err := e.ReadLine("> ")
+			NoError(t, err)
+			EqualO(t, line, test.expected)
+		})
+	}
+}
+
+func TestEditorQuit(t *testing.T) {
+	for _, keys := range []string{"\x04", "get\x03", ""} {
+		e := newEditor(strings.NewReader(keys), io.Discard)
+		_, err := e.ReadLine("> ")
+		Equal(t, V(err), V(io.EOF), cmpopts.EquateErrors())
+	}
+}
+
+func TestEditorHint(t *testing.T) {
+	var out bytes.Buffer
+	e := newEditor(strings.NewReader("get \r"), &out)
+	e.hint = func(line string) string {
+		if line == "get " {
+			return "key"
+		}
+		return ""
+	}
+
+	_, err := e.ReadLine("> ")
+	NoError(t, err)
+	IsTrue(t, strings.Contains(out.String(), "get \x1b[90mkey\x1b[0m"), "out=%q", out.String())
+	// the hint is cleared once the line is read
+	IsTrue(t, strings.HasSuffix(out.String(), "> get \x1b[0K\r\x1b[6C\r\n"), "out=%q", out.String())
+}
+
+func TestHistory(t *testing.T) {
+	e := newEditor(strings.NewReader(""), io.Discard)
+	e.addHistory("a")
+	e.addHistory("a")
+	e.addHistory("b")
+	EqualO(t, e.history, []string{"a", "b"})
+
+	path := t.TempDir() + "/history"
+	appendHistory(path, "a")
+	appendHistory(path, "b")
+	EqualO(t, loadHistory(path), []string{"a", "b"})
+	EqualO(t, loadHistory(""), []string(nil))
+
+	IsTrue(t, isSensitive([]string{"auth", "pass"}), "")
+	IsTrue(t, isSensitive([]string{"ACL", "setuser", "u", ">pass"}), "")
+	IsTrue(t, isSensitive([]string{"CONFIG", "SET", "masterauth", "pass"}), "")
+	IsFalse(t, isSensitive([]string{"CONFIG", "SET", "maxmemory", "1"}), "")
+	IsFalse(t, isSensitive([]string{"get", "auth"}), "")
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// Format describes a reply for humans, like redis-cli.
+func Format(reply messages.Message) string {
+	return strings.Join(formatLines(reply), "\n")
+}
+
+func formatLines(reply messages.Message) []string {
+	switch r := reply.(type) {
+	case *messages.SimpleString:
+		return []string{r.String()}
+	case *messages.Error:
+		return []string{"(error) " + r.Error()}
+	case *messages.Integer:
+		return []string{"(integer) " + strconv.FormatInt(r.Value(), 10)}
+	case *messages.BulkString:
+		if r == nil {
+			return []string{"(nil)"}
+		}
+		return []string{Quote(r.String())}
+	case *messages.Array:
+		items := r.Items()
+		if len(items) == 0 {
+			return []string{"(empty array)"}
+		}
+
+		// the indices are right-aligned, and nested replies are indented past them
+		width := len(strconv.Itoa(len(items)))
+		var ret []string
+		for i, item := range items {
+			prefix := fmt.Sprintf("%*d) ", width, i+1)
+			indent := strings.Repeat(" ", len(prefix))
+			for j, line := range formatLines(item) {
+				if j == 0 {
+					ret = append(ret, prefix+line)
+				} else {
+					ret = append(ret, indent+line)
+				}
+			}
+		}
+		return ret
+	}
+	return []string{reply.Serialise()}
+}
+
+// Quote quotes s, escaping the bytes that are not printable ASCII.
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
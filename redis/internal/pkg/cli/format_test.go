@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		reply    messages.Message
+		expected string
+	}{
+		{"simple_string", messages.NewSimpleString("OK"), "OK"},
+		{"error", messages.NewError("ERR nope"), "(error) ERR nope"},
+		{"integer", messages.NewInteger(-3), "(integer) -3"},
+		{"bulk_string", messages.NewBulkString("a \"b\"\n\x00é"), `"a \"b\"\n\x00\xc3\xa9"`},
+		{"null", messages.NewNullBulkString(), "(nil)"},
+		{"empty_array", messages.NewArray([]messages.Message{}), "(empty array)"},
+		{"array", messages.NewArray([]messages.Message{
+			messages.NewBulkString("a"),
+			messages.NewArray([]messages.Message{messages.NewInteger(1), messages.NewNullBulkString()}),
+		}), "1) \"a\"\n2) 1) (integer) 1\n   2) (nil)"},
+		{"aligned", messages.NewArrayBulkString([]string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}),
+			" 1) \"1\"\n 2) \"2\"\n 3) \"3\"\n 4) \"4\"\n 5) \"5\"\n 6) \"6\"\n 7) \"7\"\n 8) \"8\"\n 9) \"9\"\n10) \"10\""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			EqualO(t, Format(test.reply), test.expected)
+		})
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected []string
+		hasError bool
+	}{
+		{"empty", "  ", nil, false},
+		{"simple", "set  k v", []string{"set", "k", "v"}, false},
+		{"double_quotes", `set k "a b\n\x41\"" ""`, []string{"set", "k", "a b\nA\"", ""}, false},
+		{"single_quotes", `set k 'a\'b\n'`, []string{"set", "k", `a'b\n`}, false},
+		{"unterminated", `set k "v`, nil, true},
+		{"quote_not_closing", `set k "v"x`, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := SplitArgs(test.line)
+			if test.hasError {
+				HasError(t, err)
+				return
+			}
+			NoError(t, err)
+			EqualO(t, actual, test.expected)
+		})
+	}
+}
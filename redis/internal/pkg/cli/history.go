@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const historyFile = ".rediscli_history"
+
+// historyPath returns the file that the history is kept in, like redis-cli.
+// Returns "" if there is no such file.
+func historyPath() string {
+	if path, ok := os.LookupEnv("REDISCLI_HISTFILE"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFile)
+}
+
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	return lines
+}
+
+func appendHistory(path, line string) {
+	if path == "" {
+		return
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.WriteString(line + "\n")
+}
+
+// isSensitive returns whether the command has a password, which should not be kept in the history.
+func isSensitive(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		return true
+	case "MIGRATE":
+		return slices.ContainsFunc(args, func(arg string) bool {
+			return strings.EqualFold(arg, "AUTH") || strings.EqualFold(arg, "AUTH2")
+		})
+	case "ACL":
+		return len(args) > 1 && strings.EqualFold(args[1], "SETUSER")
+	case "CONFIG":
+		return len(args) > 2 && strings.EqualFold(args[1], "SET") && strings.Contains(strings.ToLower(args[2]), "auth")
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// runPipe sends stdin to the server as it is (mass insertion), counting the replies.
+// An ECHO with a random marker is sent last, so that its reply shows that every command has been replied to.
+func (c *client) runPipe(stdin io.Reader) int {
+	if err := c.connect(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return 1
+	}
+
+	b := make([]byte, 20)
+	rand.Read(b)
+	marker := hex.EncodeToString(b)
+
+	written := make(chan error, 1)
+	go func() {
+		// written concurrently with reading the replies, otherwise both sides could block on full buffers
+		_, err := io.Copy(c.conn.conn, stdin)
+		if err == nil {
+			err = c.conn.Write("ECHO", marker)
+		}
+		written <- err
+	}()
+
+	errs, replies := 0, 0
+	for {
+		reply, _, err := c.conn.Read()
+		if err != nil {
+			fmt.Fprintf(c.stderr, "Error reading from the server: %v\n", err)
+			return 1
+		}
+		if bulk, ok := reply.(*messages.BulkString); ok && bulk.String() == marker {
+			break
+		}
+		if e, ok := reply.(*messages.Error); ok {
+			fmt.Fprintln(c.stdout, e.Error())
+			errs++
+		}
+		replies++
+	}
+	if err := <-written; err != nil {
+		fmt.Fprintf(c.stderr, "Error writing to the server: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(c.stdout, "All data transferred. Last reply received from server.")
+	fmt.Fprintf(c.stdout, "errors: %d, replies: %d\n", errs, replies)
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runScan prints every key (that matches the pattern), one per line.
+func (c *client) runScan() int {
+	if err := c.connect(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+		return 1
+	}
+
+	cursor := "0"
+	for {
+		args := []string{"SCAN", cursor}
+		if c.opts.pattern != "" {
+			args = append(args, "MATCH", c.opts.pattern)
+		}
+		if c.opts.count > 0 {
+			args = append(args, "COUNT", strconv.Itoa(c.opts.count))
+		}
+		if c.opts.scanType != "" {
+			args = append(args, "TYPE", c.opts.scanType)
+		}
+
+		reply, _, err := c.conn.Do(args...)
+		if err != nil {
+			fmt.Fprintf(c.stderr, "Error: %v\n", err)
+			return 1
+		}
+		if e, ok := reply.(*messages.Error); ok {
+			fmt.Fprintln(c.stderr, Format(e))
+			return 1
+		}
+		next, keys, ok := parseScanReply(reply)
+		if !ok {
+			fmt.Fprintf(c.stderr, "Unexpected reply to SCAN: %q\n", reply.Serialise())
+			return 1
+		}
+
+		for _, key := range keys {
+			fmt.Fprintln(c.stdout, key)
+		}
+		if next == "0" {
+			return 0
+		}
+		cursor = next
+	}
+}
+
+func parseScanReply(reply messages.Message) (string, []string, bool) {
+	array, ok := reply.(*messages.Array)
+	if !ok || len(array.Items()) != 2 {
+		return "", nil, false
+	}
+	cursor, ok := array.Items()[0].(*messages.BulkString)
+	if !ok {
+		return "", nil, false
+	}
+	keys, ok := array.Items()[1].(*messages.Array)
+	if !ok {
+		return "", nil, false
+	}
+	names, err := keys.GetCommands()
+	if err != nil {
+		return "", nil, false
+	}
+	return cursor.String(), names, true
+}
+
+// parseInfo returns the fields of an INFO reply.
+func parseInfo(info string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// keyCount sums the keys of every database in the INFO fields, e.g. "db0:keys=1,expires=0,avg_ttl=0".
+func keyCount(fields map[string]string) int64 {
+	var total int64
+	for k, v := range fields {
+		if !strings.HasPrefix(k, "db") {
+			continue
+		}
+		for _, kv := range strings.Split(v, ",") {
+			if n, ok := strings.CutPrefix(kv, "keys="); ok {
+				keys, _ := strconv.ParseInt(n, 10, 64)
+				total += keys
+			}
+		}
+	}
+	return total
+}
+
+const statHeaderEvery = 20
+
+// runStat prints a line of stats every interval, like `redis-cli --stat`.
+func (c *client) runStat() int {
+	var lastRequests int64 = -1
+	for i := 0; c.opts.repeat < 0 || i < c.opts.repeat; i++ {
+		if i > 0 {
+			time.Sleep(c.opts.interval)
+		}
+		if err := c.connect(); err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return 1
+		}
+
+		reply, _, err := c.conn.Do("INFO")
+		if err != nil {
+			fmt.Fprintf(c.stderr, "Error: %v\n", err)
+			return 1
+		}
+		if e, ok := reply.(*messages.Error); ok {
+			fmt.Fprintln(c.stderr, Format(e))
+			return 1
+		}
+		bulk, ok := reply.(*messages.BulkString)
+		if !ok {
+			fmt.Fprintf(c.stderr, "Unexpected reply to INFO: %q\n", reply.Serialise())
+			return 1
+		}
+		fields := parseInfo(bulk.String())
+
+		if i%statHeaderEvery == 0 {
+			fmt.Fprintln(c.stdout, "------- data ------ ----------------- load -----------------")
+			fmt.Fprintln(c.stdout, "keys       mem      clients requests            connections")
+		}
+		requests, _ := strconv.ParseInt(fields["total_commands_processed"], 10, 64)
+		delta := int64(0)
+		if lastRequests >= 0 {
+			delta = requests - lastRequests
+		}
+		lastRequests = requests
+		fmt.Fprintf(c.stdout, "%-10d %-8s %-7s %-19s %s\n",
+			keyCount(fields), fields["used_memory_human"], fields["connected_clients"],
+			fmt.Sprintf("%d (+%d)", requests, delta), fields["total_connections_received"])
+	}
+	return 0
+}
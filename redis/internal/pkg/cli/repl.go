@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// doc is the documentation of a command, from COMMAND DOCS.
+type doc struct {
+	summary string
+	group   string
+}
+
+// loadDocs fetches the documentation of every command, returning nil if the server does not reply with it (e.g. before AUTH).
+func (c *client) loadDocs() map[string]doc {
+	if c.conn == nil {
+		return nil
+	}
+	reply, _, err := c.conn.Do("COMMAND", "DOCS")
+	if err != nil {
+		c.disconnect()
+		return nil
+	}
+	array, ok := reply.(*messages.Array)
+	if !ok {
+		return nil
+	}
+
+	// name, [field, value, ...], name, ...
+	docs := map[string]doc{}
+	items := array.Items()
+	for i := 0; i+1 < len(items); i += 2 {
+		name, ok := items[i].(*messages.BulkString)
+		if !ok {
+			continue
+		}
+		fields, ok := items[i+1].(*messages.Array)
+		if !ok {
+			continue
+		}
+		var d doc
+		values := fields.Items()
+		for j := 0; j+1 < len(values); j += 2 {
+			field, _ := values[j].(*messages.BulkString)
+			value, _ := values[j+1].(*messages.BulkString)
+			switch field.String() {
+			case "summary":
+				d.summary = value.String()
+			case "group":
+				d.group = value.String()
+			}
+		}
+		docs[strings.ToLower(name.String())] = d
+	}
+	return docs
+}
+
+type repl struct {
+	*client
+	docs map[string]doc
+}
+
+func (r *repl) prompt() string {
+	if r.conn == nil {
+		return "not connected> "
+	}
+	return r.opts.addr() + "> "
+}
+
+// complete returns the commands that start with the line.
+func (r *repl) complete(line string) []string {
+	if line == "" || strings.ContainsAny(line, " \t") {
+		return nil
+	}
+	var ret []string
+	for name := range r.docs {
+		if strings.HasPrefix(name, strings.ToLower(line)) {
+			ret = append(ret, strings.ToUpper(name))
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// hint returns the summary of the command, once its name has been typed.
+func (r *repl) hint(line string) string {
+	if !strings.HasSuffix(line, " ") {
+		return ""
+	}
+	args, err := SplitArgs(line)
+	if err != nil || len(args) != 1 {
+		return ""
+	}
+	d, ok := r.docs[strings.ToLower(args[0])]
+	if !ok {
+		return ""
+	}
+	return d.summary
+}
+
+func (r *repl) help(args []string) {
+	if len(args) == 1 {
+		fmt.Fprintln(r.stdout, `redis-cli
+Type: "help <command>" for help on <command>
+      "quit" to exit`)
+		return
+	}
+
+	name := strings.ToLower(strings.Join(args[1:], " "))
+	d, ok := r.docs[name]
+	if !ok {
+		fmt.Fprintf(r.stdout, "No help for '%s'\n", name)
+		return
+	}
+	fmt.Fprintf(r.stdout, "\n  %s\n  summary: %s\n  group: %s\n\n", strings.ToUpper(name), d.summary, d.group)
+}
+
+// line runs a line of input, returning false if the user quits.
+func (r *repl) line(line string) bool {
+	args, err := SplitArgs(line)
+	if err != nil {
+		fmt.Fprintln(r.stderr, err)
+		return true
+	}
+	if len(args) == 0 {
+		return true
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "quit", "exit":
+		return false
+	case "help":
+		r.help(args)
+		return true
+	case "clear":
+		io.WriteString(r.stdout, "\x1b[H\x1b[2J")
+		return true
+	}
+
+	r.execute(args)
+	if r.docs == nil {
+		// e.g. after AUTH, or reconnecting
+		r.docs = r.loadDocs()
+	}
+	return true
+}
+
+// runREPL reads commands from stdin, line by line.
+// If stdin is a terminal, the lines are edited with history, completion and hints.
+func (c *client) runREPL(stdin io.Reader) int {
+	r := &repl{client: c}
+	if err := c.connect(); err != nil {
+		fmt.Fprintln(c.stderr, err)
+	}
+	r.docs = c.loadDocs()
+
+	f, ok := stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if !r.line(scanner.Text()) {
+				break
+			}
+		}
+		return 0
+	}
+
+	path := historyPath()
+	e := newEditor(f, c.stdout)
+	e.history = loadHistory(path)
+	e.complete = r.complete
+	e.hint = r.hint
+
+	fd := int(f.Fd())
+	for {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			fmt.Fprintln(c.stderr, err)
+			return 1
+		}
+		line, err := e.ReadLine(r.prompt())
+		term.Restore(fd, state)
+		if err != nil {
+			return 0
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if args, err := SplitArgs(line); err != nil || !isSensitive(args) {
+			e.addHistory(line)
+			appendHistory(path, line)
+		}
+		if !r.line(line) {
+			return 0
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+)
+
+var nextID atomic.Int64
+
+// Client is the state of a single connection.
+// A Client is only used by the goroutine serving its connection, so it is NOT safe for concurrent use;
+// except for the methods that say otherwise, which other clients use (e.g. for CLIENT LIST).
+type Client struct {
+	ID   int64
+	Addr string
+	// LAddr is the address of our end of the connection.
+	LAddr   string
+	Created time.Time
+
+	// Store holds the keys that the client's commands read and write.
+	Store *store.Store
+	// DB is the selected database, there is only database 0.
+	DB int
+
+	// Asking is set by ASKING, it lets the next command use a slot that is being imported into this node.
+	Asking bool
+	// Migrated is set by MIGRATE to the keys that it deleted, so that they are deleted from our replicas too.
+	Migrated []string
+	// ReadOnly is set by READONLY, it lets the client read from cluster replicas.
+	ReadOnly bool
+	// Master is set for the link from our master, its writes are never rejected.
+	Master bool
+	// Replica is set once the connection belongs to one of our replicas.
+	Replica bool
+	// Script is set for the client that runs the commands of a Lua script, it never waits for the script.
+	Script bool
+	// User is the ACL user that the client is authenticated as, if Authenticated.
+	User          string
+	Authenticated bool
+	// Monitor is set by MONITOR, the commands that the server handles are sent to the client.
+	Monitor bool
+	// NoEvict is set by CLIENT NO-EVICT.
+	NoEvict bool
+	// CloseAfterReply is set when the client is killed while running a command, so that it gets the reply first.
+	CloseAfterReply bool
+	reply           ReplyMode
+	// Tracking is set by CLIENT TRACKING ON, see tracking.
+	Tracking bool
+
+	// Sub receives the messages for SUBSCRIBE, it is nil for clients that cannot receive them (e.g. our master).
+	Sub *pubsub.Subscriber
+
+	// mu guards the snapshot of the client that other clients may read.
+	mu    sync.Mutex
+	state state
+	// kill closes the connection, it is nil for clients without one.
+	kill func()
+}
+
+// state is what other clients may know about a client, as of its latest command.
+type state struct {
+	name            string
+	user            string
+	db              int
+	resp            int
+	flags           string
+	lastCommand     string
+	lastInteraction time.Time
+	queryBuffer     int
+	outputBuffer    int
+}
+
+func New(addr string) *Client {
+	now := time.Now()
+	return &Client{
+		ID:      nextID.Add(1),
+		Addr:    addr,
+		Created: now,
+		state:   state{lastInteraction: now, flags: "N", resp: 2},
+	}
+}
+
+// ReplyMode is set by CLIENT REPLY.
+type ReplyMode int
+
+const (
+	ReplyOn ReplyMode = iota
+	ReplyOff
+	// ReplySkip skips the reply of the current command, then ReplySkipNext the reply of the next.
+	ReplySkip
+	ReplySkipNext
+)
+
+// SetReply changes whether replies are sent to the client, from the current command.
+func (c *Client) SetReply(mode ReplyMode) {
+	c.reply = mode
+}
+
+// Replies returns whether the reply of the command that was just handled should be sent.
+// It must be called once per command.
+func (c *Client) Replies() bool {
+	switch c.reply {
+	case ReplyOff:
+		return false
+	case ReplySkip:
+		c.reply = ReplySkipNext
+		return false
+	case ReplySkipNext:
+		c.reply = ReplyOn
+		return false
+	}
+	return true
+}
+
+// Record takes a snapshot of the client before it runs the command, with the sizes of its buffers.
+func (c *Client) Record(command string, queryBuffer, outputBuffer int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.user = c.User
+	c.state.db = c.DB
+	c.state.flags = c.flags()
+	c.state.lastCommand = strings.ToLower(command)
+	c.state.lastInteraction = time.Now()
+	c.state.queryBuffer = queryBuffer
+	c.state.outputBuffer = outputBuffer
+}
+
+func (c *Client) flags() string {
+	flags := ""
+	if c.Master {
+		flags += "M"
+	}
+	if c.Replica {
+		flags += "S"
+	}
+	if c.Monitor {
+		flags += "O"
+	}
+	if c.Sub != nil && c.Sub.Count() > 0 {
+		flags += "P"
+	}
+	if c.ReadOnly {
+		flags += "r"
+	}
+	if c.NoEvict {
+		flags += "e"
+	}
+	if c.Tracking {
+		flags += "t"
+	}
+	if flags == "" {
+		return "N"
+	}
+	return flags
+}
+
+// Name returns the name set by CLIENT SETNAME. It is safe for concurrent use.
+func (c *Client) Name() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state.name
+}
+
+// SetName names the client, or removes its name if it is empty.
+func (c *Client) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.name = name
+}
+
+// Resp returns the protocol version set by HELLO, 2 or 3; only RESP3 clients are sent push messages.
+// It is safe for concurrent use.
+func (c *Client) Resp() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state.resp
+}
+
+// SetResp sets the protocol version of the client.
+func (c *Client) SetResp(resp int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state.resp = resp
+}
+
+// SetKill sets how the connection of the client is closed.
+func (c *Client) SetKill(kill func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kill = kill
+}
+
+// Kill closes the connection of the client, returning false if it has none. It is safe for concurrent use.
+func (c *Client) Kill() bool {
+	c.mu.Lock()
+	kill := c.kill
+	c.mu.Unlock()
+
+	if kill == nil {
+		return false
+	}
+	kill()
+	return true
+}
+
+// Type returns the type of the client, as of its latest command: "normal", "master", "replica" or "pubsub".
+// It is safe for concurrent use.
+func (c *Client) Type() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.typeLocked()
+}
+
+func (c *Client) typeLocked() string {
+	switch {
+	case strings.Contains(c.state.flags, "M"):
+		return "master"
+	case strings.Contains(c.state.flags, "S"):
+		return "replica"
+	case strings.Contains(c.state.flags, "P"):
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// AuthenticatedAs returns the user of the client, as of its latest command. It is safe for concurrent use.
+func (c *Client) AuthenticatedAs() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state.user
+}
+
+// Info describes the client in a line of CLIENT LIST. It is safe for concurrent use.
+func (c *Client) Info(now time.Time) string {
+	c.mu.Lock()
+	st := c.state
+	c.mu.Unlock()
+
+	var sub, psub int64
+	if c.Sub != nil {
+		psub = c.Sub.PatternCount()
+		sub = c.Sub.Count() - psub
+	}
+	user := st.user
+	if user == "" {
+		user = "default"
+	}
+
+	fields := []string{
+		"id=" + strconv.FormatInt(c.ID, 10),
+		"addr=" + c.Addr,
+		"laddr=" + c.LAddr,
+		"name=" + st.name,
+		"age=" + strconv.FormatInt(int64(now.Sub(c.Created).Seconds()), 10),
+		"idle=" + strconv.FormatInt(int64(now.Sub(st.lastInteraction).Seconds()), 10),
+		"flags=" + st.flags,
+		"db=" + strconv.Itoa(st.db),
+		"sub=" + strconv.FormatInt(sub, 10),
+		"psub=" + strconv.FormatInt(psub, 10),
+		"multi=-1",
+		"qbuf=" + strconv.Itoa(st.queryBuffer),
+		"obl=" + strconv.Itoa(st.outputBuffer),
+		"cmd=" + st.lastCommand,
+		"user=" + user,
+		"resp=" + strconv.Itoa(st.resp),
+	}
+	return strings.Join(fields, " ")
+}
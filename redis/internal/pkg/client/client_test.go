@@ -0,0 +1,163 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// newClient registers a client whose kills are counted.
+func newClient(r *Registry, addr string, killed *int) *Client {
+	c := New(addr)
+	c.LAddr = "127.0.0.1:6379"
+	c.SetKill(func() {
+		*killed++
+	})
+	r.Add(c)
+	return c
+}
+
+func TestNames(t *testing.T) {
+	r := NewRegistry()
+	c := New("127.0.0.1:1000")
+
+	reply, _ := r.Command(c, []string{"CLIENT", "GETNAME"})
+	EqualO(t, reply, messages.NewNullBulkString().Serialise())
+	reply, _ = r.Command(c, []string{"client", "setname", "worker-1"})
+	EqualO(t, reply, okReply)
+	reply, _ = r.Command(c, []string{"CLIENT", "GETNAME"})
+	EqualO(t, reply, messages.NewBulkString("worker-1").Serialise())
+	reply, _ = r.Command(c, []string{"CLIENT", "SETNAME", "has space"})
+	IsTrue(t, strings.HasPrefix(reply, "-ERR Client names"), "reply=%q", reply)
+
+	reply, _ = r.Command(c, []string{"CLIENT", "ID"})
+	EqualO(t, reply, messages.NewInteger(c.ID).Serialise())
+
+	_, ok := r.Command(c, []string{"GET", "k"})
+	IsFalse(t, ok, "GET should not be handled")
+}
+
+func TestList(t *testing.T) {
+	r := NewRegistry()
+	killed := 0
+	a := newClient(r, "127.0.0.1:1000", &killed)
+	b := newClient(r, "127.0.0.1:2000", &killed)
+	b.Sub = pubsub.NewSubscriber()
+	pubsub.New().PSubscribe(b.Sub, []string{"news.*"})
+	a.Record("GET", 10, 0)
+	b.Record("PSUBSCRIBE", 0, 0)
+	b.SetName("subscriber")
+
+	IsTrue(t, strings.HasPrefix(a.Info(time.Now()), "id="+strconv.FormatInt(a.ID, 10)+" "), "info=%q", a.Info(time.Now()))
+	info := b.Info(time.Now())
+	for _, field := range []string{"addr=127.0.0.1:2000", "name=subscriber", "flags=P", "sub=0", "psub=1", "cmd=psubscribe"} {
+		IsTrue(t, strings.Contains(info, field), "missing %s in %q", field, info)
+	}
+
+	reply, _ := r.Command(a, []string{"CLIENT", "LIST"})
+	EqualO(t, strings.Count(reply, "id="), 2)
+	reply, _ = r.Command(a, []string{"CLIENT", "LIST", "TYPE", "pubsub"})
+	IsTrue(t, strings.Count(reply, "id=") == 1 && strings.Contains(reply, "name=subscriber"), "reply=%q", reply)
+	reply, _ = r.Command(a, []string{"CLIENT", "LIST", "ID", strconv.FormatInt(a.ID, 10)})
+	IsTrue(t, strings.Count(reply, "id=") == 1 && strings.Contains(reply, "addr=127.0.0.1:1000"), "reply=%q", reply)
+	reply, _ = r.Command(a, []string{"CLIENT", "LIST", "TYPE", "unknown"})
+	IsTrue(t, strings.HasPrefix(reply, "-ERR Unknown client type"), "reply=%q", reply)
+
+	r.Remove(b)
+	EqualO(t, len(r.List()), 1)
+}
+
+func TestKill(t *testing.T) {
+	r := NewRegistry()
+	killed := 0
+	a := newClient(r, "127.0.0.1:1000", &killed)
+	b := newClient(r, "127.0.0.1:2000", &killed)
+	newClient(r, "127.0.0.1:3000", &killed)
+
+	reply, _ := r.Command(a, []string{"CLIENT", "KILL", "127.0.0.1:2000"})
+	EqualO(t, reply, okReply)
+	EqualO(t, killed, 1)
+	reply, _ = r.Command(a, []string{"CLIENT", "KILL", "127.0.0.1:9999"})
+	EqualO(t, reply, messages.GetErrorString("ERR No such client"))
+
+	reply, _ = r.Command(a, []string{"CLIENT", "KILL", "ID", strconv.FormatInt(b.ID, 10)})
+	EqualO(t, reply, messages.NewInteger(1).Serialise())
+	EqualO(t, killed, 2)
+
+	// skips the client running the command by default
+	reply, _ = r.Command(a, []string{"CLIENT", "KILL", "LADDR", "127.0.0.1:6379"})
+	EqualO(t, reply, messages.NewInteger(2).Serialise())
+	EqualO(t, killed, 4)
+	IsFalse(t, a.CloseAfterReply, "should not kill itself")
+
+	reply, _ = r.Command(a, []string{"CLIENT", "KILL", "ADDR", "127.0.0.1:1000", "SKIPME", "no"})
+	EqualO(t, reply, messages.NewInteger(1).Serialise())
+	IsTrue(t, a.CloseAfterReply, "should be closed after the reply")
+	EqualO(t, killed, 4)
+
+	reply, _ = r.Command(a, []string{"CLIENT", "KILL", "ID", "1", "TYPE"})
+	EqualO(t, reply, syntaxErr)
+	reply, _ = r.Command(a, []string{"CLIENT", "KILL", "MAXAGE", "3600"})
+	EqualO(t, reply, messages.NewInteger(0).Serialise())
+}
+
+func TestReply(t *testing.T) {
+	r := NewRegistry()
+	c := New("")
+
+	IsTrue(t, c.Replies(), "replies by default")
+	r.Command(c, []string{"CLIENT", "REPLY", "SKIP"})
+	IsFalse(t, c.Replies(), "SKIP is not replied to")
+	IsFalse(t, c.Replies(), "the command after SKIP is not replied to")
+	IsTrue(t, c.Replies(), "replies after that")
+
+	r.Command(c, []string{"CLIENT", "REPLY", "OFF"})
+	IsFalse(t, c.Replies(), "OFF is not replied to")
+	IsFalse(t, c.Replies(), "no replies while OFF")
+	reply, _ := r.Command(c, []string{"CLIENT", "REPLY", "ON"})
+	EqualO(t, reply, okReply)
+	IsTrue(t, c.Replies(), "ON is replied to")
+}
+
+func TestPause(t *testing.T) {
+	r := NewRegistry()
+	c := New("")
+
+	reply, _ := r.Command(c, []string{"CLIENT", "PAUSE", "10000", "WRITE"})
+	EqualO(t, reply, okReply)
+
+	// reads are not paused
+	r.WaitUnpaused(false)
+
+	done := make(chan struct{})
+	go func() {
+		r.WaitUnpaused(true)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("writes should be paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	r.Command(c, []string{"CLIENT", "UNPAUSE"})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("writes should be unpaused")
+	}
+
+	// pauses end by themselves
+	r.Pause(20*time.Millisecond, true)
+	start := time.Now()
+	r.WaitUnpaused(false)
+	IsTrue(t, time.Since(start) >= 10*time.Millisecond, "should wait for the pause, waited %v", time.Since(start))
+
+	reply, _ = r.Command(c, []string{"CLIENT", "PAUSE", "soon"})
+	EqualO(t, reply, messages.GetErrorString("ERR timeout is not an integer or out of range"))
+}
@@ -0,0 +1,290 @@
+package client
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const ClientCommand = "CLIENT"
+
+var (
+	invalidArgNumErr = messages.GetErrorString("ERR wrong number of arguments for command")
+	syntaxErr        = messages.GetErrorString("ERR syntax error")
+	okReply          = messages.NewSimpleString("OK").Serialise()
+)
+
+// CLIENT subcommand [arguments ...]
+func (r *Registry) Command(c *Client, commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], ClientCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return invalidArgNumErr, true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "ID":
+		return messages.NewInteger(c.ID).Serialise(), true
+	case "GETNAME":
+		if name := c.Name(); name != "" {
+			return messages.NewBulkString(name).Serialise(), true
+		}
+		return messages.NewNullBulkString().Serialise(), true
+	case "SETNAME":
+		if len(args) != 1 {
+			return invalidArgNumErr, true
+		}
+		for _, ch := range args[0] {
+			if ch <= ' ' || ch > '~' {
+				return messages.GetErrorString("ERR Client names cannot contain spaces, newlines or special characters."), true
+			}
+		}
+		c.SetName(args[0])
+		return okReply, true
+	case "INFO":
+		return messages.NewBulkString(c.Info(time.Now()) + "\n").Serialise(), true
+	case "LIST":
+		return r.list(args), true
+	case "KILL":
+		return r.kill(c, args), true
+	case "PAUSE":
+		return r.pause(args), true
+	case "UNPAUSE":
+		r.Unpause()
+		return okReply, true
+	case "NO-EVICT":
+		if len(args) != 1 {
+			return invalidArgNumErr, true
+		}
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			c.NoEvict = true
+		case "OFF":
+			c.NoEvict = false
+		default:
+			return syntaxErr, true
+		}
+		return okReply, true
+	case "REPLY":
+		if len(args) != 1 {
+			return invalidArgNumErr, true
+		}
+		switch strings.ToUpper(args[0]) {
+		case "ON":
+			c.SetReply(ReplyOn)
+		case "OFF":
+			c.SetReply(ReplyOff)
+		case "SKIP":
+			c.SetReply(ReplySkip)
+		default:
+			return syntaxErr, true
+		}
+		// OFF and SKIP are not replied to
+		return okReply, true
+	case "TRACKING", "CACHING", "GETREDIR", "TRACKINGINFO":
+		if r.tracker != nil {
+			return r.tracker.Command(c, commands)
+		}
+	}
+	return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try CLIENT HELP."), true
+}
+
+var clientTypes = []string{"normal", "master", "replica", "pubsub"}
+
+// parseType parses a client type, where "slave" is the old name of "replica".
+func parseType(s string) (string, bool) {
+	s = strings.ToLower(s)
+	if s == "slave" {
+		s = "replica"
+	}
+	for _, t := range clientTypes {
+		if s == t {
+			return t, true
+		}
+	}
+	return "", false
+}
+
+// CLIENT LIST [TYPE type] [ID id [id ...]]
+func (r *Registry) list(args []string) string {
+	clients := r.List()
+	if len(args) > 0 {
+		switch strings.ToUpper(args[0]) {
+		case "TYPE":
+			if len(args) != 2 {
+				return syntaxErr
+			}
+			t, ok := parseType(args[1])
+			if !ok {
+				return messages.GetErrorString("ERR Unknown client type '" + args[1] + "'")
+			}
+			filtered := []*Client{}
+			for _, c := range clients {
+				if c.Type() == t {
+					filtered = append(filtered, c)
+				}
+			}
+			clients = filtered
+		case "ID":
+			if len(args) < 2 {
+				return syntaxErr
+			}
+			clients = []*Client{}
+			for _, arg := range args[1:] {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil || id <= 0 {
+					return messages.GetErrorString("ERR Invalid client ID")
+				}
+				if c := r.Get(id); c != nil {
+					clients = append(clients, c)
+				}
+			}
+		default:
+			return syntaxErr
+		}
+	}
+
+	now := time.Now()
+	var b strings.Builder
+	for _, c := range clients {
+		b.WriteString(c.Info(now) + "\n")
+	}
+	return messages.NewBulkString(b.String()).Serialise()
+}
+
+// killFilter matches the clients to kill, its fields are ignored if they are empty.
+type killFilter struct {
+	id     int64
+	addr   string
+	laddr  string
+	user   string
+	typ    string
+	maxAge time.Duration
+	skipMe bool
+}
+
+func (f killFilter) matches(c, self *Client, now time.Time) bool {
+	switch {
+	case f.skipMe && c == self,
+		f.id != 0 && c.ID != f.id,
+		f.addr != "" && c.Addr != f.addr,
+		f.laddr != "" && c.LAddr != f.laddr,
+		f.user != "" && c.AuthenticatedAs() != f.user,
+		f.typ != "" && c.Type() != f.typ,
+		f.maxAge != 0 && now.Sub(c.Created) < f.maxAge:
+		return false
+	}
+	return true
+}
+
+// CLIENT KILL addr
+// CLIENT KILL [ID id] [ADDR addr] [LADDR laddr] [USER user] [TYPE type] [SKIPME yes/no] [MAXAGE seconds]
+func (r *Registry) kill(self *Client, args []string) string {
+	if len(args) == 0 {
+		return invalidArgNumErr
+	}
+
+	if len(args) == 1 {
+		// the old form kills a single client by address, even the one running it
+		for _, c := range r.List() {
+			if c.Addr == args[0] {
+				r.killClient(c, self)
+				return okReply
+			}
+		}
+		return messages.GetErrorString("ERR No such client")
+	}
+
+	if len(args)%2 != 0 {
+		return syntaxErr
+	}
+	f := killFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1]
+		switch strings.ToUpper(args[i]) {
+		case "ID":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return messages.GetErrorString("ERR client-id should be greater than 0")
+			}
+			f.id = id
+		case "ADDR":
+			f.addr = value
+		case "LADDR":
+			f.laddr = value
+		case "USER":
+			f.user = value
+		case "TYPE":
+			t, ok := parseType(value)
+			if !ok {
+				return messages.GetErrorString("ERR Unknown client type '" + value + "'")
+			}
+			f.typ = t
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				f.skipMe = true
+			case "no":
+				f.skipMe = false
+			default:
+				return syntaxErr
+			}
+		case "MAXAGE":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds < 0 {
+				return syntaxErr
+			}
+			f.maxAge = time.Duration(seconds) * time.Second
+		default:
+			return syntaxErr
+		}
+	}
+
+	now := time.Now()
+	killed := int64(0)
+	for _, c := range r.List() {
+		if f.matches(c, self, now) && r.killClient(c, self) {
+			killed++
+		}
+	}
+	return messages.NewInteger(killed).Serialise()
+}
+
+// killClient kills the client, or closes it after the reply if it is the one running the command.
+func (r *Registry) killClient(c, self *Client) bool {
+	if c == self {
+		c.CloseAfterReply = true
+		return true
+	}
+	return c.Kill()
+}
+
+// CLIENT PAUSE timeout [WRITE | ALL]
+func (r *Registry) pause(args []string) string {
+	if len(args) < 1 || len(args) > 2 {
+		return invalidArgNumErr
+	}
+
+	ms, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || ms < 0 {
+		return messages.GetErrorString("ERR timeout is not an integer or out of range")
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "WRITE":
+			all = false
+		case "ALL":
+		default:
+			return syntaxErr
+		}
+	}
+
+	r.Pause(time.Duration(ms)*time.Millisecond, all)
+	return okReply
+}
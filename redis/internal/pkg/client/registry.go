@@ -0,0 +1,130 @@
+package client
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Registry keeps track of the connected clients, and whether they are paused. To construct one, use `NewRegistry`.
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[int64]*Client
+
+	pauseMu sync.Mutex
+	// pausedUntil is when the pause ends, it is in the past if the clients are not paused.
+	pausedUntil time.Time
+	// pauseAll is set if all commands are paused, rather than only writes.
+	pauseAll bool
+	// pauseChanged is closed (and replaced) when the pause changes, to wake up the paused clients.
+	pauseChanged chan struct{}
+
+	// tracker handles the subcommands of CLIENT for client-side caching, it is nil unless clients can track keys.
+	tracker Tracker
+}
+
+// Tracker handles the subcommands of CLIENT for client-side caching (e.g. TRACKING), see tracking.
+type Tracker interface {
+	Command(c *Client, commands []string) (string, bool)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		clients:      make(map[int64]*Client),
+		pauseChanged: make(chan struct{}),
+	}
+}
+
+// SetTracking lets clients track the keys that they cache, with CLIENT TRACKING.
+func (r *Registry) SetTracking(t Tracker) {
+	r.tracker = t
+}
+
+// Add registers the client, until it is removed when it disconnects.
+func (r *Registry) Add(c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clients[c.ID] = c
+}
+
+func (r *Registry) Remove(c *Client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.clients, c.ID)
+}
+
+// Get returns the client with the ID, or nil if there is none.
+func (r *Registry) Get(id int64) *Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.clients[id]
+}
+
+// List returns the clients, in the order that they connected.
+func (r *Registry) List() []*Client {
+	r.mu.RLock()
+	ret := make([]*Client, 0, len(r.clients))
+	for _, c := range r.clients {
+		ret = append(ret, c)
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(ret, func(a, b *Client) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return ret
+}
+
+// Pause pauses the commands of clients (or only their writes, unless all is set) for d.
+// Like redis, an existing pause is only extended, and a pause of all commands is not weakened to writes.
+func (r *Registry) Pause(d time.Duration, all bool) {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+
+	now := time.Now()
+	if until := now.Add(d); until.After(r.pausedUntil) {
+		r.pausedUntil = until
+	}
+	r.pauseAll = all || (r.pauseAll && now.Before(r.pausedUntil))
+	r.notifyPause()
+}
+
+// Unpause resumes the paused clients.
+func (r *Registry) Unpause() {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+
+	r.pausedUntil = time.Time{}
+	r.pauseAll = false
+	r.notifyPause()
+}
+
+// notifyPause must be called with pauseMu held.
+func (r *Registry) notifyPause() {
+	close(r.pauseChanged)
+	r.pauseChanged = make(chan struct{})
+}
+
+// WaitUnpaused blocks while the command (a write, if write is set) is paused.
+func (r *Registry) WaitUnpaused(write bool) {
+	for {
+		r.pauseMu.Lock()
+		until, changed := r.pausedUntil, r.pauseChanged
+		paused := time.Now().Before(until) && (write || r.pauseAll)
+		r.pauseMu.Unlock()
+		if !paused {
+			return
+		}
+
+		t := time.NewTimer(time.Until(until))
+		select {
+		case <-t.C:
+		case <-changed:
+		}
+		t.Stop()
+	}
+}
@@ -0,0 +1,63 @@
+// Package clock tells the time of a store, so that tests (and embedded servers) can move it.
+package clock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type system struct{}
+
+func (system) Now() time.Time {
+	return time.Now()
+}
+
+// Real returns the system clock.
+func Real() Clock {
+	return system{}
+}
+
+// Fake is a clock that only moves when it is told to. It is safe for concurrent use.
+type Fake struct {
+	// now is in unix nanoseconds.
+	now atomic.Int64
+}
+
+func NewFake(now time.Time) *Fake {
+	ret := &Fake{}
+	ret.now.Store(now.UnixNano())
+	return ret
+}
+
+func (f *Fake) Now() time.Time {
+	return time.Unix(0, f.now.Load())
+}
+
+// Add moves the clock forward by d.
+func (f *Fake) Add(d time.Duration) {
+	f.now.Add(int64(d))
+}
+
+// Set moves the clock to now.
+func (f *Fake) Set(now time.Time) {
+	f.now.Store(now.UnixNano())
+}
+
+// Offset is the system clock, moved forward by Add. The zero value is ready to use, and it is safe for concurrent use.
+type Offset struct {
+	offset atomic.Int64
+}
+
+func (o *Offset) Now() time.Time {
+	return time.Now().Add(time.Duration(o.offset.Load()))
+}
+
+// Add moves the clock forward by d.
+func (o *Offset) Add(d time.Duration) {
+	o.offset.Add(int64(d))
+}
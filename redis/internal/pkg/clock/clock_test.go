@@ -0,0 +1,28 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFake(start)
+	IsTrue(t, f.Now().Equal(start), "now=%v", f.Now())
+
+	f.Add(time.Minute)
+	IsTrue(t, f.Now().Equal(start.Add(time.Minute)), "now=%v", f.Now())
+
+	f.Set(start)
+	IsTrue(t, f.Now().Equal(start), "now=%v", f.Now())
+}
+
+func TestOffset(t *testing.T) {
+	o := &Offset{}
+	IsTrue(t, time.Since(o.Now()) < time.Second, "now=%v", o.Now())
+
+	o.Add(time.Hour)
+	IsTrue(t, time.Until(o.Now()) > 59*time.Minute, "now=%v", o.Now())
+}
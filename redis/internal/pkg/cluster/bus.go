@@ -0,0 +1,407 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The cluster bus is a TCP connection between every pair of nodes.
+// Unlike redis, messages are JSON encoded: we do not need to be compatible with other implementations.
+
+const (
+	// how often the cron runs
+	cronInterval = 100 * time.Millisecond
+	// how often each node is pinged
+	pingInterval = time.Second
+	// nodes that do not reply within nodeTimeout are flagged as failing, and handshakes that do not complete are dropped
+	nodeTimeout    = 15 * time.Second
+	busDialTimeout = time.Second
+)
+
+type messageType string
+
+const (
+	// meet is sent to nodes in handshake, it asks them to add us to their cluster.
+	meet messageType = "meet"
+	ping messageType = "ping"
+	pong messageType = "pong"
+)
+
+// nodeInfo is what a node says about itself, or about other nodes (gossip).
+type nodeInfo struct {
+	ID          string `json:"id"`
+	IP          string `json:"ip"`
+	Port        int    `json:"port"`
+	BusPort     int    `json:"bus_port"`
+	ConfigEpoch uint64 `json:"config_epoch,omitempty"`
+	// Slots is only set for the sender, as inclusive ranges.
+	Slots [][2]int `json:"slots,omitempty"`
+}
+
+type message struct {
+	Type         messageType `json:"type"`
+	CurrentEpoch uint64      `json:"current_epoch"`
+	Sender       nodeInfo    `json:"sender"`
+	Gossip       []nodeInfo  `json:"gossip,omitempty"`
+}
+
+// link is a connection on the cluster bus.
+type link struct {
+	conn net.Conn
+
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newLink(conn net.Conn) *link {
+	return &link{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+	}
+}
+
+func (l *link) send(msg message) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conn.SetWriteDeadline(time.Now().Add(busDialTimeout))
+	return l.enc.Encode(msg)
+}
+
+func (l *link) close() {
+	l.conn.Close()
+}
+
+// acceptLoop accepts connections from other nodes, these are only used to reply to their pings.
+func (c *Cluster) acceptLoop() {
+	defer c.wg.Done()
+
+	for {
+		conn, err := c.bus.Accept()
+		if err != nil {
+			return
+		}
+
+		l := newLink(conn)
+		c.mu.Lock()
+		c.inbound[l] = struct{}{}
+		c.mu.Unlock()
+
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			c.readLoop(l, nil)
+
+			c.mu.Lock()
+			delete(c.inbound, l)
+			c.mu.Unlock()
+			l.close()
+		}()
+	}
+}
+
+// readLoop processes messages from the link until it breaks.
+// n is the node we dialled, nil for inbound links.
+func (c *Cluster) readLoop(l *link, n *Node) {
+	dec := json.NewDecoder(l.conn)
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+
+		if reply, ok := c.process(msg, n); ok {
+			if err := l.send(reply); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// cron maintains links to the other nodes, and pings them.
+func (c *Cluster) cron() {
+	defer c.wg.Done()
+
+	t := time.NewTicker(cronInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-c.ctx.Done():
+			return
+		}
+
+		now := time.Now()
+
+		c.mu.Lock()
+		var toDial []*Node
+		for id, n := range c.nodes {
+			if n == c.myself {
+				continue
+			}
+			if n.handshake && now.Sub(n.createdAt) > nodeTimeout {
+				log.Warn().Str("addr", n.addr()).Msg("cluster handshake timed out")
+				if n.link != nil {
+					n.link.close()
+				}
+				delete(c.nodes, id)
+				continue
+			}
+			if n.link == nil {
+				toDial = append(toDial, n)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, n := range toDial {
+			c.dial(n)
+		}
+
+		c.mu.Lock()
+		type pending struct {
+			l   *link
+			msg message
+		}
+		var pings []pending
+		for _, n := range c.nodes {
+			if n == c.myself || n.link == nil {
+				continue
+			}
+			waiting := n.pingSent.After(n.pongReceived)
+			if waiting && now.Sub(n.pingSent) > nodeTimeout/2 {
+				// the link may be broken without us noticing, reconnect
+				n.link.close()
+				n.link = nil
+				continue
+			}
+			if waiting || now.Sub(n.pingSent) < pingInterval {
+				continue
+			}
+			t := ping
+			if n.handshake {
+				t = meet
+			}
+			n.pingSent = now
+			pings = append(pings, pending{n.link, c.message(t)})
+		}
+		c.mu.Unlock()
+
+		for _, p := range pings {
+			if err := p.l.send(p.msg); err != nil {
+				p.l.close()
+			}
+		}
+	}
+}
+
+// dial connects to the node's bus.
+func (c *Cluster) dial(n *Node) {
+	c.mu.Lock()
+	addr := n.busAddr()
+	c.mu.Unlock()
+
+	conn, err := net.DialTimeout("tcp", addr, busDialTimeout)
+	if err != nil {
+		log.Debug().Err(err).Str("addr", addr).Msg("dialling cluster node")
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.ctx.Done():
+		conn.Close()
+		return
+	default:
+	}
+	if c.nodes[n.ID] != n || n.link != nil {
+		// forgotten, or already connected
+		conn.Close()
+		return
+	}
+
+	l := newLink(conn)
+	n.link = l
+	// the next cron pings right away
+	n.pingSent = time.Time{}
+	n.pongReceived = time.Time{}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.readLoop(l, n)
+
+		c.mu.Lock()
+		if n.link == l {
+			n.link = nil
+		}
+		c.mu.Unlock()
+		l.close()
+	}()
+}
+
+// info describes the node, must be called with c.mu held.
+func (c *Cluster) info(n *Node) nodeInfo {
+	return nodeInfo{
+		ID:          n.ID,
+		IP:          n.IP,
+		Port:        n.Port,
+		BusPort:     n.BusPort,
+		ConfigEpoch: n.ConfigEpoch,
+	}
+}
+
+// message builds a message from us, must be called with c.mu held.
+func (c *Cluster) message(t messageType) message {
+	sender := c.info(c.myself)
+	for _, r := range ranges(&c.slots, c.myself) {
+		sender.Slots = append(sender.Slots, [2]int{r.start, r.end})
+	}
+
+	var gossip []nodeInfo
+	for _, n := range c.nodes {
+		if n == c.myself || n.handshake {
+			continue
+		}
+		gossip = append(gossip, c.info(n))
+	}
+
+	return message{
+		Type:         t,
+		CurrentEpoch: c.currentEpoch,
+		Sender:       sender,
+		Gossip:       gossip,
+	}
+}
+
+// process handles a message, returning the reply if there is one.
+// n is the node we dialled, if the message came from a link we dialled.
+func (c *Cluster) process(msg message, n *Node) (message, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if msg.Type == pong && n != nil {
+		if c.nodes[n.ID] != n {
+			// forgotten
+			return message{}, false
+		}
+		if n.handshake {
+			if _, ok := c.nodes[msg.Sender.ID]; ok || msg.Sender.ID == c.myself.ID {
+				// we already know this node
+				delete(c.nodes, n.ID)
+				if n.link != nil {
+					n.link.close()
+					n.link = nil
+				}
+				return message{}, false
+			}
+			delete(c.nodes, n.ID)
+			n.ID = msg.Sender.ID
+			n.handshake = false
+			c.nodes[n.ID] = n
+			log.Info().Str("id", n.ID).Str("addr", n.addr()).Msg("cluster handshake completed")
+		}
+		n.pongReceived = now
+	}
+
+	sender, known := c.nodes[msg.Sender.ID]
+	if !known && msg.Type == meet && msg.Sender.ID != c.myself.ID {
+		sender = &Node{
+			ID:        msg.Sender.ID,
+			IP:        msg.Sender.IP,
+			Port:      msg.Sender.Port,
+			BusPort:   msg.Sender.BusPort,
+			createdAt: now,
+		}
+		c.nodes[sender.ID] = sender
+		known = true
+		log.Info().Str("id", sender.ID).Str("addr", sender.addr()).Msg("met cluster node")
+	}
+
+	if known && !sender.handshake && sender != c.myself {
+		c.update(sender, msg)
+	}
+
+	if msg.Type == pong {
+		return message{}, false
+	}
+	// pings from nodes we do not know are replied to anyway, so that their handshake completes
+	return c.message(pong), true
+}
+
+// update applies what the sender said about itself and others, must be called with c.mu held.
+func (c *Cluster) update(sender *Node, msg message) {
+	if msg.CurrentEpoch > c.currentEpoch {
+		c.currentEpoch = msg.CurrentEpoch
+	}
+	if msg.Sender.ConfigEpoch > c.currentEpoch {
+		c.currentEpoch = msg.Sender.ConfigEpoch
+	}
+	sender.ConfigEpoch = msg.Sender.ConfigEpoch
+
+	// slots go to the claim with the greatest config epoch
+	for _, r := range msg.Sender.Slots {
+		for slot := max(r[0], 0); slot <= min(r[1], SlotCount-1); slot++ {
+			owner := c.slots[slot]
+			if owner == sender {
+				continue
+			}
+			if owner == nil || owner.ConfigEpoch < sender.ConfigEpoch {
+				if owner == c.myself {
+					log.Info().Int("slot", slot).Str("id", sender.ID).Msg("lost hash slot")
+					c.migrating[slot] = nil
+				}
+				if c.importing[slot] == sender {
+					// importing was finished on the other side, without telling us
+					c.importing[slot] = nil
+				}
+				c.slots[slot] = sender
+			}
+		}
+	}
+
+	// two masters with the same config epoch cannot tell whose claim wins, so the smaller ID moves on
+	if sender.ConfigEpoch == c.myself.ConfigEpoch && c.myself.ID < sender.ID {
+		c.bumpEpoch()
+	}
+
+	for _, g := range msg.Gossip {
+		if g.ID == c.myself.ID {
+			continue
+		}
+		if _, ok := c.nodes[g.ID]; ok {
+			continue
+		}
+		c.startHandshake(g.IP, g.Port, g.BusPort)
+	}
+}
+
+// startHandshake adds a node that we have yet to meet, must be called with c.mu held.
+// It returns false if we are already meeting the node.
+func (c *Cluster) startHandshake(ip string, port int, busPort int) bool {
+	for _, n := range c.nodes {
+		if n.handshake && n.IP == ip && n.Port == port && n.BusPort == busPort {
+			return false
+		}
+	}
+
+	n := &Node{
+		// replaced by the real ID once the node replies
+		ID:        newNodeID(),
+		IP:        ip,
+		Port:      port,
+		BusPort:   busPort,
+		handshake: true,
+		createdAt: time.Now(),
+	}
+	c.nodes[n.ID] = n
+	return true
+}
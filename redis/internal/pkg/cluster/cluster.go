@@ -0,0 +1,258 @@
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/operate/oss_and_stack/reference/cluster-spec/
+
+// Store is the part of the store that the cluster needs.
+type Store interface {
+	Exists(key string) bool
+	// Keys returns all keys that have not expired.
+	Keys() []string
+}
+
+// Node is a node in the cluster, as seen by this node.
+type Node struct {
+	ID          string
+	IP          string
+	Port        int
+	BusPort     int
+	ConfigEpoch uint64
+
+	// handshake nodes have been met, but have not replied yet, so their ID is made up.
+	handshake    bool
+	createdAt    time.Time
+	pingSent     time.Time
+	pongReceived time.Time
+	link         *link
+}
+
+func (n *Node) addr() string {
+	return net.JoinHostPort(n.IP, strconv.Itoa(n.Port))
+}
+
+func (n *Node) busAddr() string {
+	return net.JoinHostPort(n.IP, strconv.Itoa(n.BusPort))
+}
+
+// failing returns whether the node has not replied to a ping for too long.
+func (n *Node) failing(now time.Time) bool {
+	return !n.pingSent.IsZero() && n.pingSent.After(n.pongReceived) && now.Sub(n.pingSent) > nodeTimeout
+}
+
+// Cluster is the cluster state of a single server.
+type Cluster struct {
+	mu sync.Mutex
+
+	myself *Node
+	// nodes includes myself, and nodes that are still in handshake.
+	nodes map[string]*Node
+
+	slots     [SlotCount]*Node
+	importing [SlotCount]*Node
+	migrating [SlotCount]*Node
+
+	currentEpoch uint64
+
+	store Store
+
+	bus net.Listener
+	// inbound are the links other nodes dialled.
+	inbound map[*link]struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func newNodeID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// New starts a cluster node, with its cluster bus listening on busAddr.
+// addr is the address clients use to reach this node.
+func New(addr string, busAddr string, store Store) (*Cluster, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		// other nodes need an address they can reach
+		host = "127.0.0.1"
+	}
+
+	bus, err := net.Listen("tcp", busAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	myself := &Node{
+		ID:        newNodeID(),
+		IP:        host,
+		Port:      port,
+		BusPort:   bus.Addr().(*net.TCPAddr).Port,
+		createdAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{
+		mu:      sync.Mutex{},
+		myself:  myself,
+		nodes:   map[string]*Node{myself.ID: myself},
+		store:   store,
+		bus:     bus,
+		inbound: make(map[*link]struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+		wg:      sync.WaitGroup{},
+	}
+
+	c.wg.Add(2)
+	go c.acceptLoop()
+	go c.cron()
+
+	log.Info().Str("id", myself.ID).Str("bus", bus.Addr().String()).Msg("cluster mode enabled")
+
+	return c, nil
+}
+
+// Close stops the cluster bus.
+func (c *Cluster) Close() {
+	c.cancel()
+	c.bus.Close()
+
+	c.mu.Lock()
+	for _, n := range c.nodes {
+		if n.link != nil {
+			n.link.close()
+		}
+	}
+	for l := range c.inbound {
+		l.close()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+}
+
+// MyID returns the ID of this node.
+func (c *Cluster) MyID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.myself.ID
+}
+
+func movedErr(slot int, n *Node) string {
+	return messages.GetErrorString(fmt.Sprintf("MOVED %d %s", slot, n.addr()))
+}
+
+func askErr(slot int, n *Node) string {
+	return messages.GetErrorString(fmt.Sprintf("ASK %d %s", slot, n.addr()))
+}
+
+var (
+	crossSlotErr   = messages.GetErrorString("CROSSSLOT Keys in request don't hash to the same slot")
+	clusterDownErr = messages.GetErrorString("CLUSTERDOWN Hash slot not served")
+	tryAgainErr    = messages.GetErrorString("TRYAGAIN Multiple keys request during rehashing of slot")
+)
+
+// Redirect checks whether this node serves the keys of a command.
+// If it does not, it returns the error that redirects the client (e.g. MOVED), and true.
+// asking is whether the client sent ASKING just before this command.
+func (c *Cluster) Redirect(keys []string, asking bool) (string, bool) {
+	if len(keys) == 0 {
+		return "", false
+	}
+
+	slot := KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if KeySlot(key) != slot {
+			return crossSlotErr, true
+		}
+	}
+
+	c.mu.Lock()
+	owner := c.slots[slot]
+	migrating := c.migrating[slot]
+	importing := c.importing[slot]
+	myself := c.myself
+	c.mu.Unlock()
+
+	if owner == nil {
+		return clusterDownErr, true
+	}
+
+	if owner == myself {
+		if migrating == nil {
+			return "", false
+		}
+		// keys that are gone have already been migrated
+		missing := 0
+		for _, key := range keys {
+			if !c.store.Exists(key) {
+				missing++
+			}
+		}
+		switch {
+		case missing == 0:
+			return "", false
+		case missing == len(keys):
+			return askErr(slot, migrating), true
+		default:
+			return tryAgainErr, true
+		}
+	}
+
+	if importing != nil && asking {
+		return "", false
+	}
+
+	return movedErr(slot, owner), true
+}
+
+// setSlot assigns the slot to the node, must be called with c.mu held.
+func (c *Cluster) setSlot(slot int, n *Node) {
+	c.slots[slot] = n
+}
+
+// bumpEpoch gives myself a new config epoch, greater than every other, so that my slot claims win.
+// Must be called with c.mu held.
+func (c *Cluster) bumpEpoch() {
+	c.currentEpoch++
+	c.myself.ConfigEpoch = c.currentEpoch
+}
+
+// keysInSlot returns up to count keys in the slot (all of them if count is negative), it is O(n) in the number of keys.
+func (c *Cluster) keysInSlot(slot int, count int) []string {
+	ret := []string{}
+	for _, key := range c.store.Keys() {
+		if count >= 0 && len(ret) >= count {
+			break
+		}
+		if KeySlot(key) == slot {
+			ret = append(ret, key)
+		}
+	}
+	return ret
+}
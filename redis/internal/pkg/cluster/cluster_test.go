@@ -0,0 +1,222 @@
+package cluster
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+type fakeStore struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func (f *fakeStore) Exists(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, ok := f.keys[key]
+	return ok
+}
+
+func (f *fakeStore) Keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ret := []string{}
+	for k := range f.keys {
+		ret = append(ret, k)
+	}
+	return ret
+}
+
+func (f *fakeStore) set(keys ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, k := range keys {
+		f.keys[k] = struct{}{}
+	}
+}
+
+func newCluster(t *testing.T, port int) (*Cluster, *fakeStore) {
+	f := &fakeStore{keys: map[string]struct{}{}}
+	c, err := New("127.0.0.1:"+strconv.Itoa(port), "localhost:0", f)
+	NoError(t, err)
+	t.Cleanup(c.Close)
+	return c, f
+}
+
+func command(c *Cluster, args ...string) string {
+	ret, _ := c.Command(append([]string{"CLUSTER"}, args...))
+	return ret
+}
+
+// waitFor polls until f is true, failing the test after the timeout.
+func waitFor(t *testing.T, msg string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	c, f := newCluster(t, 7000)
+	ok := messages.NewSimpleString("OK").Serialise()
+
+	// slots are not served until they are assigned
+	ret, redirected := c.Redirect([]string{"foo"}, false)
+	IsTrue(t, redirected, "")
+	EqualO(t, ret, clusterDownErr)
+
+	EqualO(t, command(c, "ADDSLOTSRANGE", "0", strconv.Itoa(SlotCount-1)), ok)
+	_, redirected = c.Redirect([]string{"foo"}, false)
+	IsFalse(t, redirected, "")
+	_, redirected = c.Redirect(nil, false)
+	IsFalse(t, redirected, "")
+
+	ret, redirected = c.Redirect([]string{"foo", "bar"}, false)
+	IsTrue(t, redirected, "")
+	EqualO(t, ret, crossSlotErr)
+	_, redirected = c.Redirect([]string{"{user}.a", "{user}.b"}, false)
+	IsFalse(t, redirected, "")
+
+	// another node owns the slot
+	other := &Node{ID: strings.Repeat("b", 40), IP: "127.0.0.1", Port: 7001, BusPort: 17001}
+	c.mu.Lock()
+	c.nodes[other.ID] = other
+	c.mu.Unlock()
+
+	slot := strconv.Itoa(KeySlot("foo"))
+	f.set("foo")
+	EqualO(t, command(c, "SETSLOT", slot, "NODE", other.ID), messages.GetErrorString("ERR Can't assign hashslot 12182 to a different node while I still hold keys for this hash slot."))
+
+	// migrating: keys that are still here are served, the rest are asked for elsewhere
+	EqualO(t, command(c, "SETSLOT", slot, "MIGRATING", other.ID), ok)
+	_, redirected = c.Redirect([]string{"foo"}, false)
+	IsFalse(t, redirected, "")
+	ret, redirected = c.Redirect([]string{"{foo}.missing"}, false)
+	IsTrue(t, redirected, "")
+	EqualO(t, ret, messages.GetErrorString("ASK 12182 127.0.0.1:7001"))
+	ret, _ = c.Redirect([]string{"foo", "{foo}.missing"}, false)
+	EqualO(t, ret, tryAgainErr)
+
+	EqualO(t, command(c, "SETSLOT", slot, "STABLE"), ok)
+	f.mu.Lock()
+	delete(f.keys, "foo")
+	f.mu.Unlock()
+	EqualO(t, command(c, "SETSLOT", slot, "NODE", other.ID), ok)
+
+	ret, redirected = c.Redirect([]string{"foo"}, false)
+	IsTrue(t, redirected, "")
+	EqualO(t, ret, messages.GetErrorString("MOVED 12182 127.0.0.1:7001"))
+
+	// importing: only clients that sent ASKING are served
+	EqualO(t, command(c, "SETSLOT", slot, "IMPORTING", other.ID), ok)
+	_, redirected = c.Redirect([]string{"foo"}, false)
+	IsTrue(t, redirected, "")
+	_, redirected = c.Redirect([]string{"foo"}, true)
+	IsFalse(t, redirected, "")
+
+	// finishing the import claims the slot with a new epoch
+	epoch := c.myself.ConfigEpoch
+	EqualO(t, command(c, "SETSLOT", slot, "NODE", c.MyID()), ok)
+	IsTrue(t, c.myself.ConfigEpoch > epoch, "epoch should be bumped")
+	_, redirected = c.Redirect([]string{"foo"}, false)
+	IsFalse(t, redirected, "")
+}
+
+func TestCommand(t *testing.T) {
+	c, f := newCluster(t, 7000)
+	f.set("a{x}", "b{x}", "c")
+
+	EqualO(t, command(c, "KEYSLOT", "foo"), messages.NewInteger(12182).Serialise())
+	EqualO(t, command(c, "COUNTKEYSINSLOT", strconv.Itoa(KeySlot("x"))), messages.NewInteger(2).Serialise())
+	keys := command(c, "GETKEYSINSLOT", strconv.Itoa(KeySlot("x")), "1")
+	IsTrue(t, keys == messages.NewArrayBulkString([]string{"a{x}"}).Serialise() || keys == messages.NewArrayBulkString([]string{"b{x}"}).Serialise(), "%q", keys)
+	EqualO(t, command(c, "COUNTKEYSINSLOT", "16384"), invalidSlotErr)
+	EqualO(t, command(c, "MYID"), messages.NewBulkString(c.MyID()).Serialise())
+
+	EqualO(t, command(c, "ADDSLOTS", "0", "1", "2", "5"), messages.NewSimpleString("OK").Serialise())
+	EqualO(t, command(c, "ADDSLOTS", "5"), messages.GetErrorString("ERR Slot 5 is already busy"))
+	EqualO(t, command(c, "DELSLOTS", "6"), messages.GetErrorString("ERR Slot 6 is already unassigned"))
+
+	EqualO(t, command(c, "SLOTS"), messages.NewArray([]messages.Message{
+		messages.NewArray([]messages.Message{
+			messages.NewInteger(0), messages.NewInteger(2),
+			messages.NewArray([]messages.Message{messages.NewBulkString("127.0.0.1"), messages.NewInteger(7000), messages.NewBulkString(c.MyID())}),
+		}),
+		messages.NewArray([]messages.Message{
+			messages.NewInteger(5), messages.NewInteger(5),
+			messages.NewArray([]messages.Message{messages.NewBulkString("127.0.0.1"), messages.NewInteger(7000), messages.NewBulkString(c.MyID())}),
+		}),
+	}).Serialise())
+
+	nodes := command(c, "NODES")
+	IsTrue(t, strings.Contains(nodes, c.MyID()+" 127.0.0.1:7000@"), "%q", nodes)
+	IsTrue(t, strings.Contains(nodes, " myself,master - 0 0 0 connected 0-2 5\n"), "%q", nodes)
+
+	info := command(c, "INFO")
+	IsTrue(t, strings.Contains(info, "cluster_state:fail\r\n"), "%q", info)
+	IsTrue(t, strings.Contains(info, "cluster_slots_assigned:4\r\n"), "%q", info)
+
+	IsTrue(t, strings.HasPrefix(command(c, "NOPE"), "-ERR unknown subcommand"), "")
+}
+
+func TestBus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping cluster bus")
+	}
+
+	a, _ := newCluster(t, 7000)
+	b, _ := newCluster(t, 7001)
+	c, _ := newCluster(t, 7002)
+	all := []*Cluster{a, b, c}
+
+	third := SlotCount / 3
+	command(a, "ADDSLOTSRANGE", "0", strconv.Itoa(third-1))
+	command(b, "ADDSLOTSRANGE", strconv.Itoa(third), strconv.Itoa(2*third-1))
+	command(c, "ADDSLOTSRANGE", strconv.Itoa(2*third), strconv.Itoa(SlotCount-1))
+
+	// a meets b, and b meets c; a learns about c through gossip
+	command(a, "MEET", "127.0.0.1", "7001", strconv.Itoa(b.myself.BusPort))
+	command(b, "MEET", "127.0.0.1", "7002", strconv.Itoa(c.myself.BusPort))
+
+	for _, n := range all {
+		waitFor(t, "cluster to converge", func() bool {
+			return strings.Contains(command(n, "INFO"), "cluster_state:ok\r\ncluster_slots_assigned:16384\r\ncluster_slots_ok:16384\r\ncluster_slots_pfail:0\r\ncluster_slots_fail:0\r\ncluster_known_nodes:3\r\n")
+		})
+	}
+
+	// every node has the same view of the slots
+	slots := command(a, "SLOTS")
+	EqualO(t, command(b, "SLOTS"), slots)
+	EqualO(t, command(c, "SLOTS"), slots)
+
+	ret, _ := a.Redirect([]string{"foo"}, false)
+	EqualO(t, ret, messages.GetErrorString("MOVED 12182 127.0.0.1:7002"))
+
+	// moving a slot from c to a
+	slot := strconv.Itoa(KeySlot("foo"))
+	command(a, "SETSLOT", slot, "IMPORTING", c.MyID())
+	command(c, "SETSLOT", slot, "MIGRATING", a.MyID())
+	command(a, "SETSLOT", slot, "NODE", a.MyID())
+	command(c, "SETSLOT", slot, "NODE", a.MyID())
+
+	for _, n := range all {
+		waitFor(t, "slot to move", func() bool {
+			ret, _ := n.Redirect([]string{"foo"}, false)
+			return n == a && ret == "" || ret == messages.GetErrorString("MOVED 12182 127.0.0.1:7000")
+		})
+	}
+}
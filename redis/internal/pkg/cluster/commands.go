@@ -0,0 +1,464 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+var (
+	invalidArgsErr = messages.GetErrorString("ERR wrong number of arguments for command")
+	invalidSlotErr = messages.GetErrorString("ERR Invalid or out of range slot")
+	okReply        = messages.NewSimpleString("OK").Serialise()
+)
+
+func unknownNodeErr(id string) string {
+	return messages.GetErrorString("ERR I don't know about node " + id)
+}
+
+func parseSlot(s string) (int, bool) {
+	slot, err := strconv.Atoi(s)
+	if err != nil || slot < 0 || slot >= SlotCount {
+		return 0, false
+	}
+	return slot, true
+}
+
+// Command handles CLUSTER.
+func (c *Cluster) Command(commands []string) (string, bool) {
+	if len(commands) < 2 {
+		return invalidArgsErr, true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "MYID":
+		return messages.NewBulkString(c.MyID()).Serialise(), true
+	case "KEYSLOT":
+		if len(args) != 1 {
+			return invalidArgsErr, true
+		}
+		return messages.NewInteger(int64(KeySlot(args[0]))).Serialise(), true
+	case "COUNTKEYSINSLOT":
+		if len(args) != 1 {
+			return invalidArgsErr, true
+		}
+		slot, ok := parseSlot(args[0])
+		if !ok {
+			return invalidSlotErr, true
+		}
+		return messages.NewInteger(int64(len(c.keysInSlot(slot, -1)))).Serialise(), true
+	case "GETKEYSINSLOT":
+		if len(args) != 2 {
+			return invalidArgsErr, true
+		}
+		slot, ok := parseSlot(args[0])
+		if !ok {
+			return invalidSlotErr, true
+		}
+		count, err := strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return messages.GetErrorString("ERR Invalid number of keys"), true
+		}
+		return messages.NewArrayBulkString(c.keysInSlot(slot, count)).Serialise(), true
+	case "SLOTS":
+		return c.slotsCommand(), true
+	case "SHARDS":
+		return c.shardsCommand(), true
+	case "NODES":
+		return messages.NewBulkString(c.nodesCommand()).Serialise(), true
+	case "INFO":
+		return messages.NewBulkString(c.infoCommand()).Serialise(), true
+	case "MEET":
+		return c.meet(args), true
+	case "ADDSLOTS":
+		return c.addSlots(args, false), true
+	case "ADDSLOTSRANGE":
+		return c.addSlots(args, true), true
+	case "DELSLOTS":
+		return c.delSlots(args, false), true
+	case "DELSLOTSRANGE":
+		return c.delSlots(args, true), true
+	case "SETSLOT":
+		return c.setSlotCommand(args), true
+	}
+
+	return messages.GetErrorString(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLUSTER HELP.", commands[1])), true
+}
+
+// shard is a node and the slots it serves.
+type shard struct {
+	node   *Node
+	ranges []slotRange
+}
+
+// shards returns every node that serves slots, ordered by their first slot.
+// Must be called with c.mu held.
+func (c *Cluster) shards() []shard {
+	var ret []shard
+	for _, n := range c.nodes {
+		if r := ranges(&c.slots, n); len(r) > 0 {
+			ret = append(ret, shard{n, r})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ranges[0].start < ret[j].ranges[0].start
+	})
+	return ret
+}
+
+func (c *Cluster) slotsCommand() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ret := []messages.Message{}
+	for start := 0; start < SlotCount; {
+		n := c.slots[start]
+		end := start
+		for end+1 < SlotCount && c.slots[end+1] == n {
+			end++
+		}
+		if n != nil {
+			ret = append(ret, messages.NewArray([]messages.Message{
+				messages.NewInteger(int64(start)),
+				messages.NewInteger(int64(end)),
+				messages.NewArray([]messages.Message{
+					messages.NewBulkString(n.IP),
+					messages.NewInteger(int64(n.Port)),
+					messages.NewBulkString(n.ID),
+				}),
+			}))
+		}
+		start = end + 1
+	}
+	return messages.NewArray(ret).Serialise()
+}
+
+func (c *Cluster) shardsCommand() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	shards := c.shards()
+	ret := make([]messages.Message, 0, len(shards))
+	for _, s := range shards {
+		slots := make([]messages.Message, 0, 2*len(s.ranges))
+		for _, r := range s.ranges {
+			slots = append(slots, messages.NewInteger(int64(r.start)), messages.NewInteger(int64(r.end)))
+		}
+
+		health := "online"
+		if s.node.failing(now) {
+			health = "failed"
+		}
+		node := messages.NewArray([]messages.Message{
+			messages.NewBulkString("id"), messages.NewBulkString(s.node.ID),
+			messages.NewBulkString("port"), messages.NewInteger(int64(s.node.Port)),
+			messages.NewBulkString("ip"), messages.NewBulkString(s.node.IP),
+			messages.NewBulkString("endpoint"), messages.NewBulkString(s.node.IP),
+			messages.NewBulkString("role"), messages.NewBulkString("master"),
+			messages.NewBulkString("replication-offset"), messages.NewInteger(0),
+			messages.NewBulkString("health"), messages.NewBulkString(health),
+		})
+
+		ret = append(ret, messages.NewArray([]messages.Message{
+			messages.NewBulkString("slots"), messages.NewArray(slots),
+			messages.NewBulkString("nodes"), messages.NewArray([]messages.Message{node}),
+		}))
+	}
+	return messages.NewArray(ret).Serialise()
+}
+
+// nodesCommand is in the format of https://redis.io/docs/latest/commands/cluster-nodes/
+func (c *Cluster) nodesCommand() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	ids := make([]string, 0, len(c.nodes))
+	for id := range c.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	sb := strings.Builder{}
+	for _, id := range ids {
+		n := c.nodes[id]
+
+		flags := []string{}
+		if n == c.myself {
+			flags = append(flags, "myself")
+		}
+		flags = append(flags, "master")
+		if n.handshake {
+			flags = append(flags, "handshake")
+		}
+		if n.failing(now) {
+			flags = append(flags, "fail?")
+		}
+
+		linkState := "disconnected"
+		if n == c.myself || n.link != nil {
+			linkState = "connected"
+		}
+
+		fmt.Fprintf(&sb, "%s %s@%d %s - %d %d %d %s",
+			n.ID, n.addr(), n.BusPort, strings.Join(flags, ","),
+			unixMilli(n.pingSent), unixMilli(n.pongReceived),
+			n.ConfigEpoch, linkState)
+
+		for _, r := range ranges(&c.slots, n) {
+			if r.start == r.end {
+				fmt.Fprintf(&sb, " %d", r.start)
+			} else {
+				fmt.Fprintf(&sb, " %d-%d", r.start, r.end)
+			}
+		}
+		if n == c.myself {
+			for slot := 0; slot < SlotCount; slot++ {
+				if m := c.migrating[slot]; m != nil {
+					fmt.Fprintf(&sb, " [%d->-%s]", slot, m.ID)
+				}
+				if i := c.importing[slot]; i != nil {
+					fmt.Fprintf(&sb, " [%d-<-%s]", slot, i.ID)
+				}
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// unixMilli is 0 for the zero time.
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func (c *Cluster) infoCommand() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	assigned := 0
+	for _, n := range c.slots {
+		if n != nil {
+			assigned++
+		}
+	}
+	state := "ok"
+	if assigned != SlotCount {
+		state = "fail"
+	}
+	known := 0
+	for _, n := range c.nodes {
+		if !n.handshake {
+			known++
+		}
+	}
+
+	lines := []string{
+		"cluster_enabled:1",
+		"cluster_state:" + state,
+		"cluster_slots_assigned:" + strconv.Itoa(assigned),
+		"cluster_slots_ok:" + strconv.Itoa(assigned),
+		"cluster_slots_pfail:0",
+		"cluster_slots_fail:0",
+		"cluster_known_nodes:" + strconv.Itoa(known),
+		"cluster_size:" + strconv.Itoa(len(c.shards())),
+		"cluster_current_epoch:" + strconv.FormatUint(c.currentEpoch, 10),
+		"cluster_my_epoch:" + strconv.FormatUint(c.myself.ConfigEpoch, 10),
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// meet handles CLUSTER MEET ip port [cluster-bus-port].
+func (c *Cluster) meet(args []string) string {
+	if len(args) != 2 && len(args) != 3 {
+		return invalidArgsErr
+	}
+
+	port, err := strconv.Atoi(args[1])
+	if err != nil || port <= 0 || port > 65535 {
+		return messages.GetErrorString("ERR Invalid base port specified: " + args[1])
+	}
+	// same default as redis
+	busPort := port + 10000
+	if len(args) == 3 {
+		busPort, err = strconv.Atoi(args[2])
+		if err != nil || busPort <= 0 || busPort > 65535 {
+			return messages.GetErrorString("ERR Invalid bus port specified: " + args[2])
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.startHandshake(args[0], port, busPort)
+	return okReply
+}
+
+// parseSlots parses slots, or pairs of start and end slots if isRange.
+func parseSlots(args []string, isRange bool) ([]int, string, bool) {
+	if len(args) == 0 || (isRange && len(args)%2 != 0) {
+		return nil, invalidArgsErr, false
+	}
+
+	var ret []int
+	if !isRange {
+		for _, arg := range args {
+			slot, ok := parseSlot(arg)
+			if !ok {
+				return nil, invalidSlotErr, false
+			}
+			ret = append(ret, slot)
+		}
+		return ret, "", true
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		start, ok1 := parseSlot(args[i])
+		end, ok2 := parseSlot(args[i+1])
+		if !ok1 || !ok2 {
+			return nil, invalidSlotErr, false
+		}
+		if start > end {
+			return nil, messages.GetErrorString(fmt.Sprintf("ERR start slot number %d is greater than end slot number %d", start, end)), false
+		}
+		for slot := start; slot <= end; slot++ {
+			ret = append(ret, slot)
+		}
+	}
+	return ret, "", true
+}
+
+// addSlots handles CLUSTER ADDSLOTS and ADDSLOTSRANGE.
+func (c *Cluster) addSlots(args []string, isRange bool) string {
+	slots, errReply, ok := parseSlots(args, isRange)
+	if !ok {
+		return errReply
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, slot := range slots {
+		if c.slots[slot] != nil {
+			return messages.GetErrorString(fmt.Sprintf("ERR Slot %d is already busy", slot))
+		}
+	}
+	for _, slot := range slots {
+		c.importing[slot] = nil
+		c.setSlot(slot, c.myself)
+	}
+	return okReply
+}
+
+// delSlots handles CLUSTER DELSLOTS and DELSLOTSRANGE.
+func (c *Cluster) delSlots(args []string, isRange bool) string {
+	slots, errReply, ok := parseSlots(args, isRange)
+	if !ok {
+		return errReply
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, slot := range slots {
+		if c.slots[slot] == nil {
+			return messages.GetErrorString(fmt.Sprintf("ERR Slot %d is already unassigned", slot))
+		}
+	}
+	for _, slot := range slots {
+		c.setSlot(slot, nil)
+		c.importing[slot] = nil
+		c.migrating[slot] = nil
+	}
+	return okReply
+}
+
+// setSlotCommand handles CLUSTER SETSLOT slot IMPORTING|MIGRATING|NODE node-id, and CLUSTER SETSLOT slot STABLE.
+func (c *Cluster) setSlotCommand(args []string) string {
+	if len(args) < 2 {
+		return invalidArgsErr
+	}
+	slot, ok := parseSlot(args[0])
+	if !ok {
+		return invalidSlotErr
+	}
+
+	action := strings.ToUpper(args[1])
+	if action == "STABLE" {
+		if len(args) != 2 {
+			return invalidArgsErr
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.importing[slot] = nil
+		c.migrating[slot] = nil
+		return okReply
+	}
+
+	if len(args) != 3 {
+		return invalidArgsErr
+	}
+	id := args[2]
+
+	// checked before taking the lock, the store has its own
+	hasKeys := len(c.keysInSlot(slot, 1)) > 0
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, known := c.nodes[id]
+	if !known || n.handshake {
+		return unknownNodeErr(id)
+	}
+
+	switch action {
+	case "MIGRATING":
+		if c.slots[slot] != c.myself {
+			return messages.GetErrorString(fmt.Sprintf("ERR I'm not the owner of hash slot %d", slot))
+		}
+		if n == c.myself {
+			return messages.GetErrorString("ERR I can't migrate to myself")
+		}
+		c.migrating[slot] = n
+	case "IMPORTING":
+		if c.slots[slot] == c.myself {
+			return messages.GetErrorString(fmt.Sprintf("ERR I'm already the owner of hash slot %d", slot))
+		}
+		if n == c.myself {
+			return messages.GetErrorString("ERR I can't import from myself")
+		}
+		c.importing[slot] = n
+	case "NODE":
+		if n == c.myself {
+			if c.importing[slot] != nil {
+				// the migration is done, make sure our claim beats the old owner's
+				c.importing[slot] = nil
+				c.bumpEpoch()
+			}
+			c.migrating[slot] = nil
+			c.setSlot(slot, n)
+			return okReply
+		}
+
+		if c.slots[slot] == c.myself && hasKeys {
+			return messages.GetErrorString(fmt.Sprintf("ERR Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot))
+		}
+		c.migrating[slot] = nil
+		c.importing[slot] = nil
+		c.setSlot(slot, n)
+	default:
+		return messages.GetErrorString("ERR Invalid CLUSTER SETSLOT action or number of arguments")
+	}
+
+	return okReply
+}
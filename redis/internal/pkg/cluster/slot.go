@@ -0,0 +1,59 @@
+package cluster
+
+import (
+	"strings"
+)
+
+// SlotCount is the number of hash slots the keyspace is split into.
+const SlotCount = 16384
+
+// crc16 is CRC16-CCITT (XMODEM), as used by redis cluster.
+// https://redis.io/docs/latest/operate/oss_and_stack/reference/cluster-spec/#appendix-a-crc16-reference-implementation-in-ansi-c
+func crc16(s string) uint16 {
+	crc := uint16(0)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// KeySlot returns the hash slot of the key.
+// If the key contains a non-empty hash tag (e.g. "{user1000}.following"), only the hash tag is hashed.
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key)) & (SlotCount - 1)
+}
+
+// slotRange is an inclusive range of slots.
+type slotRange struct {
+	start int
+	end   int
+}
+
+// ranges compresses the slots owned by the node into ranges.
+func ranges(slots *[SlotCount]*Node, n *Node) []slotRange {
+	var ret []slotRange
+	for i := 0; i < SlotCount; i++ {
+		if slots[i] != n {
+			continue
+		}
+		if len(ret) > 0 && ret[len(ret)-1].end == i-1 {
+			ret[len(ret)-1].end = i
+		} else {
+			ret = append(ret, slotRange{i, i})
+		}
+	}
+	return ret
+}
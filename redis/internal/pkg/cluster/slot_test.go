@@ -0,0 +1,48 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestKeySlot(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected int
+	}{
+		{"123456789", 0x31C3},
+		{"somekey", 11058},
+		{"foo", 12182},
+		{"foo{hash_tag}", 2515},
+		{"bar{hash_tag}", 2515},
+		{"{user1000}.following", KeySlot("user1000")},
+		// only the first hash tag counts
+		{"{a}{b}", KeySlot("a")},
+		{"x{a}", KeySlot("a")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			EqualO(t, KeySlot(test.key), test.expected)
+		})
+	}
+
+	// empty and unclosed hash tags are ignored
+	IsTrue(t, KeySlot("{}foo") == int(crc16("{}foo"))&(SlotCount-1), "empty hash tag should hash the whole key")
+	IsTrue(t, KeySlot("{foo") == int(crc16("{foo"))&(SlotCount-1), "unclosed hash tag should hash the whole key")
+}
+
+var cmpSlotRange = cmp.AllowUnexported(slotRange{})
+
+func TestRanges(t *testing.T) {
+	var slots [SlotCount]*Node
+	n := &Node{}
+	for _, i := range []int{0, 1, 2, 5, 7, 8, SlotCount - 1} {
+		slots[i] = n
+	}
+
+	EqualO(t, ranges(&slots, n), []slotRange{{0, 2}, {5, 5}, {7, 8}, {SlotCount - 1, SlotCount - 1}}, cmpSlotRange)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const ConfigCommand = "CONFIG"
+
+var (
+	invalidArgNumErr = messages.GetErrorString("ERR wrong number of arguments for command")
+	okReply          = messages.NewSimpleString("OK").Serialise()
+)
+
+// CONFIG subcommand [arguments ...]
+func (c *Config) Command(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], ConfigCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return invalidArgNumErr, true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "GET":
+		if len(args) < 1 {
+			return invalidArgNumErr, true
+		}
+		return messages.NewArrayBulkString(c.Match(args...)).Serialise(), true
+	case "SET":
+		if len(args) < 2 || len(args)%2 != 0 {
+			return invalidArgNumErr, true
+		}
+		if err := c.Set(args...); err != nil {
+			return messages.GetErrorString("ERR " + err.Error()), true
+		}
+		return okReply, true
+	case "REWRITE":
+		if len(args) != 0 {
+			return invalidArgNumErr, true
+		}
+		if err := c.Rewrite(); err != nil {
+			log.Err(err).Msg("CONFIG REWRITE")
+			return messages.GetErrorString("ERR Rewriting config file: " + err.Error()), true
+		}
+		return okReply, true
+	case "RESETSTAT":
+		if len(args) != 0 {
+			return invalidArgNumErr, true
+		}
+		c.ResetStat()
+		return okReply, true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try CONFIG HELP."), true
+	}
+}
@@ -0,0 +1,379 @@
+// Package config holds the server's parameters, from a redis.conf-style file and command-line arguments.
+// Parameters that can change at runtime are bound to the code that applies them (see Config.Bind).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/glob"
+)
+
+type kind int
+
+const (
+	stringKind kind = iota
+	intKind
+	// boolKind values are "yes" or "no".
+	boolKind
+)
+
+type param struct {
+	name         string
+	kind         kind
+	defaultValue string
+}
+
+// params are all the parameters, with their defaults.
+var params = []param{
+	{name: "bind", defaultValue: "localhost"},
+	{name: "port", kind: intKind, defaultValue: "6379"},
+	{name: "unixsocket"},
+	// in octal, 0 leaves the permissions to the umask
+	{name: "unixsocketperm", defaultValue: "0"},
+	{name: "tls-port", kind: intKind, defaultValue: "0"},
+	{name: "tls-cert-file"},
+	{name: "tls-key-file"},
+	{name: "tls-ca-cert-file"},
+	{name: "tls-auth-clients", defaultValue: "yes"},
+	{name: "tls-protocols"},
+	{name: "tls-ciphers"},
+	{name: "cluster-enabled", kind: boolKind, defaultValue: "no"},
+	// 0 is port + 10000
+	{name: "cluster-port", kind: intKind, defaultValue: "0"},
+	// 0 does not serve metrics
+	{name: "metrics-port", kind: intKind, defaultValue: "0"},
+	{name: "maxmemory", defaultValue: "0"},
+	{name: "maxmemory-policy", defaultValue: "noeviction"},
+	{name: "maxmemory-samples", kind: intKind, defaultValue: "5"},
+	{name: "notify-keyspace-events"},
+	{name: "requirepass"},
+	// snapshots are saved to dir/dbfilename
+	{name: "dir", defaultValue: "data"},
+	{name: "dbfilename", defaultValue: "data.rdb"},
+	{name: "aclfile"},
+	{name: "masteruser"},
+	{name: "masterauth"},
+	{name: "loglevel", defaultValue: "error"},
+	// in microseconds, negative disables the slow log
+	{name: "slowlog-log-slower-than", kind: intKind, defaultValue: "10000"},
+	{name: "slowlog-max-len", kind: intKind, defaultValue: "128"},
+	// in milliseconds, 0 disables the latency monitor
+	{name: "latency-monitor-threshold", kind: intKind, defaultValue: "0"},
+	// in milliseconds, how long a script runs before other clients are replied to with BUSY
+	{name: "busy-reply-threshold", kind: intKind, defaultValue: "5000"},
+}
+
+func (p param) validate(value string) error {
+	switch p.kind {
+	case intKind:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("argument couldn't be parsed into an integer")
+		}
+	case boolKind:
+		if value != "yes" && value != "no" {
+			return fmt.Errorf("argument must be 'yes' or 'no'")
+		}
+	}
+	return nil
+}
+
+type value struct {
+	param
+	value string
+	// given is set if the value was given (in the file, the arguments or by CONFIG SET), rather than the default.
+	given bool
+	// apply is set if the parameter can change at runtime.
+	apply func(value string) error
+}
+
+// Config holds the values of the parameters. To construct one, use `New`.
+type Config struct {
+	mu     sync.Mutex
+	values map[string]*value
+	// file is the config file (for CONFIG REWRITE), if there is one.
+	file       string
+	resetStats []func()
+
+	// setMu serialises Set, as the values are applied without holding mu.
+	setMu sync.Mutex
+}
+
+// New returns the default config.
+func New() *Config {
+	c := &Config{values: map[string]*value{}}
+	for _, p := range params {
+		c.values[p.name] = &value{param: p, value: p.defaultValue}
+	}
+	return c
+}
+
+// set sets the value, without applying it.
+func (c *Config) set(name, v string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.values[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown parameter '%s'", name)
+	}
+	if p.kind == boolKind {
+		v = strings.ToLower(v)
+	}
+	if err := p.validate(v); err != nil {
+		return err
+	}
+	p.value = v
+	p.given = true
+	return nil
+}
+
+// Load reads the config file, which is also where CONFIG REWRITE writes to.
+func (c *Config) Load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	lines, err := parseFile(string(data))
+	if err != nil {
+		return fmt.Errorf("%s:%w", file, err)
+	}
+	for _, l := range lines {
+		if err := c.set(l.name, l.value); err != nil {
+			return fmt.Errorf("%s:%d: %w", file, l.number, err)
+		}
+	}
+
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.file = abs
+	c.mu.Unlock()
+	return nil
+}
+
+// ParseArgs parses the command-line arguments, like redis-server: an optional config file, then parameters that override it (e.g. `--port 7000`).
+// A boolean parameter without a value (e.g. `--cluster-enabled`) is set to yes.
+func (c *Config) ParseArgs(args []string) error {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		if err := c.Load(args[0]); err != nil {
+			return err
+		}
+		args = args[1:]
+	}
+
+	for len(args) > 0 {
+		name, ok := strings.CutPrefix(args[0], "--")
+		if !ok {
+			return fmt.Errorf("expected a parameter (e.g. --port), got '%s'", args[0])
+		}
+		i := 1
+		for i < len(args) && !strings.HasPrefix(args[i], "--") {
+			i++
+		}
+		v := strings.Join(args[1:i], " ")
+		if i == 1 && c.isBool(name) {
+			v = "yes"
+		}
+		if err := c.set(name, v); err != nil {
+			return fmt.Errorf("--%s: %w", name, err)
+		}
+		args = args[i:]
+	}
+	return nil
+}
+
+func (c *Config) isBool(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.values[strings.ToLower(name)]
+	return ok && p.kind == boolKind
+}
+
+// Get returns the value of the parameter, or "" if there is no such parameter.
+func (c *Config) Get(name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.values[name]; ok {
+		return p.value
+	}
+	return ""
+}
+
+// Int returns the value of an integer parameter.
+func (c *Config) Int(name string) int {
+	n, _ := strconv.Atoi(c.Get(name))
+	return n
+}
+
+// Bool returns the value of a boolean parameter.
+func (c *Config) Bool(name string) bool {
+	return c.Get(name) == "yes"
+}
+
+// File returns the config file, or "" if there is none.
+func (c *Config) File() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.file
+}
+
+// Bind lets the parameter change at runtime (with CONFIG SET), with apply applying the new value.
+// If the value was given (rather than the default), it is applied now.
+func (c *Config) Bind(name string, apply func(value string) error) error {
+	c.mu.Lock()
+	p, ok := c.values[name]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("unknown parameter '%s'", name)
+	}
+	p.apply = apply
+	v, given := p.value, p.given
+	c.mu.Unlock()
+
+	if !given {
+		return nil
+	}
+	if err := apply(v); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// SetError is returned by Set, for the parameter that could not be set.
+type SetError struct {
+	Name string
+	Err  error
+}
+
+func (e *SetError) Error() string {
+	return fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", e.Name, e.Err)
+}
+
+func (e *SetError) Unwrap() error {
+	return e.Err
+}
+
+var immutableErr = errors.New("can't set immutable config")
+
+// Set sets the parameters at runtime, from pairs of names and values.
+// Either all of them are set, or none of them are.
+func (c *Config) Set(pairs ...string) error {
+	c.setMu.Lock()
+	defer c.setMu.Unlock()
+
+	if len(pairs)%2 != 0 {
+		return errors.New("wrong number of arguments")
+	}
+
+	type change struct {
+		p        *value
+		old      string
+		oldGiven bool
+		new      string
+	}
+	changes := []change{}
+	c.mu.Lock()
+	for i := 0; i < len(pairs); i += 2 {
+		name := strings.ToLower(pairs[i])
+		p, ok := c.values[name]
+		if !ok {
+			c.mu.Unlock()
+			return &SetError{Name: pairs[i], Err: errors.New("unknown parameter")}
+		}
+		if p.apply == nil {
+			c.mu.Unlock()
+			return &SetError{Name: name, Err: immutableErr}
+		}
+		if slices.ContainsFunc(changes, func(ch change) bool { return ch.p == p }) {
+			c.mu.Unlock()
+			return &SetError{Name: name, Err: errors.New("duplicate parameter")}
+		}
+		v := pairs[i+1]
+		if p.kind == boolKind {
+			v = strings.ToLower(v)
+		}
+		if err := p.validate(v); err != nil {
+			c.mu.Unlock()
+			return &SetError{Name: name, Err: err}
+		}
+		changes = append(changes, change{p: p, old: p.value, oldGiven: p.given, new: v})
+	}
+	// the values are all set before any are applied, as some are applied together (e.g. the tls-* parameters)
+	for _, ch := range changes {
+		ch.p.value = ch.new
+		ch.p.given = true
+	}
+	c.mu.Unlock()
+
+	for i, ch := range changes {
+		if err := ch.p.apply(ch.new); err != nil {
+			// restores the values, including the ones that were applied
+			c.mu.Lock()
+			for _, ch := range changes {
+				ch.p.value = ch.old
+				ch.p.given = ch.oldGiven
+			}
+			c.mu.Unlock()
+			for _, ch := range changes[:i] {
+				ch.p.apply(ch.old)
+			}
+			return &SetError{Name: ch.p.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// Match returns the names and values of the parameters that match any of the glob-style patterns, sorted by name.
+func (c *Config) Match(patterns ...string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := []string{}
+	for name := range c.values {
+		for _, pattern := range patterns {
+			if glob.Match(strings.ToLower(pattern), name) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	slices.Sort(names)
+
+	ret := make([]string, 0, len(names)*2)
+	for _, name := range names {
+		ret = append(ret, name, c.values[name].value)
+	}
+	return ret
+}
+
+// OnResetStat registers a function that resets statistics, for CONFIG RESETSTAT.
+func (c *Config) OnResetStat(reset func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resetStats = append(c.resetStats, reset)
+}
+
+// ResetStat resets all statistics.
+func (c *Config) ResetStat() {
+	c.mu.Lock()
+	resetStats := slices.Clone(c.resetStats)
+	c.mu.Unlock()
+
+	for _, reset := range resetStats {
+		reset()
+	}
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+		hasError bool
+	}{
+		{"", []string{}, false},
+		{"port 7000", []string{"port", "7000"}, false},
+		{"  save 3600 1\t300 100 ", []string{"save", "3600", "1", "300", "100"}, false},
+		{`requirepass "pass word"`, []string{"requirepass", "pass word"}, false},
+		{`requirepass ""`, []string{"requirepass", ""}, false},
+		{`requirepass "a\"b\x41\n"`, []string{"requirepass", "a\"bA\n"}, false},
+		{`requirepass 'it\'s'`, []string{"requirepass", "it's"}, false},
+		{`requirepass "unbalanced`, nil, true},
+		{`requirepass "a"b`, nil, true},
+		{`requirepass "\x4"`, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			actual, err := splitArgs(test.line)
+			if test.hasError {
+				HasError(t, err)
+			} else {
+				NoError(t, err)
+				EqualO(t, actual, test.expected)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "simple", "pass word", `a"b'c\d`, "#hash", "new\nline"} {
+		args, err := splitArgs("requirepass " + quote(value))
+		NoError(t, err)
+		EqualO(t, args, []string{"requirepass", value})
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "redis.conf")
+	NoError(t, os.WriteFile(file, []byte(content), 0o600))
+	return file
+}
+
+func TestParseArgs(t *testing.T) {
+	file := writeFile(t, "# a comment, with 'quotes\nport 7000\n\nMAXMEMORY 100mb\ntls-protocols TLSv1.2 TLSv1.3\n")
+
+	c := New()
+	NoError(t, c.ParseArgs([]string{file, "--port", "7001", "--cluster-enabled", "--notify-keyspace-events", "KEA"}))
+	EqualO(t, c.Int("port"), 7001)
+	EqualO(t, c.Get("maxmemory"), "100mb")
+	EqualO(t, c.Get("tls-protocols"), "TLSv1.2 TLSv1.3")
+	IsTrue(t, c.Bool("cluster-enabled"), "cluster-enabled should be set")
+	EqualO(t, c.Get("notify-keyspace-events"), "KEA")
+	EqualO(t, c.Get("maxmemory-policy"), "noeviction")
+	EqualO(t, c.File(), file)
+
+	NoError(t, New().ParseArgs(nil))
+	HasError(t, New().ParseArgs([]string{"--port", "x"}))
+	HasError(t, New().ParseArgs([]string{"--unknown", "1"}))
+	HasError(t, New().ParseArgs([]string{"--port", "1", "extra", "--cluster-enabled", "maybe"}))
+	HasError(t, New().ParseArgs([]string{filepath.Join(t.TempDir(), "missing.conf")}))
+
+	err := New().Load(writeFile(t, "port 1\nbogus 2\n"))
+	IsTrue(t, err != nil && filepath.Base(err.Error()) == "redis.conf:2: unknown parameter 'bogus'", "err=%v", err)
+}
+
+func TestSet(t *testing.T) {
+	c := New()
+	NoError(t, c.ParseArgs([]string{"--maxmemory", "1mb"}))
+
+	applied := map[string]string{}
+	apply := func(name string) func(string) error {
+		return func(value string) error {
+			if value == "invalid" {
+				return errors.New("invalid value")
+			}
+			applied[name] = value
+			return nil
+		}
+	}
+	NoError(t, c.Bind("maxmemory", apply("maxmemory")))
+	NoError(t, c.Bind("requirepass", apply("requirepass")))
+	// only given values are applied when bound
+	EqualO(t, applied, map[string]string{"maxmemory": "1mb"})
+
+	NoError(t, c.Set("MAXMEMORY", "2mb", "requirepass", "secret"))
+	EqualO(t, applied, map[string]string{"maxmemory": "2mb", "requirepass": "secret"})
+	EqualO(t, c.Get("maxmemory"), "2mb")
+
+	// nothing changes if any value is invalid
+	err := c.Set("maxmemory", "3mb", "requirepass", "invalid")
+	EqualO(t, err.Error(), "CONFIG SET failed (possibly related to argument 'requirepass') - invalid value")
+	EqualO(t, applied, map[string]string{"maxmemory": "2mb", "requirepass": "secret"})
+	EqualO(t, c.Get("maxmemory"), "2mb")
+
+	err = c.Set("port", "7000")
+	EqualO(t, err.Error(), "CONFIG SET failed (possibly related to argument 'port') - can't set immutable config")
+	HasError(t, c.Set("unknown", "1"))
+	HasError(t, c.Set("maxmemory", "1", "maxmemory", "2"))
+	HasError(t, c.Bind("unknown", apply("unknown")))
+}
+
+func TestMatch(t *testing.T) {
+	c := New()
+	EqualO(t, c.Match("maxmemory*"), []string{"maxmemory", "0", "maxmemory-policy", "noeviction", "maxmemory-samples", "5"})
+	EqualO(t, c.Match("PORT", "tls-port"), []string{"port", "6379", "tls-port", "0"})
+	EqualO(t, c.Match("nothing*"), []string{})
+}
+
+func TestRewrite(t *testing.T) {
+	HasError(t, New().Rewrite())
+
+	file := writeFile(t, "# my config\nport 7000\n\nmaxmemory 1mb\nmaxmemory 2mb\n")
+	c := New()
+	NoError(t, c.Load(file))
+	NoError(t, c.Bind("maxmemory", func(string) error { return nil }))
+	NoError(t, c.Bind("requirepass", func(string) error { return nil }))
+	NoError(t, c.Set("maxmemory", "3mb", "requirepass", "pass word"))
+
+	NoError(t, c.Rewrite())
+	data, err := os.ReadFile(file)
+	NoError(t, err)
+	EqualO(t, string(data), "# my config\nport 7000\n\nmaxmemory 3mb\n# Generated by CONFIG REWRITE\nrequirepass \"pass word\"\n")
+
+	// the rewritten file is loaded the same
+	loaded := New()
+	NoError(t, loaded.Load(file))
+	EqualO(t, loaded.Get("requirepass"), "pass word")
+
+	// rewriting again keeps it the same
+	NoError(t, c.Rewrite())
+	again, err := os.ReadFile(file)
+	NoError(t, err)
+	EqualO(t, string(again), string(data))
+}
+
+func TestCommand(t *testing.T) {
+	c := New()
+	NoError(t, c.Bind("maxmemory", func(string) error { return nil }))
+	resets := 0
+	c.OnResetStat(func() { resets++ })
+
+	tests := []struct {
+		commands []string
+		expected string
+	}{
+		{[]string{"CONFIG", "GET", "maxmemory"}, "*2\r\n$9\r\nmaxmemory\r\n$1\r\n0\r\n"},
+		{[]string{"config", "set", "maxmemory", "10mb"}, "+OK\r\n"},
+		{[]string{"CONFIG", "GET", "maxmemory"}, "*2\r\n$9\r\nmaxmemory\r\n$4\r\n10mb\r\n"},
+		{[]string{"CONFIG", "SET", "maxmemory"}, "-ERR wrong number of arguments for command\r\n"},
+		{[]string{"CONFIG", "SET", "port", "1"}, "-ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config\r\n"},
+		{[]string{"CONFIG", "REWRITE"}, "-ERR Rewriting config file: The server is running without a config file\r\n"},
+		{[]string{"CONFIG", "RESETSTAT"}, "+OK\r\n"},
+		{[]string{"CONFIG", "NOPE"}, "-ERR unknown subcommand 'NOPE'. Try CONFIG HELP.\r\n"},
+		{[]string{"CONFIG"}, "-ERR wrong number of arguments for command\r\n"},
+	}
+
+	for _, test := range tests {
+		actual, ok := c.Command(test.commands)
+		IsTrue(t, ok, "%v not handled", test.commands)
+		EqualO(t, actual, test.expected)
+	}
+	EqualO(t, resets, 1)
+
+	_, ok := c.Command([]string{"GET", "k"})
+	IsFalse(t, ok, "GET should not be handled")
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// line is a parameter in the config file.
+type line struct {
+	number int
+	name   string
+	// value has the arguments joined by spaces.
+	value string
+}
+
+// parseFile parses a redis.conf-style file, which has a parameter and its arguments per line.
+// Empty lines, and lines starting with #, are ignored.
+func parseFile(data string) ([]line, error) {
+	ret := []line{}
+	for i, text := range strings.Split(data, "\n") {
+		if isComment(text) {
+			continue
+		}
+		args, err := splitArgs(text)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", i+1, err)
+		}
+		if len(args) == 0 {
+			continue
+		}
+		ret = append(ret, line{number: i + 1, name: strings.ToLower(args[0]), value: strings.Join(args[1:], " ")})
+	}
+	return ret, nil
+}
+
+func isComment(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "#")
+}
+
+// splitArgs splits a line into arguments, like redis' sdssplitargs.
+// Arguments are separated by whitespace, and may be quoted: "double quotes" support escapes (e.g. \n, \x41), 'single quotes' only support \'.
+func splitArgs(s string) ([]string, error) {
+	args := []string{}
+	for {
+		s = strings.TrimLeft(s, " \t\r")
+		if s == "" {
+			return args, nil
+		}
+
+		var arg strings.Builder
+		switch s[0] {
+		case '"':
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] != '\\' || i+1 >= len(s) {
+					arg.WriteByte(s[i])
+					continue
+				}
+				i++
+				switch s[i] {
+				case 'n':
+					arg.WriteByte('\n')
+				case 'r':
+					arg.WriteByte('\r')
+				case 't':
+					arg.WriteByte('\t')
+				case 'x':
+					if i+2 >= len(s) {
+						return nil, errors.New("invalid \\x escape")
+					}
+					b, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+					if err != nil {
+						return nil, errors.New("invalid \\x escape")
+					}
+					arg.WriteByte(byte(b))
+					i += 2
+				default:
+					arg.WriteByte(s[i])
+				}
+			}
+			if i >= len(s) {
+				return nil, errors.New("unbalanced quotes")
+			}
+			s = s[i+1:]
+		case '\'':
+			i := 1
+			for ; i < len(s) && s[i] != '\''; i++ {
+				if s[i] == '\\' && i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				}
+				arg.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, errors.New("unbalanced quotes")
+			}
+			s = s[i+1:]
+		default:
+			i := strings.IndexAny(s, " \t\r")
+			if i < 0 {
+				i = len(s)
+			}
+			arg.WriteString(s[:i])
+			s = s[i:]
+		}
+		// a closing quote must be followed by a space
+		if s != "" && !strings.ContainsAny(s[:1], " \t\r") {
+			return nil, errors.New("closing quote must be followed by a space")
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// quote returns the value as an argument in the config file.
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n\"'\\#") && strconv.CanBackquote(value) {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+const rewriteSignature = "# Generated by CONFIG REWRITE"
+
+var noFileErr = errors.New("The server is running without a config file")
+
+// Rewrite writes the current values to the config file, keeping its comments and the order of its lines.
+// Parameters that are not in the file are appended, if they are not the default.
+func (c *Config) Rewrite() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.file == "" {
+		return noFileErr
+	}
+	data, err := os.ReadFile(c.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	lines := []string{}
+	if trimmed := strings.TrimRight(string(data), "\n"); trimmed != "" {
+		lines = strings.Split(trimmed, "\n")
+	}
+
+	out := []string{}
+	seen := map[string]bool{}
+	hasSignature := false
+	for _, text := range lines {
+		if text == rewriteSignature {
+			hasSignature = true
+		}
+		if isComment(text) {
+			out = append(out, text)
+			continue
+		}
+		args, err := splitArgs(text)
+		if err != nil || len(args) == 0 {
+			out = append(out, text)
+			continue
+		}
+		name := strings.ToLower(args[0])
+		p, ok := c.values[name]
+		if !ok {
+			out = append(out, text)
+			continue
+		}
+		if seen[name] {
+			// only the last of duplicate lines had effect, the value replaces the first
+			continue
+		}
+		seen[name] = true
+		out = append(out, name+" "+quote(p.value))
+	}
+
+	for _, p := range params {
+		v := c.values[p.name]
+		if seen[p.name] || v.value == p.defaultValue {
+			continue
+		}
+		if !hasSignature {
+			out = append(out, rewriteSignature)
+			hasSignature = true
+		}
+		out = append(out, p.name+" "+quote(v.value))
+	}
+
+	// replaces the file atomically, so that it is never half-written
+	tmp, err := os.CreateTemp(filepath.Dir(c.file), filepath.Base(c.file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(strings.Join(out, "\n") + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file)
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	AskingCommand    = "ASKING"
+	ReadOnlyCommand  = "READONLY"
+	ReadWriteCommand = "READWRITE"
+)
+
+// Asking lets the next command of the client use a slot that is being imported.
+func Asking(c *client.Client, commands []string) (string, bool) {
+	c.Asking = true
+	return messages.NewSimpleString("OK").Serialise(), true
+}
+
+func ReadOnly(c *client.Client, commands []string) (string, bool) {
+	c.ReadOnly = true
+	return messages.NewSimpleString("OK").Serialise(), true
+}
+
+func ReadWrite(c *client.Client, commands []string) (string, bool) {
+	c.ReadOnly = false
+	return messages.NewSimpleString("OK").Serialise(), true
+}
@@ -1,8 +1,6 @@
 package handler
 
 import (
-	"strings"
-
 	"github.com/rs/zerolog/log"
 
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
@@ -24,17 +22,3 @@ func wrongTypeError(item items.Item) (string, bool) {
 	log.Error().Any("item", item).Msg(msg)
 	return messages.GetErrorString(msg), true
 }
-
-func commandsStartWith(commands []string, should []string) bool {
-	if len(commands) < len(should) {
-		return false
-	}
-
-	for i, s := range should {
-		if !strings.EqualFold(s, commands[i]) {
-			return false
-		}
-	}
-
-	return true
-}
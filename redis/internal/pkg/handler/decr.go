@@ -3,23 +3,16 @@ package handler
 import (
 	"github.com/rs/zerolog/log"
 
-	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 const DecrCommand = "DECR"
 
-func Decr(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{DecrCommand}) {
-		return "", false
-	}
-
-	if len(commands) != 2 {
-		return invalidArgNum()
-	}
-
-	s := store.GetSingleton()
+func Decr(c *client.Client, commands []string) (string, bool) {
+	s := c.Store
 	key := commands[1]
 
 	item, ok := s.Get(key)
@@ -37,6 +30,7 @@ func Decr(commands []string) (string, bool) {
 		log.Error().Any("item", item).Msg(msg)
 		return messages.GetErrorString(msg), true
 	}
+	s.Notify(pubsub.String, "decrby", key)
 
 	return messages.NewInteger(ret).Serialise(), true
 }
@@ -1,25 +1,21 @@
 package handler
 
 import (
-	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 const DelCommand = "DEL"
 
-func Del(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{DelCommand}) {
-		return "", false
-	}
-
-	if len(commands) < 2 {
-		return invalidArgNum()
-	}
-
+func Del(c *client.Client, commands []string) (string, bool) {
 	keys := commands[1:]
 
-	s := store.GetSingleton()
-	count := s.DeleteMany(keys)
+	s := c.Store
+	deleted := s.DeleteMany(keys)
+	for _, key := range deleted {
+		s.Notify(pubsub.Generic, "del", key)
+	}
 
-	return messages.NewInteger(count).Serialise(), true
+	return messages.NewInteger(int64(len(deleted))).Serialise(), true
 }
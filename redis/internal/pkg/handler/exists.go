@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
@@ -18,17 +19,9 @@ func exists(s *store.Store, cache map[string]bool, key string) bool {
 
 const ExistsCommand = "EXISTS"
 
-func Exists(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{ExistsCommand}) {
-		return "", false
-	}
-
-	if len(commands) < 2 {
-		return invalidArgNum()
-	}
-
+func Exists(c *client.Client, commands []string) (string, bool) {
 	cache := make(map[string]bool)
-	s := store.GetSingleton()
+	s := c.Store
 	count := int64(0)
 	for i := 1; i < len(commands); i++ {
 		key := commands[i]
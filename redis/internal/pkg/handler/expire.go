@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const PExpireAtCommand = "PEXPIREAT"
+
+// PEXPIREAT key unix-time-milliseconds
+func PExpireAt(c *client.Client, commands []string) (string, bool) {
+	at, err := strconv.ParseInt(commands[2], 10, 64)
+	if err != nil {
+		return messages.GetErrorString("ERR value is not an integer or out of range"), true
+	}
+
+	s := c.Store
+	key := commands[1]
+	item, ok := s.Get(key)
+	if !ok {
+		return messages.NewInteger(0).Serialise(), true
+	}
+
+	expiry := delay.NewDelay(time.UnixMilli(at))
+	if expiry.HasExpired(s.Now()) {
+		// like redis, a time in the past deletes the key
+		for _, key := range s.DeleteMany([]string{key}) {
+			s.Notify(pubsub.Generic, "del", key)
+		}
+		return messages.NewInteger(1).Serialise(), true
+	}
+
+	if err := s.SetWithDelay(key, item, expiry); err != nil {
+		return messages.GetError(err), true
+	}
+	s.Notify(pubsub.Generic, "expire", key)
+	return messages.NewInteger(1).Serialise(), true
+}
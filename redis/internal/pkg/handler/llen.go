@@ -1,25 +1,19 @@
 package handler
 
 import (
-	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 const LLenCommand = "LLEN"
 
-func LLen(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{LLenCommand}) {
-		return "", false
-	}
-
-	if len(commands) != 2 {
-		return invalidArgNum()
-	}
-
-	s := store.GetSingleton()
+func LLen(c *client.Client, commands []string) (string, bool) {
+	s := c.Store
 	key := commands[1]
 	item, ok := s.Get(key)
 	if !ok {
+		s.Notify(pubsub.KeyMiss, "keymiss", key)
 		return messages.NewInteger(0).Serialise(), true
 	}
 
@@ -3,23 +3,16 @@ package handler
 import (
 	"github.com/rs/zerolog/log"
 
-	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 const LPushCommand = "LPUSH"
 
-func LPush(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{LPushCommand}) {
-		return "", false
-	}
-
-	if len(commands) < 3 {
-		return invalidArgNum()
-	}
-
-	s := store.GetSingleton()
+func LPush(c *client.Client, commands []string) (string, bool) {
+	s := c.Store
 	key := commands[1]
 	item, ok := s.Get(key)
 	if !ok {
@@ -35,6 +28,7 @@ func LPush(commands []string) (string, bool) {
 	if !ok {
 		return wrongTypeError(item)
 	}
+	s.Notify(pubsub.List, "lpush", key)
 
 	return messages.NewInteger(ret).Serialise(), true
 }
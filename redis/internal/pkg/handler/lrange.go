@@ -4,22 +4,15 @@ import (
 	"strconv"
 
 	"github.com/rs/zerolog/log"
-	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 const LRangeCommand = "LRANGE"
 
-func LRange(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{LRangeCommand}) {
-		return "", false
-	}
-
-	if len(commands) != 4 {
-		return invalidArgNum()
-	}
-
-	s := store.GetSingleton()
+func LRange(c *client.Client, commands []string) (string, bool) {
+	s := c.Store
 	key := commands[1]
 
 	start, err := strconv.Atoi(commands[2])
@@ -37,6 +30,7 @@ func LRange(commands []string) (string, bool) {
 
 	item, ok := s.Get(key)
 	if !ok {
+		s.Notify(pubsub.KeyMiss, "keymiss", key)
 		return messages.NewArray([]messages.Message{}).Serialise(), true
 	}
 
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const MemoryCommand = "MEMORY"
+
+// MEMORY USAGE key [SAMPLES count]
+func Memory(c *client.Client, commands []string) (string, bool) {
+	if !strings.EqualFold(commands[1], "USAGE") {
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try MEMORY HELP."), true
+	}
+	if len(commands) != 3 && len(commands) != 5 {
+		return invalidArgNum()
+	}
+	if len(commands) == 5 {
+		// usage is tracked exactly, so samples are accepted but not needed
+		if !strings.EqualFold(commands[3], "SAMPLES") {
+			return messages.GetErrorString("ERR syntax error"), true
+		}
+		if _, err := strconv.Atoi(commands[4]); err != nil {
+			return messages.GetErrorString("ERR value is not an integer or out of range"), true
+		}
+	}
+
+	value, ok := c.Store.Peek(commands[2])
+	if !ok {
+		return messages.NewNullBulkString().Serialise(), true
+	}
+
+	return messages.NewInteger(value.MemoryUsage(commands[2])).Serialise(), true
+}
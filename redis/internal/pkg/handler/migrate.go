@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const MigrateCommand = "MIGRATE"
+
+type migrateArgs struct {
+	addr    string
+	timeout time.Duration
+	keys    []string
+	// copy keeps the keys, replace replaces the keys on the target.
+	copy    bool
+	replace bool
+	// username (if any) and password authenticate with the target, if password is set.
+	username string
+	password string
+}
+
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password | AUTH2 username password] [KEYS key [key ...]]
+func parseMigrateArguments(commands []string) (migrateArgs, error) {
+	args := migrateArgs{}
+	args.addr = net.JoinHostPort(commands[1], commands[2])
+	if db, err := strconv.Atoi(commands[4]); err != nil || db != 0 {
+		return args, errors.New("ERR only database 0 is supported")
+	}
+	timeout, err := strconv.ParseInt(commands[5], 10, 64)
+	if err != nil || timeout < 0 {
+		return args, errors.New("ERR timeout is not an integer or out of range")
+	}
+	args.timeout = time.Duration(timeout) * time.Millisecond
+	if args.timeout == 0 {
+		args.timeout = time.Second
+	}
+
+	rest := commands[6:]
+	for len(rest) > 0 {
+		switch strings.ToUpper(rest[0]) {
+		case "COPY":
+			args.copy = true
+			rest = rest[1:]
+		case "REPLACE":
+			args.replace = true
+			rest = rest[1:]
+		case "AUTH":
+			if len(rest) < 2 {
+				return args, errors.New("ERR syntax error")
+			}
+			args.username, args.password = "", rest[1]
+			rest = rest[2:]
+		case "AUTH2":
+			if len(rest) < 3 {
+				return args, errors.New("ERR syntax error")
+			}
+			args.username, args.password = rest[1], rest[2]
+			rest = rest[3:]
+		case "KEYS":
+			if commands[3] != "" {
+				return args, errors.New("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			args.keys = rest[1:]
+			rest = nil
+		default:
+			return args, errors.New("ERR syntax error")
+		}
+	}
+	if commands[3] != "" {
+		args.keys = []string{commands[3]}
+	}
+	if len(args.keys) == 0 {
+		return args, errors.New("ERR syntax error")
+	}
+
+	return args, nil
+}
+
+// MigrateKeys returns the keys moved by MIGRATE, they are deleted from replicas (and redirected in cluster mode).
+func MigrateKeys(commands []string) []string {
+	args, err := parseMigrateArguments(commands)
+	if err != nil {
+		return nil
+	}
+	return args.keys
+}
+
+// migrate sends the keys to the target, returning the keys that were sent.
+func migrate(s *store.Store, args migrateArgs) ([]string, error) {
+	var sent []string
+	var buf strings.Builder
+	for _, key := range args.keys {
+		value, ok := s.GetValue(key)
+		if !ok {
+			continue
+		}
+		now := s.Now()
+		item, ok := value.Item(now)
+		if !ok {
+			continue
+		}
+
+		ttl := int64(0)
+		if expiry, ok := value.Expiry(); ok {
+			// at least 1ms, 0 is no expiry
+			ttl = max(expiry.Sub(now).Milliseconds(), 1)
+		}
+
+		restore := []string{RestoreAskingCommand, key, strconv.FormatInt(ttl, 10), string(rdb.DumpItem(item))}
+		if args.replace {
+			restore = append(restore, "REPLACE")
+		}
+		buf.WriteString(messages.NewArrayBulkString(restore).Serialise())
+		sent = append(sent, key)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", args.addr, args.timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(args.timeout))
+
+	auth := ""
+	if args.password != "" {
+		commands := []string{"AUTH", args.password}
+		if args.username != "" {
+			commands = []string{"AUTH", args.username, args.password}
+		}
+		auth = messages.NewArrayBulkString(commands).Serialise()
+	}
+	if _, err := conn.Write([]byte(auth + buf.String())); err != nil {
+		return nil, err
+	}
+
+	rd := messages.NewReader(conn)
+	if auth != "" {
+		reply, err := rd.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := reply.(*messages.Error); ok {
+			// the keys were not restored, as we are not authenticated
+			return nil, fmt.Errorf("ERR Target instance replied with error: %s", e.Error())
+		}
+	}
+	var migrated []string
+	var replyErr error
+	for _, key := range sent {
+		reply, err := rd.ReadMessage()
+		if err != nil {
+			return migrated, err
+		}
+		if e, ok := reply.(*messages.Error); ok {
+			if replyErr == nil {
+				replyErr = fmt.Errorf("ERR Target instance replied with error: %s", e.Error())
+			}
+			continue
+		}
+		migrated = append(migrated, key)
+	}
+
+	return migrated, replyErr
+}
+
+func Migrate(c *client.Client, commands []string) (string, bool) {
+	c.Migrated = nil
+	args, err := parseMigrateArguments(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+
+	s := c.Store
+	migrated, err := migrate(s, args)
+	if !args.copy {
+		// keys that made it to the target are no longer ours, even if others failed
+		c.Migrated = s.DeleteMany(migrated)
+		for _, key := range c.Migrated {
+			s.Notify(pubsub.Generic, "del", key)
+		}
+	}
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return messages.GetErrorString("IOERR error or timeout reading to target instance"), true
+		}
+		if _, isOpErr := err.(*net.OpError); isOpErr {
+			return messages.GetErrorString("IOERR error or timeout connecting to target instance"), true
+		}
+		log.Err(err).Str("target", args.addr).Msg("migrate")
+		return messages.GetError(err), true
+	}
+	if migrated == nil {
+		return messages.NewSimpleString("NOKEY").Serialise(), true
+	}
+
+	return messages.NewSimpleString("OK").Serialise(), true
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// fakeTarget accepts a single connection, replying to the commands with replies in order, the last one is repeated.
+func fakeTarget(t *testing.T, replies ...string) (string, string, <-chan []string) {
+	l, err := net.Listen("tcp", "localhost:0")
+	NoError(t, err)
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	received := make(chan []string, 16)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		rd := messages.NewReader(conn)
+		for {
+			commands, err := rd.ReadCommands()
+			if err != nil {
+				close(received)
+				return
+			}
+			received <- commands
+			conn.Write([]byte(replies[0]))
+			if len(replies) > 1 {
+				replies = replies[1:]
+			}
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return host, port, received
+}
+
+func TestMigrate(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("k1", items.NewString("v1"))
+	s.Set("k2", items.NewListBuilder().Add([]string{"a", "b"}).Build())
+
+	host, port, received := fakeTarget(t, messages.NewSimpleString("OK").Serialise())
+
+	ret, _ := Migrate(c, []string{"MIGRATE", host, port, "", "0", "1000", "KEYS", "k1", "k2", "missing"})
+	EqualO(t, ret, messages.NewSimpleString("OK").Serialise())
+
+	for _, key := range []string{"k1", "k2"} {
+		commands := <-received
+		EqualO(t, commands[:3], []string{RestoreAskingCommand, key, "0"})
+		item, err := rdb.RestoreItem([]byte(commands[3]))
+		NoError(t, err)
+		IsTrue(t, item != nil, "")
+
+		_, ok := s.Get(key)
+		IsFalse(t, ok, "%s should have been deleted", key)
+	}
+
+	EqualO(t, c.Migrated, []string{"k1", "k2"})
+
+	ret, _ = Migrate(c, []string{"MIGRATE", host, port, "missing", "0", "1000"})
+	EqualO(t, ret, messages.NewSimpleString("NOKEY").Serialise())
+	EqualO(t, c.Migrated, []string(nil))
+}
+
+func TestMigrateOptions(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("k1", items.NewString("v1"))
+
+	host, port, received := fakeTarget(t, messages.NewSimpleString("OK").Serialise())
+
+	ret, _ := Migrate(c, []string{"MIGRATE", host, port, "", "0", "1000", "COPY", "REPLACE", "AUTH2", "user", "pass", "KEYS", "k1"})
+	EqualO(t, ret, messages.NewSimpleString("OK").Serialise())
+	EqualO(t, <-received, []string{"AUTH", "user", "pass"})
+	commands := <-received
+	EqualO(t, commands[:3], []string{RestoreAskingCommand, "k1", "0"})
+	EqualO(t, commands[4:], []string{"REPLACE"})
+	IsTrue(t, s.Exists("k1"), "k1 should have been copied")
+
+	EqualO(t, c.Migrated, []string(nil))
+	EqualO(t, MigrateKeys([]string{"MIGRATE", host, port, "k1", "0", "1000", "AUTH"}), []string(nil))
+
+	// the keys are kept if the target rejects our password
+	host, port, _ = fakeTarget(t, messages.GetErrorString("WRONGPASS invalid username-password pair or user is disabled."))
+	ret, _ = Migrate(c, []string{"MIGRATE", host, port, "k1", "0", "1000", "AUTH", "nope"})
+	EqualO(t, ret, messages.GetErrorString("ERR Target instance replied with error: WRONGPASS invalid username-password pair or user is disabled."))
+	IsTrue(t, s.Exists("k1"), "k1 should not have been deleted")
+}
+
+func TestMigrateError(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("k1", items.NewString("v1"))
+
+	host, port, _ := fakeTarget(t, messages.GetErrorString("BUSYKEY Target key name already exists."))
+
+	ret, _ := Migrate(c, []string{"MIGRATE", host, port, "k1", "0", "1000"})
+	IsTrue(t, strings.HasPrefix(ret, "-ERR Target instance replied with error: BUSYKEY"), "%q", ret)
+
+	_, ok := s.Get("k1")
+	IsTrue(t, ok, "k1 should not have been deleted")
+
+	ret, _ = Migrate(c, []string{"MIGRATE", host, port, "k1", "0", "1000", "KEYS", "k1"})
+	EqualO(t, ret, messages.GetErrorString("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string"))
+}
+
+func TestMigratePartial(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("k1", items.NewString("v1"))
+	s.Set("k2", items.NewString("v2"))
+
+	host, port, _ := fakeTarget(t, messages.NewSimpleString("OK").Serialise(), messages.GetErrorString("BUSYKEY Target key name already exists."))
+
+	// the keys that were restored are deleted, even though MIGRATE fails
+	ret, _ := Migrate(c, []string{"MIGRATE", host, port, "", "0", "1000", "KEYS", "k1", "k2"})
+	EqualO(t, ret, messages.GetErrorString("ERR Target instance replied with error: BUSYKEY Target key name already exists."))
+	EqualO(t, c.Migrated, []string{"k1"})
+	IsFalse(t, s.Exists("k1"), "k1 should have been deleted")
+	IsTrue(t, s.Exists("k2"), "k2 should not have been deleted")
+}
+
+func TestRestoreAsking(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	payload := string(rdb.DumpItem(items.NewString("v1")))
+
+	ret, _ := RestoreAsking(c, []string{RestoreAskingCommand, "k1", "0", payload})
+	EqualO(t, ret, messages.NewSimpleString("OK").Serialise())
+	item, ok := s.Get("k1")
+	IsTrue(t, ok, "")
+	IsTrue(t, item.Equal(items.NewString("v1")), "%+v", item)
+
+	ret, _ = RestoreAsking(c, []string{RestoreAskingCommand, "k1", "0", payload})
+	EqualO(t, ret, busyKeyErr)
+
+	ret, _ = RestoreAsking(c, []string{RestoreAskingCommand, "k2", "0", "garbage"})
+	EqualO(t, ret, messages.GetErrorString("ERR "+rdb.InvalidPayloadErr.Error()))
+}
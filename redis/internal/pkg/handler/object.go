@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const ObjectCommand = "OBJECT"
+
+// OBJECT IDLETIME key | OBJECT FREQ key
+func Object(c *client.Client, commands []string) (string, bool) {
+	if len(commands) != 3 {
+		return invalidArgNum()
+	}
+
+	s := c.Store
+	subcommand := strings.ToUpper(commands[1])
+	isLFU := s.EvictionPolicy().IsLFU()
+	switch subcommand {
+	case "IDLETIME":
+		if isLFU {
+			return messages.GetErrorString("ERR An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."), true
+		}
+	case "FREQ":
+		if !isLFU {
+			return messages.GetErrorString("ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."), true
+		}
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try OBJECT HELP."), true
+	}
+
+	// inspecting a key does not count as an access
+	value, ok := s.Peek(commands[2])
+	if !ok {
+		return messages.NewNullBulkString().Serialise(), true
+	}
+
+	now := s.Now()
+	if subcommand == "IDLETIME" {
+		return messages.NewInteger(int64(value.IdleTime(now) / time.Second)).Serialise(), true
+	}
+	return messages.NewInteger(int64(value.Freq(now))).Serialise(), true
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/clock"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+)
+
+func TestObjectIdleTime(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC))
+	c := client.New("")
+	c.Store = store.NewWithClock(clk)
+	t.Cleanup(c.Store.Close)
+	s := c.Store
+
+	// access times are by the store's clock, not the real one
+	s.Set("k", items.NewString("v"))
+	ret, _ := Object(c, []string{"OBJECT", "IDLETIME", "k"})
+	EqualO(t, ret, ":0\r\n")
+	clk.Add(90 * time.Second)
+	ret, _ = Object(c, []string{"OBJECT", "IDLETIME", "k"})
+	EqualO(t, ret, ":90\r\n")
+
+	// and so are the access times of the keys loaded from a snapshot
+	loaded := client.New("")
+	loaded.Store = store.NewWithClock(clk)
+	t.Cleanup(loaded.Store.Close)
+	NoError(t, loaded.Store.LoadSnapshot(s.Snapshot()))
+	clk.Add(30 * time.Second)
+	ret, _ = Object(loaded, []string{"OBJECT", "IDLETIME", "k"})
+	EqualO(t, ret, ":30\r\n")
+}
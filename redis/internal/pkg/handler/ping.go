@@ -1,16 +1,13 @@
 package handler
 
 import (
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 const PingCommand = "PING"
 
-func Ping(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{PingCommand}) {
-		return "", false
-	}
-
+func Ping(_ *client.Client, commands []string) (string, bool) {
 	if len(commands) == 1 {
 		return messages.NewSimpleString("PONG").Serialise(), true
 	}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+var busyKeyErr = messages.GetErrorString("BUSYKEY Target key name already exists.")
+
+const (
+	DumpCommand    = "DUMP"
+	RestoreCommand = "RESTORE"
+	// RestoreAskingCommand is sent by MIGRATE, it is RESTORE for a slot that is being imported.
+	RestoreAskingCommand = "RESTORE-ASKING"
+)
+
+// DUMP key
+func Dump(c *client.Client, commands []string) (string, bool) {
+	item, ok := c.Store.Get(commands[1])
+	if !ok {
+		return messages.NewNullBulkString().Serialise(), true
+	}
+	return messages.NewBulkString(string(rdb.DumpItem(item))).Serialise(), true
+}
+
+type restoreArgs struct {
+	key     string
+	ttl     int64
+	payload string
+	replace bool
+	absTTL  bool
+	// idleTime (seconds) and freq are -1 if they are not given.
+	idleTime int64
+	freq     int64
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func parseRestoreArguments(commands []string) (restoreArgs, error) {
+	args := restoreArgs{idleTime: -1, freq: -1}
+	args.key = commands[1]
+	ttl, err := strconv.ParseInt(commands[2], 10, 64)
+	if err != nil || ttl < 0 {
+		return args, errors.New("ERR Invalid TTL value, must be >= 0")
+	}
+	args.ttl = ttl
+	args.payload = commands[3]
+
+	for i := 4; i < len(commands); i++ {
+		hasValue := i+1 < len(commands)
+		switch strings.ToUpper(commands[i]) {
+		case "REPLACE":
+			args.replace = true
+		case "ABSTTL":
+			args.absTTL = true
+		// IDLETIME and FREQ cannot be given together, like redis
+		case "IDLETIME":
+			if !hasValue || args.freq != -1 {
+				return args, errors.New("ERR syntax error")
+			}
+			i++
+			idleTime, err := strconv.ParseInt(commands[i], 10, 64)
+			if err != nil || idleTime < 0 {
+				return args, errors.New("ERR Invalid IDLETIME value, must be >= 0")
+			}
+			args.idleTime = idleTime
+		case "FREQ":
+			if !hasValue || args.idleTime != -1 {
+				return args, errors.New("ERR syntax error")
+			}
+			i++
+			freq, err := strconv.ParseInt(commands[i], 10, 64)
+			if err != nil || freq < 0 || freq > 255 {
+				return args, errors.New("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+			args.freq = freq
+		default:
+			return args, errors.New("ERR syntax error")
+		}
+	}
+
+	return args, nil
+}
+
+// RestorePropagation returns the RESTORE (or RESTORE-ASKING) to propagate to replicas, given its reply.
+// Like redis, a relative TTL is made absolute (ABSTTL), so that replicas expire the key when we do.
+func RestorePropagation(s *store.Store, commands []string, reply string) []string {
+	args, err := parseRestoreArguments(commands)
+	if err != nil || strings.HasPrefix(reply, "-") {
+		return nil
+	}
+	if args.absTTL || args.ttl == 0 {
+		return commands
+	}
+
+	value, ok := s.Peek(args.key)
+	if !ok {
+		// it had already expired, which only deletes the key
+		return commands
+	}
+	expiry, ok := value.Expiry()
+	if !ok {
+		return commands
+	}
+	ret := slices.Clone(commands)
+	ret[2] = strconv.FormatInt(expiry.UnixMilli(), 10)
+	return append(ret, "ABSTTL")
+}
+
+func restore(c *client.Client, commands []string) (string, bool) {
+	args, err := parseRestoreArguments(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+	item, err := rdb.RestoreItem([]byte(args.payload))
+	if err != nil {
+		return messages.GetErrorString("ERR " + err.Error()), true
+	}
+
+	s := c.Store
+	if !args.replace && s.Exists(args.key) {
+		return busyKeyErr, true
+	}
+
+	now := s.Now()
+	var expiry *delay.Delay
+	if args.absTTL && args.ttl > 0 {
+		expiry = delay.NewDelay(time.UnixMilli(args.ttl))
+	} else if args.ttl > 0 {
+		expiry = delay.NewDelay(now.Add(time.Duration(args.ttl) * time.Millisecond))
+	}
+	if expiry.HasExpired(now) {
+		// like redis, a key that has already expired is not restored (but it still replaces the key)
+		for _, key := range s.DeleteMany([]string{args.key}) {
+			s.Notify(pubsub.Generic, "del", key)
+		}
+		return messages.NewSimpleString("OK").Serialise(), true
+	}
+
+	if err := s.SetWithDelay(args.key, item, expiry); err != nil {
+		return messages.GetError(err), true
+	}
+	if value, ok := s.Peek(args.key); ok {
+		if args.idleTime != -1 {
+			value.SetIdleTime(now, time.Duration(args.idleTime)*time.Second)
+		}
+		if args.freq != -1 {
+			value.SetFreq(now, uint8(args.freq))
+		}
+	}
+	s.Notify(pubsub.Generic, "restore", args.key)
+
+	return messages.NewSimpleString("OK").Serialise(), true
+}
+
+func Restore(c *client.Client, commands []string) (string, bool) {
+	return restore(c, commands)
+}
+
+// RESTORE-ASKING key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func RestoreAsking(c *client.Client, commands []string) (string, bool) {
+	return restore(c, commands)
+}
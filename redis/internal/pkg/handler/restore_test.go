@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/clock"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func TestDumpRestore(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("list", items.NewListBuilder().Add([]string{"a", "b"}).Build())
+
+	ret, _ := Dump(c, []string{"DUMP", "missing"})
+	EqualO(t, ret, messages.NewNullBulkString().Serialise())
+	ret, _ = Dump(c, []string{"DUMP", "list"})
+	payload := string(rdb.DumpItem(items.NewListBuilder().Add([]string{"a", "b"}).Build()))
+	EqualO(t, ret, messages.NewBulkString(payload).Serialise())
+
+	ok := messages.NewSimpleString("OK").Serialise()
+	ret, _ = Restore(c, []string{"RESTORE", "copy", "0", payload})
+	EqualO(t, ret, ok)
+	item, _ := s.Get("copy")
+	values, _ := item.LRange(0, -1)
+	EqualO(t, values, []string{"a", "b"})
+
+	ret, _ = Restore(c, []string{"RESTORE", "copy", "0", payload})
+	EqualO(t, ret, busyKeyErr)
+	ret, _ = Restore(c, []string{"RESTORE", "copy", "0", string(rdb.DumpItem(items.NewString("v"))), "REPLACE"})
+	EqualO(t, ret, ok)
+	item, _ = s.Get("copy")
+	IsTrue(t, item.Equal(items.NewString("v")), "%+v", item)
+
+	tests := []struct {
+		name     string
+		commands []string
+		expected string
+	}{
+		{"ttl", []string{"RESTORE", "k", "-1", payload}, "-ERR Invalid TTL value, must be >= 0\r\n"},
+		{"payload", []string{"RESTORE", "k", "0", "garbage"}, "-ERR " + rdb.InvalidPayloadErr.Error() + "\r\n"},
+		{"idletime", []string{"RESTORE", "k", "0", payload, "IDLETIME", "-1"}, "-ERR Invalid IDLETIME value, must be >= 0\r\n"},
+		{"freq", []string{"RESTORE", "k", "0", payload, "FREQ", "256"}, "-ERR Invalid FREQ value, must be >= 0 and <= 255\r\n"},
+		{"idletime_freq", []string{"RESTORE", "k", "0", payload, "IDLETIME", "1", "FREQ", "1"}, "-ERR syntax error\r\n"},
+		{"missing_value", []string{"RESTORE", "k", "0", payload, "FREQ"}, "-ERR syntax error\r\n"},
+		{"unknown", []string{"RESTORE", "k", "0", payload, "NOPE"}, "-ERR syntax error\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ret, _ := Restore(c, test.commands)
+			EqualO(t, ret, test.expected)
+		})
+	}
+	IsFalse(t, s.Exists("k"), "invalid restores should not create the key")
+}
+
+func TestRestoreOptions(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC))
+	c := client.New("")
+	c.Store = store.NewWithClock(clk)
+	t.Cleanup(c.Store.Close)
+	s := c.Store
+	payload := string(rdb.DumpItem(items.NewString("v")))
+	now := clk.Now()
+
+	commands := []string{"RESTORE", "ttl", "1500", payload}
+	ret, _ := Restore(c, commands)
+	value, _ := s.Peek("ttl")
+	expiry, _ := value.Expiry()
+	EqualO(t, expiry, now.Add(1500*time.Millisecond))
+	// replicas expire the key at the same time as us, whenever they apply the command
+	EqualO(t, RestorePropagation(s, commands, ret), []string{"RESTORE", "ttl", strconv.FormatInt(expiry.UnixMilli(), 10), payload, "ABSTTL"})
+	EqualO(t, RestorePropagation(s, commands, busyKeyErr), []string(nil))
+
+	absolute := now.Add(time.Hour)
+	Restore(c, []string{"RESTORE", "abs", strconv.FormatInt(absolute.UnixMilli(), 10), payload, "ABSTTL"})
+	value, _ = s.Peek("abs")
+	expiry, _ = value.Expiry()
+	EqualO(t, expiry, absolute)
+
+	// keys that have already expired are not restored, but they are still replaced
+	s.Set("expired", items.NewString("old"))
+	ret, _ = Restore(c, []string{"RESTORE", "expired", strconv.FormatInt(now.Add(-time.Hour).UnixMilli(), 10), payload, "ABSTTL", "REPLACE"})
+	EqualO(t, ret, messages.NewSimpleString("OK").Serialise())
+	IsFalse(t, s.Exists("expired"), "")
+
+	Restore(c, []string{"RESTORE", "idle", "0", payload, "IDLETIME", "120"})
+	value, _ = s.Peek("idle")
+	EqualO(t, value.IdleTime(now), 2*time.Minute)
+
+	Restore(c, []string{"RESTORE", "freq", "0", payload, "FREQ", "42"})
+	value, _ = s.Peek("freq")
+	EqualO(t, value.Freq(now), uint8(42))
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/glob"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const ScanCommand = "SCAN"
+
+const defaultScanCount = 10
+
+// scanHash orders the keys for SCAN. The cursor is the hash to continue from,
+// so keys that exist for the whole iteration are returned, even if other keys are added or deleted.
+func scanHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// the top bit is dropped, so that the next cursor (hash+1) does not overflow
+	return h.Sum64() >> 1
+}
+
+type scanArgs struct {
+	cursor    uint64
+	pattern   string
+	count     int
+	valueType string
+}
+
+func parseScanArguments(commands []string) (scanArgs, error) {
+	cursor, err := strconv.ParseUint(commands[1], 10, 64)
+	if err != nil {
+		return scanArgs{}, errors.New("ERR invalid cursor")
+	}
+	args := scanArgs{cursor: cursor, count: defaultScanCount}
+
+	for i := 2; i < len(commands); i += 2 {
+		if i+1 >= len(commands) {
+			return scanArgs{}, errors.New("ERR syntax error")
+		}
+		value := commands[i+1]
+		switch strings.ToUpper(commands[i]) {
+		case "MATCH":
+			args.pattern = value
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return scanArgs{}, errors.New("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return scanArgs{}, errors.New("ERR syntax error")
+			}
+			args.count = count
+		case "TYPE":
+			args.valueType = strings.ToLower(value)
+		default:
+			return scanArgs{}, errors.New("ERR syntax error")
+		}
+	}
+
+	return args, nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func Scan(c *client.Client, commands []string) (string, bool) {
+	args, err := parseScanArguments(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+
+	type entry struct {
+		key  string
+		hash uint64
+	}
+	s := c.Store
+	var entries []entry
+	for _, key := range s.Keys() {
+		if h := scanHash(key); h >= args.cursor {
+			entries = append(entries, entry{key, h})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].hash != entries[j].hash {
+			return entries[i].hash < entries[j].hash
+		}
+		return entries[i].key < entries[j].key
+	})
+
+	// keys with the same hash are returned together, as the cursor cannot point between them
+	n := min(args.count, len(entries))
+	for n < len(entries) && entries[n].hash == entries[n-1].hash {
+		n++
+	}
+	next := uint64(0)
+	if n < len(entries) {
+		next = entries[n-1].hash + 1
+	}
+
+	// like redis, the filters are applied after the COUNT keys are chosen
+	now := s.Now()
+	keys := []string{}
+	for _, e := range entries[:n] {
+		if args.pattern != "" && !glob.Match(args.pattern, e.key) {
+			continue
+		}
+		if args.valueType != "" {
+			value, ok := s.Peek(e.key)
+			if !ok {
+				continue
+			}
+			item, ok := value.Item(now)
+			if !ok || item.ValueType().String() != args.valueType {
+				continue
+			}
+		}
+		keys = append(keys, e.key)
+	}
+
+	return messages.NewArray([]messages.Message{
+		messages.NewBulkString(strconv.FormatUint(next, 10)),
+		messages.NewArrayBulkString(keys),
+	}).Serialise(), true
+}
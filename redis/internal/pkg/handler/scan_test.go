@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func TestScan(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	var expected []string
+	for i := 0; i < 25; i++ {
+		key := fmt.Sprintf("key:%d", i)
+		s.Set(key, items.NewString("v"))
+		expected = append(expected, key)
+	}
+	s.Set("list", items.NewListBuilder().Add([]string{"a"}).Build())
+
+	scan := func(commands ...string) (string, []string) {
+		reply, ok := Scan(c, commands)
+		IsTrue(t, ok, "SCAN should be handled")
+		msg, err := messages.Deserialise(reply)
+		NoError(t, err)
+		array, ok := msg.(*messages.Array)
+		IsTrue(t, ok, "reply=%q", reply)
+		keys, err := array.Items()[1].(*messages.Array).GetCommands()
+		NoError(t, err)
+		return array.Items()[0].(*messages.BulkString).String(), keys
+	}
+
+	var actual []string
+	cursor, calls := "0", 0
+	for {
+		next, keys := scan("SCAN", cursor, "MATCH", "key:*", "COUNT", "7")
+		actual = append(actual, keys...)
+		calls++
+		if next == "0" {
+			break
+		}
+		cursor = next
+	}
+	slices.Sort(actual)
+	slices.Sort(expected)
+	EqualO(t, actual, expected)
+	EqualO(t, calls, 4)
+
+	_, keys := scan("scan", "0", "count", "100", "type", "LIST")
+	EqualO(t, keys, []string{"list"})
+
+	reply, _ := Scan(c, []string{"SCAN", "x"})
+	EqualO(t, reply, messages.GetErrorString("ERR invalid cursor"))
+	reply, _ = Scan(c, []string{"SCAN", "0", "COUNT"})
+	EqualO(t, reply, messages.GetErrorString("ERR syntax error"))
+	reply, _ = Scan(c, []string{"SCAN", "0", "COUNT", "0"})
+	EqualO(t, reply, messages.GetErrorString("ERR syntax error"))
+}
@@ -3,10 +3,13 @@ package handler
 import (
 	"errors"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
@@ -43,7 +46,8 @@ type setArgs struct {
 	expiry    time.Time
 }
 
-func parseSetArguments(commands []string) (setArgs, error) {
+// parseSetArguments parses the options of SET, with relative expiries from now.
+func parseSetArguments(commands []string, now time.Time) (setArgs, error) {
 	args := setArgs{
 		NX:        false,
 		XX:        false,
@@ -56,9 +60,9 @@ func parseSetArguments(commands []string) (setArgs, error) {
 
 	commands = commands[3:]
 
-	// supports arguments being out of order
+	// supports arguments being out of order, in any case (like redis)
 	for len(commands) > 0 {
-		switch commands[0] {
+		switch strings.ToUpper(commands[0]) {
 		case "NX":
 			args.NX = true
 		case "XX":
@@ -70,13 +74,13 @@ func parseSetArguments(commands []string) (setArgs, error) {
 			if err != nil {
 				return args, err
 			}
-			args.expiry = time.Now().Add(d * time.Second)
+			args.expiry = now.Add(d * time.Second)
 		case "PX":
 			d, commands, err = getDuration(commands)
 			if err != nil {
 				return args, err
 			}
-			args.expiry = time.Now().Add(d * time.Millisecond)
+			args.expiry = now.Add(d * time.Millisecond)
 		case "EXAT":
 			d, commands, err = getDuration(commands)
 			if err != nil {
@@ -101,20 +105,60 @@ func parseSetArguments(commands []string) (setArgs, error) {
 
 const SetCommand = "SET"
 
-func Set(commands []string) (string, bool) {
-	if len(commands) == 0 || !commandsStartWith(commands, []string{SetCommand}) {
-		return "", false
+// SetGets returns whether SET replies with the old value (with GET), so that it reads the key too.
+func SetGets(commands []string) bool {
+	args, err := parseSetArguments(commands, time.Time{})
+	return err == nil && args.shouldGet
+}
+
+// SetPropagation returns the SET to propagate to replicas, given its reply, or nil if it did not set the key (with NX or XX).
+// Like redis, a relative expiry (EX or PX) is made absolute (PXAT), so that replicas expire the key when we do.
+func SetPropagation(s *store.Store, commands []string, reply string) []string {
+	if strings.HasPrefix(reply, "-") {
+		return nil
+	}
+	args, err := parseSetArguments(commands, s.Now())
+	if err != nil {
+		return nil
 	}
 
-	if len(commands) < 3 || len(commands) > 7 {
-		return invalidArgNum()
+	null := messages.NewNullBulkString().Serialise()
+	switch {
+	case !args.shouldGet && reply != messages.NewSimpleString("OK").Serialise():
+		return nil
+	// with GET, the reply is the old value: XX only sets existing keys
+	case args.shouldGet && args.XX && reply == null:
+		return nil
 	}
 
-	s := store.GetSingleton()
+	value, ok := s.Peek(commands[1])
+	if args.shouldGet && args.NX {
+		// NX with GET replies null whether or not it set the key, so check that the key holds our value
+		str, isString := "", false
+		if item, exists := value.Item(s.Now()); ok && exists {
+			str, isString = item.Get()
+		}
+		if reply != null || !isString || str != commands[2] {
+			return nil
+		}
+	}
+
+	if args.expiry.IsZero() || !ok {
+		return commands
+	}
+	expiry, ok := value.Expiry()
+	if !ok {
+		return commands
+	}
+	return []string{SetCommand, commands[1], commands[2], "PXAT", strconv.FormatInt(expiry.UnixMilli(), 10)}
+}
+
+func Set(c *client.Client, commands []string) (string, bool) {
+	s := c.Store
 
 	key := commands[1]
 	value := commands[2]
-	args, err := parseSetArguments(commands)
+	args, err := parseSetArguments(commands, s.Now())
 	if err != nil {
 		return messages.GetError(err), true
 	}
@@ -149,6 +193,10 @@ func Set(commands []string) (string, bool) {
 	if err != nil {
 		return messages.GetError(err), true
 	}
+	s.Notify(pubsub.String, "set", key)
+	if !args.expiry.IsZero() {
+		s.Notify(pubsub.Generic, "expire", key)
+	}
 
 	if args.shouldGet {
 		// key was set (with GET)
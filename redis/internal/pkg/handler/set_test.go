@@ -2,15 +2,20 @@ package handler
 
 import (
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/clock"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 func TestParseSetArguments(t *testing.T) {
+	now := time.Date(2024, time.May, 2, 15, 8, 20, 0, time.UTC)
 	tests := []struct {
 		name     string
 		commands []string
@@ -22,17 +27,17 @@ func TestParseSetArguments(t *testing.T) {
 		{"simple", strings.Split("SET k v XX", " "), setArgs{false, true, false, time.Time{}}, false},
 		{"simple", strings.Split("SET k v GET", " "), setArgs{false, false, true, time.Time{}}, false},
 
-		// would have to mock time.Now()...
-		// {"simple", strings.Split("SET k v EX 10", " "), setArgs{setNone, false, time.Time{}}, false},
-		// {"simple", strings.Split("SET k v PX 10", " "), setArgs{setNone, false, time.Time{}}, false},
+		{"simple", strings.Split("SET k v EX 10", " "), setArgs{false, false, false, now.Add(10 * time.Second)}, false},
+		{"simple", strings.Split("SET k v PX 10", " "), setArgs{false, false, false, now.Add(10 * time.Millisecond)}, false},
 		{"simple", strings.Split("SET k v EXAT 1714662500", " "), setArgs{false, false, false, time.Date(2024, time.May, 2, 15, 8, 20, 0, time.UTC)}, false},
 		{"simple", strings.Split("SET k v PXAT 1714662500000", " "), setArgs{false, false, false, time.Date(2024, time.May, 2, 15, 8, 20, 0, time.UTC)}, false},
 		{"complex", strings.Split("SET k v GET XX PXAT 1714662500000", " "), setArgs{false, true, true, time.Date(2024, time.May, 2, 15, 8, 20, 0, time.UTC)}, false},
+		{"lowercase", strings.Split("set k v get xx pxat 1714662500000", " "), setArgs{false, true, true, time.Date(2024, time.May, 2, 15, 8, 20, 0, time.UTC)}, false},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			actual, err := parseSetArguments(test.commands)
+			actual, err := parseSetArguments(test.commands, now)
 
 			if test.hasError && err == nil {
 				t.Errorf("expected err, but succeeded with %+v", actual)
@@ -46,10 +51,18 @@ func TestParseSetArguments(t *testing.T) {
 	}
 }
 
-func assertSet(t *testing.T, command string, expected messages.Message, expectedOk bool) {
+// newClient returns a client with a store of its own.
+func newClient(t *testing.T) *client.Client {
+	c := client.New("")
+	c.Store = store.New()
+	t.Cleanup(c.Store.Close)
+	return c
+}
+
+func assertSet(t *testing.T, c *client.Client, command string, expected messages.Message, expectedOk bool) {
 	commands := strings.Split(command, " ")
 
-	res, ok := Set(commands)
+	res, ok := Set(c, commands)
 	if ok != expectedOk {
 		t.Errorf("expected %v, but got %v", expectedOk, ok)
 	}
@@ -66,42 +79,75 @@ func assertSet(t *testing.T, command string, expected messages.Message, expected
 // Tests the interactions between multiple sets.
 func TestSet(t *testing.T) {
 	t.Run("no options, NX, XX", func(t *testing.T) {
-		store.ResetSingleton()
+		c := newClient(t)
 
-		assertSet(t, "SET k v", messages.NewSimpleString("OK"), true)
-		assertSet(t, "SET k v", messages.NewSimpleString("OK"), true)
+		assertSet(t, c, "SET k v", messages.NewSimpleString("OK"), true)
+		assertSet(t, c, "SET k v", messages.NewSimpleString("OK"), true)
 
-		assertSet(t, "SET k v NX", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k v NX", messages.NewNullBulkString(), true)
 		// check that repeated sets still won't set
-		assertSet(t, "SET k v NX", messages.NewNullBulkString(), true)
-		assertSet(t, "SET k v NX", messages.NewNullBulkString(), true)
-		assertSet(t, "SET k_nx v NX", messages.NewSimpleString("OK"), true)
+		assertSet(t, c, "SET k v NX", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k v NX", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k_nx v NX", messages.NewSimpleString("OK"), true)
 
-		assertSet(t, "SET k v XX", messages.NewSimpleString("OK"), true)
-		assertSet(t, "SET k_xx v XX", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k v XX", messages.NewSimpleString("OK"), true)
+		assertSet(t, c, "SET k_xx v XX", messages.NewNullBulkString(), true)
 		// check that repeated sets still won't set
-		assertSet(t, "SET k_xx v XX", messages.NewNullBulkString(), true)
-		assertSet(t, "SET k_xx v XX", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k_xx v XX", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k_xx v XX", messages.NewNullBulkString(), true)
 	})
 
 	t.Run("tests GET", func(t *testing.T) {
-		store.ResetSingleton()
+		c := newClient(t)
 
-		assertSet(t, "SET k v1 GET", messages.NewNullBulkString(), true)
-		assertSet(t, "SET k v2 GET", messages.NewBulkString("v1"), true)
-		assertSet(t, "SET k v3 GET", messages.NewBulkString("v2"), true)
-		assertSet(t, "SET k v4 GET", messages.NewBulkString("v3"), true)
+		assertSet(t, c, "SET k v1 GET", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k v2 GET", messages.NewBulkString("v1"), true)
+		assertSet(t, c, "SET k v3 GET", messages.NewBulkString("v2"), true)
+		assertSet(t, c, "SET k v4 GET", messages.NewBulkString("v3"), true)
 	})
 
 	t.Run("tests NX/XX + GET", func(t *testing.T) {
-		store.ResetSingleton()
+		c := newClient(t)
 
-		assertSet(t, "SET k1 v1", messages.NewSimpleString("OK"), true)
+		assertSet(t, c, "SET k1 v1", messages.NewSimpleString("OK"), true)
 		// shouldn't set
-		assertSet(t, "SET k1 v2 NX GET", messages.NewNullBulkString(), true)
-		assertSet(t, "SET k1 v3 GET", messages.NewBulkString("v1"), true)
+		assertSet(t, c, "SET k1 v2 NX GET", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k1 v3 GET", messages.NewBulkString("v1"), true)
 
-		assertSet(t, "SET k2 v1 XX GET", messages.NewNullBulkString(), true)
-		assertSet(t, "SET k2 v2 GET", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k2 v1 XX GET", messages.NewNullBulkString(), true)
+		assertSet(t, c, "SET k2 v2 GET", messages.NewNullBulkString(), true)
 	})
 }
+
+func TestSetPropagation(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC))
+	c := client.New("")
+	c.Store = store.NewWithClock(clk)
+	t.Cleanup(c.Store.Close)
+	at := strconv.FormatInt(clk.Now().Add(10*time.Second).UnixMilli(), 10)
+
+	tests := []struct {
+		name     string
+		command  string
+		expected []string
+	}{
+		{"plain", "SET k v", []string{"SET", "k", "v"}},
+		// replicas expire the key at the same time as us, whenever they apply the command
+		{"ex", "SET k v EX 10", []string{"SET", "k", "v", "PXAT", at}},
+		{"px", "SET k v PX 10000 GET", []string{"SET", "k", "v", "PXAT", at}},
+		{"nx_not_set", "SET k v NX", nil},
+		{"xx_set", "SET k v XX", []string{"SET", "k", "v", "XX"}},
+		{"nx_get_not_set", "SET k other NX GET", nil},
+		{"nx_get_set", "SET new v NX GET", []string{"SET", "new", "v", "NX", "GET"}},
+		{"xx_get_not_set", "SET missing v XX GET", nil},
+		{"error", "SET k v EX 0", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			commands := strings.Split(test.command, " ")
+			reply, _ := Set(c, commands)
+			EqualO(t, SetPropagation(c.Store, commands, reply), test.expected)
+		})
+	}
+	IsFalse(t, c.Store.Exists("missing"), "")
+}
@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	SortCommand   = "SORT"
+	SortROCommand = "SORT_RO"
+)
+
+type sortArgs struct {
+	key string
+	// by is the pattern of the weights, empty to sort by the elements.
+	by     string
+	noSort bool
+	// offset and count are the LIMIT, count is negative for every element.
+	offset int
+	count  int
+	gets   []string
+	desc   bool
+	alpha  bool
+	// store is the destination, empty to reply with the elements.
+	store string
+}
+
+// SORT key [BY pattern] [LIMIT offset count] [GET pattern [GET pattern ...]] [ASC | DESC] [ALPHA] [STORE destination]
+// SORT_RO is the same, without STORE.
+func parseSortArguments(commands []string) (sortArgs, error) {
+	args := sortArgs{count: -1}
+	readOnly := strings.EqualFold(commands[0], SortROCommand)
+
+	args.key = commands[1]
+	for i := 2; i < len(commands); i++ {
+		left := len(commands) - i - 1
+		switch option := strings.ToUpper(commands[i]); {
+		case option == "ASC":
+			args.desc = false
+		case option == "DESC":
+			args.desc = true
+		case option == "ALPHA":
+			args.alpha = true
+		case option == "LIMIT" && left >= 2:
+			offset, err := strconv.Atoi(commands[i+1])
+			if err != nil {
+				return args, errors.New("ERR value is not an integer or out of range")
+			}
+			count, err := strconv.Atoi(commands[i+2])
+			if err != nil {
+				return args, errors.New("ERR value is not an integer or out of range")
+			}
+			args.offset, args.count = max(offset, 0), count
+			i += 2
+		case option == "BY" && left >= 1:
+			i++
+			args.by = commands[i]
+			// like redis, weights that are the same for every element do not sort
+			args.noSort = !strings.Contains(args.by, "*")
+		case option == "GET" && left >= 1:
+			i++
+			args.gets = append(args.gets, commands[i])
+		case option == "STORE" && left >= 1 && !readOnly:
+			i++
+			args.store = commands[i]
+		default:
+			return args, errors.New("ERR syntax error")
+		}
+	}
+
+	return args, nil
+}
+
+// SortKeys returns the key that SORT sorts, and its STORE destination (if any).
+func SortKeys(commands []string) []string {
+	args, err := parseSortArguments(commands)
+	if err != nil {
+		return nil
+	}
+	if args.store == "" {
+		return []string{args.key}
+	}
+	return []string{args.key, args.store}
+}
+
+// SortStores returns whether SORT has a STORE destination, only then is it a write.
+func SortStores(commands []string) bool {
+	args, err := parseSortArguments(commands)
+	return err == nil && args.store != ""
+}
+
+// SortLookups returns the option (BY or GET) whose pattern looks up other keys, if any does.
+// Like redis, "#" and BY without "*" do not.
+func SortLookups(commands []string) string {
+	args, err := parseSortArguments(commands)
+	switch {
+	case err != nil:
+		return ""
+	case args.by != "" && !args.noSort:
+		return "BY"
+	case slices.ContainsFunc(args.gets, func(pattern string) bool { return pattern != "#" }):
+		return "GET"
+	}
+	return ""
+}
+
+// lookupPattern returns the value of the key that the pattern makes for the element, like redis:
+// "#" is the element itself, the first "*" is replaced by the element, and "key->field" is the field of a hash.
+func lookupPattern(s *store.Store, pattern, element string) (string, bool) {
+	if pattern == "#" {
+		return element, true
+	}
+	star := strings.Index(pattern, "*")
+	if star == -1 {
+		// a fixed key is the same for every element
+		return "", false
+	}
+
+	if arrow := strings.Index(pattern[star+1:], "->"); arrow != -1 && star+1+arrow+2 < len(pattern) {
+		// there are no hashes yet, so the fields of hashes are never found
+		return "", false
+	}
+
+	item, ok := s.Get(pattern[:star] + element + pattern[star+1:])
+	if !ok {
+		return "", false
+	}
+	return item.Get()
+}
+
+type sortElement struct {
+	value string
+	// weight is the value to sort by (for ALPHA), or score is (otherwise).
+	weight    string
+	hasWeight bool
+	score     float64
+}
+
+func sortElements(s *store.Store, args sortArgs, elements []string) ([]string, error) {
+	if args.noSort {
+		return elements, nil
+	}
+
+	sorted := make([]sortElement, len(elements))
+	for i, element := range elements {
+		e := sortElement{value: element, weight: element, hasWeight: true}
+		if args.by != "" {
+			e.weight, e.hasWeight = lookupPattern(s, args.by, element)
+		}
+		if !args.alpha && e.hasWeight {
+			score, err := strconv.ParseFloat(e.weight, 64)
+			if err != nil || math.IsNaN(score) {
+				return nil, errors.New("ERR One or more scores can't be converted into double")
+			}
+			e.score = score
+		}
+		sorted[i] = e
+	}
+
+	slices.SortStableFunc(sorted, func(a, b sortElement) int {
+		var cmp int
+		switch {
+		case !args.alpha:
+			// missing weights are 0
+			cmp = compareFloats(a.score, b.score)
+		case a.hasWeight != b.hasWeight:
+			// missing weights are first
+			cmp = -1
+			if a.hasWeight {
+				cmp = 1
+			}
+		default:
+			cmp = strings.Compare(a.weight, b.weight)
+		}
+		if cmp == 0 {
+			// like redis, the elements break ties, so that the order is deterministic
+			cmp = strings.Compare(a.value, b.value)
+		}
+		if args.desc {
+			return -cmp
+		}
+		return cmp
+	})
+
+	ret := make([]string, len(sorted))
+	for i, e := range sorted {
+		ret[i] = e.value
+	}
+	return ret, nil
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func Sort(c *client.Client, commands []string) (string, bool) {
+	args, err := parseSortArguments(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+
+	s := c.Store
+	var elements []string
+	if item, ok := s.Get(args.key); ok {
+		// only lists can be sorted, there are no sets or sorted sets yet
+		if elements, ok = item.LRange(0, -1); !ok {
+			return wrongTypeError(item)
+		}
+	}
+
+	elements, err = sortElements(s, args, elements)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+	start := min(args.offset, len(elements))
+	end := len(elements)
+	if args.count >= 0 {
+		end = min(start+args.count, end)
+	}
+	elements = elements[start:end]
+
+	ret := []messages.Message{}
+	var values []string
+	for _, element := range elements {
+		if len(args.gets) == 0 {
+			ret = append(ret, messages.NewBulkString(element))
+			values = append(values, element)
+			continue
+		}
+		for _, pattern := range args.gets {
+			value, ok := lookupPattern(s, pattern, element)
+			if ok {
+				ret = append(ret, messages.NewBulkString(value))
+			} else {
+				ret = append(ret, messages.NewNullBulkString())
+			}
+			// missing values are stored as empty strings
+			values = append(values, value)
+		}
+	}
+
+	if args.store == "" {
+		return messages.NewArray(ret).Serialise(), true
+	}
+
+	if len(values) == 0 {
+		for _, key := range s.DeleteMany([]string{args.store}) {
+			s.Notify(pubsub.Generic, "del", key)
+		}
+	} else {
+		if err := s.Set(args.store, items.NewListBuilder().Add(values).Build()); err != nil {
+			return messages.GetError(err), true
+		}
+		s.Notify(pubsub.List, "sortstore", args.store)
+	}
+	return messages.NewInteger(int64(len(values))).Serialise(), true
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func TestSort(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("nums", items.NewListBuilder().Add([]string{"3", "10", "1", "2.5", "-1"}).Build())
+	s.Set("users", items.NewListBuilder().Add([]string{"bob", "alice", "carol", "dave"}).Build())
+	s.Set("words", items.NewListBuilder().Add([]string{"b", "a", "c"}).Build())
+	s.Set("str", items.NewString("v"))
+	for k, v := range map[string]string{
+		"weight_bob": "2", "weight_alice": "3", "weight_carol": "1",
+		"name_bob": "Bob", "name_alice": "Alice",
+	} {
+		s.Set(k, items.NewString(v))
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"numeric", "SORT nums", "*5\r\n$2\r\n-1\r\n$1\r\n1\r\n$3\r\n2.5\r\n$1\r\n3\r\n$2\r\n10\r\n"},
+		{"desc", "SORT nums DESC LIMIT 0 2", "*2\r\n$2\r\n10\r\n$1\r\n3\r\n"},
+		{"limit", "SORT nums LIMIT 1 2", "*2\r\n$1\r\n1\r\n$3\r\n2.5\r\n"},
+		{"limit_past_end", "SORT nums LIMIT 10 2", "*0\r\n"},
+		{"limit_negative_count", "SORT nums LIMIT 3 -1", "*2\r\n$1\r\n3\r\n$2\r\n10\r\n"},
+		{"not_numbers", "SORT words", "-ERR One or more scores can't be converted into double\r\n"},
+		{"alpha", "SORT words ALPHA DESC", "*3\r\n$1\r\nc\r\n$1\r\nb\r\n$1\r\na\r\n"},
+		// dave has no weight, so it is 0
+		{"by", "SORT users BY weight_*", "*4\r\n$4\r\ndave\r\n$5\r\ncarol\r\n$3\r\nbob\r\n$5\r\nalice\r\n"},
+		{"by_alpha", "SORT users BY name_* ALPHA", "*4\r\n$5\r\ncarol\r\n$4\r\ndave\r\n$5\r\nalice\r\n$3\r\nbob\r\n"},
+		{"by_fixed", "SORT users BY nosort", "*4\r\n$3\r\nbob\r\n$5\r\nalice\r\n$5\r\ncarol\r\n$4\r\ndave\r\n"},
+		{"get", "SORT users BY weight_* LIMIT 2 2 GET # GET name_* GET weight_*", "*6\r\n$3\r\nbob\r\n$3\r\nBob\r\n$1\r\n2\r\n$5\r\nalice\r\n$5\r\nAlice\r\n$1\r\n3\r\n"},
+		{"get_hash", "SORT users BY nosort LIMIT 0 1 GET user_*->name", "*1\r\n$-1\r\n"},
+		{"get_fixed", "SORT words ALPHA LIMIT 0 1 GET name_bob", "*1\r\n$-1\r\n"},
+		{"missing", "SORT missing", "*0\r\n"},
+		{"wrong_type", "SORT str", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"syntax", "SORT nums LIMIT 1", "-ERR syntax error\r\n"},
+		{"limit_integer", "SORT nums LIMIT a 1", "-ERR value is not an integer or out of range\r\n"},
+		{"read_only_store", "SORT_RO nums STORE dest", "-ERR syntax error\r\n"},
+		{"read_only", "SORT_RO words ALPHA", "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ret, _ := Sort(c, strings.Split(test.command, " "))
+			EqualO(t, ret, test.expected)
+		})
+	}
+	IsFalse(t, s.Exists("dest"), "SORT_RO should not store")
+}
+
+func TestSortStore(t *testing.T) {
+	c := newClient(t)
+	s := c.Store
+	s.Set("users", items.NewListBuilder().Add([]string{"bob", "alice"}).Build())
+	s.Set("name_bob", items.NewString("Bob"))
+
+	ret, _ := Sort(c, []string{"SORT", "users", "ALPHA", "GET", "#", "GET", "name_*", "STORE", "dest"})
+	EqualO(t, ret, messages.NewInteger(4).Serialise())
+	item, _ := s.Get("dest")
+	values, _ := item.LRange(0, -1)
+	// missing values are stored as empty strings
+	EqualO(t, values, []string{"alice", "", "bob", "Bob"})
+
+	// an empty result deletes the destination
+	ret, _ = Sort(c, []string{"SORT", "missing", "STORE", "dest"})
+	EqualO(t, ret, messages.NewInteger(0).Serialise())
+	IsFalse(t, s.Exists("dest"), "")
+
+	EqualO(t, SortKeys([]string{"SORT", "users", "STORE", "dest"}), []string{"users", "dest"})
+	EqualO(t, SortKeys([]string{"SORT_RO", "users", "BY", "w_*"}), []string{"users"})
+	IsTrue(t, SortStores([]string{"SORT", "users", "STORE", "dest"}), "")
+	IsFalse(t, SortStores([]string{"SORT", "users"}), "")
+}
+
+func TestSortLookups(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"SORT users", ""},
+		{"SORT users BY nosort GET #", ""},
+		{"SORT users BY weight_*", "BY"},
+		{"SORT_RO users GET # GET name_*", "GET"},
+		// a fixed key is looked up too
+		{"SORT users GET name", "GET"},
+		{"SORT users BY", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			EqualO(t, SortLookups(strings.Split(test.command, " ")), test.expected)
+		})
+	}
+}
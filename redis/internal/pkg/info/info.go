@@ -0,0 +1,246 @@
+// Package info implements INFO, which reports the state of the server in sections.
+package info
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/replication"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	InfoCommand = "INFO"
+
+	// RedisVersion is the version of redis whose behaviour this follows, for clients that check it.
+	RedisVersion = "7.2.4"
+)
+
+// Stats are the counters collected by the router (and the server, for connections).
+type Stats struct {
+	ConnectedClients         atomic.Int64
+	TotalConnectionsReceived atomic.Int64
+	TotalCommandsProcessed   atomic.Int64
+	TotalErrorReplies        atomic.Int64
+}
+
+// Reset sets the counters to 0, except for ConnectedClients (which is not a counter).
+func (s *Stats) Reset() {
+	s.TotalConnectionsReceived.Store(0)
+	s.TotalCommandsProcessed.Store(0)
+	s.TotalErrorReplies.Store(0)
+}
+
+// Sources are what INFO reports on.
+type Sources struct {
+	Stats       *Stats
+	Store       *store.Store
+	Replication *replication.Replication
+	PubSub      *pubsub.PubSub
+	// ClusterEnabled is set if the server is in cluster mode.
+	ClusterEnabled bool
+	// TCPPort is 0 if the server is not listening on TCP.
+	TCPPort int
+	// ConfigFile is empty if the server is running without a config file.
+	ConfigFile string
+}
+
+// Info reports on the sources. To construct one, use `New`.
+type Info struct {
+	src     Sources
+	started time.Time
+	// runID identifies this run of the server, it is random.
+	runID string
+}
+
+func New(src Sources) *Info {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return &Info{src: src, started: time.Now(), runID: hex.EncodeToString(b)}
+}
+
+// section is a named group of "field:value" lines.
+type section struct {
+	name  string
+	lines func(i *Info, now time.Time) []string
+}
+
+// sections are in the order that they are reported.
+var sections = []section{
+	{"Server", (*Info).server},
+	{"Clients", (*Info).clients},
+	{"Memory", (*Info).memory},
+	{"Persistence", (*Info).persistence},
+	{"Stats", (*Info).stats},
+	{"Replication", (*Info).replication},
+	{"Cluster", (*Info).cluster},
+	{"Keyspace", (*Info).keyspace},
+}
+
+// INFO [section ...]
+func (i *Info) Command(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], InfoCommand) {
+		return "", false
+	}
+
+	return messages.NewBulkString(i.Report(commands[1:]...)).Serialise(), true
+}
+
+// Report returns the sections with the names (case-insensitively), or all of them if there are no names (or "all", "default" or "everything").
+// Unknown names are ignored.
+func (i *Info) Report(names ...string) string {
+	all := len(names) == 0
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "all", "default", "everything":
+			all = true
+		}
+	}
+
+	now := time.Now()
+	ret := []string{}
+	for _, s := range sections {
+		if !all && !slices.ContainsFunc(names, func(name string) bool { return strings.EqualFold(name, s.name) }) {
+			continue
+		}
+		var b strings.Builder
+		b.WriteString("# " + s.name + "\r\n")
+		for _, line := range s.lines(i, now) {
+			b.WriteString(line + "\r\n")
+		}
+		ret = append(ret, b.String())
+	}
+	return strings.Join(ret, "\r\n")
+}
+
+func (i *Info) server(now time.Time) []string {
+	mode := "standalone"
+	if i.src.ClusterEnabled {
+		mode = "cluster"
+	}
+	uptime := int64(now.Sub(i.started).Seconds())
+
+	return []string{
+		"redis_version:" + RedisVersion,
+		"redis_mode:" + mode,
+		"os:" + runtime.GOOS + " " + runtime.GOARCH,
+		"arch_bits:" + strconv.Itoa(strconv.IntSize),
+		"go_version:" + runtime.Version(),
+		"process_id:" + strconv.Itoa(os.Getpid()),
+		"run_id:" + i.runID,
+		"tcp_port:" + strconv.Itoa(i.src.TCPPort),
+		"server_time_usec:" + strconv.FormatInt(now.UnixMicro(), 10),
+		"uptime_in_seconds:" + strconv.FormatInt(uptime, 10),
+		"uptime_in_days:" + strconv.FormatInt(uptime/(24*60*60), 10),
+		"config_file:" + i.src.ConfigFile,
+	}
+}
+
+func (i *Info) clients(time.Time) []string {
+	return []string{
+		"connected_clients:" + strconv.FormatInt(i.src.Stats.ConnectedClients.Load(), 10),
+	}
+}
+
+func (i *Info) memory(time.Time) []string {
+	used := i.src.Store.UsedMemory()
+	maxMemory := i.src.Store.MaxMemory()
+
+	return []string{
+		"used_memory:" + strconv.FormatInt(used, 10),
+		"used_memory_human:" + humanBytes(used),
+		"maxmemory:" + strconv.FormatInt(maxMemory, 10),
+		"maxmemory_human:" + humanBytes(maxMemory),
+		"maxmemory_policy:" + string(i.src.Store.EvictionPolicy()),
+	}
+}
+
+// humanBytes formats the number of bytes like redis (e.g. 1.50K).
+func humanBytes(n int64) string {
+	units := []string{"K", "M", "G", "T", "P"}
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + "B"
+	}
+	f := float64(n)
+	unit := ""
+	for _, u := range units {
+		if f < 1024 {
+			break
+		}
+		f /= 1024
+		unit = u
+	}
+	return fmt.Sprintf("%.2f%s", f, unit)
+}
+
+func (i *Info) persistence(time.Time) []string {
+	lastSave, ok := i.src.Store.LastSave()
+	status := "ok"
+	if !ok {
+		status = "err"
+	}
+
+	return []string{
+		"loading:0",
+		"rdb_last_save_time:" + strconv.FormatInt(lastSave.Unix(), 10),
+		"rdb_last_bgsave_status:" + status,
+	}
+}
+
+func (i *Info) stats(time.Time) []string {
+	st := i.src.Stats
+	storeStats := i.src.Store.Stats()
+	var channels, patterns int64
+	if i.src.PubSub != nil {
+		channels = int64(len(i.src.PubSub.Channels("")))
+		patterns = i.src.PubSub.NumPat()
+	}
+
+	return []string{
+		"total_connections_received:" + strconv.FormatInt(st.TotalConnectionsReceived.Load(), 10),
+		"total_commands_processed:" + strconv.FormatInt(st.TotalCommandsProcessed.Load(), 10),
+		"total_error_replies:" + strconv.FormatInt(st.TotalErrorReplies.Load(), 10),
+		"expired_keys:" + strconv.FormatInt(storeStats.ExpiredKeys.Load(), 10),
+		"evicted_keys:" + strconv.FormatInt(storeStats.EvictedKeys.Load(), 10),
+		"keyspace_hits:" + strconv.FormatInt(storeStats.KeyspaceHits.Load(), 10),
+		"keyspace_misses:" + strconv.FormatInt(storeStats.KeyspaceMisses.Load(), 10),
+		"pubsub_channels:" + strconv.FormatInt(channels, 10),
+		"pubsub_patterns:" + strconv.FormatInt(patterns, 10),
+	}
+}
+
+func (i *Info) replication(time.Time) []string {
+	if i.src.Replication == nil {
+		return []string{"role:" + string(replication.RoleMaster), "connected_slaves:0"}
+	}
+	return i.src.Replication.Info()
+}
+
+func (i *Info) cluster(time.Time) []string {
+	enabled := 0
+	if i.src.ClusterEnabled {
+		enabled = 1
+	}
+	return []string{"cluster_enabled:" + strconv.Itoa(enabled)}
+}
+
+func (i *Info) keyspace(time.Time) []string {
+	keys, expires := i.src.Store.Keyspace()
+	if keys == 0 {
+		// like redis, empty databases are not reported
+		return nil
+	}
+	return []string{fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=0", keys, expires)}
+}
@@ -0,0 +1,80 @@
+package info
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+)
+
+// fields parses a report into its fields, by section.
+func fields(report string) map[string]map[string]string {
+	ret := map[string]map[string]string{}
+	var current map[string]string
+	for _, line := range strings.Split(report, "\r\n") {
+		if name, ok := strings.CutPrefix(line, "# "); ok {
+			current = map[string]string{}
+			ret[name] = current
+		} else if field, value, ok := strings.Cut(line, ":"); ok {
+			current[field] = value
+		}
+	}
+	return ret
+}
+
+func TestReport(t *testing.T) {
+	st := store.New()
+	st.Set("k", items.NewString("v"))
+	st.Get("k")
+	st.Get("missing")
+	stats := &Stats{}
+	stats.ConnectedClients.Store(2)
+	stats.TotalCommandsProcessed.Store(10)
+
+	i := New(Sources{Stats: stats, Store: st, PubSub: pubsub.New(), TCPPort: 6379, ConfigFile: "/etc/redis.conf"})
+
+	all := fields(i.Report())
+	EqualO(t, len(all), len(sections))
+	EqualO(t, all["Server"]["tcp_port"], "6379")
+	EqualO(t, all["Server"]["config_file"], "/etc/redis.conf")
+	EqualO(t, all["Server"]["redis_mode"], "standalone")
+	EqualO(t, all["Clients"]["connected_clients"], "2")
+	EqualO(t, all["Memory"]["maxmemory_policy"], "noeviction")
+	EqualO(t, all["Persistence"]["rdb_last_bgsave_status"], "ok")
+	EqualO(t, all["Stats"]["total_commands_processed"], "10")
+	EqualO(t, all["Stats"]["keyspace_hits"], "1")
+	EqualO(t, all["Stats"]["keyspace_misses"], "1")
+	EqualO(t, all["Replication"]["role"], "master")
+	EqualO(t, all["Cluster"]["cluster_enabled"], "0")
+	EqualO(t, all["Keyspace"]["db0"], "keys=1,expires=0,avg_ttl=0")
+
+	some := fields(i.Report("clients", "STATS", "unknown"))
+	EqualO(t, len(some), 2)
+	IsTrue(t, some["Clients"] != nil && some["Stats"] != nil, "sections=%v", some)
+	EqualO(t, len(fields(i.Report("everything"))), len(sections))
+
+	stats.Reset()
+	EqualO(t, stats.TotalCommandsProcessed.Load(), int64(0))
+	EqualO(t, stats.ConnectedClients.Load(), int64(2))
+}
+
+func TestHumanBytes(t *testing.T) {
+	EqualO(t, humanBytes(0), "0B")
+	EqualO(t, humanBytes(1023), "1023B")
+	EqualO(t, humanBytes(1536), "1.50K")
+	EqualO(t, humanBytes(100*1024*1024), "100.00M")
+}
+
+func TestCommand(t *testing.T) {
+	i := New(Sources{Stats: &Stats{}, Store: store.New()})
+
+	reply, ok := i.Command([]string{"info", "cluster"})
+	IsTrue(t, ok, "INFO should be handled")
+	EqualO(t, reply, "$30\r\n# Cluster\r\ncluster_enabled:0\r\n\r\n")
+
+	_, ok = i.Command([]string{"GET", "k"})
+	IsFalse(t, ok, "GET should not be handled")
+}
@@ -0,0 +1,180 @@
+// Package latency implements LATENCY, which records the events (e.g. expiry cycles) that took longer than a threshold.
+package latency
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/operate/oss_and_stack/management/optimization/latency-monitor/
+
+const LatencyCommand = "LATENCY"
+
+// Events that are monitored.
+const (
+	Command       = "command"
+	FastCommand   = "fast-command"
+	ExpireCycle   = "expire-cycle"
+	EvictionCycle = "eviction-cycle"
+	Save          = "save"
+	Load          = "load"
+)
+
+// historyLen is the number of samples kept for each event, like redis.
+const historyLen = 160
+
+// Sample is a latency (in milliseconds, like redis) of an event.
+type Sample struct {
+	Time    time.Time
+	Latency int64
+}
+
+// series is the history of an event, with the largest latency seen.
+type series struct {
+	samples []Sample
+	max     int64
+}
+
+// Monitor records events that took at least its threshold. To construct one, use `New`.
+type Monitor struct {
+	// threshold is in milliseconds, events are not recorded if it is 0.
+	threshold atomic.Int64
+
+	mu     sync.Mutex
+	events map[string]*series
+}
+
+func New() *Monitor {
+	return &Monitor{events: make(map[string]*series)}
+}
+
+// SetThreshold sets the minimum latency of the events that are recorded, or stops recording them if it is 0.
+func (m *Monitor) SetThreshold(threshold time.Duration) {
+	m.threshold.Store(threshold.Milliseconds())
+}
+
+// Add records the event, if it took at least the threshold. It may be called on a nil Monitor, which records nothing.
+func (m *Monitor) Add(event string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	threshold := m.threshold.Load()
+	ms := d.Milliseconds()
+	if threshold == 0 || ms < threshold {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.events[event]
+	if !ok {
+		s = &series{}
+		m.events[event] = s
+	}
+	now := time.Now()
+	if n := len(s.samples); n > 0 && s.samples[n-1].Time.Unix() == now.Unix() {
+		// like redis, there is one sample per second, with the largest latency
+		s.samples[n-1].Latency = max(s.samples[n-1].Latency, ms)
+	} else {
+		if n == historyLen {
+			s.samples = s.samples[1:]
+		}
+		s.samples = append(s.samples, Sample{Time: now, Latency: ms})
+	}
+	s.max = max(s.max, ms)
+}
+
+// History returns the samples of the event, oldest first.
+func (m *Monitor) History(event string) []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s, ok := m.events[event]; ok {
+		return slices.Clone(s.samples)
+	}
+	return nil
+}
+
+// Reset forgets the events (or all of them, if there are none), returning the number of events forgotten.
+func (m *Monitor) Reset(events ...string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(events) == 0 {
+		n := len(m.events)
+		clear(m.events)
+		return n
+	}
+	n := 0
+	for _, event := range events {
+		if _, ok := m.events[strings.ToLower(event)]; ok {
+			delete(m.events, strings.ToLower(event))
+			n++
+		}
+	}
+	return n
+}
+
+// LATENCY subcommand [arguments ...]
+func (m *Monitor) Command(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], LatencyCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return messages.GetErrorString("ERR wrong number of arguments for command"), true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "LATEST":
+		return m.latest(), true
+	case "HISTORY":
+		if len(args) != 1 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		ret := []messages.Message{}
+		for _, s := range m.History(strings.ToLower(args[0])) {
+			ret = append(ret, messages.NewArray([]messages.Message{
+				messages.NewInteger(s.Time.Unix()),
+				messages.NewInteger(s.Latency),
+			}))
+		}
+		return messages.NewArray(ret).Serialise(), true
+	case "RESET":
+		return messages.NewInteger(int64(m.Reset(args...))).Serialise(), true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try LATENCY HELP."), true
+	}
+}
+
+// latest replies with the event name, time and latency of the latest sample, and the largest latency, of each event.
+func (m *Monitor) latest() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.events))
+	for name := range m.events {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	ret := []messages.Message{}
+	for _, name := range names {
+		s := m.events[name]
+		last := s.samples[len(s.samples)-1]
+		ret = append(ret, messages.NewArray([]messages.Message{
+			messages.NewBulkString(name),
+			messages.NewInteger(last.Time.Unix()),
+			messages.NewInteger(last.Latency),
+			messages.NewInteger(s.max),
+		}))
+	}
+	return messages.NewArray(ret).Serialise()
+}
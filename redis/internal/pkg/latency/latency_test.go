@@ -0,0 +1,47 @@
+package latency
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func TestMonitor(t *testing.T) {
+	m := New()
+	// disabled by default
+	m.Add(ExpireCycle, time.Second)
+	EqualO(t, len(m.History(ExpireCycle)), 0)
+
+	m.SetThreshold(100 * time.Millisecond)
+	m.Add(ExpireCycle, 50*time.Millisecond)
+	EqualO(t, len(m.History(ExpireCycle)), 0)
+	m.Add(ExpireCycle, 200*time.Millisecond)
+	m.Add(ExpireCycle, 300*time.Millisecond)
+	m.Add(Save, 100*time.Millisecond)
+
+	// samples in the same second are merged
+	history := m.History(ExpireCycle)
+	EqualO(t, len(history), 1)
+	EqualO(t, history[0].Latency, int64(300))
+
+	reply, _ := m.Command([]string{"LATENCY", "LATEST"})
+	IsTrue(t, strings.HasPrefix(reply, "*2\r\n*4\r\n$12\r\nexpire-cycle\r\n"), "reply=%q", reply)
+	IsTrue(t, strings.Contains(reply, ":300\r\n:300\r\n*4\r\n$4\r\nsave\r\n"), "reply=%q", reply)
+
+	reply, _ = m.Command([]string{"latency", "history", "SAVE"})
+	IsTrue(t, strings.HasPrefix(reply, "*1\r\n*2\r\n:") && strings.HasSuffix(reply, ":100\r\n"), "reply=%q", reply)
+
+	reply, _ = m.Command([]string{"LATENCY", "RESET", "save", "unknown"})
+	EqualO(t, reply, messages.NewInteger(1).Serialise())
+	reply, _ = m.Command([]string{"LATENCY", "RESET"})
+	EqualO(t, reply, messages.NewInteger(1).Serialise())
+	reply, _ = m.Command([]string{"LATENCY", "LATEST"})
+	EqualO(t, reply, "*0\r\n")
+
+	// a nil monitor records nothing
+	var none *Monitor
+	none.Add(Save, time.Hour)
+}
@@ -1,7 +1,9 @@
 package logging
 
 import (
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -23,20 +25,30 @@ func setLogLevel() {
 		logLevel = defaultLogLevel
 	}
 
-	switch logLevel {
-	case "TRACE":
-		zerolog.SetGlobalLevel(zerolog.TraceLevel)
-	case "DEBUG":
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	case "INFO":
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	case "WARN":
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
-	case "ERROR":
-		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
-	case "FATAL":
-		zerolog.SetGlobalLevel(zerolog.FatalLevel)
-	case "PANIC":
-		zerolog.SetGlobalLevel(zerolog.PanicLevel)
+	SetLevel(logLevel)
+}
+
+// levels are the log levels, with redis' names (for loglevel) mapped to the closest ones.
+var levels = map[string]zerolog.Level{
+	"TRACE":   zerolog.TraceLevel,
+	"DEBUG":   zerolog.DebugLevel,
+	"INFO":    zerolog.InfoLevel,
+	"VERBOSE": zerolog.InfoLevel,
+	"WARN":    zerolog.WarnLevel,
+	"NOTICE":  zerolog.WarnLevel,
+	"WARNING": zerolog.WarnLevel,
+	"ERROR":   zerolog.ErrorLevel,
+	"FATAL":   zerolog.FatalLevel,
+	"PANIC":   zerolog.PanicLevel,
+	"NOTHING": zerolog.Disabled,
+}
+
+// SetLevel sets the log level (e.g. "debug", or redis' "verbose"), case-insensitively.
+func SetLevel(name string) error {
+	level, ok := levels[strings.ToUpper(name)]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", name)
 	}
+	zerolog.SetGlobalLevel(level)
+	return nil
 }
@@ -0,0 +1,122 @@
+// Package metrics collects latencies, and writes metrics in the Prometheus text format.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Buckets are the upper bounds (in seconds) of the buckets of every histogram, from 10µs to 10s.
+var Buckets = [...]float64{
+	0.00001, 0.000025, 0.00005,
+	0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005,
+	0.01, 0.025, 0.05,
+	0.1, 0.25, 0.5,
+	1, 2.5, 5, 10,
+}
+
+// Histogram counts durations by bucket. The zero value is ready to use.
+type Histogram struct {
+	// counts are not cumulative, the last one is for durations above the largest bucket.
+	counts [len(Buckets) + 1]atomic.Int64
+	count  atomic.Int64
+	// sum is in nanoseconds.
+	sum atomic.Int64
+}
+
+// Observe records a duration.
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := 0
+	for i < len(Buckets) && seconds > Buckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+	h.count.Add(1)
+}
+
+// Count returns the number of durations recorded.
+func (h *Histogram) Count() int64 {
+	return h.count.Load()
+}
+
+// Sum returns the total of the durations recorded.
+func (h *Histogram) Sum() time.Duration {
+	return time.Duration(h.sum.Load())
+}
+
+// Cumulative returns the number of durations less than or equal to each bucket (like Prometheus' le), excluding +Inf.
+func (h *Histogram) Cumulative() []int64 {
+	ret := make([]int64, len(Buckets))
+	total := int64(0)
+	for i := range Buckets {
+		total += h.counts[i].Load()
+		ret[i] = total
+	}
+	return ret
+}
+
+// Reset sets all counts to 0.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		h.counts[i].Store(0)
+	}
+	h.count.Store(0)
+	h.sum.Store(0)
+}
+
+// Commands holds a histogram of latencies per command. The zero value is ready to use.
+type Commands struct {
+	mu         sync.RWMutex
+	histograms map[string]*Histogram
+}
+
+// Observe records the latency of a call to the command.
+func (c *Commands) Observe(command string, d time.Duration) {
+	c.mu.RLock()
+	h, ok := c.histograms[command]
+	c.mu.RUnlock()
+	if !ok {
+		c.mu.Lock()
+		if c.histograms == nil {
+			c.histograms = map[string]*Histogram{}
+		}
+		if h, ok = c.histograms[command]; !ok {
+			h = &Histogram{}
+			c.histograms[command] = h
+		}
+		c.mu.Unlock()
+	}
+	h.Observe(d)
+}
+
+// Get returns the histogram of the command, or nil if it has not been called.
+func (c *Commands) Get(command string) *Histogram {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.histograms[command]
+}
+
+// Names returns the commands that have been called, in no particular order.
+func (c *Commands) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ret := make([]string, 0, len(c.histograms))
+	for name := range c.histograms {
+		ret = append(ret, name)
+	}
+	return ret
+}
+
+// Reset forgets all calls.
+func (c *Commands) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.histograms = nil
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := &Histogram{}
+	h.Observe(5 * time.Microsecond)
+	h.Observe(time.Millisecond)
+	h.Observe(time.Minute)
+
+	EqualO(t, h.Count(), int64(3))
+	EqualO(t, h.Sum(), time.Minute+time.Millisecond+5*time.Microsecond)
+	cumulative := h.Cumulative()
+	EqualO(t, cumulative[0], int64(1))
+	// le is inclusive
+	EqualO(t, cumulative[6], int64(2))
+	// above the largest bucket is only counted in +Inf
+	EqualO(t, cumulative[len(cumulative)-1], int64(2))
+
+	h.Reset()
+	EqualO(t, h.Count(), int64(0))
+	EqualO(t, h.Cumulative()[len(Buckets)-1], int64(0))
+}
+
+func TestCommands(t *testing.T) {
+	c := &Commands{}
+	EqualO(t, c.Get("get") == nil, true)
+
+	c.Observe("get", time.Millisecond)
+	c.Observe("get", time.Millisecond)
+	c.Observe("set", time.Millisecond)
+	EqualO(t, c.Get("get").Count(), int64(2))
+	EqualO(t, len(c.Names()), 2)
+
+	c.Reset()
+	EqualO(t, len(c.Names()), 0)
+}
+
+func TestWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b)
+	w.Counter("calls_total", "Number of calls.\nBy command.",
+		Sample{Labels: []Label{{"command", `a"b\c`}}, Value: 3},
+	)
+	w.Gauge("clients", "Clients.", Sample{Value: 1.5})
+	h := &Histogram{}
+	h.Observe(time.Second)
+	w.Histogram("latency_seconds", "Latency.", LabeledHistogram{Labels: []Label{{"command", "get"}}, Histogram: h})
+	NoError(t, w.Flush())
+
+	out := b.String()
+	for _, line := range []string{
+		`# HELP calls_total Number of calls.\nBy command.`,
+		`# TYPE calls_total counter`,
+		`calls_total{command="a\"b\\c"} 3`,
+		`# TYPE clients gauge`,
+		`clients 1.5`,
+		`# TYPE latency_seconds histogram`,
+		`latency_seconds_bucket{command="get",le="0.5"} 0`,
+		`latency_seconds_bucket{command="get",le="1"} 1`,
+		`latency_seconds_bucket{command="get",le="+Inf"} 1`,
+		`latency_seconds_sum{command="get"} 1`,
+		`latency_seconds_count{command="get"} 1`,
+	} {
+		IsTrue(t, strings.Contains(out, line+"\n"), "missing %q in:\n%s", line, out)
+	}
+}
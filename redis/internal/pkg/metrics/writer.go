@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Label is a name and value that identify a sample (e.g. command="get").
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Writer writes metrics in the Prometheus text format.
+// Each metric must be written once, with all of its samples; see https://prometheus.io/docs/instrumenting/exposition_formats/.
+type Writer struct {
+	w *bufio.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Flush writes any buffered metrics.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) header(name, kind, help string) {
+	w.w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func (w *Writer) sample(name string, labels []Label, value string) {
+	w.w.WriteString(name)
+	if len(labels) > 0 {
+		w.w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.w.WriteByte(',')
+			}
+			w.w.WriteString(l.Name + `="` + escapeLabel(l.Value) + `"`)
+		}
+		w.w.WriteByte('}')
+	}
+	w.w.WriteString(" " + value + "\n")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Sample is a value with its labels, for metrics with several samples.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Counter writes a counter (a value that only goes up, until it is reset).
+func (w *Writer) Counter(name, help string, samples ...Sample) {
+	w.header(name, "counter", help)
+	for _, s := range samples {
+		w.sample(name, s.Labels, formatFloat(s.Value))
+	}
+}
+
+// Gauge writes a gauge (a value that goes up and down).
+func (w *Writer) Gauge(name, help string, samples ...Sample) {
+	w.header(name, "gauge", help)
+	for _, s := range samples {
+		w.sample(name, s.Labels, formatFloat(s.Value))
+	}
+}
+
+// LabeledHistogram is a histogram with its labels, for metrics with several histograms.
+type LabeledHistogram struct {
+	Labels    []Label
+	Histogram *Histogram
+}
+
+// Histogram writes histograms, in seconds.
+func (w *Writer) Histogram(name, help string, histograms ...LabeledHistogram) {
+	w.header(name, "histogram", help)
+	for _, lh := range histograms {
+		h := lh.Histogram
+		for i, count := range h.Cumulative() {
+			labels := append(append([]Label{}, lh.Labels...), Label{"le", formatFloat(Buckets[i])})
+			w.sample(name+"_bucket", labels, strconv.FormatInt(count, 10))
+		}
+		// the total is read after the buckets, so that +Inf is never less than them
+		count := strconv.FormatInt(h.Count(), 10)
+		w.sample(name+"_bucket", append(append([]Label{}, lh.Labels...), Label{"le", "+Inf"}), count)
+		w.sample(name+"_sum", lh.Labels, formatFloat(h.Sum().Seconds()))
+		w.sample(name+"_count", lh.Labels, count)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
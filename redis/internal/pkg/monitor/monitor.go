@@ -0,0 +1,137 @@
+// Package monitor implements MONITOR, which streams the commands that the server handles.
+package monitor
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/commands/monitor/
+
+const MonitorCommand = "MONITOR"
+
+// Monitors are the subscribers that are sent every command. To construct one, use `New`.
+type Monitors struct {
+	// count is the number of monitors, so that commands are only formatted while someone is watching.
+	count    atomic.Int64
+	mu       sync.RWMutex
+	monitors map[*pubsub.Subscriber]struct{}
+}
+
+func New() *Monitors {
+	return &Monitors{monitors: make(map[*pubsub.Subscriber]struct{})}
+}
+
+// Add starts sending commands to the subscriber, until it is removed.
+func (m *Monitors) Add(sub *pubsub.Subscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.monitors[sub]; !ok {
+		m.monitors[sub] = struct{}{}
+		m.count.Add(1)
+	}
+}
+
+func (m *Monitors) Remove(sub *pubsub.Subscriber) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.monitors[sub]; ok {
+		delete(m.monitors, sub)
+		m.count.Add(-1)
+	}
+}
+
+// Active returns whether there are any monitors.
+func (m *Monitors) Active() bool {
+	return m.count.Load() > 0
+}
+
+// Feed sends the command, from the client at addr, to the monitors.
+func (m *Monitors) Feed(now time.Time, addr string, commands []string) {
+	if !m.Active() {
+		return
+	}
+	line := Format(now, addr, commands)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for sub := range m.monitors {
+		sub.Send(line)
+	}
+}
+
+// Format returns the line sent to monitors for the command, like redis:
+// +1339518083.107412 [0 127.0.0.1:60866] "set" "k" "v"
+func Format(now time.Time, addr string, commands []string) string {
+	var b strings.Builder
+	b.WriteString("+" + strconv.FormatInt(now.Unix(), 10) + ".")
+	micros := strconv.Itoa(now.Nanosecond() / 1000)
+	b.WriteString(strings.Repeat("0", 6-len(micros)) + micros)
+	b.WriteString(" [0 " + addr + "]")
+	for _, arg := range commands {
+		b.WriteString(" " + repr(arg))
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// repr quotes the argument like redis' sdscatrepr, so that the line has no newlines.
+func repr(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		default:
+			if c < ' ' || c > '~' {
+				b.WriteString(`\x`)
+				b.WriteString(strconv.FormatUint(uint64(c)>>4, 16))
+				b.WriteString(strconv.FormatUint(uint64(c)&0xf, 16))
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// MONITOR
+func (m *Monitors) Command(c *client.Client, commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], MonitorCommand) {
+		return "", false
+	}
+
+	if len(commands) != 1 {
+		return messages.GetErrorString("ERR wrong number of arguments for command"), true
+	}
+	if c.Sub == nil {
+		return messages.GetErrorString("ERR this client cannot be a monitor"), true
+	}
+
+	c.Monitor = true
+	m.Add(c.Sub)
+	return messages.NewSimpleString("OK").Serialise(), true
+}
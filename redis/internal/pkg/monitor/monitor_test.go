@@ -0,0 +1,41 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+)
+
+func TestFormat(t *testing.T) {
+	now := time.Unix(1339518083, 107412000)
+	EqualO(t, Format(now, "127.0.0.1:60866", []string{"set", "k", "v"}), "+1339518083.107412 [0 127.0.0.1:60866] \"set\" \"k\" \"v\"\r\n")
+	EqualO(t, Format(time.Unix(1, 5000), "a", []string{"get"}), "+1.000005 [0 a] \"get\"\r\n")
+
+	EqualO(t, repr("a \"b\"\\\r\n\x01\xff"), `"a \"b\"\\\r\n\x01\xff"`)
+}
+
+func TestFeed(t *testing.T) {
+	m := New()
+	IsFalse(t, m.Active(), "no monitors yet")
+	// nothing to send to
+	m.Feed(time.Now(), "127.0.0.1:1000", []string{"get", "k"})
+
+	c := client.New("127.0.0.1:2000")
+	c.Sub = pubsub.NewSubscriber()
+	reply, ok := m.Command(c, []string{"monitor"})
+	IsTrue(t, ok, "MONITOR should be handled")
+	EqualO(t, reply, "+OK\r\n")
+	IsTrue(t, c.Monitor && m.Active(), "should be monitoring")
+
+	m.Feed(time.Unix(10, 0), "127.0.0.1:1000", []string{"get", "k"})
+	EqualO(t, <-c.Sub.Messages(), "+10.000000 [0 127.0.0.1:1000] \"get\" \"k\"\r\n")
+
+	m.Remove(c.Sub)
+	IsFalse(t, m.Active(), "the monitor was removed")
+
+	_, ok = m.Command(c, []string{"GET", "k"})
+	IsFalse(t, ok, "GET should not be handled")
+}
@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	SubscribeCommand    = "SUBSCRIBE"
+	PSubscribeCommand   = "PSUBSCRIBE"
+	UnsubscribeCommand  = "UNSUBSCRIBE"
+	PUnsubscribeCommand = "PUNSUBSCRIBE"
+	PublishCommand      = "PUBLISH"
+	PubSubCommand       = "PUBSUB"
+)
+
+var invalidArgNumErr = messages.GetErrorString("ERR wrong number of arguments for command")
+
+// Command handles (P)SUBSCRIBE and (P)UNSUBSCRIBE for the subscriber.
+func (ps *PubSub) Command(s *Subscriber, commands []string) (string, bool) {
+	if len(commands) == 0 {
+		return "", false
+	}
+
+	name := strings.ToUpper(commands[0])
+	args := commands[1:]
+	switch name {
+	case SubscribeCommand, PSubscribeCommand:
+		if len(args) == 0 {
+			return invalidArgNumErr, true
+		}
+	case UnsubscribeCommand, PUnsubscribeCommand:
+	default:
+		return "", false
+	}
+
+	if s == nil {
+		return messages.GetErrorString("ERR " + name + " isn't allowed for this client"), true
+	}
+
+	switch name {
+	case SubscribeCommand:
+		return ps.Subscribe(s, args), true
+	case PSubscribeCommand:
+		return ps.PSubscribe(s, args), true
+	case UnsubscribeCommand:
+		return ps.Unsubscribe(s, args), true
+	default:
+		return ps.PUnsubscribe(s, args), true
+	}
+}
+
+// PUBLISH channel message
+func (ps *PubSub) PublishRoute(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], PublishCommand) {
+		return "", false
+	}
+
+	if len(commands) != 3 {
+		return invalidArgNumErr, true
+	}
+
+	return messages.NewInteger(ps.Publish(commands[1], commands[2])).Serialise(), true
+}
+
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func (ps *PubSub) PubSubRoute(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], PubSubCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return invalidArgNumErr, true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "CHANNELS":
+		if len(args) > 1 {
+			return invalidArgNumErr, true
+		}
+		pattern := ""
+		if len(args) == 1 {
+			pattern = args[0]
+		}
+		return messages.NewArrayBulkString(ps.Channels(pattern)).Serialise(), true
+	case "NUMSUB":
+		ret := []messages.Message{}
+		for _, channel := range args {
+			ret = append(ret, messages.NewBulkString(channel), messages.NewInteger(ps.NumSub(channel)))
+		}
+		return messages.NewArray(ret).Serialise(), true
+	case "NUMPAT":
+		if len(args) != 0 {
+			return invalidArgNumErr, true
+		}
+		return messages.NewInteger(ps.NumPat()).Serialise(), true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try PUBSUB HELP."), true
+	}
+}
+
+// Subscribed handles commands from a subscriber that is subscribed to something, where only some commands are allowed.
+// It returns false if the command should be handled as usual.
+func Subscribed(commands []string) (string, bool) {
+	switch name := strings.ToUpper(commands[0]); name {
+	case SubscribeCommand, PSubscribeCommand, UnsubscribeCommand, PUnsubscribeCommand:
+		return "", false
+	case "PING":
+		// replies like a message, as the client is expecting those
+		message := ""
+		if len(commands) > 1 {
+			message = commands[1]
+		}
+		return messages.NewArrayBulkString([]string{"pong", message}).Serialise(), true
+	default:
+		return messages.GetErrorString("ERR Can't execute '" + strings.ToLower(name) + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context"), true
+	}
+}
@@ -0,0 +1,134 @@
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// https://redis.io/docs/latest/develop/use/keyspace-notifications/
+
+// Class is a set of classes of keyspace events.
+type Class uint32
+
+const (
+	// Keyspace events are published to `__keyspace@<db>__:<key>`, with the event as the message.
+	Keyspace Class = 1 << iota
+	// Keyevent events are published to `__keyevent@<db>__:<event>`, with the key as the message.
+	Keyevent
+	Generic
+	String
+	List
+	Set
+	Hash
+	SortedSet
+	Expired
+	Evicted
+	Stream
+	KeyMiss
+	Module
+	NewKey
+
+	// All is the same as redis' "A" (which excludes key-miss and new key events).
+	All = Generic | String | List | Set | Hash | SortedSet | Expired | Evicted | Stream | Module
+)
+
+// classFlags are the characters of each class, in the same order as redis.
+var classFlags = []struct {
+	flag  byte
+	class Class
+}{
+	{'g', Generic},
+	{'$', String},
+	{'l', List},
+	{'s', Set},
+	{'h', Hash},
+	{'z', SortedSet},
+	{'x', Expired},
+	{'e', Evicted},
+	{'t', Stream},
+	{'d', Module},
+	{'K', Keyspace},
+	{'E', Keyevent},
+	{'m', KeyMiss},
+	{'n', NewKey},
+}
+
+// ParseClasses parses the value of notify-keyspace-events (e.g. "KEA", or "Ex" for expired key events).
+func ParseClasses(s string) (Class, error) {
+	ret := Class(0)
+outer:
+	for i := 0; i < len(s); i++ {
+		if s[i] == 'A' {
+			ret |= All
+			continue
+		}
+		for _, f := range classFlags {
+			if s[i] == f.flag {
+				ret |= f.class
+				continue outer
+			}
+		}
+		return 0, fmt.Errorf("invalid keyspace event class %q", s[i])
+	}
+	return ret, nil
+}
+
+// String returns the classes in the same format as `ParseClasses`.
+func (c Class) String() string {
+	all := c&All == All
+
+	sb := strings.Builder{}
+	if all {
+		sb.WriteByte('A')
+	}
+	for _, f := range classFlags {
+		if c&f.class != 0 && !(all && f.class&All != 0) {
+			sb.WriteByte(f.flag)
+		}
+	}
+	return sb.String()
+}
+
+// Notifier publishes keyspace notifications.
+// The zero value publishes nothing, until both the classes and the PubSub are set.
+type Notifier struct {
+	classes atomic.Uint32
+	ps      atomic.Pointer[PubSub]
+}
+
+// SetPubSub sets where the notifications are published.
+func (n *Notifier) SetPubSub(ps *PubSub) {
+	n.ps.Store(ps)
+}
+
+// SetClasses sets the classes of events that are published.
+func (n *Notifier) SetClasses(c Class) {
+	n.classes.Store(uint32(c))
+}
+
+// Classes returns the classes of events that are published.
+func (n *Notifier) Classes() Class {
+	return Class(n.classes.Load())
+}
+
+// Notify publishes the event on the key, if its class is enabled.
+// It never blocks, so it may be called while holding the store's lock.
+func (n *Notifier) Notify(class Class, event, key string) {
+	classes := n.Classes()
+	if classes&class == 0 {
+		return
+	}
+	ps := n.ps.Load()
+	if ps == nil {
+		return
+	}
+
+	// there is only one database
+	if classes&Keyspace != 0 {
+		ps.Publish("__keyspace@0__:"+key, event)
+	}
+	if classes&Keyevent != 0 {
+		ps.Publish("__keyevent@0__:"+event, key)
+	}
+}
@@ -0,0 +1,61 @@
+package pubsub
+
+import (
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestParseClasses(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected Class
+		str      string
+	}{
+		{"", 0, ""},
+		{"KEA", Keyspace | Keyevent | All, "AKE"},
+		{"Ex", Keyevent | Expired, "xE"},
+		{"K$lg", Keyspace | Generic | String | List, "g$lK"},
+		{"AKEmn", All | Keyspace | Keyevent | KeyMiss | NewKey, "AKEmn"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			actual, err := ParseClasses(test.s)
+			NoError(t, err)
+			EqualO(t, actual, test.expected)
+			EqualO(t, actual.String(), test.str)
+		})
+	}
+
+	_, err := ParseClasses("KEq")
+	HasError(t, err)
+}
+
+func TestNotify(t *testing.T) {
+	ps := New()
+	s := NewSubscriber()
+	ps.PSubscribe(s, []string{"__key*__:*"})
+
+	n := Notifier{}
+	// nothing is published until there is a PubSub
+	n.SetClasses(Keyspace | Keyevent | All)
+	n.Notify(String, "set", "k")
+	n.SetPubSub(ps)
+
+	n.Notify(String, "set", "k")
+	EqualO(t, received(s), []string{
+		pmessage("__key*__:*", "__keyspace@0__:k", "set"),
+		pmessage("__key*__:*", "__keyevent@0__:set", "k"),
+	})
+
+	n.SetClasses(Keyevent | Expired)
+	n.Notify(String, "set", "k")
+	n.Notify(Expired, "expired", "k")
+	EqualO(t, received(s), []string{pmessage("__key*__:*", "__keyevent@0__:expired", "k")})
+
+	// new key events are not included in "A"
+	n.SetClasses(Keyspace | All)
+	n.Notify(NewKey, "new", "k")
+	EqualO(t, received(s), []string{})
+}
@@ -0,0 +1,272 @@
+// Package pubsub implements PUBLISH and SUBSCRIBE (and their pattern variants).
+package pubsub
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/glob"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/develop/interact/pubsub/
+
+// subscriberBuffer is the number of messages that may be waiting to be written to a subscriber.
+// Like redis' client-output-buffer-limit for pubsub clients, subscribers that fall further behind are disconnected.
+const subscriberBuffer = 4096
+
+// Subscriber receives the messages published to the channels (and patterns) that it is subscribed to.
+// To construct one, use `NewSubscriber`.
+type Subscriber struct {
+	// channels and patterns are guarded by PubSub.mu
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	// count is the number of channels and patterns, and patternCount of patterns; they can be read without the lock.
+	count        atomic.Int64
+	patternCount atomic.Int64
+
+	messages  chan string
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewSubscriber() *Subscriber {
+	return &Subscriber{
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		messages: make(chan string, subscriberBuffer),
+		done:     make(chan struct{}),
+	}
+}
+
+// Messages returns the serialised messages to be written to the subscriber.
+func (s *Subscriber) Messages() <-chan string {
+	return s.messages
+}
+
+// Done is closed when the subscriber is removed, or when it falls too far behind.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Count returns the number of channels and patterns that the subscriber is subscribed to.
+func (s *Subscriber) Count() int64 {
+	return s.count.Load()
+}
+
+// PatternCount returns the number of patterns that the subscriber is subscribed to.
+func (s *Subscriber) PatternCount() int64 {
+	return s.patternCount.Load()
+}
+
+func (s *Subscriber) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// Send queues the serialised message to be written to the subscriber, disconnecting it if it is too far behind.
+// It never blocks, as it is called while holding locks (e.g. of the store for keyspace notifications).
+func (s *Subscriber) Send(message string) {
+	select {
+	case s.messages <- message:
+	default:
+		log.Warn().Msg("subscriber is too far behind, disconnecting it")
+		s.close()
+	}
+}
+
+type PubSub struct {
+	mu       sync.RWMutex
+	channels map[string]map[*Subscriber]struct{}
+	patterns map[string]map[*Subscriber]struct{}
+}
+
+func New() *PubSub {
+	return &PubSub{
+		channels: make(map[string]map[*Subscriber]struct{}),
+		patterns: make(map[string]map[*Subscriber]struct{}),
+	}
+}
+
+func reply(kind string, name messages.Message, count int64) string {
+	return messages.NewArray([]messages.Message{
+		messages.NewBulkString(kind),
+		name,
+		messages.NewInteger(count),
+	}).Serialise()
+}
+
+// add must be called with ps.mu held.
+func add(subscribers map[string]map[*Subscriber]struct{}, name string, s *Subscriber) {
+	set, ok := subscribers[name]
+	if !ok {
+		set = make(map[*Subscriber]struct{})
+		subscribers[name] = set
+	}
+	set[s] = struct{}{}
+}
+
+// remove must be called with ps.mu held.
+func remove(subscribers map[string]map[*Subscriber]struct{}, name string, s *Subscriber) {
+	delete(subscribers[name], s)
+	if len(subscribers[name]) == 0 {
+		delete(subscribers, name)
+	}
+}
+
+// Subscribe subscribes s to the channels, returning the confirmation for each channel.
+func (ps *PubSub) Subscribe(s *Subscriber, channels []string) string {
+	return ps.subscribe(s, channels, "subscribe", s.channels, ps.channels)
+}
+
+// PSubscribe subscribes s to the patterns, returning the confirmation for each pattern.
+func (ps *PubSub) PSubscribe(s *Subscriber, patterns []string) string {
+	return ps.subscribe(s, patterns, "psubscribe", s.patterns, ps.patterns)
+}
+
+func (ps *PubSub) subscribe(s *Subscriber, names []string, kind string, own map[string]struct{}, subscribers map[string]map[*Subscriber]struct{}) string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ret := ""
+	for _, name := range names {
+		if _, ok := own[name]; !ok {
+			own[name] = struct{}{}
+			add(subscribers, name, s)
+			s.count.Add(1)
+			if kind == "psubscribe" {
+				s.patternCount.Add(1)
+			}
+		}
+		ret += reply(kind, messages.NewBulkString(name), s.count.Load())
+	}
+	return ret
+}
+
+// Unsubscribe unsubscribes s from the channels (or all channels, if there are none), returning the confirmation for each channel.
+func (ps *PubSub) Unsubscribe(s *Subscriber, channels []string) string {
+	return ps.unsubscribe(s, channels, "unsubscribe", s.channels, ps.channels)
+}
+
+// PUnsubscribe unsubscribes s from the patterns (or all patterns, if there are none), returning the confirmation for each pattern.
+func (ps *PubSub) PUnsubscribe(s *Subscriber, patterns []string) string {
+	return ps.unsubscribe(s, patterns, "punsubscribe", s.patterns, ps.patterns)
+}
+
+func (ps *PubSub) unsubscribe(s *Subscriber, names []string, kind string, own map[string]struct{}, subscribers map[string]map[*Subscriber]struct{}) string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if len(names) == 0 {
+			return reply(kind, messages.NewNullBulkString(), s.count.Load())
+		}
+	}
+
+	ret := ""
+	for _, name := range names {
+		if _, ok := own[name]; ok {
+			delete(own, name)
+			remove(subscribers, name, s)
+			s.count.Add(-1)
+			if kind == "punsubscribe" {
+				s.patternCount.Add(-1)
+			}
+		}
+		ret += reply(kind, messages.NewBulkString(name), s.count.Load())
+	}
+	return ret
+}
+
+// Remove unsubscribes s from everything, it should be called when the subscriber disconnects.
+func (ps *PubSub) Remove(s *Subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for name := range s.channels {
+		remove(ps.channels, name, s)
+	}
+	for name := range s.patterns {
+		remove(ps.patterns, name, s)
+	}
+	clear(s.channels)
+	clear(s.patterns)
+	s.count.Store(0)
+	s.patternCount.Store(0)
+	s.close()
+}
+
+// Publish sends the message to the subscribers of the channel, returning the number of subscribers that received it.
+func (ps *PubSub) Publish(channel, message string) int64 {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	count := int64(0)
+	if subscribers, ok := ps.channels[channel]; ok {
+		serialised := messages.NewArrayBulkString([]string{"message", channel, message}).Serialise()
+		for s := range subscribers {
+			s.Send(serialised)
+			count++
+		}
+	}
+	for pattern, subscribers := range ps.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		serialised := messages.NewArrayBulkString([]string{"pmessage", pattern, channel, message}).Serialise()
+		for s := range subscribers {
+			s.Send(serialised)
+			count++
+		}
+	}
+	return count
+}
+
+// Channels returns the channels with at least one subscriber, that match the pattern (if it is not empty).
+func (ps *PubSub) Channels(pattern string) []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	ret := []string{}
+	for channel := range ps.channels {
+		if pattern == "" || glob.Match(pattern, channel) {
+			ret = append(ret, channel)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Subscribed returns whether s is subscribed to the channel itself (rather than to a pattern that matches it).
+func (ps *PubSub) Subscribed(s *Subscriber, channel string) bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	_, ok := s.channels[channel]
+	return ok
+}
+
+// NumSub returns the number of subscribers of the channel (excluding patterns).
+func (ps *PubSub) NumSub(channel string) int64 {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	return int64(len(ps.channels[channel]))
+}
+
+// NumPat returns the number of patterns that are subscribed to.
+func (ps *PubSub) NumPat() int64 {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	return int64(len(ps.patterns))
+}
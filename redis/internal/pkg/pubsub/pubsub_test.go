@@ -0,0 +1,124 @@
+package pubsub
+
+import (
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// received drains the messages that have been sent to s.
+func received(s *Subscriber) []string {
+	ret := []string{}
+	for {
+		select {
+		case m := <-s.Messages():
+			ret = append(ret, m)
+		default:
+			return ret
+		}
+	}
+}
+
+func message(channel, msg string) string {
+	return messages.NewArrayBulkString([]string{"message", channel, msg}).Serialise()
+}
+
+func pmessage(pattern, channel, msg string) string {
+	return messages.NewArrayBulkString([]string{"pmessage", pattern, channel, msg}).Serialise()
+}
+
+func TestSubscribe(t *testing.T) {
+	ps := New()
+	a := NewSubscriber()
+	b := NewSubscriber()
+
+	EqualO(t, ps.Subscribe(a, []string{"x", "y", "x"}), reply("subscribe", messages.NewBulkString("x"), 1)+reply("subscribe", messages.NewBulkString("y"), 2)+reply("subscribe", messages.NewBulkString("x"), 2))
+	EqualO(t, ps.PSubscribe(b, []string{"x*"}), reply("psubscribe", messages.NewBulkString("x*"), 1))
+	EqualO(t, a.Count(), int64(2))
+
+	EqualO(t, ps.Publish("x", "1"), int64(2))
+	EqualO(t, ps.Publish("xyz", "2"), int64(1))
+	EqualO(t, ps.Publish("z", "3"), int64(0))
+	EqualO(t, received(a), []string{message("x", "1")})
+	EqualO(t, received(b), []string{pmessage("x*", "x", "1"), pmessage("x*", "xyz", "2")})
+
+	EqualO(t, ps.Channels(""), []string{"x", "y"})
+	EqualO(t, ps.Channels("y*"), []string{"y"})
+	EqualO(t, ps.NumSub("x"), int64(1))
+	EqualO(t, ps.NumPat(), int64(1))
+
+	// unsubscribes from everything
+	EqualO(t, ps.Unsubscribe(a, nil), reply("unsubscribe", messages.NewBulkString("x"), 1)+reply("unsubscribe", messages.NewBulkString("y"), 0))
+	EqualO(t, ps.Unsubscribe(a, nil), reply("unsubscribe", messages.NewNullBulkString(), 0))
+	EqualO(t, ps.Publish("x", "4"), int64(1))
+	EqualO(t, received(a), []string{})
+	EqualO(t, ps.Channels(""), []string{})
+
+	ps.Remove(b)
+	EqualO(t, ps.Publish("x", "5"), int64(0))
+	EqualO(t, ps.NumPat(), int64(0))
+	select {
+	case <-b.Done():
+	default:
+		t.Errorf("removed subscriber should be done")
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	ps := New()
+	s := NewSubscriber()
+	ps.Subscribe(s, []string{"x"})
+
+	for i := 0; i < subscriberBuffer; i++ {
+		ps.Publish("x", "m")
+	}
+	select {
+	case <-s.Done():
+		t.Fatalf("subscriber should not be disconnected yet")
+	default:
+	}
+
+	// publishing never blocks, the subscriber is disconnected instead
+	ps.Publish("x", "m")
+	<-s.Done()
+}
+
+func TestCommand(t *testing.T) {
+	ps := New()
+	s := NewSubscriber()
+
+	ret, ok := ps.Command(s, []string{"subscribe", "x"})
+	IsTrue(t, ok, "")
+	EqualO(t, ret, reply("subscribe", messages.NewBulkString("x"), 1))
+	ret, _ = ps.Command(s, []string{"SUBSCRIBE"})
+	EqualO(t, ret, invalidArgNumErr)
+	ret, _ = ps.Command(nil, []string{"SUBSCRIBE", "x"})
+	EqualO(t, ret, messages.GetErrorString("ERR SUBSCRIBE isn't allowed for this client"))
+	_, ok = ps.Command(s, []string{"GET", "x"})
+	IsFalse(t, ok, "")
+
+	ret, _ = ps.PublishRoute([]string{"PUBLISH", "x", "hello"})
+	EqualO(t, ret, messages.NewInteger(1).Serialise())
+	ret, _ = ps.PubSubRoute([]string{"PUBSUB", "NUMSUB", "x", "y"})
+	EqualO(t, ret, messages.NewArray([]messages.Message{
+		messages.NewBulkString("x"), messages.NewInteger(1),
+		messages.NewBulkString("y"), messages.NewInteger(0),
+	}).Serialise())
+	ret, _ = ps.PubSubRoute([]string{"PUBSUB", "CHANNELS"})
+	EqualO(t, ret, messages.NewArrayBulkString([]string{"x"}).Serialise())
+	ret, _ = ps.PubSubRoute([]string{"PUBSUB", "NUMPAT"})
+	EqualO(t, ret, messages.NewInteger(0).Serialise())
+}
+
+func TestSubscribed(t *testing.T) {
+	_, ok := Subscribed([]string{"unsubscribe"})
+	IsFalse(t, ok, "")
+
+	ret, ok := Subscribed([]string{"PING"})
+	IsTrue(t, ok, "")
+	EqualO(t, ret, messages.NewArrayBulkString([]string{"pong", ""}).Serialise())
+
+	ret, _ = Subscribed([]string{"GET", "x"})
+	EqualO(t, ret, messages.GetErrorString("ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context"))
+}
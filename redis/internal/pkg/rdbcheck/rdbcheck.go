@@ -0,0 +1,293 @@
+package rdbcheck
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/disk"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb/encoding"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// TypeStats are the statistics for a single value type.
+type TypeStats struct {
+	Keys    int
+	Bytes   int
+	Expires int
+	Expired int
+	// Largest is the key that takes up the most bytes in the snapshot.
+	Largest     string
+	LargestSize int
+}
+
+// Stats are the statistics of a snapshot, collected by Check.
+type Stats struct {
+	Size  int
+	Types map[encoding.ValueType]*TypeStats
+}
+
+func (s *Stats) add(e rdb.Entry) {
+	t, ok := s.Types[e.Type]
+	if !ok {
+		t = &TypeStats{}
+		s.Types[e.Type] = t
+	}
+
+	t.Keys++
+	t.Bytes += e.Size
+	if _, ok := e.Value.Expiry(); ok {
+		t.Expires++
+	}
+	if e.Value.HasExpired(time.Now()) {
+		t.Expired++
+	}
+	if e.Size > t.LargestSize {
+		t.Largest = e.Key
+		t.LargestSize = e.Size
+	}
+}
+
+// Check walks the whole snapshot, returning its stats.
+// If the snapshot is invalid, the stats collected so far are returned together with a *rdb.LoadError.
+func Check(data []byte) (*Stats, error) {
+	stats := &Stats{
+		Size:  len(data),
+		Types: map[encoding.ValueType]*TypeStats{},
+	}
+
+	buf := rdb.NewLoadBuffer(data)
+	err := buf.Walk(func(e rdb.Entry) error {
+		stats.add(e)
+		return nil
+	})
+
+	return stats, err
+}
+
+func (s *Stats) write(w io.Writer) {
+	types := make([]encoding.ValueType, 0, len(s.Types))
+	for t := range s.Types {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	fmt.Fprintf(w, "size: %d bytes\n", s.Size)
+	for _, t := range types {
+		ts := s.Types[t]
+		fmt.Fprintf(w, "%s: keys=%d bytes=%d expires=%d expired=%d", t, ts.Keys, ts.Bytes, ts.Expires, ts.Expired)
+		if ts.Largest != "" {
+			fmt.Fprintf(w, " largest=%q (%d bytes)", ts.Largest, ts.LargestSize)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// Format is an output format of Dump.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatRESP Format = "resp"
+)
+
+type jsonEntry struct {
+	Key  string `json:"key"`
+	Type string `json:"type"`
+	// Value is a string for strings, and a []string for lists.
+	Value any `json:"value"`
+	// ExpiresAt is in milliseconds since the Unix epoch.
+	ExpiresAt int64 `json:"expires_at,omitempty"`
+}
+
+// Dump writes the (unexpired) contents of the snapshot to w.
+// FormatRESP writes commands that can be replayed against a server, e.g. with `redis-cli --pipe`.
+// Nothing is written unless the whole snapshot is valid, as its checksum is only verified at the end.
+func Dump(w io.Writer, data []byte, format Format) error {
+	if format != FormatJSON && format != FormatRESP {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	var entries []jsonEntry
+	var resp strings.Builder
+
+	buf := rdb.NewLoadBuffer(data)
+	err := buf.Walk(func(e rdb.Entry) error {
+		item, ok := e.Value.Item(time.Now())
+		if !ok {
+			// expired
+			return nil
+		}
+		expiry, hasExpiry := e.Value.Expiry()
+
+		if format == FormatRESP {
+			resp.WriteString(commands(e.Key, item, expiry, hasExpiry))
+			return nil
+		}
+		entry := jsonEntry{
+			Key:   e.Key,
+			Type:  e.Type.String(),
+			Value: value(item),
+		}
+		if hasExpiry {
+			entry.ExpiresAt = expiry.UnixMilli()
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == FormatRESP {
+		_, err := io.WriteString(w, resp.String())
+		return err
+	}
+
+	if entries == nil {
+		entries = []jsonEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func value(item items.Item) any {
+	switch item.ValueType() {
+	case encoding.ValueString:
+		v, _ := item.Get()
+		return v
+	case encoding.ValueList:
+		v, _ := item.LRange(0, -1)
+		return v
+	}
+	return nil
+}
+
+// commands returns the serialised commands that recreate the key.
+func commands(key string, item items.Item, expiry time.Time, hasExpiry bool) string {
+	var ret string
+
+	switch item.ValueType() {
+	case encoding.ValueString:
+		v, _ := item.Get()
+		cmd := []string{"SET", key, v}
+		if hasExpiry {
+			cmd = append(cmd, "PXAT", fmt.Sprint(expiry.UnixMilli()))
+		}
+		return messages.NewArrayBulkString(cmd).Serialise()
+	case encoding.ValueList:
+		v, _ := item.LRange(0, -1)
+		if len(v) == 0 {
+			// empty lists cannot be created with commands
+			return ""
+		}
+		ret = messages.NewArrayBulkString(append([]string{"RPUSH", key}, v...)).Serialise()
+	}
+
+	if hasExpiry {
+		ret += messages.NewArrayBulkString([]string{"PEXPIREAT", key, fmt.Sprint(expiry.UnixMilli())}).Serialise()
+	}
+
+	return ret
+}
+
+func readFile(fs *flag.FlagSet, stderr io.Writer) ([]byte, bool) {
+	path := disk.DefaultPath()
+	if fs.NArg() > 1 {
+		fmt.Fprintf(stderr, "expected at most 1 file, got %d\n", fs.NArg())
+		return nil, false
+	}
+	if fs.NArg() == 1 {
+		path = fs.Arg(0)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil, false
+	}
+	return data, true
+}
+
+func printLoadError(w io.Writer, err error) {
+	var loadErr *rdb.LoadError
+	if errors.As(err, &loadErr) {
+		fmt.Fprintf(w, "offset: %d\n", loadErr.Offset)
+		if loadErr.Key != "" {
+			fmt.Fprintf(w, "key: %q\n", loadErr.Key)
+		}
+		fmt.Fprintf(w, "error: %v\n", loadErr.Err)
+		return
+	}
+	fmt.Fprintf(w, "error: %v\n", err)
+}
+
+// RunCheck is the entrypoint of the `check-rdb` command.
+// Returns the exit code.
+func RunCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("check-rdb", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: check-rdb [file] (default %s)\n", disk.DefaultPath())
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	data, ok := readFile(fs, stderr)
+	if !ok {
+		return 1
+	}
+
+	stats, err := Check(data)
+	if err != nil {
+		fmt.Fprintln(stdout, "status: INVALID")
+		printLoadError(stdout, err)
+		fmt.Fprintln(stdout, "-- stats up to the failure --")
+		stats.write(stdout)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "status: OK")
+	stats.write(stdout)
+	return 0
+}
+
+// RunDump is the entrypoint of the `rdb-dump` command.
+// Returns the exit code.
+func RunDump(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("rdb-dump", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", string(FormatJSON), "output format, either json or resp")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: rdb-dump [--format json|resp] [file] (default %s)\n", disk.DefaultPath())
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if f := Format(*format); f != FormatJSON && f != FormatRESP {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return 2
+	}
+
+	data, ok := readFile(fs, stderr)
+	if !ok {
+		return 1
+	}
+
+	if err := Dump(stdout, data, Format(*format)); err != nil {
+		printLoadError(stderr, err)
+		return 1
+	}
+	return 0
+}
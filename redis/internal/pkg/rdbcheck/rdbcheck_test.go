@@ -0,0 +1,115 @@
+package rdbcheck
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb/encoding"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/redistest"
+)
+
+func snapshot() []byte {
+	expiry := time.UnixMilli(4102444800000) // 2100-01-01
+
+	return (&rdb.SaveBuffer{}).Save(map[string]*items.Value{
+		"s": items.NewValue(items.NewString("v"), nil, time.Now()),
+		"i": items.NewValue(items.NewString("1"), delay.NewDelay(expiry), time.Now()),
+		"l": items.NewValue(items.NewListBuilder().Add([]string{"a", "b"}).Build(), nil, time.Now()),
+	}, time.Now())
+}
+
+func TestCheck(t *testing.T) {
+	stats, err := Check(snapshot())
+	NoError(t, err)
+
+	strs := stats.Types[encoding.ValueString]
+	EqualO(t, strs.Keys, 2)
+	EqualO(t, strs.Expires, 1)
+	EqualO(t, strs.Expired, 0)
+	lists := stats.Types[encoding.ValueList]
+	EqualO(t, lists.Keys, 1)
+	EqualO(t, lists.Largest, "l")
+
+	corrupted := snapshot()
+	corrupted = corrupted[:len(corrupted)-3]
+	_, err = Check(corrupted)
+	HasError(t, err)
+}
+
+func TestDumpJSON(t *testing.T) {
+	buf := bytes.Buffer{}
+	NoError(t, Dump(&buf, snapshot(), FormatJSON))
+
+	out := buf.String()
+	IsTrue(t, strings.Contains(out, `"key": "s"`), "%s", out)
+	IsTrue(t, strings.Contains(out, `"expires_at": 4102444800000`), "%s", out)
+}
+
+func TestDumpRESP(t *testing.T) {
+	buf := bytes.Buffer{}
+	NoError(t, Dump(&buf, snapshot(), FormatRESP))
+
+	out := buf.String()
+	expected := []string{
+		messages.NewArrayBulkString([]string{"SET", "s", "v"}).Serialise(),
+		messages.NewArrayBulkString([]string{"SET", "i", "1", "PXAT", "4102444800000"}).Serialise(),
+		messages.NewArrayBulkString([]string{"RPUSH", "l", "a", "b"}).Serialise(),
+	}
+	for _, e := range expected {
+		IsTrue(t, strings.Contains(out, e), "expected %q in %q", e, out)
+	}
+}
+
+func TestDumpCorrupted(t *testing.T) {
+	corrupted := snapshot()
+	// the checksum is only verified after every entry has been read
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	for _, format := range []Format{FormatJSON, FormatRESP} {
+		buf := bytes.Buffer{}
+		HasError(t, Dump(&buf, corrupted, format))
+		EqualO(t, buf.String(), "")
+	}
+}
+
+func TestDumpRESPReplay(t *testing.T) {
+	expiry := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	data := (&rdb.SaveBuffer{}).Save(map[string]*items.Value{
+		"s": items.NewValue(items.NewString("v"), delay.NewDelay(expiry), time.Now()),
+		"l": items.NewValue(items.NewListBuilder().Add([]string{"a", "b"}).Build(), delay.NewDelay(expiry), time.Now()),
+	}, time.Now())
+	buf := bytes.Buffer{}
+	NoError(t, Dump(&buf, data, FormatRESP))
+
+	s := redistest.RunT(t)
+	conn, err := net.Dial("tcp", s.Addr())
+	NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write(buf.Bytes())
+	NoError(t, err)
+
+	// SET with PXAT, then RPUSH and PEXPIREAT
+	rd := messages.NewReader(conn)
+	for i := 0; i < 3; i++ {
+		reply, err := rd.ReadMessage()
+		NoError(t, err)
+		_, isErr := reply.(*messages.Error)
+		IsFalse(t, isErr, "replaying the dump failed: %q", reply.Serialise())
+	}
+
+	value, err := s.Get("s")
+	NoError(t, err)
+	EqualO(t, value, "v")
+	list, err := s.List("l")
+	NoError(t, err)
+	EqualO(t, list, []string{"a", "b"})
+	IsTrue(t, s.TTL("s") > 59*time.Minute && s.TTL("l") > 59*time.Minute, "the keys should keep their TTLs: %v %v", s.TTL("s"), s.TTL("l"))
+}
@@ -0,0 +1,77 @@
+package replication
+
+// Backlog is a circular buffer holding the most recent bytes of the replication stream.
+// It lets replicas that briefly disconnect continue from where they left off, instead of needing a full resync.
+// Offsets are replication offsets: the first byte ever written has offset 1.
+// It is NOT safe for concurrent use.
+type Backlog struct {
+	buf []byte
+	// idx is where the next byte is written to.
+	idx int
+	// histlen is the number of valid bytes in buf.
+	histlen int
+	// offset is the replication offset of the last byte written.
+	offset int64
+}
+
+// NewBacklog constructs a Backlog of the given size, which continues after offset.
+func NewBacklog(size int, offset int64) *Backlog {
+	return &Backlog{
+		buf:    make([]byte, size),
+		offset: offset,
+	}
+}
+
+// Reset discards the history, continuing after offset.
+func (b *Backlog) Reset(offset int64) {
+	b.idx = 0
+	b.histlen = 0
+	b.offset = offset
+}
+
+func (b *Backlog) Write(p []byte) {
+	b.offset += int64(len(p))
+
+	// only the tail of p can fit
+	if len(p) > len(b.buf) {
+		p = p[len(p)-len(b.buf):]
+	}
+
+	for len(p) > 0 {
+		n := copy(b.buf[b.idx:], p)
+		b.idx = (b.idx + n) % len(b.buf)
+		p = p[n:]
+		b.histlen = min(b.histlen+n, len(b.buf))
+	}
+}
+
+// Offset returns the replication offset of the last byte written.
+func (b *Backlog) Offset() int64 {
+	return b.offset
+}
+
+// start returns the replication offset of the first byte in the history.
+func (b *Backlog) start() int64 {
+	return b.offset - int64(b.histlen) + 1
+}
+
+// From returns all bytes from the replication offset onwards.
+// ok is false if the offset is no longer (or not yet) in the history.
+func (b *Backlog) From(offset int64) (ret []byte, ok bool) {
+	if offset < b.start() || offset > b.offset+1 {
+		return nil, false
+	}
+
+	n := int(b.offset - offset + 1)
+	ret = make([]byte, 0, n)
+
+	// index of `offset` in buf
+	i := (b.idx - n + len(b.buf)) % max(len(b.buf), 1)
+	for len(ret) < n {
+		end := min(len(b.buf), i+n-len(ret))
+		ret = append(ret, b.buf[i:end]...)
+		i = 0
+	}
+
+	return ret, true
+}
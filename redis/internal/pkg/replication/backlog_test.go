@@ -0,0 +1,38 @@
+package replication
+
+import (
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestBacklog(t *testing.T) {
+	b := NewBacklog(8, 0)
+
+	Equal(t, V(b.From(1)), V([]byte{}, true))
+	Equal(t, V(b.From(2)), V([]byte(nil), false))
+
+	b.Write([]byte("abc"))
+	EqualO(t, b.Offset(), int64(3))
+	Equal(t, V(b.From(1)), V([]byte("abc"), true))
+	Equal(t, V(b.From(3)), V([]byte("c"), true))
+	Equal(t, V(b.From(4)), V([]byte{}, true))
+
+	// wraps around, "ab" is overwritten
+	b.Write([]byte("defgh"))
+	b.Write([]byte("ij"))
+	EqualO(t, b.Offset(), int64(10))
+	Equal(t, V(b.From(2)), V([]byte(nil), false))
+	Equal(t, V(b.From(3)), V([]byte("cdefghij"), true))
+	Equal(t, V(b.From(9)), V([]byte("ij"), true))
+
+	// larger than the whole buffer
+	b.Write([]byte("0123456789"))
+	EqualO(t, b.Offset(), int64(20))
+	Equal(t, V(b.From(13)), V([]byte("23456789"), true))
+	Equal(t, V(b.From(12)), V([]byte(nil), false))
+
+	b.Reset(100)
+	Equal(t, V(b.From(101)), V([]byte{}, true))
+	Equal(t, V(b.From(20)), V([]byte(nil), false))
+}
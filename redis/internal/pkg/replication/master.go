@@ -0,0 +1,165 @@
+package replication
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// replicaOutputLimit is the number of pending writes a replica may fall behind by before it is dropped.
+// The replica will reconnect, and continue from the backlog if it can.
+const replicaOutputLimit = 4096
+
+// replica is the master's view of one of its replicas.
+type replica struct {
+	conn          net.Conn
+	ip            string
+	listeningPort int
+	ackOffset     atomic.Int64
+
+	out       chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newReplica(conn net.Conn, p Peer) *replica {
+	ip := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return &replica{
+		conn:          conn,
+		ip:            ip,
+		listeningPort: p.ListeningPort,
+		out:           make(chan []byte, replicaOutputLimit),
+		done:          make(chan struct{}),
+	}
+}
+
+// send queues bytes to be written to the replica.
+// Must be called with Replication.mu held, so that writes are queued in order.
+func (rp *replica) send(b []byte) {
+	select {
+	case rp.out <- b:
+	default:
+		log.Warn().Str("replica", rp.conn.RemoteAddr().String()).Msg("replica is too far behind, dropping it")
+		rp.close()
+	}
+}
+
+func (rp *replica) close() {
+	rp.closeOnce.Do(func() {
+		close(rp.done)
+		rp.conn.Close()
+	})
+}
+
+func (rp *replica) writeLoop() {
+	for {
+		select {
+		case b := <-rp.out:
+			for len(b) > 0 {
+				n, err := rp.conn.Write(b)
+				if err != nil {
+					log.Debug().Err(err).Msg("writing to replica")
+					rp.close()
+					return
+				}
+				b = b[n:]
+			}
+		case <-rp.done:
+			return
+		}
+	}
+}
+
+// readLoop reads acknowledgements from the replica until it disconnects.
+func (r *Replication) readLoop(rp *replica, rd *messages.Reader) {
+	for {
+		commands, err := rd.ReadCommands()
+		if err != nil {
+			return
+		}
+
+		// REPLCONF ACK <offset>
+		if len(commands) == 3 && strings.EqualFold(commands[0], "REPLCONF") && strings.EqualFold(commands[1], "ACK") {
+			offset, err := strconv.ParseInt(commands[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			rp.ackOffset.Store(offset)
+			r.notifyAcked()
+		}
+	}
+}
+
+// partial returns the bytes a replica needs to continue from the offset, if it can.
+// Must be called with r.mu held.
+func (r *Replication) partial(replID string, offset int64) ([]byte, bool) {
+	if replID != r.replID && (replID != r.replID2 || offset > r.secondOffset) {
+		return nil, false
+	}
+	return r.backlog.From(offset)
+}
+
+// ServeReplica handles PSYNC (and SYNC), taking over the connection.
+// It blocks until the replica disconnects.
+func (r *Replication) ServeReplica(conn net.Conn, rd *messages.Reader, commands []string, p Peer) {
+	isSync := strings.EqualFold(commands[0], "SYNC")
+	if (isSync && len(commands) != 1) || (!isSync && len(commands) != 3) {
+		conn.Write([]byte(invalidArgsErr))
+		return
+	}
+
+	rp := newReplica(conn, p)
+
+	r.mu.Lock()
+	if l := r.master; l != nil && l.getState() != stateConnected {
+		r.mu.Unlock()
+		conn.Write([]byte(messages.GetError(errNotConnected)))
+		return
+	}
+
+	var data []byte
+	if !isSync {
+		offset, err := strconv.ParseInt(commands[2], 10, 64)
+		if err == nil {
+			if backlog, ok := r.partial(commands[1], offset); ok {
+				log.Info().Str("replica", conn.RemoteAddr().String()).Int64("offset", offset).Msg("partial resync")
+				data = append([]byte(fmt.Sprintf("+CONTINUE %s\r\n", r.replID)), backlog...)
+				rp.ackOffset.Store(offset - 1)
+			}
+		}
+	}
+	if data == nil {
+		log.Info().Str("replica", conn.RemoteAddr().String()).Msg("full resync")
+		snapshot := r.store.Snapshot()
+		if !isSync {
+			data = []byte(fmt.Sprintf("+FULLRESYNC %s %d\r\n", r.replID, r.backlog.Offset()))
+		}
+		// the snapshot is not followed by CRLF
+		data = append(data, fmt.Sprintf("$%d\r\n", len(snapshot))...)
+		data = append(data, snapshot...)
+		rp.ackOffset.Store(r.backlog.Offset())
+	}
+	rp.send(data)
+	r.replicas[rp] = struct{}{}
+	r.mu.Unlock()
+
+	go rp.writeLoop()
+	r.readLoop(rp, rd)
+
+	r.mu.Lock()
+	delete(r.replicas, rp)
+	r.mu.Unlock()
+	rp.close()
+	log.Info().Str("replica", conn.RemoteAddr().String()).Msg("replica disconnected")
+}
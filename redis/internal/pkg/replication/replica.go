@@ -0,0 +1,347 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const (
+	// how often a replica acknowledges its offset to its master
+	ackInterval = time.Second
+	// how long to wait before reconnecting to the master
+	reconnectInterval = time.Second
+	dialTimeout       = 5 * time.Second
+)
+
+type linkState string
+
+// same as the states reported by ROLE
+const (
+	stateConnect    linkState = "connect"
+	stateConnecting linkState = "connecting"
+	stateSync       linkState = "sync"
+	stateConnected  linkState = "connected"
+)
+
+// link is a replica's connection to its master.
+type link struct {
+	host string
+	port int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu    sync.Mutex
+	state linkState
+	conn  net.Conn
+}
+
+func newLink(host string, port int) *link {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &link{
+		host:   host,
+		port:   port,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		state:  stateConnect,
+	}
+}
+
+func (l *link) getState() linkState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.state
+}
+
+func (l *link) setState(state linkState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.state = state
+}
+
+func (l *link) setConn(conn net.Conn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.conn = conn
+}
+
+// write writes a command to the master.
+func (l *link) write(commands ...string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return net.ErrClosed
+	}
+	_, err := l.conn.Write([]byte(messages.NewArrayBulkString(commands).Serialise()))
+	return err
+}
+
+// stop closes the link, and waits for it to stop.
+func (l *link) stop() {
+	l.cancel()
+	l.mu.Lock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
+	l.mu.Unlock()
+	<-l.done
+}
+
+// runLink keeps the link to the master up until it is stopped.
+func (r *Replication) runLink(l *link) {
+	defer close(l.done)
+
+	for {
+		err := r.syncWithMaster(l)
+		l.setState(stateConnect)
+		l.mu.Lock()
+		if l.conn != nil {
+			l.conn.Close()
+			l.conn = nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-l.ctx.Done():
+			return
+		default:
+		}
+		log.Warn().Err(err).Str("host", l.host).Int("port", l.port).Msg("lost link to master, reconnecting")
+
+		select {
+		case <-l.ctx.Done():
+			return
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+// request writes a command to the master and reads a single reply, erroring on error replies.
+func request(l *link, rd *messages.Reader, commands ...string) (messages.Message, error) {
+	if err := l.write(commands...); err != nil {
+		return nil, err
+	}
+	reply, err := rd.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := reply.(*messages.Error); ok {
+		return nil, fmt.Errorf("%s: %w", commands[0], e)
+	}
+	return reply, nil
+}
+
+// syncWithMaster connects to the master, syncs, and applies the replication stream until the link breaks.
+func (r *Replication) syncWithMaster(l *link) error {
+	l.setState(stateConnecting)
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(l.ctx, "tcp", net.JoinHostPort(l.host, strconv.Itoa(l.port)))
+	if err != nil {
+		return err
+	}
+	l.setConn(conn)
+	rd := messages.NewReader(conn)
+
+	r.mu.Lock()
+	listeningPort := r.listeningPort
+	masterUser, masterAuth := r.masterUser, r.masterAuth
+	replID, offset := r.replID, r.backlog.Offset()+1
+	r.mu.Unlock()
+
+	if masterAuth != "" {
+		auth := []string{"AUTH", masterAuth}
+		if masterUser != "" {
+			auth = []string{"AUTH", masterUser, masterAuth}
+		}
+		if _, err := request(l, rd, auth...); err != nil {
+			return err
+		}
+	}
+	if _, err := request(l, rd, "PING"); err != nil {
+		return err
+	}
+	if _, err := request(l, rd, "REPLCONF", "listening-port", strconv.Itoa(listeningPort)); err != nil {
+		return err
+	}
+	if _, err := request(l, rd, "REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+
+	reply, err := request(l, rd, "PSYNC", replID, strconv.FormatInt(offset, 10))
+	if err != nil {
+		return err
+	}
+	status, ok := reply.(*messages.SimpleString)
+	if !ok {
+		return errors.New("unexpected reply to PSYNC")
+	}
+
+	fields := strings.Fields(status.String())
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		l.setState(stateSync)
+		masterOffset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		if err := r.fullSync(l, rd, fields[1], masterOffset); err != nil {
+			return err
+		}
+	case len(fields) >= 1 && fields[0] == "CONTINUE":
+		r.mu.Lock()
+		if len(fields) == 2 && fields[1] != r.replID {
+			// the master has a new history, which continues ours
+			r.replID2 = r.replID
+			r.secondOffset = r.backlog.Offset() + 1
+			r.replID = fields[1]
+		}
+		r.mu.Unlock()
+		log.Info().Int64("offset", offset).Msg("partial resync with master")
+	default:
+		return fmt.Errorf("unexpected reply to PSYNC: %q", status.String())
+	}
+
+	l.setState(stateConnected)
+
+	go r.ackLoop(l, conn)
+
+	return r.stream(l, rd)
+}
+
+// fullSync loads the snapshot sent by the master.
+func (r *Replication) fullSync(l *link, rd *messages.Reader, replID string, offset int64) error {
+	br := rd.Bufio()
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "$") || !strings.HasSuffix(line, messages.CRLF) {
+		return fmt.Errorf("unexpected snapshot header %q", line)
+	}
+	length, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil || length < 0 {
+		return fmt.Errorf("unexpected snapshot header %q", line)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.master != l {
+		return errors.New("link was replaced")
+	}
+	if err := r.store.LoadSnapshot(data); err != nil {
+		return err
+	}
+	r.replID = replID
+	r.replID2 = ""
+	r.secondOffset = 0
+	r.backlog.Reset(offset)
+	// our replicas have the old data set
+	r.disconnectReplicas()
+
+	log.Info().Int("bytes", length).Int64("offset", offset).Msg("full resync with master")
+
+	return nil
+}
+
+// ackLoop periodically acknowledges our offset to the master.
+func (r *Replication) ackLoop(l *link, conn net.Conn) {
+	t := time.NewTicker(ackInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-l.ctx.Done():
+			return
+		}
+
+		l.mu.Lock()
+		current := l.conn
+		l.mu.Unlock()
+		if current != conn {
+			// the connection was replaced
+			return
+		}
+
+		if err := l.write("REPLCONF", "ACK", strconv.FormatInt(r.Offset(), 10)); err != nil {
+			return
+		}
+	}
+}
+
+func isGetAck(commands []string) bool {
+	return len(commands) == 3 && strings.EqualFold(commands[0], "REPLCONF") && strings.EqualFold(commands[1], "GETACK")
+}
+
+// stream applies the replication stream, until the link breaks.
+func (r *Replication) stream(l *link, rd *messages.Reader) error {
+	for {
+		start := rd.Consumed()
+		commands, err := rd.ReadCommands()
+		if err != nil {
+			return err
+		}
+		raw := []byte(messages.NewArrayBulkString(commands).Serialise())
+		if n := rd.Consumed() - start; n != int64(len(raw)) {
+			// offsets must match the master's exactly
+			return fmt.Errorf("command was not serialised canonically (%d bytes, expected %d)", n, len(raw))
+		}
+
+		if !isGetAck(commands) && !strings.EqualFold(commands[0], "PING") {
+			// PING keeps the link alive, it has nothing to apply
+			// commands are applied without r.mu, as the command may wait for a script that is running, whose writes need r.mu (if only to be rejected)
+			if !r.isMaster(l) {
+				return errors.New("link was replaced")
+			}
+			r.exec(commands)
+		}
+
+		r.mu.Lock()
+		if r.master != l {
+			r.mu.Unlock()
+			return errors.New("link was replaced")
+		}
+		if isGetAck(commands) {
+			// the offset does not include this GETACK
+			if err := l.write("REPLCONF", "ACK", strconv.FormatInt(r.backlog.Offset(), 10)); err != nil {
+				r.mu.Unlock()
+				return err
+			}
+		}
+		// chained replicas get exactly what we got
+		r.forward(raw)
+		r.mu.Unlock()
+	}
+}
+
+// isMaster returns whether l is the link to our master.
+func (r *Replication) isMaster(l *link) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.master == l
+}
@@ -0,0 +1,483 @@
+package replication
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/operate/oss_and_stack/management/replication/
+
+const defaultBacklogSize = 1024 * 1024
+
+var (
+	ReadOnlyErr    = messages.GetErrorString("READONLY You can't write against a read only replica.")
+	invalidArgsErr = messages.GetErrorString("ERR wrong number of arguments for command")
+)
+
+type Role string
+
+const (
+	RoleMaster  Role = "master"
+	RoleReplica Role = "slave"
+)
+
+// Store is the part of the store that replication needs.
+type Store interface {
+	// Snapshot serialises the whole store.
+	Snapshot() []byte
+	// LoadSnapshot replaces the contents of the store with the snapshot.
+	LoadSnapshot(data []byte) error
+}
+
+// Executor applies a command received from the master, returning the reply.
+// Commands from the master must bypass the read-only check.
+type Executor func(commands []string) string
+
+// Replication is the replication state of a single server, which is either a master or a replica.
+// Servers start as masters; REPLICAOF turns them into replicas (and REPLICAOF NO ONE back).
+type Replication struct {
+	// rejectsWrites is set while we are a read-only replica, so that writes are rejected without waiting for mu.
+	// It is only written with mu held, see `updateRejectsWrites`.
+	rejectsWrites atomic.Bool
+
+	// mu guards everything below.
+	// Writes hold it while executing (see `Execute`), so that taking a snapshot and registering a replica is atomic with respect to writes.
+	mu sync.Mutex
+
+	replID string
+	// replID2 is the previous replication ID, valid for offsets up to secondOffset.
+	// This lets replicas of the old master continue with PSYNC after a replica is promoted.
+	replID2      string
+	secondOffset int64
+	// backlog.Offset() is the replication offset (master_repl_offset).
+	backlog *Backlog
+
+	replicas map[*replica]struct{}
+	// acked is closed (and replaced) whenever a replica acknowledges an offset.
+	acked chan struct{}
+
+	// master is the link to our master, nil if we are a master.
+	master *link
+	// readOnly rejects writes from clients when we are a replica.
+	readOnly bool
+
+	// listeningPort is the port advertised to our master.
+	listeningPort int
+	// masterUser and masterAuth authenticate us to our master, if masterAuth is set.
+	masterUser string
+	masterAuth string
+	store      Store
+	exec       Executor
+}
+
+func New(store Store, exec Executor) *Replication {
+	ret := &Replication{
+		mu:       sync.Mutex{},
+		replID:   newReplID(),
+		backlog:  NewBacklog(defaultBacklogSize, 0),
+		replicas: make(map[*replica]struct{}),
+		acked:    make(chan struct{}),
+		readOnly: true,
+		store:    store,
+		exec:     exec,
+	}
+
+	return ret
+}
+
+func newReplID() string {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// SetListeningPort sets the port advertised to our master (when we are a replica).
+func (r *Replication) SetListeningPort(port int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeningPort = port
+}
+
+// SetMasterAuth sets the credentials used to authenticate to our master, the user may be empty for the default user.
+func (r *Replication) SetMasterAuth(user, password string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.masterUser = user
+	r.masterAuth = password
+}
+
+// SetReadOnly sets whether clients may write to us while we are a replica.
+func (r *Replication) SetReadOnly(readOnly bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.readOnly = readOnly
+	r.updateRejectsWrites()
+}
+
+// updateRejectsWrites must be called with r.mu held, whenever master or readOnly change.
+func (r *Replication) updateRejectsWrites() {
+	r.rejectsWrites.Store(r.master != nil && r.readOnly)
+}
+
+// Role returns our current role.
+func (r *Replication) Role() Role {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.master != nil {
+		return RoleReplica
+	}
+	return RoleMaster
+}
+
+// Info describes the replication state, as "field:value" lines for INFO.
+func (r *Replication) Info() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ret := []string{}
+	if l := r.master; l != nil {
+		state := l.getState()
+		linkStatus := "down"
+		if state == stateConnected {
+			linkStatus = "up"
+		}
+		syncInProgress := 0
+		if state == stateSync {
+			syncInProgress = 1
+		}
+		ret = append(ret,
+			"role:"+string(RoleReplica),
+			"master_host:"+l.host,
+			"master_port:"+strconv.Itoa(l.port),
+			"master_link_status:"+linkStatus,
+			"master_sync_in_progress:"+strconv.Itoa(syncInProgress),
+			"slave_read_only:"+strconv.Itoa(boolToInt(r.readOnly)),
+		)
+	} else {
+		ret = append(ret, "role:"+string(RoleMaster))
+	}
+
+	ret = append(ret, "connected_slaves:"+strconv.Itoa(len(r.replicas)))
+	i := 0
+	for rp := range r.replicas {
+		ret = append(ret, fmt.Sprintf("slave%d:ip=%s,port=%d,state=online,offset=%d", i, rp.ip, rp.listeningPort, rp.ackOffset.Load()))
+		i++
+	}
+	replID2 := r.replID2
+	if replID2 == "" {
+		// like redis, when there is no previous ID
+		replID2 = strings.Repeat("0", len(r.replID))
+	}
+	ret = append(ret,
+		"master_replid:"+r.replID,
+		"master_replid2:"+replID2,
+		"master_repl_offset:"+strconv.FormatInt(r.backlog.Offset(), 10),
+		"second_repl_offset:"+strconv.FormatInt(r.secondOffset, 10),
+	)
+	return ret
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Offset returns the replication offset.
+func (r *Replication) Offset() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.backlog.Offset()
+}
+
+// Execute runs a write command from a client, propagating it to our replicas.
+// exec returns the reply, whether the command was handled, and the commands to propagate (if any).
+// Writes are rejected if we are a read-only replica.
+func (r *Replication) Execute(exec func() (string, bool, [][]string)) (string, bool) {
+	if r.rejectsWrites.Load() {
+		// without r.mu, which the replication stream may need while a script that writes holds it up
+		return ReadOnlyErr, true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.master != nil {
+		if r.readOnly {
+			return ReadOnlyErr, true
+		}
+		// writes to a writable replica are local only
+		ret, ok, _ := exec()
+		return ret, ok
+	}
+
+	ret, ok, propagate := exec()
+	if ok {
+		for _, commands := range propagate {
+			r.feed(commands)
+		}
+	}
+	return ret, ok
+}
+
+// feed propagates a command to our replicas.
+// Must be called with r.mu held.
+func (r *Replication) feed(commands []string) {
+	r.forward([]byte(messages.NewArrayBulkString(commands).Serialise()))
+}
+
+// forward appends raw bytes to the replication stream.
+// Must be called with r.mu held.
+func (r *Replication) forward(b []byte) {
+	r.backlog.Write(b)
+	for rp := range r.replicas {
+		rp.send(b)
+	}
+}
+
+// disconnectReplicas drops all our replicas, they will reconnect and resync.
+// Must be called with r.mu held.
+func (r *Replication) disconnectReplicas() {
+	for rp := range r.replicas {
+		rp.close()
+	}
+}
+
+// Close stops replicating, closing the link to our master and dropping all our replicas.
+func (r *Replication) Close() {
+	r.mu.Lock()
+	l := r.master
+	r.disconnectReplicas()
+	r.mu.Unlock()
+
+	if l != nil {
+		l.stop()
+	}
+}
+
+// ReplicaOf handles REPLICAOF (and SLAVEOF).
+func (r *Replication) ReplicaOf(commands []string) (string, bool) {
+	if len(commands) != 3 {
+		return invalidArgsErr, true
+	}
+
+	if strings.EqualFold(commands[1], "NO") && strings.EqualFold(commands[2], "ONE") {
+		r.promote()
+		return messages.NewSimpleString("OK").Serialise(), true
+	}
+
+	host := commands[1]
+	port, err := strconv.Atoi(commands[2])
+	if err != nil || port < 0 || port > 65535 {
+		return messages.GetErrorString("ERR Invalid master port"), true
+	}
+
+	r.mu.Lock()
+	old := r.master
+	if old != nil && old.host == host && old.port == port {
+		r.mu.Unlock()
+		return messages.NewSimpleString("OK Already connected to specified master").Serialise(), true
+	}
+	if old == nil {
+		// our replicas have to resync with the new history
+		r.disconnectReplicas()
+	}
+	l := newLink(host, port)
+	r.master = l
+	r.updateRejectsWrites()
+	r.mu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+	log.Info().Str("host", host).Int("port", port).Msg("replicating from master")
+	go r.runLink(l)
+
+	return messages.NewSimpleString("OK").Serialise(), true
+}
+
+// promote turns us into a master.
+func (r *Replication) promote() {
+	r.mu.Lock()
+	l := r.master
+	if l == nil {
+		r.mu.Unlock()
+		return
+	}
+	r.master = nil
+	r.updateRejectsWrites()
+	// replicas of our old master may continue from us with the old ID
+	r.replID2 = r.replID
+	r.secondOffset = r.backlog.Offset() + 1
+	r.replID = newReplID()
+	r.mu.Unlock()
+
+	l.stop()
+	log.Info().Msg("promoted to master")
+}
+
+// RoleCommand handles ROLE.
+func (r *Replication) RoleCommand(commands []string) (string, bool) {
+	if len(commands) != 1 {
+		return invalidArgsErr, true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l := r.master; l != nil {
+		return messages.NewArray([]messages.Message{
+			messages.NewBulkString(string(RoleReplica)),
+			messages.NewBulkString(l.host),
+			messages.NewInteger(int64(l.port)),
+			messages.NewBulkString(string(l.getState())),
+			messages.NewInteger(r.backlog.Offset()),
+		}).Serialise(), true
+	}
+
+	replicas := make([]messages.Message, 0, len(r.replicas))
+	for rp := range r.replicas {
+		replicas = append(replicas, messages.NewArrayBulkString([]string{
+			rp.ip,
+			strconv.Itoa(rp.listeningPort),
+			strconv.FormatInt(rp.ackOffset.Load(), 10),
+		}))
+	}
+
+	return messages.NewArray([]messages.Message{
+		messages.NewBulkString(string(RoleMaster)),
+		messages.NewInteger(r.backlog.Offset()),
+		messages.NewArray(replicas),
+	}).Serialise(), true
+}
+
+// countAcked counts the replicas that have acknowledged the offset.
+// Must be called with r.mu held.
+func (r *Replication) countAcked(offset int64) int64 {
+	count := int64(0)
+	for rp := range r.replicas {
+		if rp.ackOffset.Load() >= offset {
+			count++
+		}
+	}
+	return count
+}
+
+// notifyAcked wakes up everyone waiting on acknowledgements.
+func (r *Replication) notifyAcked() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	close(r.acked)
+	r.acked = make(chan struct{})
+}
+
+// Wait handles WAIT.
+// It blocks until numreplicas replicas have acknowledged every write so far, or until the timeout (0 blocks forever).
+func (r *Replication) Wait(commands []string) (string, bool) {
+	if len(commands) != 3 {
+		return invalidArgsErr, true
+	}
+
+	n, err := strconv.ParseInt(commands[1], 10, 64)
+	if err != nil {
+		return messages.GetErrorString("ERR value is not an integer or out of range"), true
+	}
+	timeout, err := strconv.ParseInt(commands[2], 10, 64)
+	if err != nil || timeout < 0 {
+		return messages.GetErrorString("ERR timeout is not an integer or out of range"), true
+	}
+
+	r.mu.Lock()
+	if r.master != nil {
+		r.mu.Unlock()
+		return messages.GetErrorString("ERR WAIT cannot be used with replica instances."), true
+	}
+	target := r.backlog.Offset()
+	count := r.countAcked(target)
+	if count < n {
+		// ask for acknowledgements now, instead of waiting for the periodic ones
+		r.feed([]string{"REPLCONF", "GETACK", "*"})
+	}
+	acked := r.acked
+	r.mu.Unlock()
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(time.Duration(timeout) * time.Millisecond)
+		defer t.Stop()
+		deadline = t.C
+	}
+
+	for count < n {
+		select {
+		case <-acked:
+		case <-deadline:
+			return messages.NewInteger(count).Serialise(), true
+		}
+
+		r.mu.Lock()
+		count = r.countAcked(target)
+		acked = r.acked
+		r.mu.Unlock()
+	}
+
+	return messages.NewInteger(count).Serialise(), true
+}
+
+// Peer is what a replica told us about itself with REPLCONF, before it sends PSYNC.
+type Peer struct {
+	ListeningPort int
+	Capabilities  []string
+}
+
+// ReplConf handles REPLCONF sent by a replica before it starts syncing.
+func (r *Replication) ReplConf(p *Peer, commands []string) string {
+	if len(commands)%2 != 1 {
+		return messages.GetErrorString("ERR syntax error")
+	}
+
+	for i := 1; i < len(commands); i += 2 {
+		option, value := strings.ToLower(commands[i]), commands[i+1]
+		switch option {
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return messages.GetErrorString("ERR value is not an integer or out of range")
+			}
+			p.ListeningPort = port
+		case "capa":
+			p.Capabilities = append(p.Capabilities, value)
+		case "ip-address":
+			// we always use the address of the connection
+		case "ack", "getack":
+			// only meaningful on a replication link
+			return ""
+		default:
+			return messages.GetErrorString("ERR Unrecognized REPLCONF option: " + commands[i])
+		}
+	}
+
+	return messages.NewSimpleString("OK").Serialise()
+}
+
+var errNotConnected = errors.New("NOMASTERLINK Can't SYNC while not connected with my master")
@@ -0,0 +1,191 @@
+package replication
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+type fakeStore struct {
+	mu        sync.Mutex
+	data      map[string]string
+	snapshots atomic.Int32
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{data: map[string]string{}}
+}
+
+func (f *fakeStore) Snapshot() []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.snapshots.Add(1)
+	b, _ := json.Marshal(f.data)
+	return b
+}
+
+func (f *fakeStore) LoadSnapshot(data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data = map[string]string{}
+	return json.Unmarshal(data, &f.data)
+}
+
+// exec only understands SET.
+func (f *fakeStore) exec(commands []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data[commands[1]] = commands[2]
+	return messages.NewSimpleString("OK").Serialise()
+}
+
+func (f *fakeStore) get(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.data[key]
+}
+
+func set(r *Replication, f *fakeStore, key, value string) string {
+	commands := []string{"SET", key, value}
+	ret, _ := r.Execute(func() (string, bool, [][]string) {
+		return f.exec(commands), true, [][]string{commands}
+	})
+	return ret
+}
+
+// serve accepts replicas for the master, like the server does.
+func serve(t *testing.T, master *Replication) int {
+	l, err := net.Listen("tcp", "localhost:0")
+	NoError(t, err)
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+
+				rd := messages.NewReader(conn)
+				peer := Peer{}
+				for {
+					commands, err := rd.ReadCommands()
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(commands[0]) {
+					case "PING":
+						conn.Write([]byte(messages.NewSimpleString("PONG").Serialise()))
+					case "REPLCONF":
+						conn.Write([]byte(master.ReplConf(&peer, commands)))
+					case "PSYNC", "SYNC":
+						master.ServeReplica(conn, rd, commands, peer)
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func eventually(t *testing.T, f func() bool, msg string) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for: %s", msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func isConnected(r *Replication) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.master != nil && r.master.getState() == stateConnected
+}
+
+func TestReplication(t *testing.T) {
+	masterStore := newFakeStore()
+	master := New(masterStore, nil)
+	masterStore.data["before"] = "sync"
+	port := serve(t, master)
+	defer master.Close()
+
+	replicaStore := newFakeStore()
+	replica := New(replicaStore, replicaStore.exec)
+	defer replica.Close()
+
+	reply, _ := replica.ReplicaOf([]string{"REPLICAOF", "localhost", strconv.Itoa(port)})
+	EqualO(t, reply, "+OK\r\n")
+	EqualO(t, replica.Role(), RoleReplica)
+	eventually(t, func() bool { return isConnected(replica) }, "replica to connect")
+
+	// full sync
+	EqualO(t, replicaStore.get("before"), "sync")
+	EqualO(t, masterStore.snapshots.Load(), int32(1))
+
+	// command stream
+	EqualO(t, set(master, masterStore, "k", "v"), "+OK\r\n")
+	eventually(t, func() bool { return replicaStore.get("k") == "v" }, "replica to apply SET")
+	EqualO(t, replica.Offset(), master.Offset())
+
+	// WAIT
+	reply, _ = master.Wait([]string{"WAIT", "1", "1000"})
+	EqualO(t, reply, ":1\r\n")
+	reply, _ = master.Wait([]string{"WAIT", "2", "50"})
+	EqualO(t, reply, ":1\r\n")
+	reply, _ = replica.Wait([]string{"WAIT", "1", "0"})
+	IsTrue(t, strings.HasPrefix(reply, "-"), "%q", reply)
+
+	// replicas are read-only
+	EqualO(t, set(replica, replicaStore, "k", "local"), ReadOnlyErr)
+
+	// partial resync after a disconnect
+	master.mu.Lock()
+	master.disconnectReplicas()
+	master.mu.Unlock()
+	set(master, masterStore, "missed", "while disconnected")
+	eventually(t, func() bool { return replicaStore.get("missed") == "while disconnected" }, "replica to catch up")
+	EqualO(t, masterStore.snapshots.Load(), int32(1))
+	eventually(t, func() bool { return replica.Offset() == master.Offset() }, "offsets to match")
+
+	// promotion keeps the old history
+	replID := replica.replID
+	reply, _ = replica.ReplicaOf([]string{"REPLICAOF", "NO", "ONE"})
+	EqualO(t, reply, "+OK\r\n")
+	EqualO(t, replica.Role(), RoleMaster)
+	EqualO(t, replica.replID2, replID)
+	EqualO(t, set(replica, replicaStore, "k", "local"), "+OK\r\n")
+}
+
+func TestRoleCommand(t *testing.T) {
+	r := New(newFakeStore(), nil)
+	defer r.Close()
+
+	reply, _ := r.RoleCommand([]string{"ROLE"})
+	EqualO(t, reply, "*3\r\n$6\r\nmaster\r\n:0\r\n*0\r\n")
+
+	reply, _ = r.ReplicaOf([]string{"REPLICAOF", "localhost", "notaport"})
+	IsTrue(t, strings.HasPrefix(reply, "-"), "%q", reply)
+}
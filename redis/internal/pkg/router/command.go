@@ -0,0 +1,198 @@
+package router
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/glob"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/commands/command/
+
+const CommandCommand = "COMMAND"
+
+// COMMAND [subcommand [arguments ...]]
+func (r *Router) Command(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], CommandCommand) {
+		return "", false
+	}
+
+	if len(commands) == 1 {
+		return r.commandInfos(r.Names()), true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "COUNT":
+		return messages.NewInteger(int64(len(r.Names()))).Serialise(), true
+	case "INFO":
+		if len(args) == 0 {
+			return r.commandInfos(r.Names()), true
+		}
+		return r.commandInfos(args), true
+	case "DOCS":
+		if len(args) == 0 {
+			args = r.Names()
+		}
+		return r.commandDocs(args), true
+	case "LIST":
+		return r.commandList(args), true
+	case "GETKEYS":
+		return r.commandGetKeys(args), true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try COMMAND HELP."), true
+	}
+}
+
+// commandInfos replies with the description of each command, or nil for unknown commands, like redis 7.
+func (r *Router) commandInfos(names []string) string {
+	ret := make([]messages.Message, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !r.Exists(name) {
+			ret = append(ret, messages.NewNullBulkString())
+			continue
+		}
+		info := r.info[name]
+
+		categories := make([]string, 0, len(info.categories))
+		for _, category := range info.categories {
+			categories = append(categories, "@"+category)
+		}
+		firstKey, lastKey, keyStep := info.firstKey, info.lastKey, info.keyStep
+		if info.getKeys != nil {
+			// the keys cannot be described by positions
+			firstKey, lastKey, keyStep = 0, 0, 0
+		}
+
+		ret = append(ret, messages.NewArray([]messages.Message{
+			messages.NewBulkString(name),
+			messages.NewInteger(int64(info.arity)),
+			messages.NewArraySimpleString(info.flags()),
+			messages.NewInteger(int64(firstKey)),
+			messages.NewInteger(int64(lastKey)),
+			messages.NewInteger(int64(keyStep)),
+			messages.NewArraySimpleString(categories),
+			// tips
+			messages.NewArray([]messages.Message{}),
+			info.keySpecs(),
+			// subcommands
+			messages.NewArray([]messages.Message{}),
+		}))
+	}
+	return messages.NewArray(ret).Serialise()
+}
+
+// keySpecs describes the positions of the keys, like redis 7.
+func (info commandInfo) keySpecs() messages.Message {
+	if info.getKeys == nil && info.firstKey <= 0 {
+		return messages.NewArray([]messages.Message{})
+	}
+
+	access := "RO"
+	if info.write {
+		access = "RW"
+	}
+	beginSearch := []messages.Message{messages.NewBulkString("type"), messages.NewBulkString("unknown"), messages.NewBulkString("spec"), messages.NewArray([]messages.Message{})}
+	findKeys := beginSearch
+	if info.getKeys == nil {
+		// lastkey is relative to the first key, unless it counts from the end
+		lastKey := info.lastKey
+		if lastKey >= 0 {
+			lastKey -= info.firstKey
+		}
+		beginSearch = []messages.Message{
+			messages.NewBulkString("type"), messages.NewBulkString("index"),
+			messages.NewBulkString("spec"), messages.NewArray([]messages.Message{messages.NewBulkString("index"), messages.NewInteger(int64(info.firstKey))}),
+		}
+		findKeys = []messages.Message{
+			messages.NewBulkString("type"), messages.NewBulkString("range"),
+			messages.NewBulkString("spec"), messages.NewArray([]messages.Message{
+				messages.NewBulkString("lastkey"), messages.NewInteger(int64(lastKey)),
+				messages.NewBulkString("keystep"), messages.NewInteger(int64(max(info.keyStep, 1))),
+				messages.NewBulkString("limit"), messages.NewInteger(0),
+			}),
+		}
+	}
+
+	return messages.NewArray([]messages.Message{
+		messages.NewArray([]messages.Message{
+			messages.NewBulkString("flags"), messages.NewArraySimpleString([]string{access}),
+			messages.NewBulkString("begin_search"), messages.NewArray(beginSearch),
+			messages.NewBulkString("find_keys"), messages.NewArray(findKeys),
+		}),
+	})
+}
+
+// commandDocs replies with the name and documentation of each command, skipping unknown commands.
+func (r *Router) commandDocs(names []string) string {
+	ret := []messages.Message{}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !r.Exists(name) {
+			continue
+		}
+		info := r.info[name]
+		ret = append(ret, messages.NewBulkString(name), messages.NewArray([]messages.Message{
+			messages.NewBulkString("summary"), messages.NewBulkString(info.summary),
+			messages.NewBulkString("group"), messages.NewBulkString(info.group()),
+		}))
+	}
+	return messages.NewArray(ret).Serialise()
+}
+
+// COMMAND LIST [FILTERBY MODULE module-name | ACLCAT category | PATTERN pattern]
+func (r *Router) commandList(args []string) string {
+	names := r.Names()
+	if len(args) == 0 {
+		return messages.NewArrayBulkString(names).Serialise()
+	}
+	if len(args) != 3 || !strings.EqualFold(args[0], "FILTERBY") {
+		return messages.GetErrorString("ERR syntax error")
+	}
+
+	ret := []string{}
+	switch strings.ToUpper(args[1]) {
+	case "MODULE":
+		// there are no modules
+	case "ACLCAT":
+		category := strings.ToLower(args[2])
+		for _, name := range names {
+			if slices.Contains(r.info[name].categories, category) {
+				ret = append(ret, name)
+			}
+		}
+	case "PATTERN":
+		pattern := strings.ToLower(args[2])
+		for _, name := range names {
+			if glob.Match(pattern, name) {
+				ret = append(ret, name)
+			}
+		}
+	default:
+		return messages.GetErrorString("ERR syntax error")
+	}
+	return messages.NewArrayBulkString(ret).Serialise()
+}
+
+// COMMAND GETKEYS command [arg ...]
+func (r *Router) commandGetKeys(args []string) string {
+	if len(args) == 0 {
+		return messages.GetErrorString("ERR wrong number of arguments for 'command|getkeys' command")
+	}
+
+	name := strings.ToLower(args[0])
+	if !r.Exists(name) {
+		return messages.GetErrorString("ERR Invalid command specified")
+	}
+	info := r.info[name]
+	if !info.checkArity(args) {
+		return messages.GetErrorString("ERR Invalid number of arguments specified for command")
+	}
+	keys := info.keys(args)
+	if len(keys) == 0 {
+		return messages.GetErrorString("ERR The command has no key arguments")
+	}
+	return messages.NewArrayBulkString(keys).Serialise()
+}
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/info"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/replication"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/commands/hello/
+
+const HelloCommand = "HELLO"
+
+type helloArgs struct {
+	// resp is the protocol version, 0 to keep the client's.
+	resp int
+	// username and password authenticate the client, if auth is set.
+	auth               bool
+	username, password string
+	// name is the client's new name, if setName is set.
+	setName bool
+	name    string
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func parseHelloArguments(commands []string) (helloArgs, error) {
+	args := helloArgs{}
+	if len(commands) > 1 {
+		version, err := strconv.Atoi(commands[1])
+		if err != nil {
+			return args, errors.New("ERR Protocol version is not an integer or out of range")
+		}
+		if version != 2 && version != 3 {
+			return args, errors.New("NOPROTO unsupported protocol version")
+		}
+		args.resp = version
+	}
+
+	for i := 2; i < len(commands); i++ {
+		left := len(commands) - i - 1
+		switch {
+		case strings.EqualFold(commands[i], "AUTH") && left >= 2:
+			args.auth, args.username, args.password = true, commands[i+1], commands[i+2]
+			i += 2
+		case strings.EqualFold(commands[i], "SETNAME") && left >= 1:
+			args.setName, args.name = true, commands[i+1]
+			i++
+		default:
+			return args, errors.New("ERR Syntax error in HELLO option '" + commands[i] + "'")
+		}
+	}
+
+	return args, nil
+}
+
+// helloAuths returns whether HELLO authenticates the client itself (with AUTH), so it needs no authorization.
+// Only a valid AUTH option does, not e.g. a client name of "AUTH".
+func helloAuths(commands []string) bool {
+	args, err := parseHelloArguments(commands)
+	return err == nil && args.auth
+}
+
+// Hello switches the protocol of the client, like redis.
+// Only push messages (e.g. of CLIENT TRACKING) differ in RESP3, other replies are the same as in RESP2.
+func (r *Router) Hello(c *client.Client, commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], HelloCommand) {
+		return "", false
+	}
+
+	args, err := parseHelloArguments(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+	resp := c.Resp()
+	if args.resp != 0 {
+		resp = args.resp
+	}
+
+	if args.auth && r.acl != nil && !r.acl.Authenticate(c, args.username, args.password) {
+		return messages.GetErrorString("WRONGPASS invalid username-password pair or user is disabled."), true
+	}
+	if args.setName {
+		for _, ch := range args.name {
+			if ch <= ' ' || ch > '~' {
+				return messages.GetErrorString("ERR Client names cannot contain spaces, newlines or special characters."), true
+			}
+		}
+		c.SetName(args.name)
+	}
+	c.SetResp(resp)
+
+	mode, role := "standalone", "master"
+	if r.cluster != nil {
+		mode = "cluster"
+	}
+	if r.repl != nil && r.repl.Role() == replication.RoleReplica {
+		role = "replica"
+	}
+	pairs := []messages.Message{
+		messages.NewBulkString("server"), messages.NewBulkString("redis"),
+		messages.NewBulkString("version"), messages.NewBulkString(info.RedisVersion),
+		messages.NewBulkString("proto"), messages.NewInteger(int64(resp)),
+		messages.NewBulkString("id"), messages.NewInteger(c.ID),
+		messages.NewBulkString("mode"), messages.NewBulkString(mode),
+		messages.NewBulkString("role"), messages.NewBulkString(role),
+		messages.NewBulkString("modules"), messages.NewArray([]messages.Message{}),
+	}
+	if resp == 3 {
+		return messages.NewMap(pairs).Serialise(), true
+	}
+	return messages.NewArray(pairs).Serialise(), true
+}
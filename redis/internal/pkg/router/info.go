@@ -0,0 +1,153 @@
+package router
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+)
+
+// commandInfo is what the router needs to know about a command, besides how to handle it.
+// It is also what COMMAND reports.
+type commandInfo struct {
+	// arity is the number of arguments (including the command's name), or the negated minimum number if it is negative.
+	arity int
+	// summary describes the command, for COMMAND DOCS.
+	summary string
+	// blocking commands may wait (e.g. for replicas) before replying.
+	blocking bool
+	// noScript commands cannot be called from scripts.
+	noScript bool
+	// scripting commands do not wait for scripts, they run scripts (or manage them) themselves.
+	scripting bool
+
+	// write commands modify the keyspace, they are propagated to replicas.
+	write bool
+	// writeSubcommands are the lowercase subcommands that are writes, for commands that are not.
+	writeSubcommands []string
+	// asking commands behave as if ASKING was sent before them.
+	asking bool
+	// denyOOM commands may use more memory, they are rejected when the memory limit cannot be kept.
+	denyOOM bool
+
+	// firstKey, lastKey and keyStep are the positions of the keys in the command.
+	// firstKey is 0 if the command has no keys; lastKey is negative to count from the end (-1 is the last argument).
+	firstKey int
+	lastKey  int
+	keyStep  int
+	// getKeys returns the keys for commands whose keys cannot be described by positions, if set.
+	getKeys func(commands []string) []string
+	// access is set for writes that also read the values of their keys (e.g. INCR replies with the value), if they always do.
+	// accesses is set instead for those that only do with some arguments (e.g. SET with GET).
+	// Either way, the ACL user needs read access to the keys too.
+	access   bool
+	accesses func(commands []string) bool
+
+	// categories are the ACL categories of the command (e.g. "read", "fast").
+	categories []string
+	// subcommands are the ACL categories of subcommands that differ from the command's, by their lowercase names.
+	subcommands map[string][]string
+
+	// channels returns the pub/sub channels in the command, if set.
+	channels func(commands []string) []string
+	// channelPatterns is set if the channels are patterns.
+	channelPatterns bool
+
+	// propagate rewrites the command before it is propagated to replicas, if set.
+	// It is given the client and the reply, and returns nil if nothing should be propagated.
+	propagate func(c *client.Client, commands []string, reply string) []string
+}
+
+// keys returns the keys in the command.
+func (info commandInfo) keys(commands []string) []string {
+	if info.getKeys != nil {
+		return info.getKeys(commands)
+	}
+	if info.firstKey <= 0 || info.firstKey >= len(commands) {
+		return nil
+	}
+
+	last := info.lastKey
+	if last < 0 {
+		last += len(commands)
+	}
+	last = min(last, len(commands)-1)
+	step := max(info.keyStep, 1)
+
+	ret := make([]string, 0, (last-info.firstKey)/step+1)
+	for i := info.firstKey; i <= last; i += step {
+		ret = append(ret, commands[i])
+	}
+	return ret
+}
+
+// isWrite returns whether the command (or its subcommand) is a write.
+func (info commandInfo) isWrite(commands []string) bool {
+	return info.write || (len(commands) > 1 && slices.Contains(info.writeSubcommands, strings.ToLower(commands[1])))
+}
+
+// isAccess returns whether the command reads the values of its keys although it is a write.
+func (info commandInfo) isAccess(commands []string) bool {
+	return info.access || info.accesses != nil && info.accesses(commands)
+}
+
+// checkArity returns whether the command has a valid number of arguments.
+func (info commandInfo) checkArity(commands []string) bool {
+	if info.arity >= 0 {
+		return info.arity == 0 || len(commands) == info.arity
+	}
+	return len(commands) >= -info.arity
+}
+
+// flags returns the flags of the command, like redis' COMMAND INFO.
+func (info commandInfo) flags() []string {
+	ret := []string{}
+	if info.write {
+		ret = append(ret, "write")
+	} else if slices.Contains(info.categories, "read") {
+		ret = append(ret, "readonly")
+	}
+	if info.denyOOM {
+		ret = append(ret, "denyoom")
+	}
+	if slices.Contains(info.categories, "admin") {
+		ret = append(ret, "admin")
+	}
+	if slices.Contains(info.categories, "pubsub") {
+		ret = append(ret, "pubsub")
+	}
+	if info.noScript {
+		ret = append(ret, "noscript")
+	}
+	if slices.Contains(info.categories, "fast") {
+		ret = append(ret, "fast")
+	}
+	if info.blocking {
+		ret = append(ret, "blocking")
+	}
+	if info.getKeys != nil {
+		ret = append(ret, "movablekeys")
+	}
+	return ret
+}
+
+// group returns the group of the command in redis' documentation (e.g. "string").
+func (info commandInfo) group() string {
+	for _, category := range []string{"string", "list", "pubsub", "connection", "scripting"} {
+		if slices.Contains(info.categories, category) {
+			return category
+		}
+	}
+	if slices.Contains(info.categories, "keyspace") {
+		return "generic"
+	}
+	return "server"
+}
+
+// categoriesOf returns the ACL categories of the command, with the subcommand (if it has one).
+func (info commandInfo) categoriesOf(subcommand string) []string {
+	if categories, ok := info.subcommands[strings.ToLower(subcommand)]; ok {
+		return categories
+	}
+	return info.categories
+}
@@ -2,26 +2,78 @@ package router
 
 import (
 	"errors"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/acl"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/cluster"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/handler"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/info"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/latency"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/metrics"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/monitor"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/replication"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/scripting"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/slowlog"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tracking"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 var EmptyBodyErr string = messages.GetErrorString("request body cannot be empty")
 var BodyParsingErr string = messages.GetErrorString("request body could not be parsed")
 
-type Route func(commands []string) (string, bool)
+// Route handles a command from the client, which holds the state of its connection (e.g. its store, ASKING).
+type Route func(c *client.Client, commands []string) (string, bool)
+
+// stateless adapts a route that does not need the state of the connection.
+func stateless(route func(commands []string) (string, bool)) Route {
+	return func(_ *client.Client, commands []string) (string, bool) {
+		return route(commands)
+	}
+}
 
 type Router struct {
 	handlers map[string]Route
+	info     map[string]commandInfo
+	repl     *replication.Replication
+	cluster  *cluster.Cluster
+	// acl is nil if clients may run any command.
+	acl *acl.ACL
+	// master is the client for commands from our master.
+	master *client.Client
+	stats  info.Stats
+	// latencies are the latencies of the handlers, by command.
+	latencies metrics.Commands
+	// clients is nil unless clients can be paused.
+	clients *client.Registry
+	// slowlog and latency are nil unless slow commands are logged and monitored.
+	slowlog *slowlog.SlowLog
+	latency *latency.Monitor
+	// monitors is nil unless clients can MONITOR.
+	monitors *monitor.Monitors
+	// scripts is nil unless clients can run scripts.
+	scripts *scripting.Engine
+	// store is the store of the clients that the router creates (e.g. our master).
+	store *store.Store
+	// tracking is nil unless clients can track the keys that they cache.
+	tracking *tracking.Tracking
 }
 
 func New(routes map[string]Route) *Router {
+	master := client.New("master")
+	master.Master = true
+
 	router := &Router{
 		handlers: make(map[string]Route),
+		info:     make(map[string]commandInfo),
+		master:   master,
 	}
 
 	for cmd, r := range routes {
@@ -31,7 +83,8 @@ func New(routes map[string]Route) *Router {
 	return router
 }
 
-func NewDefault() *Router {
+// NewDefault constructs a Router with the default commands, the clients that it creates (e.g. our master) use st.
+func NewDefault(st *store.Store) *Router {
 	routes := map[string]Route{
 		handler.PingCommand:   handler.Ping,
 		handler.EchoCommand:   handler.Echo,
@@ -46,11 +99,359 @@ func NewDefault() *Router {
 		handler.LRangeCommand: handler.LRange,
 		handler.SaveCommand:   handler.Save,
 		handler.DelCommand:    handler.Del,
+		handler.ScanCommand:   handler.Scan,
+
+		handler.PExpireAtCommand:     handler.PExpireAt,
+		handler.SortCommand:          handler.Sort,
+		handler.SortROCommand:        handler.Sort,
+		handler.DumpCommand:          handler.Dump,
+		handler.RestoreCommand:       handler.Restore,
+		handler.MigrateCommand:       handler.Migrate,
+		handler.RestoreAskingCommand: handler.RestoreAsking,
+		handler.ObjectCommand:        handler.Object,
+		handler.MemoryCommand:        handler.Memory,
 	}
 
 	// for routes like ACL, use sub-handlers
 
-	return New(routes)
+	router := New(routes)
+	router.store = st
+	router.master.Store = st
+	router.AddRoute(CommandCommand, stateless(router.Command))
+	router.AddRoute(HelloCommand, router.Hello)
+
+	read := func(arity int, summary string, categories ...string) commandInfo {
+		return commandInfo{arity: arity, summary: summary, firstKey: 1, lastKey: 1, keyStep: 1, categories: append([]string{"read"}, categories...)}
+	}
+	write := func(arity int, summary string, categories ...string) commandInfo {
+		return commandInfo{arity: arity, summary: summary, write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, categories: append([]string{"write"}, categories...)}
+	}
+	// access marks writes that reply with the values of their keys
+	access := func(info commandInfo) commandInfo {
+		info.access = true
+		return info
+	}
+	admin := []string{"admin", "slow", "dangerous"}
+	infos := map[string]commandInfo{
+		HelloCommand:          {arity: -1, summary: "Handshakes with the Redis server.", noScript: true, categories: []string{"fast", "connection"}},
+		handler.PingCommand:   {arity: -1, summary: "Returns the server's liveliness response.", categories: []string{"fast", "connection"}},
+		handler.EchoCommand:   {arity: 2, summary: "Returns the given string.", categories: []string{"fast", "connection"}},
+		handler.GetCommand:    read(2, "Returns the string value of a key.", "string", "fast"),
+		handler.SetCommand:    {arity: -3, summary: "Sets the string value of a key, ignoring its type. The key is created if it doesn't exist.", write: true, denyOOM: true, accesses: handler.SetGets, propagate: propagateSet, firstKey: 1, lastKey: 1, keyStep: 1, categories: []string{"write", "string", "slow"}},
+		handler.ExistsCommand: {arity: -2, summary: "Determines whether one or more keys exist.", firstKey: 1, lastKey: -1, keyStep: 1, categories: []string{"keyspace", "read", "fast"}},
+		handler.IncrCommand:   access(write(2, "Increments the integer value of a key by one. Uses 0 as initial value if the key doesn't exist.", "string", "fast")),
+		handler.DecrCommand:   access(write(2, "Decrements the integer value of a key by one. Uses 0 as initial value if the key doesn't exist.", "string", "fast")),
+		handler.LPushCommand:  write(-3, "Prepends one or more elements to a list. Creates the key if it doesn't exist.", "list", "fast"),
+		handler.RPushCommand:  write(-3, "Appends one or more elements to a list. Creates the key if it doesn't exist.", "list", "fast"),
+		handler.LLenCommand:   read(2, "Returns the length of a list.", "list", "fast"),
+		handler.LRangeCommand: read(4, "Returns a range of elements from a list.", "list", "slow"),
+		handler.SaveCommand:   {arity: 1, summary: "Synchronously saves the database(s) to disk.", noScript: true, categories: admin},
+		handler.DelCommand:    {arity: -2, summary: "Deletes one or more keys.", write: true, firstKey: 1, lastKey: -1, keyStep: 1, categories: []string{"keyspace", "write", "slow"}},
+		handler.ScanCommand:   {arity: -2, summary: "Iterates over the key names in the database.", categories: []string{"keyspace", "read", "slow"}},
+
+		// like redis, SORT is a write even without STORE, SORT_RO is for read-only replicas
+		handler.SortCommand:      {arity: -2, summary: "Sorts the elements in a list, a set, or a sorted set, optionally storing the result.", write: true, denyOOM: true, access: true, getKeys: handler.SortKeys, propagate: propagateSort, categories: []string{"write", "list", "slow", "dangerous"}},
+		handler.SortROCommand:    {arity: -2, summary: "Returns the sorted elements of a list, a set, or a sorted set.", getKeys: handler.SortKeys, categories: []string{"read", "list", "slow", "dangerous"}},
+		handler.PExpireAtCommand: {arity: 3, summary: "Sets the expiration time of a key to a Unix milliseconds timestamp.", write: true, firstKey: 1, lastKey: 1, keyStep: 1, categories: []string{"keyspace", "write", "fast"}},
+		handler.DumpCommand:      read(2, "Returns a serialized representation of the value stored at a key.", "keyspace", "slow"),
+		handler.RestoreCommand:   {arity: -4, summary: "Creates a key from the serialized representation of a value.", write: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, propagate: propagateRestore, categories: []string{"write", "keyspace", "slow", "dangerous"}},
+		handler.MigrateCommand:   {arity: -6, summary: "Atomically transfers a key from one Redis instance to another.", write: true, access: true, getKeys: handler.MigrateKeys, propagate: propagateMigrate, categories: []string{"keyspace", "write", "slow", "dangerous"}},
+		// only sent by MIGRATE, to a node that is importing the slot
+		handler.RestoreAskingCommand: {arity: -4, summary: "An internal command for migrating keys in a cluster.", write: true, asking: true, denyOOM: true, firstKey: 1, lastKey: 1, keyStep: 1, propagate: propagateRestore, categories: []string{"keyspace", "write", "slow", "dangerous"}},
+		handler.ObjectCommand:        {arity: -2, summary: "A container for object introspection commands.", firstKey: 2, lastKey: 2, keyStep: 1, categories: []string{"keyspace", "read", "slow"}},
+		handler.MemoryCommand:        {arity: -2, summary: "A container for memory diagnostics commands.", firstKey: 2, lastKey: 2, keyStep: 1, categories: []string{"read", "slow"}},
+		CommandCommand:               {arity: -1, summary: "Returns detailed information about all commands.", categories: []string{"slow", "connection"}},
+
+		// handled by the server, before they reach the router
+		"REPLCONF": {arity: -1, summary: "An internal command for configuring the replication stream.", noScript: true, categories: admin},
+		"PSYNC":    {arity: -3, summary: "An internal command used in replication.", noScript: true, categories: admin},
+		"SYNC":     {arity: 1, summary: "An internal command used in replication.", noScript: true, categories: admin},
+	}
+	for cmd, info := range infos {
+		router.addInfo(cmd, info)
+	}
+
+	return router
+}
+
+// propagateSet only propagates SETs that set the key, with absolute expiries.
+func propagateSet(c *client.Client, commands []string, reply string) []string {
+	return handler.SetPropagation(c.Store, commands, reply)
+}
+
+// propagateRestore propagates RESTORE with an absolute TTL.
+func propagateRestore(c *client.Client, commands []string, reply string) []string {
+	return handler.RestorePropagation(c.Store, commands, reply)
+}
+
+// propagateMigrate deletes the keys that MIGRATE deleted from our replicas, even if it failed for other keys.
+func propagateMigrate(c *client.Client, commands []string, reply string) []string {
+	if len(c.Migrated) == 0 {
+		return nil
+	}
+	return append([]string{handler.DelCommand}, c.Migrated...)
+}
+
+// propagateSort only propagates SORT with STORE, as it does not write otherwise.
+func propagateSort(c *client.Client, commands []string, reply string) []string {
+	if strings.HasPrefix(reply, "-") || !handler.SortStores(commands) {
+		return nil
+	}
+	return commands
+}
+
+// SetReplication makes the router propagate writes with repl, and adds the replication commands.
+func (r *Router) SetReplication(repl *replication.Replication) {
+	r.repl = repl
+
+	r.AddRoute("REPLICAOF", stateless(repl.ReplicaOf))
+	r.AddRoute("SLAVEOF", stateless(repl.ReplicaOf))
+	r.AddRoute("ROLE", stateless(repl.RoleCommand))
+	r.AddRoute("WAIT", stateless(repl.Wait))
+
+	dangerous := []string{"admin", "slow", "dangerous"}
+	r.addInfo("REPLICAOF", commandInfo{arity: 3, summary: "Configures a server as replica of another, or promotes it to a master.", noScript: true, categories: dangerous})
+	r.addInfo("SLAVEOF", commandInfo{arity: 3, summary: "Sets a Redis server as a replica of another, or promotes it to being a master.", noScript: true, categories: dangerous})
+	r.addInfo("ROLE", commandInfo{arity: 1, summary: "Returns the replication role.", categories: []string{"admin", "fast", "dangerous"}})
+	r.addInfo("WAIT", commandInfo{arity: 3, summary: "Blocks until the asynchronous replication of all preceding write commands sent by the connection is completed.", blocking: true, noScript: true, categories: []string{"slow", "connection"}})
+}
+
+// SetCluster makes the router redirect commands for keys that other nodes serve, and adds the cluster commands.
+func (r *Router) SetCluster(c *cluster.Cluster) {
+	r.cluster = c
+
+	r.AddRoute("CLUSTER", stateless(c.Command))
+	r.AddRoute(handler.AskingCommand, handler.Asking)
+	r.AddRoute(handler.ReadOnlyCommand, handler.ReadOnly)
+	r.AddRoute(handler.ReadWriteCommand, handler.ReadWrite)
+
+	dangerous := []string{"admin", "slow", "dangerous"}
+	r.addInfo("CLUSTER", commandInfo{
+		arity:      -2,
+		summary:    "A container for Redis Cluster commands.",
+		categories: []string{"slow"},
+		subcommands: map[string][]string{
+			"addslots": dangerous, "addslotsrange": dangerous, "delslots": dangerous, "delslotsrange": dangerous,
+			"meet": dangerous, "setslot": dangerous,
+		},
+	})
+	connection := []string{"fast", "connection"}
+	r.addInfo(handler.AskingCommand, commandInfo{arity: 1, summary: "Signals that a cluster client is following an -ASK redirect.", categories: connection})
+	r.addInfo(handler.ReadOnlyCommand, commandInfo{arity: 1, summary: "Enables read-only queries for a connection to a Redis Cluster replica node.", categories: connection})
+	r.addInfo(handler.ReadWriteCommand, commandInfo{arity: 1, summary: "Enables read-write queries for a connection to a Redis Cluster replica node.", categories: connection})
+}
+
+// SetPubSub adds the pub/sub commands, with messages published to ps.
+func (r *Router) SetPubSub(ps *pubsub.PubSub) {
+	subscribe := func(c *client.Client, commands []string) (string, bool) {
+		return ps.Command(c.Sub, commands)
+	}
+	r.AddRoute(pubsub.SubscribeCommand, subscribe)
+	r.AddRoute(pubsub.PSubscribeCommand, subscribe)
+	r.AddRoute(pubsub.UnsubscribeCommand, subscribe)
+	r.AddRoute(pubsub.PUnsubscribeCommand, subscribe)
+	r.AddRoute(pubsub.PublishCommand, stateless(ps.PublishRoute))
+	r.AddRoute(pubsub.PubSubCommand, stateless(ps.PubSubRoute))
+
+	args := func(commands []string) []string {
+		return commands[1:]
+	}
+	r.addInfo(pubsub.SubscribeCommand, commandInfo{arity: -2, summary: "Listens for messages published to channels.", noScript: true, categories: []string{"pubsub", "slow"}, channels: args})
+	r.addInfo(pubsub.PSubscribeCommand, commandInfo{arity: -2, summary: "Listens for messages published to channels that match one or more patterns.", noScript: true, categories: []string{"pubsub", "slow"}, channels: args, channelPatterns: true})
+	r.addInfo(pubsub.UnsubscribeCommand, commandInfo{arity: -1, summary: "Stops listening to messages posted to channels.", noScript: true, categories: []string{"pubsub", "slow"}})
+	r.addInfo(pubsub.PUnsubscribeCommand, commandInfo{arity: -1, summary: "Stops listening to messages published to channels that match one or more patterns.", noScript: true, categories: []string{"pubsub", "slow"}})
+	r.addInfo(pubsub.PublishCommand, commandInfo{
+		arity:      3,
+		summary:    "Posts a message to a channel.",
+		categories: []string{"pubsub", "fast"},
+		channels: func(commands []string) []string {
+			return commands[1:min(2, len(commands))]
+		},
+	})
+	r.addInfo(pubsub.PubSubCommand, commandInfo{arity: -2, summary: "A container for Pub/Sub commands.", categories: []string{"pubsub", "slow"}})
+}
+
+// SetACL makes the router check that clients are allowed to run commands, and adds AUTH and ACL.
+func (r *Router) SetACL(a *acl.ACL) {
+	r.acl = a
+
+	r.AddRoute(acl.AuthCommand, a.Auth)
+	r.AddRoute(acl.ACLCommand, a.Command)
+
+	dangerous := []string{"admin", "slow", "dangerous"}
+	r.addInfo(acl.AuthCommand, commandInfo{arity: -2, summary: "Authenticates the connection.", noScript: true, categories: []string{"fast", "connection"}})
+	r.addInfo(acl.ACLCommand, commandInfo{
+		arity:      -2,
+		summary:    "A container for Access List Control commands.",
+		categories: []string{"slow"},
+		subcommands: map[string][]string{
+			"setuser": dangerous, "getuser": dangerous, "deluser": dangerous, "list": dangerous, "users": dangerous,
+			"log": dangerous, "load": dangerous, "save": dangerous,
+		},
+	})
+}
+
+// SetConfig adds CONFIG, for the parameters of the config.
+func (r *Router) SetConfig(cfg *config.Config) {
+	r.AddRoute(config.ConfigCommand, stateless(cfg.Command))
+	r.addInfo(config.ConfigCommand, commandInfo{arity: -2, summary: "A container for server configuration commands.", categories: []string{"admin", "slow", "dangerous"}})
+}
+
+// SetClients adds CLIENT for the clients in reg, and pauses commands while they are paused.
+func (r *Router) SetClients(reg *client.Registry) {
+	r.clients = reg
+
+	r.AddRoute(client.ClientCommand, reg.Command)
+
+	admin := []string{"admin", "slow", "dangerous", "connection"}
+	r.addInfo(client.ClientCommand, commandInfo{
+		arity:      -2,
+		summary:    "A container for client connection commands.",
+		categories: []string{"slow", "connection"},
+		subcommands: map[string][]string{
+			"list": admin, "kill": admin, "pause": admin, "unpause": admin, "no-evict": admin,
+		},
+	})
+}
+
+// SetSlowLog logs the commands that are slow in l, and adds SLOWLOG.
+func (r *Router) SetSlowLog(l *slowlog.SlowLog) {
+	r.slowlog = l
+
+	r.AddRoute(slowlog.SlowLogCommand, stateless(l.Command))
+	r.addInfo(slowlog.SlowLogCommand, commandInfo{arity: -2, summary: "A container for slow log commands.", categories: []string{"admin", "slow", "dangerous"}})
+}
+
+// SetLatency monitors the latencies of commands with m, and adds LATENCY.
+func (r *Router) SetLatency(m *latency.Monitor) {
+	r.latency = m
+
+	r.AddRoute(latency.LatencyCommand, stateless(m.Command))
+	r.addInfo(latency.LatencyCommand, commandInfo{arity: -2, summary: "A container for latency diagnostics commands.", categories: []string{"admin", "slow", "dangerous"}})
+}
+
+// SetMonitors sends the commands that are handled to the monitors, and adds MONITOR.
+func (r *Router) SetMonitors(m *monitor.Monitors) {
+	r.monitors = m
+
+	r.AddRoute(monitor.MonitorCommand, m.Command)
+	r.addInfo(monitor.MonitorCommand, commandInfo{arity: 1, summary: "Listens for all requests received by the server in real-time.", noScript: true, categories: []string{"admin", "slow", "dangerous"}})
+}
+
+// SetScripting runs scripts with e atomically, and adds EVAL, SCRIPT, FCALL and FUNCTION.
+func (r *Router) SetScripting(e *scripting.Engine) {
+	r.scripts = e
+
+	r.AddRoute(scripting.EvalCommand, e.Eval)
+	r.AddRoute(scripting.EvalShaCommand, e.Eval)
+	r.AddRoute(scripting.EvalROCommand, e.Eval)
+	r.AddRoute(scripting.EvalShaROCommand, e.Eval)
+	r.AddRoute(scripting.ScriptCommand, stateless(e.Script))
+
+	eval := func(summary string) commandInfo {
+		// the writes of the script are propagated as they are called
+		return commandInfo{arity: -3, summary: summary, noScript: true, scripting: true, getKeys: scripting.Keys, categories: []string{"slow", "scripting"}}
+	}
+	r.addInfo(scripting.EvalCommand, eval("Executes a server-side Lua script."))
+	r.addInfo(scripting.EvalShaCommand, eval("Executes a server-side Lua script by SHA1 digest."))
+	r.addInfo(scripting.EvalROCommand, eval("Executes a read-only server-side Lua script."))
+	r.addInfo(scripting.EvalShaROCommand, eval("Executes a read-only server-side Lua script by SHA1 digest."))
+	r.addInfo(scripting.ScriptCommand, commandInfo{arity: -2, summary: "A container for Lua scripts management commands.", noScript: true, scripting: true, categories: []string{"slow", "scripting"}})
+
+	r.AddRoute(scripting.FCallCommand, e.FCall)
+	r.AddRoute(scripting.FCallROCommand, e.FCall)
+	r.AddRoute(scripting.FunctionCommand, stateless(e.Function))
+
+	r.addInfo(scripting.FCallCommand, eval("Invokes a function."))
+	r.addInfo(scripting.FCallROCommand, eval("Invokes a read-only function."))
+	// the libraries are propagated to replicas, as they are saved with the keys
+	writes := []string{"write", "slow", "scripting"}
+	r.addInfo(scripting.FunctionCommand, commandInfo{
+		arity: -2, summary: "A container for function commands.", noScript: true, scripting: true,
+		writeSubcommands: []string{"load", "delete", "flush", "restore"},
+		categories:       []string{"slow", "scripting"},
+		subcommands:      map[string][]string{"load": writes, "delete": writes, "flush": writes, "restore": writes},
+	})
+}
+
+// SetTracking sends the invalidations of the keys that commands write to the clients in t that cache them.
+func (r *Router) SetTracking(t *tracking.Tracking) {
+	r.tracking = t
+}
+
+// SetInfo adds INFO.
+func (r *Router) SetInfo(i *info.Info) {
+	r.AddRoute(info.InfoCommand, stateless(i.Command))
+	r.addInfo(info.InfoCommand, commandInfo{arity: -1, summary: "Returns information and statistics about the server.", categories: []string{"slow", "dangerous"}})
+}
+
+// Exists returns whether there is such a command.
+func (r *Router) Exists(command string) bool {
+	command = strings.ToLower(command)
+	_, ok := r.handlers[command]
+	_, infoOk := r.info[command]
+	return ok || infoOk
+}
+
+// Categories returns the ACL categories of the command, with the subcommand (if it has one).
+func (r *Router) Categories(command, subcommand string) []string {
+	return r.info[strings.ToLower(command)].categoriesOf(subcommand)
+}
+
+// Names returns the names of all commands, in lowercase.
+func (r *Router) Names() []string {
+	names := map[string]struct{}{}
+	for name := range r.handlers {
+		names[name] = struct{}{}
+	}
+	for name := range r.info {
+		names[name] = struct{}{}
+	}
+
+	ret := make([]string, 0, len(names))
+	for name := range names {
+		ret = append(ret, name)
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// Authorize returns the error reply if the client may not run the command (e.g. it is not authenticated), and false if it may.
+func (r *Router) Authorize(c *client.Client, commands []string) (string, bool) {
+	if r.acl == nil || c.Master || len(commands) == 0 {
+		return "", false
+	}
+
+	command := strings.ToLower(commands[0])
+	if command == strings.ToLower(acl.AuthCommand) || (command == strings.ToLower(HelloCommand) && helloAuths(commands)) {
+		// clients must be able to authenticate
+		return "", false
+	}
+
+	info := r.info[command]
+	req := acl.Request{
+		Commands: append([]string{command}, commands[1:]...),
+		Keys:     info.keys(commands),
+		Write:    info.isWrite(commands),
+		Access:   info.isAccess(commands),
+	}
+	if info.channels != nil {
+		req.Channels = info.channels(commands)
+		req.ChannelPatterns = info.channelPatterns
+	}
+	if resp, denied := r.acl.Authorize(c, req); denied {
+		return resp, true
+	}
+
+	if command == strings.ToLower(handler.SortCommand) || command == strings.ToLower(handler.SortROCommand) {
+		// like redis, the keys that the patterns look up are not known beforehand, so they need access to every key
+		if option := handler.SortLookups(commands); option != "" {
+			if u := r.acl.User(c.User); u == nil || !u.CanReadAllKeys() {
+				return messages.GetErrorString("ERR " + option + " option of SORT denied due to insufficient ACL permissions."), true
+			}
+		}
+	}
+	return "", false
 }
 
 func (r *Router) Handle(request string) (string, bool) {
@@ -66,14 +467,78 @@ func (r *Router) Handle(request string) (string, bool) {
 		return messages.GetError(err), false
 	}
 
-	ret, ok := r.route(commands)
+	c := client.New("")
+	c.Store = r.store
+	return r.HandleCommands(c, commands), true
+}
+
+// HandleCommands handles a request from the client that has already been parsed.
+func (r *Router) HandleCommands(c *client.Client, commands []string) string {
+	ret, ok := r.route(c, commands)
 	if !ok {
 		msg := "did not match any route"
 		log.Error().Str("err", msg).Strs("commands", commands).Msg("getting commands from request")
-		return messages.GetErrorString(msg), true
+		r.stats.TotalErrorReplies.Add(1)
+		return messages.GetErrorString(msg)
+	}
+
+	r.count(ret)
+	return ret
+}
+
+// count counts a command that was handled, with its reply.
+func (r *Router) count(reply string) {
+	r.stats.TotalCommandsProcessed.Add(1)
+	if strings.HasPrefix(reply, "-") {
+		r.stats.TotalErrorReplies.Add(1)
+	}
+}
+
+// Stats returns the counters collected by the router, for INFO.
+func (r *Router) Stats() *info.Stats {
+	return &r.stats
+}
+
+// feed sends the command to the monitors, unless it is an admin command (or AUTH), like redis.
+func (r *Router) feed(c *client.Client, commands []string, info commandInfo) {
+	subcommand := ""
+	if len(commands) > 1 {
+		subcommand = commands[1]
+	}
+	if slices.Contains(info.categoriesOf(subcommand), "admin") || strings.EqualFold(commands[0], acl.AuthCommand) {
+		return
+	}
+	r.monitors.Feed(time.Now(), c.Addr, commands)
+}
+
+// observe records how long the command took.
+func (r *Router) observe(c *client.Client, commands []string, info commandInfo, d time.Duration) {
+	command := strings.ToLower(commands[0])
+	r.latencies.Observe(command, d)
+	if r.slowlog != nil {
+		r.slowlog.Log(commands, d, c.Addr, c.Name())
+	}
+	if slices.Contains(info.categories, "fast") {
+		r.latency.Add(latency.FastCommand, d)
+	} else {
+		r.latency.Add(latency.Command, d)
 	}
+}
+
+// Latencies returns the latencies of the handlers, by command (in lowercase).
+func (r *Router) Latencies() *metrics.Commands {
+	return &r.latencies
+}
 
-	return ret, true
+// Apply handles a command from our master, it is never rejected for being a write.
+func (r *Router) Apply(commands []string) string {
+	ret, ok := r.route(r.master, commands)
+	if !ok {
+		log.Error().Strs("commands", commands).Msg("command from master did not match any route")
+	} else {
+		r.count(ret)
+	}
+	return ret
 }
 
 func (r *Router) getCommands(request messages.Message) ([]string, error) {
@@ -94,20 +559,130 @@ func (r *Router) AddRoute(command string, route Route) {
 	r.handlers[strings.ToLower(command)] = route
 }
 
-func (r *Router) route(commands []string) (string, bool) {
+func (r *Router) addInfo(command string, info commandInfo) {
+	r.info[strings.ToLower(command)] = info
+}
+
+func (r *Router) route(c *client.Client, commands []string) (string, bool) {
 	if len(commands) == 0 {
 		return "", false
 	}
 
 	command := strings.ToLower(commands[0])
-	route, ok := r.handlers[command]
-	if ok {
-		resp, ok := route(commands)
-		if ok {
-			log.Info().Strs("commands", commands).Str("resp", resp).Msg("matched route")
+	handle, ok := r.handlers[command]
+	if !ok {
+		return "", false
+	}
+
+	info := r.info[command]
+	if !info.checkArity(commands) {
+		return messages.GetErrorString("ERR wrong number of arguments for '" + command + "' command"), true
+	}
+	if c.Script && info.noScript {
+		return messages.GetErrorString("ERR This Redis command is not allowed from script"), true
+	}
+
+	if c.Sub != nil && c.Sub.Count() > 0 {
+		if resp, ok := pubsub.Subscribed(commands); ok {
 			return resp, true
 		}
 	}
+	if resp, denied := r.Authorize(c, commands); denied {
+		return resp, true
+	}
+
+	s := c.Store
+	asking := c.Asking || info.asking
+	if command != strings.ToLower(handler.AskingCommand) {
+		// ASKING only applies to the next command
+		c.Asking = false
+	}
+
+	if r.cluster != nil && !c.Master {
+		if redirect, ok := r.cluster.Redirect(info.keys(commands), asking); ok {
+			return redirect, true
+		}
+	}
+
+	if r.clients != nil && !c.Master && command != strings.ToLower(client.ClientCommand) {
+		// CLIENT is never paused, so that CLIENT UNPAUSE can end the pause
+		r.clients.WaitUnpaused(info.isWrite(commands))
+	}
+
+	if r.scripts != nil && !c.Script && !info.blocking && !info.scripting {
+		// commands wait for the script that is running, as it is atomic; our master's never get BUSY
+		release, ok := r.scripts.Hold(c.Master)
+		if !ok {
+			return scripting.BusyErr, true
+		}
+		defer release()
+	}
+
+	if r.monitors != nil && r.monitors.Active() {
+		r.feed(c, commands, info)
+	}
+
+	write := info.isWrite(commands)
+	exec := func() (string, bool, [][]string) {
+		var propagate [][]string
+		if info.denyOOM && !c.Master && s != nil {
+			// our master evicts for us, its writes are never rejected
+			evicted, err := s.Evict()
+			if len(evicted) > 0 {
+				propagate = append(propagate, append([]string{handler.DelCommand}, evicted...))
+			}
+			if err != nil {
+				return messages.GetError(err), true, propagate
+			}
+		}
+
+		start := time.Now()
+		resp, ok := handle(c, commands)
+		if ok {
+			r.observe(c, commands, info, time.Since(start))
+		}
+		if !write || (strings.HasPrefix(resp, "-") && info.propagate == nil) {
+			// writes that were rejected (e.g. WRONGTYPE) did not modify anything, commands that rewrite their propagation decide for themselves
+			return resp, ok, propagate
+		}
+
+		keys := info.keys(commands)
+		if s != nil {
+			s.UpdateUsage(keys)
+		}
+		if info.propagate == nil {
+			propagate = append(propagate, commands)
+		} else if rewritten := info.propagate(c, commands, resp); rewritten != nil {
+			propagate = append(propagate, rewritten)
+		} else {
+			// nothing was written (e.g. SORT without STORE)
+			return resp, ok, propagate
+		}
+		if r.tracking != nil {
+			r.tracking.Invalidate(c, keys)
+		}
+		return resp, ok, propagate
+	}
+
+	if r.tracking != nil && c.Tracking {
+		// before the keys are read, so that a write that races with the read still invalidates them
+		var keys []string
+		if !write && slices.Contains(info.categories, "read") {
+			keys = info.keys(commands)
+		}
+		r.tracking.Track(c, commands, keys)
+	}
+
+	var resp string
+	if write && r.repl != nil && !c.Master {
+		resp, ok = r.repl.Execute(exec)
+	} else {
+		resp, ok, _ = exec()
+	}
+	if ok {
+		log.Info().Strs("commands", commands).Str("resp", resp).Msg("matched route")
+		return resp, true
+	}
 
 	return "", false
 }
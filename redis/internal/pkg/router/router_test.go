@@ -1,9 +1,17 @@
 package router
 
 import (
+	"slices"
 	"testing"
 
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/acl"
 	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/handler"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tracking"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
 func TestHandle(t *testing.T) {
@@ -33,3 +41,231 @@ func TestHandle(t *testing.T) {
 		})
 	}
 }
+
+func TestCategories(t *testing.T) {
+	r := NewDefault(store.New())
+	r.SetPubSub(pubsub.New())
+	r.SetACL(acl.New(r))
+
+	// every command needs categories, otherwise only +@all allows it
+	for _, name := range r.Names() {
+		IsTrue(t, r.info[name].arity != 0, "%s has no arity", name)
+		IsTrue(t, len(r.Categories(name, "")) > 0, "%s has no categories", name)
+		for _, category := range r.Categories(name, "") {
+			IsTrue(t, slices.Contains(acl.Categories, category), "%s has unknown category %s", name, category)
+		}
+	}
+
+	EqualO(t, r.Categories("ACL", "whoami"), []string{"slow"})
+	EqualO(t, r.Categories("ACL", "SETUSER"), []string{"admin", "slow", "dangerous"})
+}
+
+func TestArity(t *testing.T) {
+	r := NewDefault(store.New())
+
+	EqualO(t, r.HandleCommands(client.New(""), []string{"GET"}), messages.GetErrorString("ERR wrong number of arguments for 'get' command"))
+	EqualO(t, r.HandleCommands(client.New(""), []string{"get", "a", "b"}), messages.GetErrorString("ERR wrong number of arguments for 'get' command"))
+	EqualO(t, r.HandleCommands(client.New(""), []string{"PING"}), messages.NewSimpleString("PONG").Serialise())
+	EqualO(t, r.HandleCommands(client.New(""), []string{"DEL"}), messages.GetErrorString("ERR wrong number of arguments for 'del' command"))
+}
+
+func TestClientStores(t *testing.T) {
+	r := NewDefault(store.New())
+	c1, c2 := client.New(""), client.New("")
+	c1.Store, c2.Store = store.New(), store.New()
+
+	EqualO(t, r.HandleCommands(c1, []string{"SET", "k", "1"}), messages.NewSimpleString("OK").Serialise())
+	EqualO(t, r.HandleCommands(c2, []string{"GET", "k"}), messages.NewNullBulkString().Serialise())
+	EqualO(t, r.HandleCommands(c1, []string{"GET", "k"}), messages.NewBulkString("1").Serialise())
+}
+
+func TestCommand(t *testing.T) {
+	r := NewDefault(store.New())
+	count := int64(len(r.Names()))
+
+	reply, ok := r.Command([]string{"COMMAND", "COUNT"})
+	IsTrue(t, ok, "COMMAND should be handled")
+	EqualO(t, reply, messages.NewInteger(count).Serialise())
+
+	reply, _ = r.Command([]string{"command", "info", "get", "nope"})
+	EqualO(t, reply, "*2\r\n"+
+		"*10\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n*3\r\n+@read\r\n+@string\r\n+@fast\r\n*0\r\n"+
+		"*1\r\n*6\r\n$5\r\nflags\r\n*1\r\n+RO\r\n$12\r\nbegin_search\r\n*4\r\n$4\r\ntype\r\n$5\r\nindex\r\n$4\r\nspec\r\n*2\r\n$5\r\nindex\r\n:1\r\n"+
+		"$9\r\nfind_keys\r\n*4\r\n$4\r\ntype\r\n$5\r\nrange\r\n$4\r\nspec\r\n*6\r\n$7\r\nlastkey\r\n:0\r\n$7\r\nkeystep\r\n:1\r\n$5\r\nlimit\r\n:0\r\n"+
+		"*0\r\n"+
+		"$-1\r\n")
+
+	reply, _ = r.Command([]string{"COMMAND", "DOCS", "echo"})
+	EqualO(t, reply, "*2\r\n$4\r\necho\r\n*4\r\n$7\r\nsummary\r\n$25\r\nReturns the given string.\r\n$5\r\ngroup\r\n$10\r\nconnection\r\n")
+
+	reply, _ = r.Command([]string{"COMMAND", "LIST", "FILTERBY", "ACLCAT", "list"})
+	EqualO(t, reply, messages.NewArrayBulkString([]string{"llen", "lpush", "lrange", "rpush", "sort", "sort_ro"}).Serialise())
+	reply, _ = r.Command([]string{"COMMAND", "LIST", "FILTERBY", "PATTERN", "l*"})
+	EqualO(t, reply, messages.NewArrayBulkString([]string{"llen", "lpush", "lrange"}).Serialise())
+
+	reply, _ = r.Command([]string{"COMMAND", "GETKEYS", "DEL", "a", "b"})
+	EqualO(t, reply, messages.NewArrayBulkString([]string{"a", "b"}).Serialise())
+	reply, _ = r.Command([]string{"COMMAND", "GETKEYS", "MIGRATE", "host", "6379", "", "0", "5000", "KEYS", "a", "b"})
+	EqualO(t, reply, messages.NewArrayBulkString([]string{"a", "b"}).Serialise())
+	reply, _ = r.Command([]string{"COMMAND", "GETKEYS", "GET"})
+	EqualO(t, reply, messages.GetErrorString("ERR Invalid number of arguments specified for command"))
+	reply, _ = r.Command([]string{"COMMAND", "GETKEYS", "PING"})
+	EqualO(t, reply, messages.GetErrorString("ERR The command has no key arguments"))
+	reply, _ = r.Command([]string{"COMMAND", "GETKEYS", "NOPE"})
+	EqualO(t, reply, messages.GetErrorString("ERR Invalid command specified"))
+}
+
+func TestHello(t *testing.T) {
+	r := NewDefault(store.New())
+	a := acl.New(r)
+	NoError(t, a.SetRequirePass("secret"))
+	r.SetACL(a)
+	c := client.New("")
+	id := messages.NewInteger(c.ID)
+
+	hello := func(resp int64) []messages.Message {
+		return []messages.Message{
+			messages.NewBulkString("server"), messages.NewBulkString("redis"),
+			messages.NewBulkString("version"), messages.NewBulkString("7.2.4"),
+			messages.NewBulkString("proto"), messages.NewInteger(resp),
+			messages.NewBulkString("id"), id,
+			messages.NewBulkString("mode"), messages.NewBulkString("standalone"),
+			messages.NewBulkString("role"), messages.NewBulkString("master"),
+			messages.NewBulkString("modules"), messages.NewArray([]messages.Message{}),
+		}
+	}
+
+	EqualO(t, r.HandleCommands(c, []string{"HELLO"}), messages.GetErrorString("NOAUTH Authentication required."))
+	// only an AUTH option authenticates, not arguments that happen to be "AUTH"
+	for _, commands := range [][]string{{"HELLO", "3", "SETNAME", "AUTH"}, {"HELLO", "3", "AUTH"}, {"HELLO", "3", "SETNAME", "AUTH", "AUTH", "x"}} {
+		EqualO(t, r.HandleCommands(c, commands), messages.GetErrorString("NOAUTH Authentication required."))
+	}
+	EqualO(t, c.Resp(), 2)
+	EqualO(t, c.Name(), "")
+	EqualO(t, r.HandleCommands(c, []string{"HELLO", "3", "AUTH", "default", "wrong"}), messages.GetErrorString("WRONGPASS invalid username-password pair or user is disabled."))
+	EqualO(t, c.Resp(), 2)
+	EqualO(t, r.HandleCommands(c, []string{"HELLO", "3", "AUTH", "default", "secret", "SETNAME", "app"}), messages.NewMap(hello(3)).Serialise())
+	EqualO(t, c.Resp(), 3)
+	EqualO(t, c.Name(), "app")
+
+	EqualO(t, r.HandleCommands(c, []string{"HELLO", "2"}), messages.NewArray(hello(2)).Serialise())
+	EqualO(t, c.Resp(), 2)
+	EqualO(t, r.HandleCommands(c, []string{"HELLO", "4"}), messages.GetErrorString("NOPROTO unsupported protocol version"))
+	EqualO(t, r.HandleCommands(c, []string{"HELLO", "three"}), messages.GetErrorString("ERR Protocol version is not an integer or out of range"))
+	EqualO(t, r.HandleCommands(c, []string{"HELLO", "3", "SETNAME"}), messages.GetErrorString("ERR Syntax error in HELLO option 'SETNAME'"))
+}
+
+func TestSortACL(t *testing.T) {
+	r := NewDefault(store.New())
+	a := acl.New(r)
+	r.SetACL(a)
+	NoError(t, a.SetUser("alice", "on", "nopass", "+@all", "~users", "~weight_*"))
+	c := client.New("")
+	c.Store = store.New()
+	IsTrue(t, a.Authenticate(c, "alice", ""), "")
+
+	empty := messages.NewArray([]messages.Message{}).Serialise()
+	EqualO(t, r.HandleCommands(c, []string{"SORT", "users", "GET", "#", "BY", "nosort"}), empty)
+	// the patterns may look up any key, so they need access to every key
+	EqualO(t, r.HandleCommands(c, []string{"SORT", "users", "BY", "weight_*"}), messages.GetErrorString("ERR BY option of SORT denied due to insufficient ACL permissions."))
+	EqualO(t, r.HandleCommands(c, []string{"SORT_RO", "users", "GET", "weight_*"}), messages.GetErrorString("ERR GET option of SORT denied due to insufficient ACL permissions."))
+
+	NoError(t, a.SetUser("alice", "%R~*"))
+	EqualO(t, r.HandleCommands(c, []string{"SORT", "users", "BY", "weight_*"}), empty)
+}
+
+func TestWriteACL(t *testing.T) {
+	r := NewDefault(store.New())
+	a := acl.New(r)
+	r.SetACL(a)
+	NoError(t, a.SetUser("writer", "on", "nopass", "+@all", "%W~*"))
+	c := client.New("")
+	c.Store = store.New()
+	IsTrue(t, a.Authenticate(c, "writer", ""), "")
+
+	noPerm := messages.GetErrorString("NOPERM No permissions to access a key")
+	EqualO(t, r.HandleCommands(c, []string{"SET", "k", "1"}), messages.NewSimpleString("OK").Serialise())
+	EqualO(t, r.HandleCommands(c, []string{"DEL", "k"}), messages.NewInteger(1).Serialise())
+	// writes that reply with the values of their keys need read access too
+	EqualO(t, r.HandleCommands(c, []string{"SET", "k", "1", "GET"}), noPerm)
+	EqualO(t, r.HandleCommands(c, []string{"INCR", "k"}), noPerm)
+	EqualO(t, r.HandleCommands(c, []string{"SORT", "k"}), noPerm)
+	EqualO(t, r.HandleCommands(c, []string{"GET", "k"}), noPerm)
+
+	NoError(t, a.SetUser("writer", "%R~*"))
+	EqualO(t, r.HandleCommands(c, []string{"INCR", "k"}), messages.NewInteger(1).Serialise())
+}
+
+func TestTracking(t *testing.T) {
+	s := store.New()
+	r := NewDefault(s)
+	reg := client.NewRegistry()
+	r.SetClients(reg)
+	tr := tracking.New(reg, pubsub.New())
+	reg.SetTracking(tr)
+	r.SetTracking(tr)
+
+	c, writer := client.New(""), client.New("")
+	c.Store, writer.Store = s, s
+	c.Sub = pubsub.NewSubscriber()
+	c.SetResp(3)
+	reg.Add(c)
+	reg.Add(writer)
+
+	EqualO(t, r.HandleCommands(c, []string{"CLIENT", "TRACKING", "ON"}), messages.NewSimpleString("OK").Serialise())
+	r.HandleCommands(c, []string{"GET", "read"})
+	// only the keys that the client read are tracked
+	r.HandleCommands(c, []string{"SET", "written", "1"})
+	r.HandleCommands(writer, []string{"SET", "written", "2"})
+	r.HandleCommands(writer, []string{"SET", "read", "1"})
+	EqualO(t, <-c.Sub.Messages(), ">2\r\n$10\r\ninvalidate\r\n*1\r\n$4\r\nread\r\n")
+	EqualO(t, len(c.Sub.Messages()), 0)
+
+	EqualO(t, r.HandleCommands(writer, []string{"CLIENT", "TRACKING", "ON", "BCAST", "PREFIX", "a"}), messages.NewSimpleString("OK").Serialise())
+	EqualO(t, r.HandleCommands(writer, []string{"CLIENT", "TRACKINGINFO"}), "*6\r\n$5\r\nflags\r\n*2\r\n$2\r\non\r\n$5\r\nbcast\r\n$8\r\nredirect\r\n:0\r\n$8\r\nprefixes\r\n*1\r\n$1\r\na\r\n")
+}
+
+func TestTrackingRace(t *testing.T) {
+	s := store.New()
+	r := NewDefault(s)
+	reg := client.NewRegistry()
+	r.SetClients(reg)
+	tr := tracking.New(reg, pubsub.New())
+	reg.SetTracking(tr)
+	r.SetTracking(tr)
+
+	c, writer := client.New(""), client.New("")
+	c.Store, writer.Store = s, s
+	c.Sub = pubsub.NewSubscriber()
+	c.SetResp(3)
+	reg.Add(c)
+	reg.Add(writer)
+	EqualO(t, r.HandleCommands(c, []string{"CLIENT", "TRACKING", "ON"}), messages.NewSimpleString("OK").Serialise())
+
+	// a read that has read the key, but not yet replied, when the key is written
+	reading, written := make(chan struct{}), make(chan struct{})
+	r.AddRoute("SLOWGET", func(c *client.Client, commands []string) (string, bool) {
+		reply, _ := handler.Get(c, []string{"GET", commands[1]})
+		close(reading)
+		<-written
+		return reply, true
+	})
+	r.addInfo("SLOWGET", commandInfo{arity: 2, firstKey: 1, lastKey: 1, keyStep: 1, categories: []string{"read", "slow"}})
+
+	done := make(chan string)
+	go func() {
+		done <- r.HandleCommands(c, []string{"SLOWGET", "k"})
+	}()
+	<-reading
+	r.HandleCommands(writer, []string{"SET", "k", "v"})
+	close(written)
+	EqualO(t, <-done, messages.NewNullBulkString().Serialise())
+
+	// the client caches the value from before the write, so it must be invalidated
+	select {
+	case message := <-c.Sub.Messages():
+		EqualO(t, message, ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n")
+	default:
+		t.Fatal("k should have been invalidated")
+	}
+}
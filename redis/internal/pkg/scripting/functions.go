@@ -0,0 +1,510 @@
+package scripting
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/glob"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/develop/interact/programmability/functions-intro/
+
+const (
+	FunctionCommand = "FUNCTION"
+	FCallCommand    = "FCALL"
+	FCallROCommand  = "FCALL_RO"
+)
+
+// loadTimeout is how long a library may run when it is loaded, like redis.
+const loadTimeout = 500 * time.Millisecond
+
+// the flags of functions, like redis
+var functionFlags = []string{"no-writes", "allow-oom", "allow-stale", "no-cluster", "allow-cross-slot-keys"}
+
+// library is a named set of functions, loaded from its code.
+type library struct {
+	name string
+	code string
+	// state is where the library was loaded, its functions are called in it (one at a time, like every script).
+	state *lua.LState
+	// session is the FCALL that is running, for redis.call.
+	session   *session
+	functions map[string]*function
+}
+
+type function struct {
+	name        string
+	description string
+	flags       []string
+	library     *library
+	callback    *lua.LFunction
+}
+
+// registry is the libraries, and their functions by name.
+type registry struct {
+	libraries map[string]*library
+	functions map[string]*function
+}
+
+func newRegistry() registry {
+	return registry{libraries: map[string]*library{}, functions: map[string]*function{}}
+}
+
+func (r registry) clone() registry {
+	return registry{libraries: maps.Clone(r.libraries), functions: maps.Clone(r.functions)}
+}
+
+// add adds the library, replacing the library of the same name if replace is set.
+// Functions cannot have the same names as the functions of other libraries.
+func (r registry) add(lib *library, replace bool) error {
+	if _, ok := r.libraries[lib.name]; ok && !replace {
+		return messages.NewError("ERR Library '" + lib.name + "' already exists")
+	}
+	for name := range lib.functions {
+		if f, ok := r.functions[name]; ok && f.library.name != lib.name {
+			return messages.NewError("ERR Function " + name + " already exists")
+		}
+	}
+
+	r.delete(lib.name)
+	r.libraries[lib.name] = lib
+	for name, f := range lib.functions {
+		r.functions[name] = f
+	}
+	return nil
+}
+
+func (r registry) delete(name string) bool {
+	lib, ok := r.libraries[name]
+	if !ok {
+		return false
+	}
+	delete(r.libraries, name)
+	for name := range lib.functions {
+		delete(r.functions, name)
+	}
+	return true
+}
+
+// sorted returns the libraries, by name.
+func (r registry) sorted() []*library {
+	ret := make([]*library, 0, len(r.libraries))
+	for _, lib := range r.libraries {
+		ret = append(ret, lib)
+	}
+	slices.SortFunc(ret, func(a, b *library) int {
+		return strings.Compare(a.name, b.name)
+	})
+	return ret
+}
+
+// validName returns whether the name of a library or function only has letters, numbers and underscores.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// metadata parses the first line of a library (e.g. "#!lua name=mylib"), returning its name and the rest of its code.
+func metadata(code string) (string, string, error) {
+	if !strings.HasPrefix(code, "#!") {
+		return "", "", messages.NewError("ERR Missing library metadata")
+	}
+	line, body, _ := strings.Cut(code, "\n")
+	// the line is kept, so that errors have the right line numbers
+	body = "\n" + body
+
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 || !strings.EqualFold(fields[0], "lua") {
+		engine := ""
+		if len(fields) > 0 {
+			engine = fields[0]
+		}
+		return "", "", messages.NewError("ERR Engine '" + engine + "' not found")
+	}
+	name := ""
+	for _, field := range fields[1:] {
+		value, ok := strings.CutPrefix(field, "name=")
+		if !ok {
+			return "", "", messages.NewError("ERR Invalid metadata value given: " + field)
+		}
+		name = value
+	}
+	if name == "" {
+		return "", "", messages.NewError("ERR Library name was not given")
+	}
+	if !validName(name) {
+		return "", "", messages.NewError("ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+	}
+	return name, body, nil
+}
+
+// registerFunction returns redis.register_function, which calls add for every function that the library registers.
+// It is called as register_function(name, callback) or register_function{function_name=..., callback=..., flags={...}, description=...}.
+func registerFunction(add func(f *function, callback *lua.LFunction) error) lua.LGFunction {
+	return func(L *lua.LState) int {
+		f := &function{}
+		var callback *lua.LFunction
+		if t, ok := L.Get(1).(*lua.LTable); ok && L.GetTop() == 1 {
+			name, ok := t.RawGetString("function_name").(lua.LString)
+			if !ok {
+				L.RaiseError("function_name argument given to redis.register_function must be a string")
+			}
+			f.name = string(name)
+			if callback, ok = t.RawGetString("callback").(*lua.LFunction); !ok {
+				L.RaiseError("callback argument given to redis.register_function must be a function")
+			}
+			if description, ok := t.RawGetString("description").(lua.LString); ok {
+				f.description = string(description)
+			}
+			if flags, ok := t.RawGetString("flags").(*lua.LTable); ok {
+				for i := 1; i <= flags.Len(); i++ {
+					flag := flags.RawGetInt(i).String()
+					if !slices.Contains(functionFlags, flag) {
+						L.RaiseError("unknown flag given")
+					}
+					f.flags = append(f.flags, flag)
+				}
+			}
+		} else {
+			f.name = L.CheckString(1)
+			callback = L.CheckFunction(2)
+		}
+
+		if err := add(f, callback); err != nil {
+			L.RaiseError("%s", err.Error())
+		}
+		return 0
+	}
+}
+
+// compileLibrary compiles the library, and runs it to find its functions.
+// Like redis, the library cannot call commands while it is loaded, only its functions can.
+func compileLibrary(code string) (*library, error) {
+	name, body, err := metadata(code)
+	if err != nil {
+		return nil, err
+	}
+	proto, err := compile(body, functionChunk)
+	if err != nil {
+		return nil, messages.NewError("ERR Error compiling function: " + oneLine(err.Error()))
+	}
+
+	lib := &library{name: name, code: code, functions: map[string]*function{}}
+	// the reason that a function could not be registered, rather than where it was raised
+	var registerErr error
+	loading := true
+	register := registerFunction(func(f *function, callback *lua.LFunction) error {
+		if !validName(f.name) {
+			registerErr = messages.NewError("ERR Function names can only contain letters, numbers, or underscores(_) and must be at least one character long")
+		} else if _, ok := lib.functions[f.name]; ok {
+			registerErr = messages.NewError("ERR Function already exists in the library")
+		}
+		if registerErr != nil {
+			return registerErr
+		}
+		f.library = lib
+		f.callback = callback
+		lib.functions[f.name] = f
+		return nil
+	})
+	L := newSandbox(func(L *lua.LState) int {
+		if !loading {
+			return notLoading(L)
+		}
+		return register(L)
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 0, nil); err != nil {
+		L.Close()
+		if registerErr != nil {
+			return nil, registerErr
+		}
+		if ctx.Err() != nil {
+			return nil, messages.NewError("ERR FUNCTION LOAD timeout")
+		}
+		msg := err.Error()
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			msg = apiErr.Object.String()
+		}
+		return nil, messages.NewError("ERR Error registering functions: " + oneLine(msg))
+	}
+	if len(lib.functions) == 0 {
+		L.Close()
+		return nil, messages.NewError("ERR No functions registered")
+	}
+
+	loading = false
+	setCalls(L, func() *session { return lib.session })
+	lib.state = L
+	return lib, nil
+}
+
+// LoadLibrary compiles and adds the library, replacing the library of the same name if replace is set.
+// It returns the name of the library.
+func (e *Engine) LoadLibrary(code string, replace bool) (string, error) {
+	lib, err := compileLibrary(code)
+	if err != nil {
+		return "", err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return lib.name, e.registry.add(lib, replace)
+}
+
+// Libraries returns the code of every library, by their names.
+func (e *Engine) Libraries() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ret := []string{}
+	for _, lib := range e.registry.sorted() {
+		ret = append(ret, lib.code)
+	}
+	return ret
+}
+
+// LoadLibraries replaces the libraries with the codes, or returns an error (and keeps them) if any of them are invalid.
+func (e *Engine) LoadLibraries(codes []string) error {
+	r := newRegistry()
+	for _, code := range codes {
+		lib, err := compileLibrary(code)
+		if err != nil {
+			return err
+		}
+		if err := r.add(lib, false); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.registry = r
+	return nil
+}
+
+// restoreLibraries adds the libraries of a FUNCTION DUMP payload, with the policy (FLUSH, APPEND or REPLACE).
+func (e *Engine) restoreLibraries(payload, policy string) error {
+	codes, err := rdb.RestoreFunctions([]byte(payload))
+	if err != nil {
+		return messages.NewError("ERR payload version or checksum are wrong")
+	}
+	libs := make([]*library, len(codes))
+	for i, code := range codes {
+		if libs[i], err = compileLibrary(code); err != nil {
+			return err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r := e.registry.clone()
+	if policy == "FLUSH" {
+		r = newRegistry()
+	}
+	for _, lib := range libs {
+		if err := r.add(lib, policy == "REPLACE"); err != nil {
+			return err
+		}
+	}
+	e.registry = r
+	return nil
+}
+
+func (e *Engine) function(name string) (*function, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	f, ok := e.registry.functions[name]
+	return f, ok
+}
+
+// FCALL function numkeys [key ...] [arg ...] | FCALL_RO function numkeys [key ...] [arg ...]
+func (e *Engine) FCall(c *client.Client, commands []string) (string, bool) {
+	if len(commands) == 0 {
+		return "", false
+	}
+	name := strings.ToUpper(commands[0])
+	if name != FCallCommand && name != FCallROCommand {
+		return "", false
+	}
+
+	n, err := numKeys(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+	f, ok := e.function(commands[1])
+	if !ok {
+		return messages.GetErrorString("ERR Function not found"), true
+	}
+	noWrites := slices.Contains(f.flags, "no-writes")
+	if name == FCallROCommand && !noWrites {
+		return messages.GetErrorString("ERR Can not execute a script with write flag using *_ro command."), true
+	}
+
+	keys, args := commands[3:3+n], commands[3+n:]
+	lib := f.library
+	return e.run(c, f.name, noWrites, lib.state, func(s *session, L *lua.LState) error {
+		lib.session = s
+		defer func() { lib.session = nil }()
+
+		L.Push(f.callback)
+		L.Push(stringsTable(L, keys))
+		L.Push(stringsTable(L, args))
+		return L.PCall(2, 1, nil)
+	}).Serialise(), true
+}
+
+// FUNCTION LOAD [REPLACE] code | LIST [LIBRARYNAME pattern] [WITHCODE] | DELETE name | FLUSH [ASYNC | SYNC]
+// | DUMP | RESTORE payload [FLUSH | APPEND | REPLACE] | KILL
+func (e *Engine) Function(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], FunctionCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return messages.GetErrorString("ERR wrong number of arguments for command"), true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "LOAD":
+		replace := len(args) == 2 && strings.EqualFold(args[0], "REPLACE")
+		if len(args) != 1 && !replace {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		name, err := e.LoadLibrary(args[len(args)-1], replace)
+		if err != nil {
+			return messages.GetError(err), true
+		}
+		return messages.NewBulkString(name).Serialise(), true
+	case "LIST":
+		return e.list(args)
+	case "DELETE":
+		if len(args) != 1 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		e.mu.Lock()
+		deleted := e.registry.delete(args[0])
+		e.mu.Unlock()
+		if !deleted {
+			return messages.GetErrorString("ERR Library not found"), true
+		}
+		return messages.NewSimpleString("OK").Serialise(), true
+	case "FLUSH":
+		if len(args) > 1 || (len(args) == 1 && !strings.EqualFold(args[0], "ASYNC") && !strings.EqualFold(args[0], "SYNC")) {
+			return messages.GetErrorString("ERR FUNCTION FLUSH only supports SYNC|ASYNC option"), true
+		}
+		e.mu.Lock()
+		e.registry = newRegistry()
+		e.mu.Unlock()
+		return messages.NewSimpleString("OK").Serialise(), true
+	case "DUMP":
+		if len(args) != 0 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		return messages.NewBulkString(string(rdb.DumpFunctions(e.Libraries()))).Serialise(), true
+	case "RESTORE":
+		if len(args) != 1 && len(args) != 2 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		policy := "APPEND"
+		if len(args) == 2 {
+			policy = strings.ToUpper(args[1])
+			if policy != "FLUSH" && policy != "APPEND" && policy != "REPLACE" {
+				return messages.GetErrorString("ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE."), true
+			}
+		}
+		if err := e.restoreLibraries(args[0], policy); err != nil {
+			return messages.GetError(err), true
+		}
+		return messages.NewSimpleString("OK").Serialise(), true
+	case "KILL":
+		if len(args) != 0 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		if err := e.Kill(); err != nil {
+			return messages.GetError(err), true
+		}
+		return messages.NewSimpleString("OK").Serialise(), true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try FUNCTION HELP."), true
+	}
+}
+
+// list replies to FUNCTION LIST, with the libraries (and their functions) sorted by name.
+func (e *Engine) list(args []string) (string, bool) {
+	pattern, withCode := "", false
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.EqualFold(args[i], "WITHCODE"):
+			withCode = true
+		case strings.EqualFold(args[i], "LIBRARYNAME") && i+1 < len(args):
+			i++
+			pattern = args[i]
+		default:
+			return messages.GetErrorString("ERR Unknown argument " + args[i]), true
+		}
+	}
+
+	e.mu.Lock()
+	libs := e.registry.sorted()
+	e.mu.Unlock()
+
+	ret := []messages.Message{}
+	for _, lib := range libs {
+		if pattern != "" && !glob.Match(pattern, lib.name) {
+			continue
+		}
+		names := make([]string, 0, len(lib.functions))
+		for name := range lib.functions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		functions := make([]messages.Message, len(names))
+		for i, name := range names {
+			f := lib.functions[name]
+			var description messages.Message = messages.NewNullBulkString()
+			if f.description != "" {
+				description = messages.NewBulkString(f.description)
+			}
+			functions[i] = messages.NewArray([]messages.Message{
+				messages.NewBulkString("name"), messages.NewBulkString(f.name),
+				messages.NewBulkString("description"), description,
+				messages.NewBulkString("flags"), messages.NewArraySimpleString(f.flags),
+			})
+		}
+		items := []messages.Message{
+			messages.NewBulkString("library_name"), messages.NewBulkString(lib.name),
+			messages.NewBulkString("engine"), messages.NewBulkString("LUA"),
+			messages.NewBulkString("functions"), messages.NewArray(functions),
+		}
+		if withCode {
+			items = append(items, messages.NewBulkString("library_code"), messages.NewBulkString(lib.code))
+		}
+		ret = append(ret, messages.NewArray(items))
+	}
+	return messages.NewArray(ret).Serialise(), true
+}
@@ -0,0 +1,149 @@
+package scripting
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+const counterLib = `#!lua name=counter
+local function incr(keys, args)
+	return redis.call('INCR', keys[1])
+end
+redis.register_function('incr', incr)
+redis.register_function{
+	function_name='peek',
+	callback=function(keys, args) return redis.call('GET', keys[1]) end,
+	flags={'no-writes'},
+	description='reads the counter',
+}
+redis.register_function{function_name='sneaky', callback=incr, flags={'no-writes'}}
+`
+
+func manage(e *Engine, commands ...string) string {
+	ret, _ := e.Function(commands)
+	return ret
+}
+
+func fcall(e *Engine, commands ...string) string {
+	ret, _ := e.FCall(client.New(""), commands)
+	return ret
+}
+
+func TestFunctionLoad(t *testing.T) {
+	e, _ := newEngine()
+
+	EqualO(t, manage(e, "FUNCTION", "LOAD", counterLib), "$7\r\ncounter\r\n")
+	EqualO(t, manage(e, "FUNCTION", "LOAD", counterLib), "-ERR Library 'counter' already exists\r\n")
+	EqualO(t, manage(e, "FUNCTION", "LOAD", "REPLACE", counterLib), "$7\r\ncounter\r\n")
+
+	tests := []struct {
+		name     string
+		code     string
+		expected string
+	}{
+		{"no_metadata", "return 1", "-ERR Missing library metadata\r\n"},
+		{"engine", "#!js name=x\n", "-ERR Engine 'js' not found\r\n"},
+		{"no_name", "#!lua\n", "-ERR Library name was not given\r\n"},
+		{"bad_metadata", "#!lua name=x foo=y\n", "-ERR Invalid metadata value given: foo=y\r\n"},
+		{"bad_name", "#!lua name=a-b\n", "-ERR Library names can only contain letters, numbers, or underscores(_) and must be at least one character long\r\n"},
+		{"no_functions", "#!lua name=x\nlocal a = 1", "-ERR No functions registered\r\n"},
+		{"duplicate", "#!lua name=x\nredis.register_function('f', function() end)\nredis.register_function('f', function() end)", "-ERR Function already exists in the library\r\n"},
+		{"other_library", "#!lua name=x\nredis.register_function('incr', function() end)", "-ERR Function incr already exists\r\n"},
+		{"bad_flag", "#!lua name=x\nredis.register_function{function_name='f', callback=function() end, flags={'nope'}}", ""},
+		{"call", "#!lua name=x\nredis.call('PING')", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := manage(e, "FUNCTION", "LOAD", test.code)
+			if test.expected == "" {
+				IsTrue(t, strings.HasPrefix(actual, "-ERR Error registering functions"), "actual=%q", actual)
+			} else {
+				EqualO(t, actual, test.expected)
+			}
+		})
+	}
+	EqualO(t, e.Libraries(), []string{counterLib})
+}
+
+func TestFCall(t *testing.T) {
+	e, f := newEngine()
+	manage(e, "FUNCTION", "LOAD", counterLib)
+
+	EqualO(t, fcall(e, "FCALL", "incr", "1", "n"), ":1\r\n")
+	EqualO(t, fcall(e, "FCALL", "incr", "1", "n"), ":2\r\n")
+	EqualO(t, fcall(e, "FCALL_RO", "peek", "1", "n"), "$1\r\n2\r\n")
+	EqualO(t, fcall(e, "FCALL_RO", "incr", "1", "n"), "-ERR Can not execute a script with write flag using *_ro command.\r\n")
+	EqualO(t, fcall(e, "FCALL", "sneaky", "1", "n"), "-ERR Write commands are not allowed from read-only scripts. script: sneaky\r\n")
+	EqualO(t, fcall(e, "FCALL", "nope", "0"), "-ERR Function not found\r\n")
+	EqualO(t, fcall(e, "FCALL", "incr", "2", "n"), "-ERR Number of keys can't be greater than number of args\r\n")
+	EqualO(t, f.keys["n"], "2")
+
+	// the library is only run by FUNCTION LOAD, where it cannot call commands, its functions are kept
+	manage(e, "FUNCTION", "LOAD", `#!lua name=state
+if redis.call then redis.call('INCR', 'loads') end
+local calls = 0
+redis.register_function('calls', function() calls = calls + 1 return calls end)`)
+	EqualO(t, fcall(e, "FCALL", "calls", "0"), ":1\r\n")
+	EqualO(t, fcall(e, "FCALL", "calls", "0"), ":2\r\n")
+	_, ok := f.keys["loads"]
+	IsFalse(t, ok, "")
+
+	// register_function is only for FUNCTION LOAD
+	ret := eval(e, "EVAL", "redis.register_function('f', function() end)", "0")
+	IsTrue(t, strings.Contains(ret, "redis.register_function can only be called on FUNCTION LOAD command"), "ret=%q", ret)
+	Equal(t, V(e.FCall(client.New(""), []string{"GET"})), V("", false))
+}
+
+func TestFunctionManage(t *testing.T) {
+	e, _ := newEngine()
+	manage(e, "FUNCTION", "LOAD", counterLib)
+	manage(e, "FUNCTION", "LOAD", "#!lua name=other\nredis.register_function('ping', function() return redis.call('PING') end)")
+
+	list := manage(e, "FUNCTION", "LIST", "LIBRARYNAME", "c*", "WITHCODE")
+	expected := messages.NewArray([]messages.Message{messages.NewArray([]messages.Message{
+		messages.NewBulkString("library_name"), messages.NewBulkString("counter"),
+		messages.NewBulkString("engine"), messages.NewBulkString("LUA"),
+		messages.NewBulkString("functions"), messages.NewArray([]messages.Message{
+			messages.NewArray([]messages.Message{messages.NewBulkString("name"), messages.NewBulkString("incr"), messages.NewBulkString("description"), messages.NewNullBulkString(), messages.NewBulkString("flags"), messages.NewArraySimpleString(nil)}),
+			messages.NewArray([]messages.Message{messages.NewBulkString("name"), messages.NewBulkString("peek"), messages.NewBulkString("description"), messages.NewBulkString("reads the counter"), messages.NewBulkString("flags"), messages.NewArraySimpleString([]string{"no-writes"})}),
+			messages.NewArray([]messages.Message{messages.NewBulkString("name"), messages.NewBulkString("sneaky"), messages.NewBulkString("description"), messages.NewNullBulkString(), messages.NewBulkString("flags"), messages.NewArraySimpleString([]string{"no-writes"})}),
+		}),
+		messages.NewBulkString("library_code"), messages.NewBulkString(counterLib),
+	})})
+	EqualO(t, list, expected.Serialise())
+	IsTrue(t, strings.HasPrefix(manage(e, "FUNCTION", "LIST"), "*2\r\n"), "both libraries should be listed")
+	EqualO(t, manage(e, "FUNCTION", "LIST", "NOPE"), "-ERR Unknown argument NOPE\r\n")
+
+	dump := manage(e, "FUNCTION", "DUMP")
+	reply, err := messages.Deserialise(dump)
+	NoError(t, err)
+	payload := reply.(*messages.BulkString).String()
+
+	EqualO(t, manage(e, "FUNCTION", "DELETE", "other"), "+OK\r\n")
+	EqualO(t, manage(e, "FUNCTION", "DELETE", "other"), "-ERR Library not found\r\n")
+	EqualO(t, fcall(e, "FCALL", "ping", "0"), "-ERR Function not found\r\n")
+
+	EqualO(t, manage(e, "FUNCTION", "RESTORE", payload), "-ERR Library 'counter' already exists\r\n")
+	EqualO(t, manage(e, "FUNCTION", "RESTORE", payload, "NOPE"), "-ERR Wrong restore policy given, value should be either FLUSH, APPEND or REPLACE.\r\n")
+	EqualO(t, manage(e, "FUNCTION", "RESTORE", "garbage"), "-ERR payload version or checksum are wrong\r\n")
+	EqualO(t, manage(e, "FUNCTION", "RESTORE", payload, "REPLACE"), "+OK\r\n")
+	EqualO(t, fcall(e, "FCALL", "ping", "0"), "+PONG\r\n")
+
+	EqualO(t, manage(e, "FUNCTION", "FLUSH"), "+OK\r\n")
+	EqualO(t, manage(e, "FUNCTION", "LIST"), "*0\r\n")
+	EqualO(t, manage(e, "FUNCTION", "RESTORE", payload, "FLUSH"), "+OK\r\n")
+	EqualO(t, len(e.Libraries()), 2)
+
+	EqualO(t, manage(e, "FUNCTION", "KILL"), "-NOTBUSY No scripts in execution right now.\r\n")
+	EqualO(t, manage(e, "FUNCTION", "NOPE"), "-ERR unknown subcommand 'NOPE'. Try FUNCTION HELP.\r\n")
+
+	// invalid libraries are not loaded
+	HasError(t, e.LoadLibraries([]string{"nope"}))
+	EqualO(t, len(e.Libraries()), 2)
+	NoError(t, e.LoadLibraries(nil))
+	EqualO(t, e.Libraries(), []string{})
+}
@@ -0,0 +1,275 @@
+package scripting
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// what errors call scripts and libraries, like redis
+const (
+	scriptChunk   = "user_script"
+	functionChunk = "user_function"
+)
+
+// the levels of redis.log
+const (
+	logDebug = iota
+	logVerbose
+	logNotice
+	logWarning
+)
+
+func compile(body, name string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(body), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+// session is the state of a script that is running, for the redis library.
+type session struct {
+	engine *Engine
+	run    *run
+	// client runs the commands of the script.
+	client   *client.Client
+	readOnly bool
+}
+
+// newState returns a sandbox (see newSandbox) with redis.call and redis.pcall.
+func (s *session) newState() *lua.LState {
+	L := newSandbox(notLoading)
+	setCalls(L, func() *session { return s })
+	return L
+}
+
+// setCalls adds redis.call and redis.pcall to the state, they run commands in the session that current returns.
+func setCalls(L *lua.LState, current func() *session) {
+	L.SetFuncs(L.GetGlobal("redis").(*lua.LTable), map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return current().call(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return current().call(L, false)
+		},
+	})
+}
+
+// notLoading is redis.register_function outside of FUNCTION LOAD.
+func notLoading(L *lua.LState) int {
+	L.RaiseError("redis.register_function can only be called on FUNCTION LOAD command")
+	return 0
+}
+
+// newSandbox returns a state with the base, table, string and math libraries, and the redis library without redis.call.
+func newSandbox(register lua.LGFunction) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for name, open := range map[string]lua.LGFunction{
+		lua.BaseLibName:   lua.OpenBase,
+		lua.TabLibName:    lua.OpenTable,
+		lua.StringLibName: lua.OpenString,
+		lua.MathLibName:   lua.OpenMath,
+	} {
+		L.Push(L.NewFunction(open))
+		L.Push(lua.LString(name))
+		L.Call(1, 0)
+	}
+	// scripts cannot read files or load modules
+	for _, name := range []string{"dofile", "loadfile", "module", "require"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"error_reply":       errorReply,
+		"status_reply":      statusReply,
+		"sha1hex":           sha1Hex,
+		"log":               logMessage,
+		"register_function": register,
+	})
+	for name, level := range map[string]int{"LOG_DEBUG": logDebug, "LOG_VERBOSE": logVerbose, "LOG_NOTICE": logNotice, "LOG_WARNING": logWarning} {
+		redis.RawSetString(name, lua.LNumber(level))
+	}
+	L.SetGlobal("redis", redis)
+	return L
+}
+
+// call runs a command, the error reply is raised if raise is set (redis.call), or returned (redis.pcall).
+func (s *session) call(L *lua.LState, raise bool) int {
+	n := L.GetTop()
+	if n == 0 {
+		L.RaiseError("Please specify at least one argument for this redis lib call")
+	}
+	commands := make([]string, n)
+	for i := 1; i <= n; i++ {
+		switch v := L.Get(i).(type) {
+		case lua.LString:
+			commands[i-1] = string(v)
+		case lua.LNumber:
+			commands[i-1] = strconv.FormatFloat(float64(v), 'f', -1, 64)
+		default:
+			L.RaiseError("Lua redis lib command arguments must be strings or integers")
+		}
+	}
+
+	reply := s.exec(commands)
+	if e, ok := reply.(*messages.Error); ok && raise {
+		L.Error(errorTable(L, e.Error()), 1)
+	}
+	L.Push(fromReply(L, reply))
+	return 1
+}
+
+// exec runs the command, returning its reply.
+func (s *session) exec(commands []string) messages.Message {
+	if !s.engine.commands.Exists(commands[0]) {
+		return messages.NewError("ERR Unknown Redis command called from script")
+	}
+	subcommand := ""
+	if len(commands) > 1 {
+		subcommand = commands[1]
+	}
+	if slices.Contains(s.engine.commands.Categories(commands[0], subcommand), "write") {
+		if s.readOnly {
+			return messages.NewError("ERR Write commands are not allowed from read-only scripts.")
+		}
+		s.engine.mu.Lock()
+		s.run.wrote = true
+		s.engine.mu.Unlock()
+	}
+
+	reply, err := messages.Deserialise(s.engine.commands.HandleCommands(s.client, commands))
+	if err != nil {
+		return messages.NewError("ERR " + err.Error())
+	}
+	return reply
+}
+
+func errorTable(L *lua.LState, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("err", lua.LString(msg))
+	return t
+}
+
+func statusTable(L *lua.LState, msg string) *lua.LTable {
+	t := L.NewTable()
+	t.RawSetString("ok", lua.LString(msg))
+	return t
+}
+
+func errorReply(L *lua.LState) int {
+	L.Push(errorTable(L, L.CheckString(1)))
+	return 1
+}
+
+func statusReply(L *lua.LState) int {
+	L.Push(statusTable(L, L.CheckString(1)))
+	return 1
+}
+
+func sha1Hex(L *lua.LState) int {
+	L.Push(lua.LString(Sha1Hex(L.CheckString(1))))
+	return 1
+}
+
+func logMessage(L *lua.LState) int {
+	level := L.CheckInt(1)
+	if L.GetTop() < 2 {
+		L.RaiseError("redis.log() requires two arguments or more.")
+	}
+	parts := make([]string, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		parts = append(parts, L.Get(i).String())
+	}
+
+	zl := zerolog.DebugLevel
+	switch level {
+	case logDebug, logVerbose:
+	case logNotice:
+		zl = zerolog.InfoLevel
+	case logWarning:
+		zl = zerolog.WarnLevel
+	default:
+		L.RaiseError("Invalid debug level.")
+	}
+	log.WithLevel(zl).Str("script", "lua").Msg(strings.Join(parts, " "))
+	return 0
+}
+
+func stringsTable(L *lua.LState, strs []string) *lua.LTable {
+	t := L.CreateTable(len(strs), 0)
+	for _, str := range strs {
+		t.Append(lua.LString(str))
+	}
+	return t
+}
+
+// toReply converts the value returned by a script to a reply, like redis:
+// numbers are truncated to integers, true is 1, false and nil are the null bulk string,
+// and tables are arrays (up to their first nil), unless they have an err or ok field.
+func toReply(lv lua.LValue) messages.Message {
+	switch v := lv.(type) {
+	case lua.LNumber:
+		return messages.NewInteger(int64(v))
+	case lua.LString:
+		return messages.NewBulkString(string(v))
+	case lua.LBool:
+		if v {
+			return messages.NewInteger(1)
+		}
+		return messages.NewNullBulkString()
+	case *lua.LTable:
+		if e, ok := v.RawGetString("err").(lua.LString); ok {
+			return messages.NewError(oneLine(string(e)))
+		}
+		if ok, isOk := v.RawGetString("ok").(lua.LString); isOk {
+			return messages.NewSimpleString(oneLine(string(ok)))
+		}
+		items := []messages.Message{}
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			items = append(items, toReply(item))
+		}
+		return messages.NewArray(items)
+	default:
+		return messages.NewNullBulkString()
+	}
+}
+
+// fromReply converts the reply of a command to a value for the script, like redis:
+// the null bulk string is false, and status and error replies are tables with an ok or err field.
+func fromReply(L *lua.LState, reply messages.Message) lua.LValue {
+	switch v := reply.(type) {
+	case *messages.Integer:
+		return lua.LNumber(v.Value())
+	case *messages.BulkString:
+		if v == nil {
+			return lua.LFalse
+		}
+		return lua.LString(v.String())
+	case *messages.SimpleString:
+		return statusTable(L, v.String())
+	case *messages.Error:
+		return errorTable(L, v.Error())
+	case *messages.Array:
+		t := L.CreateTable(len(v.Items()), 0)
+		for _, item := range v.Items() {
+			t.Append(fromReply(L, item))
+		}
+		return t
+	default:
+		return lua.LFalse
+	}
+}
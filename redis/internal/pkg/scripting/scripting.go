@@ -0,0 +1,404 @@
+// Package scripting runs Lua scripts (EVAL), which call commands through the router with redis.call.
+// A script runs atomically: other commands wait for it, or are replied to with BUSY once it has run for too long.
+package scripting
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/develop/interact/programmability/eval-intro/
+
+const (
+	EvalCommand      = "EVAL"
+	EvalShaCommand   = "EVALSHA"
+	EvalROCommand    = "EVAL_RO"
+	EvalShaROCommand = "EVALSHA_RO"
+	ScriptCommand    = "SCRIPT"
+)
+
+const busyMsg = "BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE."
+
+// BusyErr is the reply to other clients, while a script is busy.
+var BusyErr = messages.GetErrorString(busyMsg)
+
+// defaultBusyThreshold is how long a script runs before other clients are replied to with BUSY, like redis.
+const defaultBusyThreshold = 5 * time.Second
+
+// Commands is how scripts call commands.
+type Commands interface {
+	// Exists returns whether there is such a command.
+	Exists(command string) bool
+	// Categories returns the categories of the command, with the subcommand (if it has one).
+	Categories(command, subcommand string) []string
+	// HandleCommands handles a command from the client.
+	HandleCommands(c *client.Client, commands []string) string
+}
+
+// Engine caches and runs scripts. To construct one, use `New`.
+type Engine struct {
+	commands Commands
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// scripts are the compiled scripts, by their SHA1 digests.
+	scripts map[string]*lua.FunctionProto
+	// registry is the function libraries.
+	registry registry
+	// running is the script that holds the lock, and readers are the number of commands that hold it.
+	// While a script is waiting, new commands wait for it, so that scripts are not starved.
+	running *run
+	readers int
+	waiting int
+	// busyThreshold is how long a script runs before other clients are replied to with BUSY.
+	busyThreshold time.Duration
+}
+
+// run is a script (or function) that is running.
+type run struct {
+	// name is the SHA1 digest of the script, or the name of the function.
+	name   string
+	cancel context.CancelFunc
+	timer  *time.Timer
+	// busy is set once the script has run for the busy threshold.
+	busy bool
+	// wrote is set once the script calls a write command, after which it cannot be killed.
+	wrote  bool
+	killed bool
+}
+
+func New(commands Commands) *Engine {
+	e := &Engine{
+		commands:      commands,
+		scripts:       map[string]*lua.FunctionProto{},
+		registry:      newRegistry(),
+		busyThreshold: defaultBusyThreshold,
+	}
+	e.cond = sync.NewCond(&e.mu)
+	return e
+}
+
+// SetBusyThreshold sets how long a script runs before other clients are replied to with BUSY.
+func (e *Engine) SetBusyThreshold(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.busyThreshold = d
+}
+
+// Hold waits for the script that is running (if any), then stops scripts from running until release is called.
+// Unless force is set, it returns false instead of waiting for a script that is busy.
+func (e *Engine) Hold(force bool) (release func(), ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for e.running != nil || e.waiting > 0 {
+		if !force && e.running != nil && e.running.busy {
+			return nil, false
+		}
+		e.cond.Wait()
+	}
+	e.readers++
+	return e.unhold, true
+}
+
+func (e *Engine) unhold() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.readers--
+	if e.readers == 0 {
+		e.cond.Broadcast()
+	}
+}
+
+// acquire waits for the commands (and the script) that are running, then starts r.
+// It returns false if the script that is running is busy.
+func (e *Engine) acquire(r *run) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.waiting++
+	defer func() { e.waiting-- }()
+	for e.running != nil || e.readers > 0 {
+		if e.running != nil && e.running.busy {
+			// the commands that are waiting for us may go first
+			e.cond.Broadcast()
+			return false
+		}
+		e.cond.Wait()
+	}
+
+	e.running = r
+	r.timer = time.AfterFunc(e.busyThreshold, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+
+		r.busy = true
+		e.cond.Broadcast()
+	})
+	return true
+}
+
+// finish lets the commands that are waiting for r run.
+func (e *Engine) finish(r *run) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r.timer.Stop()
+	r.cancel()
+	e.running = nil
+	e.cond.Broadcast()
+}
+
+// Kill stops the script that is running, unless it has written.
+func (e *Engine) Kill() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.running == nil {
+		return messages.NewError("NOTBUSY No scripts in execution right now.")
+	}
+	if e.running.wrote {
+		return messages.NewError("UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+	}
+	e.running.killed = true
+	e.running.cancel()
+	return nil
+}
+
+// Sha1Hex returns the SHA1 digest of the script, in lowercase hex.
+func Sha1Hex(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load compiles and caches the script, returning its SHA1 digest.
+func (e *Engine) Load(body string) (string, error) {
+	sha, _, err := e.load(body)
+	return sha, err
+}
+
+func (e *Engine) load(body string) (string, *lua.FunctionProto, error) {
+	sha := Sha1Hex(body)
+	if proto, ok := e.script(sha); ok {
+		return sha, proto, nil
+	}
+
+	proto, err := compile(body, scriptChunk)
+	if err != nil {
+		return "", nil, messages.NewError("ERR Error compiling script (new function): " + oneLine(err.Error()))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.scripts[sha] = proto
+	return sha, proto, nil
+}
+
+func (e *Engine) script(sha string) (*lua.FunctionProto, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	proto, ok := e.scripts[strings.ToLower(sha)]
+	return proto, ok
+}
+
+// Flush removes the cached scripts.
+func (e *Engine) Flush() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.scripts = map[string]*lua.FunctionProto{}
+}
+
+// Keys returns the keys of EVAL (or EVALSHA, FCALL), which are given before their arguments.
+func Keys(commands []string) []string {
+	n, err := numKeys(commands)
+	if err != nil {
+		return nil
+	}
+	return commands[3 : 3+n]
+}
+
+// numKeys returns the number of keys of EVAL (or EVALSHA, FCALL).
+func numKeys(commands []string) (int, error) {
+	if len(commands) < 3 {
+		return 0, messages.NewError("ERR wrong number of arguments for command")
+	}
+	n, err := strconv.Atoi(commands[2])
+	if err != nil {
+		return 0, messages.NewError("ERR value is not an integer or out of range")
+	} else if n < 0 {
+		return 0, messages.NewError("ERR Number of keys can't be negative")
+	} else if n > len(commands)-3 {
+		return 0, messages.NewError("ERR Number of keys can't be greater than number of args")
+	}
+	return n, nil
+}
+
+// EVAL script numkeys [key ...] [arg ...] | EVALSHA sha1 numkeys [key ...] [arg ...] (and their _RO variants)
+func (e *Engine) Eval(c *client.Client, commands []string) (string, bool) {
+	if len(commands) == 0 {
+		return "", false
+	}
+	name := strings.ToUpper(commands[0])
+	if name != EvalCommand && name != EvalShaCommand && name != EvalROCommand && name != EvalShaROCommand {
+		return "", false
+	}
+	n, err := numKeys(commands)
+	if err != nil {
+		return messages.GetError(err), true
+	}
+
+	var sha string
+	var proto *lua.FunctionProto
+	if name == EvalCommand || name == EvalROCommand {
+		sha, proto, err = e.load(commands[1])
+		if err != nil {
+			return messages.GetError(err), true
+		}
+	} else {
+		sha = strings.ToLower(commands[1])
+		var ok bool
+		if proto, ok = e.script(sha); !ok {
+			return messages.GetErrorString("NOSCRIPT No matching script. Please use EVAL."), true
+		}
+	}
+
+	readOnly := name == EvalROCommand || name == EvalShaROCommand
+	keys, args := commands[3:3+n], commands[3+n:]
+	return e.run(c, sha, readOnly, nil, func(_ *session, L *lua.LState) error {
+		L.SetGlobal("KEYS", stringsTable(L, keys))
+		L.SetGlobal("ARGV", stringsTable(L, args))
+		L.Push(L.NewFunctionFromProto(proto))
+		return L.PCall(0, 1, nil)
+	}).Serialise(), true
+}
+
+// run runs a script (or function) atomically with call, which leaves its return value on the stack, returning its reply.
+// It is called in L, or in a new state if L is nil.
+func (e *Engine) run(c *client.Client, name string, readOnly bool, L *lua.LState, call func(s *session, L *lua.LState) error) messages.Message {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &run{name: name, cancel: cancel}
+	if !e.acquire(r) {
+		cancel()
+		return messages.NewError(busyMsg)
+	}
+	defer e.finish(r)
+
+	// the commands of the script are run as the client, but skip the checks for other clients (e.g. BUSY)
+	sc := client.New("lua")
+	sc.Script = true
+	sc.Store = c.Store
+	sc.DB = c.DB
+	sc.User = c.User
+	sc.Authenticated = c.Authenticated
+
+	s := &session{engine: e, run: r, client: sc, readOnly: readOnly}
+	if L == nil {
+		L = s.newState()
+		defer L.Close()
+	}
+	L.SetContext(ctx)
+	// the state of a library is called again, so nothing is left on its stack
+	defer L.SetTop(0)
+
+	if err := call(s, L); err != nil {
+		e.mu.Lock()
+		killed := r.killed
+		e.mu.Unlock()
+		if killed {
+			return messages.NewError("ERR Script killed by user with SCRIPT KILL...")
+		}
+		return scriptError(err, name)
+	}
+	return toReply(L.Get(-1))
+}
+
+// scriptError is the reply for a script that raised an error, name is its SHA1 digest (or the name of the function).
+func scriptError(err error, name string) messages.Message {
+	msg := err.Error()
+	if apiErr, ok := err.(*lua.ApiError); ok {
+		msg = apiErr.Object.String()
+		if t, ok := apiErr.Object.(*lua.LTable); ok {
+			// raised by redis.call, or with error(redis.error_reply(...))
+			if e, ok := t.RawGetString("err").(lua.LString); ok {
+				msg = string(e)
+			}
+		} else {
+			msg = "ERR " + msg
+		}
+	}
+	return messages.NewError(oneLine(msg) + " script: " + name)
+}
+
+// oneLine replaces the line breaks in an error or status reply, which cannot contain them.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// SCRIPT LOAD script | EXISTS sha1 [sha1 ...] | FLUSH [ASYNC | SYNC] | KILL
+func (e *Engine) Script(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], ScriptCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return messages.GetErrorString("ERR wrong number of arguments for command"), true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "LOAD":
+		if len(args) != 1 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		sha, err := e.Load(args[0])
+		if err != nil {
+			return messages.GetError(err), true
+		}
+		return messages.NewBulkString(sha).Serialise(), true
+	case "EXISTS":
+		if len(args) == 0 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		ret := make([]messages.Message, len(args))
+		for i, sha := range args {
+			exists := int64(0)
+			if _, ok := e.script(sha); ok {
+				exists = 1
+			}
+			ret[i] = messages.NewInteger(exists)
+		}
+		return messages.NewArray(ret).Serialise(), true
+	case "FLUSH":
+		// the scripts are always flushed synchronously, as there is nothing to free in the background
+		if len(args) > 1 || (len(args) == 1 && !strings.EqualFold(args[0], "ASYNC") && !strings.EqualFold(args[0], "SYNC")) {
+			return messages.GetErrorString("ERR SCRIPT FLUSH only support SYNC|ASYNC option"), true
+		}
+		e.Flush()
+		return messages.NewSimpleString("OK").Serialise(), true
+	case "KILL":
+		if len(args) != 0 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		if err := e.Kill(); err != nil {
+			return messages.GetError(err), true
+		}
+		return messages.NewSimpleString("OK").Serialise(), true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try SCRIPT HELP."), true
+	}
+}
@@ -0,0 +1,241 @@
+package scripting
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// fakeCommands are GET, SET, INCR and PING on a map, like the router.
+type fakeCommands struct {
+	mu   sync.Mutex
+	keys map[string]string
+}
+
+func (f *fakeCommands) Exists(command string) bool {
+	switch strings.ToUpper(command) {
+	case "GET", "SET", "INCR", "PING":
+		return true
+	}
+	return false
+}
+
+func (f *fakeCommands) Categories(command, _ string) []string {
+	switch strings.ToUpper(command) {
+	case "SET", "INCR":
+		return []string{"write"}
+	}
+	return []string{"read"}
+}
+
+func (f *fakeCommands) HandleCommands(c *client.Client, commands []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(commands[0]) {
+	case "GET":
+		v, ok := f.keys[commands[1]]
+		if !ok {
+			return messages.NewNullBulkString().Serialise()
+		}
+		return messages.NewBulkString(v).Serialise()
+	case "SET":
+		f.keys[commands[1]] = commands[2]
+		return messages.NewSimpleString("OK").Serialise()
+	case "INCR":
+		n := 0
+		if v, ok := f.keys[commands[1]]; ok {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil {
+				return messages.GetErrorString("ERR value is not an integer or out of range")
+			}
+		}
+		f.keys[commands[1]] = strconv.Itoa(n + 1)
+		return messages.NewInteger(int64(n + 1)).Serialise()
+	default:
+		return messages.NewSimpleString("PONG").Serialise()
+	}
+}
+
+func newEngine() (*Engine, *fakeCommands) {
+	f := &fakeCommands{keys: map[string]string{}}
+	return New(f), f
+}
+
+func eval(e *Engine, commands ...string) string {
+	ret, _ := e.Eval(client.New(""), commands)
+	return ret
+}
+
+func TestEval(t *testing.T) {
+	e, f := newEngine()
+	f.keys["n"] = "1"
+
+	tests := []struct {
+		name     string
+		commands []string
+		expected string
+	}{
+		{"integer", []string{"EVAL", "return 1.9", "0"}, ":1\r\n"},
+		{"string", []string{"EVAL", "return 'a'", "0"}, "$1\r\na\r\n"},
+		{"true", []string{"EVAL", "return true", "0"}, ":1\r\n"},
+		{"false", []string{"EVAL", "return false", "0"}, "$-1\r\n"},
+		{"nil", []string{"EVAL", "return nil", "0"}, "$-1\r\n"},
+		{"array", []string{"EVAL", "return {1, 'a', {2}, nil, 3}", "0"}, "*3\r\n:1\r\n$1\r\na\r\n*1\r\n:2\r\n"},
+		{"status", []string{"EVAL", "return redis.status_reply('FINE')", "0"}, "+FINE\r\n"},
+		{"error", []string{"EVAL", "return {err='ERR no'}", "0"}, "-ERR no\r\n"},
+		{"keys_argv", []string{"EVAL", "return {KEYS[1], KEYS[2], ARGV[1], #ARGV}", "2", "a", "b", "c"}, "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n:1\r\n"},
+		{"call", []string{"EVAL", "redis.call('SET', KEYS[1], ARGV[1]); return redis.call('get', KEYS[1])", "1", "k", "v"}, "$1\r\nv\r\n"},
+		{"call_integer", []string{"EVAL", "return redis.call('INCR', 'n') + 1", "0"}, ":3\r\n"},
+		{"call_number_arg", []string{"EVAL", "redis.call('SET', 'x', 10); return redis.call('GET', 'x')", "0"}, "$2\r\n10\r\n"},
+		{"call_status", []string{"EVAL", "return redis.call('SET', 'k', 'v').ok", "0"}, "$2\r\nOK\r\n"},
+		{"call_nil", []string{"EVAL", "return redis.call('GET', 'nope') == false", "0"}, ":1\r\n"},
+		{"call_error", []string{"EVAL", "return redis.call('INCR', 'k')", "0"}, "-ERR value is not an integer or out of range script: " + Sha1Hex("return redis.call('INCR', 'k')") + "\r\n"},
+		{"pcall_error", []string{"EVAL", "return redis.pcall('INCR', 'k')", "0"}, "-ERR value is not an integer or out of range\r\n"},
+		{"unknown_command", []string{"EVAL", "return redis.pcall('NOPE')", "0"}, "-ERR Unknown Redis command called from script\r\n"},
+		{"sha1hex", []string{"EVAL", "return redis.sha1hex('')", "0"}, "$40\r\nda39a3ee5e6b4b0d3255bfef95601890afd80709\r\n"},
+		{"runtime_error", []string{"EVAL", "error('oops')", "0"}, "-ERR user_script:1: oops script: " + Sha1Hex("error('oops')") + "\r\n"},
+		{"no_files", []string{"EVAL", "return loadfile == nil and dofile == nil and io == nil and os == nil", "0"}, ":1\r\n"},
+		{"compile_error", []string{"EVAL", "return +", "0"}, ""},
+		{"numkeys_not_integer", []string{"EVAL", "return 1", "x"}, "-ERR value is not an integer or out of range\r\n"},
+		{"numkeys_negative", []string{"EVAL", "return 1", "-1"}, "-ERR Number of keys can't be negative\r\n"},
+		{"numkeys_too_many", []string{"EVAL", "return 1", "2", "a"}, "-ERR Number of keys can't be greater than number of args\r\n"},
+		{"read_only", []string{"EVAL_RO", "return redis.pcall('SET', 'k', 'v')", "0"}, "-ERR Write commands are not allowed from read-only scripts.\r\n"},
+		{"read_only_read", []string{"EVAL_RO", "return redis.call('GET', 'n')", "0"}, "$1\r\n2\r\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := eval(e, test.commands...)
+			if test.expected == "" {
+				IsTrue(t, strings.HasPrefix(actual, "-ERR Error compiling script"), "actual=%q", actual)
+			} else {
+				EqualO(t, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestScript(t *testing.T) {
+	e, _ := newEngine()
+	body := "return ARGV[1]"
+	sha := Sha1Hex(body)
+
+	EqualO(t, eval(e, "EVALSHA", sha, "0", "a"), "-NOSCRIPT No matching script. Please use EVAL.\r\n")
+	Equal(t, V(e.Script([]string{"SCRIPT", "LOAD", body})), V(messages.NewBulkString(sha).Serialise(), true))
+	EqualO(t, eval(e, "EVALSHA", strings.ToUpper(sha), "0", "a"), "$1\r\na\r\n")
+	EqualO(t, eval(e, "EVALSHA_RO", sha, "0", "b"), "$1\r\nb\r\n")
+	Equal(t, V(e.Script([]string{"script", "exists", sha, "nope"})), V("*2\r\n:1\r\n:0\r\n", true))
+
+	// EVAL caches the script too
+	eval(e, "EVAL", "return 2", "0")
+	Equal(t, V(e.Script([]string{"SCRIPT", "EXISTS", Sha1Hex("return 2")})), V("*1\r\n:1\r\n", true))
+
+	Equal(t, V(e.Script([]string{"SCRIPT", "FLUSH", "nope"})), V("-ERR SCRIPT FLUSH only support SYNC|ASYNC option\r\n", true))
+	Equal(t, V(e.Script([]string{"SCRIPT", "FLUSH", "ASYNC"})), V("+OK\r\n", true))
+	Equal(t, V(e.Script([]string{"SCRIPT", "EXISTS", sha})), V("*1\r\n:0\r\n", true))
+
+	ret, ok := e.Script([]string{"SCRIPT", "LOAD", "return +"})
+	IsTrue(t, ok && strings.HasPrefix(ret, "-ERR Error compiling script"), "ret=%q", ret)
+	Equal(t, V(e.Script([]string{"SCRIPT", "KILL"})), V("-NOTBUSY No scripts in execution right now.\r\n", true))
+	Equal(t, V(e.Script([]string{"SCRIPT", "NOPE"})), V("-ERR unknown subcommand 'NOPE'. Try SCRIPT HELP.\r\n", true))
+	Equal(t, V(e.Script([]string{"GET"})), V("", false))
+	Equal(t, V(e.Eval(client.New(""), []string{"GET"})), V("", false))
+
+	EqualO(t, Keys([]string{"EVAL", "s", "2", "a", "b", "c"}), []string{"a", "b"})
+	EqualO(t, Keys([]string{"EVAL", "s", "3", "a"}), []string(nil))
+}
+
+// waitRunning waits until a script is running.
+func waitRunning(t *testing.T, e *Engine) {
+	for i := 0; i < 500; i++ {
+		e.mu.Lock()
+		running := e.running != nil
+		e.mu.Unlock()
+		if running {
+			return
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	t.Fatal("the script never ran")
+}
+
+func TestKill(t *testing.T) {
+	e, f := newEngine()
+	e.SetBusyThreshold(10 * time.Millisecond)
+
+	done := make(chan string)
+	go func() {
+		done <- eval(e, "EVAL", "while true do end", "0")
+	}()
+	waitRunning(t, e)
+
+	// until the script is busy, other commands wait for it
+	time.Sleep(20 * time.Millisecond)
+	_, ok := e.Hold(false)
+	IsFalse(t, ok, "commands should not wait for a busy script")
+	EqualO(t, eval(e, "EVAL", "return 1", "0"), BusyErr)
+
+	NoError(t, e.Kill())
+	EqualO(t, <-done, "-ERR Script killed by user with SCRIPT KILL...\r\n")
+	release, ok := e.Hold(false)
+	IsTrue(t, ok, "commands should run once the script is killed")
+	release()
+
+	// scripts that wrote cannot be killed
+	go func() {
+		done <- eval(e, "EVAL", "redis.call('SET', 'k', 'v') while true do end", "0")
+	}()
+	waitRunning(t, e)
+	time.Sleep(20 * time.Millisecond)
+	Equal(t, V(e.Script([]string{"SCRIPT", "KILL"})), V("-UNKILLABLE Sorry the script already executed write commands against the dataset. You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.\r\n", true))
+	e.mu.Lock()
+	e.running.cancel()
+	e.mu.Unlock()
+	<-done
+	EqualO(t, f.keys["k"], "v")
+}
+
+func TestAtomic(t *testing.T) {
+	e, f := newEngine()
+
+	// the script waits for the commands that are running
+	release, ok := e.Hold(false)
+	IsTrue(t, ok, "")
+	done := make(chan string)
+	go func() {
+		done <- eval(e, "EVAL", "return redis.call('INCR', 'n')", "0")
+	}()
+	select {
+	case <-done:
+		t.Fatal("the script should wait for the command")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	EqualO(t, <-done, ":1\r\n")
+
+	// commands never run in the middle of a script
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			eval(e, "EVAL", "redis.call('SET', 'a', '1'); redis.call('SET', 'b', '1'); redis.call('SET', 'a', '0'); redis.call('SET', 'b', '0')", "0")
+		}()
+		go func() {
+			defer wg.Done()
+			release, _ := e.Hold(true)
+			defer release()
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			EqualO(t, f.keys["a"], f.keys["b"])
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/acl"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/latency"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/scripting"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/slowlog"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/disk"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tlsconfig"
+)
+
+// bindConfig lets the parameters that can change at runtime be set with CONFIG SET, and applies the ones that were given.
+func (s *Server) bindConfig(cfg *config.Config, a *acl.ACL, sl *slowlog.SlowLog, monitor *latency.Monitor, scripts *scripting.Engine) error {
+	st := s.store
+	cfg.OnResetStat(st.Stats().Reset)
+	cfg.OnResetStat(s.r.Stats().Reset)
+	cfg.OnResetStat(s.r.Latencies().Reset)
+
+	binds := map[string]func(value string) error{
+		"maxmemory": func(value string) error {
+			limit, err := store.ParseMemory(value)
+			if err != nil {
+				return err
+			}
+			st.SetMaxMemory(limit)
+			return nil
+		},
+		"maxmemory-policy": func(value string) error {
+			policy, err := store.ParsePolicy(value)
+			if err != nil {
+				return err
+			}
+			st.SetEvictionPolicy(policy)
+			return nil
+		},
+		"maxmemory-samples": func(value string) error {
+			samples, err := strconv.Atoi(value)
+			if err != nil || samples <= 0 {
+				return errors.New("argument must be greater than 0")
+			}
+			st.SetEvictionSamples(samples)
+			return nil
+		},
+		"notify-keyspace-events": func(value string) error {
+			classes, err := pubsub.ParseClasses(value)
+			if err != nil {
+				return err
+			}
+			st.Notifier().SetClasses(classes)
+			return nil
+		},
+		"dir": func(value string) error {
+			st.SetPath(disk.Path(value, cfg.Get("dbfilename")))
+			return nil
+		},
+		"dbfilename": func(value string) error {
+			if filepath.Base(value) != value {
+				return errors.New("dbfilename can't be a path, just a filename")
+			}
+			st.SetPath(disk.Path(cfg.Get("dir"), value))
+			return nil
+		},
+		"requirepass": a.SetRequirePass,
+		"masteruser": func(string) error {
+			s.repl.SetMasterAuth(cfg.Get("masteruser"), cfg.Get("masterauth"))
+			return nil
+		},
+		"masterauth": func(string) error {
+			s.repl.SetMasterAuth(cfg.Get("masteruser"), cfg.Get("masterauth"))
+			return nil
+		},
+		"slowlog-log-slower-than": func(value string) error {
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			sl.SetSlowerThan(time.Duration(us) * time.Microsecond)
+			return nil
+		},
+		"slowlog-max-len": func(value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return errors.New("argument must be greater than or equal to 0")
+			}
+			sl.SetMaxLen(n)
+			return nil
+		},
+		"latency-monitor-threshold": func(value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				return errors.New("argument must be greater than or equal to 0")
+			}
+			monitor.SetThreshold(time.Duration(ms) * time.Millisecond)
+			return nil
+		},
+		"busy-reply-threshold": func(value string) error {
+			ms, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || ms < 0 {
+				return errors.New("argument must be greater than or equal to 0")
+			}
+			scripts.SetBusyThreshold(time.Duration(ms) * time.Millisecond)
+			return nil
+		},
+	}
+	if s.tls != nil {
+		// the certificates are reloaded whenever any of these change (like redis), the listener keeps its port
+		for _, name := range []string{"tls-cert-file", "tls-key-file", "tls-ca-cert-file", "tls-auth-clients", "tls-protocols", "tls-ciphers"} {
+			binds[name] = func(string) error {
+				tlsConfig, err := TLSConfig(cfg)
+				if err != nil {
+					return err
+				}
+				return s.tls.Set(tlsConfig)
+			}
+		}
+	}
+
+	for name, apply := range binds {
+		if err := cfg.Bind(name, apply); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TLSConfig returns the TLS settings in the config.
+func TLSConfig(cfg *config.Config) (tlsconfig.Config, error) {
+	authClients, err := tlsconfig.ParseAuthClients(cfg.Get("tls-auth-clients"))
+	if err != nil {
+		return tlsconfig.Config{}, err
+	}
+	return tlsconfig.Config{
+		CertFile:    cfg.Get("tls-cert-file"),
+		KeyFile:     cfg.Get("tls-key-file"),
+		CAFile:      cfg.Get("tls-ca-cert-file"),
+		AuthClients: authClients,
+		Protocols:   cfg.Get("tls-protocols"),
+		Ciphers:     cfg.Get("tls-ciphers"),
+	}, nil
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/metrics"
+)
+
+// newMetricsServer serves /metrics (in the Prometheus text format) and /healthz.
+func (s *Server) newMetricsServer() *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", s.serveMetrics)
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		// the server is alive if it can answer at all
+		w.Write([]byte("ok\n"))
+	})
+	return &http.Server{Handler: mux}
+}
+
+// serveHTTP serves the metrics until the server stops.
+func (s *Server) serveHTTP(l net.Listener) {
+	if err := s.metrics.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Err(err).Msg("serving metrics")
+	}
+}
+
+func (s *Server) serveMetrics(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := metrics.NewWriter(rw)
+	st := s.store
+	routerStats := s.r.Stats()
+	storeStats := st.Stats()
+
+	latencies := s.r.Latencies()
+	names := latencies.Names()
+	slices.Sort(names)
+	calls := make([]metrics.Sample, 0, len(names))
+	histograms := make([]metrics.LabeledHistogram, 0, len(names))
+	for _, name := range names {
+		h := latencies.Get(name)
+		labels := []metrics.Label{{Name: "command", Value: name}}
+		calls = append(calls, metrics.Sample{Labels: labels, Value: float64(h.Count())})
+		histograms = append(histograms, metrics.LabeledHistogram{Labels: labels, Histogram: h})
+	}
+	w.Counter("redis_command_calls_total", "Number of calls handled, by command.", calls...)
+	w.Histogram("redis_command_duration_seconds", "Time taken to handle a command, by command.", histograms...)
+	w.Counter("redis_commands_processed_total", "Number of commands processed.", metrics.Sample{Value: float64(routerStats.TotalCommandsProcessed.Load())})
+	w.Counter("redis_error_replies_total", "Number of error replies.", metrics.Sample{Value: float64(routerStats.TotalErrorReplies.Load())})
+
+	w.Gauge("redis_connected_clients", "Number of clients connected.", metrics.Sample{Value: float64(routerStats.ConnectedClients.Load())})
+	w.Counter("redis_connections_received_total", "Number of connections accepted.", metrics.Sample{Value: float64(routerStats.TotalConnectionsReceived.Load())})
+
+	keys, expires := st.Keyspace()
+	counts := st.TypeCounts()
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	byType := make([]metrics.Sample, 0, len(types))
+	for _, t := range types {
+		byType = append(byType, metrics.Sample{Labels: []metrics.Label{{Name: "type", Value: t}}, Value: float64(counts[t])})
+	}
+	w.Gauge("redis_keys", "Number of keys.", metrics.Sample{Value: float64(keys)})
+	w.Gauge("redis_keys_by_type", "Number of keys, by type.", byType...)
+	w.Gauge("redis_expiring_keys", "Number of keys with an expiry.", metrics.Sample{Value: float64(expires)})
+	w.Counter("redis_expired_keys_total", "Number of keys that expired.", metrics.Sample{Value: float64(storeStats.ExpiredKeys.Load())})
+	w.Counter("redis_evicted_keys_total", "Number of keys evicted for maxmemory.", metrics.Sample{Value: float64(storeStats.EvictedKeys.Load())})
+	w.Counter("redis_keyspace_hits_total", "Number of lookups of keys that exist.", metrics.Sample{Value: float64(storeStats.KeyspaceHits.Load())})
+	w.Counter("redis_keyspace_misses_total", "Number of lookups of keys that do not exist.", metrics.Sample{Value: float64(storeStats.KeyspaceMisses.Load())})
+	w.Histogram("redis_expiry_cycle_duration_seconds", "Time taken by a sweep of active expiry.", metrics.LabeledHistogram{Histogram: &storeStats.ExpiryCycles})
+	w.Gauge("redis_memory_used_bytes", "Estimated memory used by the keys.", metrics.Sample{Value: float64(st.UsedMemory())})
+
+	lastSave, ok := st.LastSave()
+	w.Gauge("redis_rdb_last_save_timestamp_seconds", "When the store was last saved to disk.", metrics.Sample{Value: float64(lastSave.Unix())})
+	w.Gauge("redis_rdb_last_save_ok", "Whether the last save to disk succeeded.", metrics.Sample{Value: float64(boolToInt(ok))})
+	w.Histogram("redis_rdb_save_duration_seconds", "Time taken to save the store to disk.", metrics.LabeledHistogram{Histogram: &storeStats.Saves})
+	w.Histogram("redis_rdb_load_duration_seconds", "Time taken to load the store from disk.", metrics.LabeledHistogram{Histogram: &storeStats.Loads})
+
+	if err := w.Flush(); err != nil {
+		log.Debug().Err(err).Msg("writing metrics")
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
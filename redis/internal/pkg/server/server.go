@@ -1,56 +1,381 @@
 package server
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
 	"errors"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/acl"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/cluster"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/info"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/latency"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/monitor"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/replication"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/router"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/scripting"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/slowlog"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tlsconfig"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tracking"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
 )
 
+// tlsHandshakeTimeout is how long a client has to complete the TLS handshake.
+const tlsHandshakeTimeout = 10 * time.Second
+
 // Server is a TCP server. To construct one, use `Server::New`.
 // When a sigint is captured, if there are any ongoing events (e.g. connections), the server will wait for up to X seconds before forcefully shutting down; if there are no events, it will gracefully shutdown.
 type Server struct {
 	ctx      context.Context
+	cancel   context.CancelFunc
 	port     string
 	wg       sync.WaitGroup
 	stopOnce sync.Once
 	r        *router.Router
-	l        net.Listener
+	repl     *replication.Replication
+	pubsub   *pubsub.PubSub
+	clients  *client.Registry
+	monitors *monitor.Monitors
+	tracking *tracking.Tracking
+	store    *store.Store
+	// ownStore is whether the store was created by (and is closed with) the server.
+	ownStore bool
+	// cluster is nil unless cluster mode is enabled.
+	cluster *cluster.Cluster
+	// l is nil if not listening on a TCP port.
+	l net.Listener
+	// tlsListener and tls are nil unless TLS is enabled.
+	tlsListener net.Listener
+	tls         *tlsconfig.Reloader
+	// unixListener is nil unless listening on a unix socket.
+	unixListener net.Listener
+	// metricsListener and metrics are nil unless serving metrics over HTTP.
+	metricsListener net.Listener
+	metrics         *http.Server
 }
 
-// New constructs a new Server with the specified port.
-func New(port string) (*Server, error) {
-	l, err := net.Listen("tcp", port)
-	if err != nil {
+type options struct {
+	clusterBusAddr string
+	requirePass    string
+	aclFile        string
+	masterUser     string
+	masterAuth     string
+	tlsPort        string
+	tlsConfig      tlsconfig.Config
+	unixSocket     string
+	unixSocketPerm os.FileMode
+	config         *config.Config
+	metricsAddr    string
+	store          *store.Store
+}
+
+// Option configures a Server.
+type Option func(*options)
+
+// WithCluster enables cluster mode, with the cluster bus listening on busAddr.
+func WithCluster(busAddr string) Option {
+	return func(o *options) {
+		o.clusterBusAddr = busAddr
+	}
+}
+
+// WithRequirePass requires clients to authenticate as the default user with the password.
+func WithRequirePass(password string) Option {
+	return func(o *options) {
+		o.requirePass = password
+	}
+}
+
+// WithACLFile loads the users from the ACL file, which is also where ACL SAVE writes them.
+func WithACLFile(file string) Option {
+	return func(o *options) {
+		o.aclFile = file
+	}
+}
+
+// WithMasterAuth authenticates to our master (when we are a replica) as the user, or the default user if it is empty.
+func WithMasterAuth(user, password string) Option {
+	return func(o *options) {
+		o.masterUser = user
+		o.masterAuth = password
+	}
+}
+
+// WithTLS also listens for TLS connections on tlsPort, with the certificates and settings of the config.
+func WithTLS(tlsPort string, config tlsconfig.Config) Option {
+	return func(o *options) {
+		o.tlsPort = tlsPort
+		o.tlsConfig = config
+	}
+}
+
+// WithUnixSocket also listens on a unix socket at path, with the permissions perm (or the umask's if it is 0).
+func WithUnixSocket(path string, perm os.FileMode) Option {
+	return func(o *options) {
+		o.unixSocket = path
+		o.unixSocketPerm = perm
+	}
+}
+
+// WithConfig adds CONFIG, and lets the parameters of the config change at runtime.
+// The parameters given in the config (rather than the defaults) are applied, overriding the other options.
+func WithConfig(cfg *config.Config) Option {
+	return func(o *options) {
+		o.config = cfg
+	}
+}
+
+// WithMetrics serves /metrics (in the Prometheus text format) and /healthz over HTTP on addr.
+func WithMetrics(addr string) Option {
+	return func(o *options) {
+		o.metricsAddr = addr
+	}
+}
+
+// WithStore serves the keys in st, rather than in a new store of the server's own.
+func WithStore(st *store.Store) Option {
+	return func(o *options) {
+		o.store = st
+	}
+}
+
+// New constructs a new Server with the specified port, which may be empty to only listen on a TLS port or unix socket.
+func New(port string, opts ...Option) (*Server, error) {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// each listener is optional, but there must be at least one
+	var l, tl, ul, ml net.Listener
+	var reloader *tlsconfig.Reloader
+	var st *store.Store
+	ownStore := o.store == nil
+	// closes the listeners (and our store) if the rest of the setup fails
+	cleanup := func() {
+		for _, listener := range []net.Listener{l, tl, ul, ml} {
+			if listener != nil {
+				listener.Close()
+			}
+		}
+		if ownStore && st != nil {
+			st.Close()
+		}
+	}
+
+	var err error
+	if port != "" {
+		l, err = net.Listen("tcp", port)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.tlsPort != "" {
+		reloader, err = tlsconfig.New(o.tlsConfig)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		tl, err = tls.Listen("tcp", o.tlsPort, reloader.TLSConfig())
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	if o.unixSocket != "" {
+		ul, err = listenUnix(o.unixSocket, o.unixSocketPerm)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	if l == nil && tl == nil && ul == nil {
+		return nil, errors.New("nothing to listen on, a port, a TLS port or a unix socket is required")
+	}
+	if o.metricsAddr != "" {
+		ml, err = net.Listen("tcp", o.metricsAddr)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+
+	st = o.store
+	if ownStore {
+		st = store.New()
+	}
+
+	r := router.NewDefault(st)
+	repl := replication.New(st, r.Apply)
+	if l != nil {
+		repl.SetListeningPort(l.Addr().(*net.TCPAddr).Port)
+	}
+	repl.SetMasterAuth(o.masterUser, o.masterAuth)
+	r.SetReplication(repl)
+
+	ps := pubsub.New()
+	st.Notifier().SetPubSub(ps)
+	r.SetPubSub(ps)
+
+	clients := client.NewRegistry()
+	r.SetClients(clients)
+
+	t := tracking.New(clients, ps)
+	clients.SetTracking(t)
+	r.SetTracking(t)
+	st.SetInvalidator(t)
+
+	monitors := monitor.New()
+	r.SetMonitors(monitors)
+
+	sl := slowlog.New()
+	r.SetSlowLog(sl)
+	monitor := latency.New()
+	r.SetLatency(monitor)
+	st.SetLatencyMonitor(monitor)
+
+	scripts := scripting.New(r)
+	r.SetScripting(scripts)
+	if err := st.SetFunctions(scripts); err != nil {
+		cleanup()
 		return nil, err
 	}
 
+	a := acl.New(r)
+	r.SetACL(a)
+	if o.aclFile != "" {
+		a.SetFile(o.aclFile)
+		if err := a.Load(); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	if o.requirePass != "" {
+		if err := a.SetRequirePass(o.requirePass); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+
+	var c *cluster.Cluster
+	if o.clusterBusAddr != "" {
+		if l == nil {
+			cleanup()
+			return nil, errors.New("cluster mode needs a port, as nodes redirect clients to it")
+		}
+		c, err = cluster.New(l.Addr().String(), o.clusterBusAddr, st)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		r.SetCluster(c)
+	}
+
 	ctx, cancelFunc := context.WithCancel(context.Background())
 	s := &Server{
 		ctx:      ctx,
+		cancel:   cancelFunc,
 		port:     ":" + port,
 		wg:       sync.WaitGroup{},
 		stopOnce: sync.Once{},
-		r:        router.NewDefault(),
+		r:        r,
+		repl:     repl,
+		pubsub:   ps,
+		clients:  clients,
+		monitors: monitors,
+		tracking: t,
+		store:    st,
+		ownStore: ownStore,
+		cluster:  c,
 		l:        l,
+
+		tlsListener:  tl,
+		tls:          reloader,
+		unixListener: ul,
+
+		metricsListener: ml,
+	}
+	if ml != nil {
+		s.metrics = s.newMetricsServer()
+	}
+
+	tcpPort, configFile := 0, ""
+	if l != nil {
+		tcpPort = l.Addr().(*net.TCPAddr).Port
+	}
+	if o.config != nil {
+		configFile = o.config.File()
+	}
+	r.SetInfo(info.New(info.Sources{
+		Stats:          r.Stats(),
+		Store:          st,
+		Replication:    repl,
+		PubSub:         ps,
+		ClusterEnabled: c != nil,
+		TCPPort:        tcpPort,
+		ConfigFile:     configFile,
+	}))
+
+	if o.config != nil {
+		r.SetConfig(o.config)
+		if err := s.bindConfig(o.config, a, sl, monitor, scripts); err != nil {
+			cleanup()
+			if c != nil {
+				c.Close()
+			}
+			cancelFunc()
+			return nil, err
+		}
 	}
 
 	go func() {
 		sigint := make(chan os.Signal, 1)
 		signal.Notify(sigint, os.Interrupt)
-		<-sigint
-		cancelFunc()
-		s.Stop()
+		defer signal.Stop(sigint)
+		select {
+		case <-sigint:
+			s.Stop()
+		case <-ctx.Done():
+			// stopped without a sigint
+		}
 	}()
 
+	if reloader != nil {
+		go func() {
+			// like redis, SIGHUP is not fatal; it reloads the certificates (e.g. after they are renewed)
+			sighup := make(chan os.Signal, 1)
+			signal.Notify(sighup, syscall.SIGHUP)
+			for {
+				select {
+				case <-sighup:
+					if err := s.ReloadTLS(); err != nil {
+						log.Err(err).Msg("reloading TLS certificates")
+					} else {
+						log.Info().Msg("reloaded TLS certificates")
+					}
+				case <-ctx.Done():
+					signal.Stop(sighup)
+					return
+				}
+			}
+		}()
+	}
+
 	return s, nil
 }
 
@@ -60,8 +385,55 @@ func (s *Server) Serve() error {
 		return errors.New("tried to call *Server::Serve() on nil")
 	}
 
+	if s.metrics != nil {
+		go s.serveHTTP(s.metricsListener)
+	}
+
+	listeners := s.listeners()
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			errs <- s.serve(l)
+		}()
+	}
+	// the listeners are all closed when the server stops
+	return <-errs
+}
+
+// listeners returns the listeners that the server is listening on.
+func (s *Server) listeners() []net.Listener {
+	ret := []net.Listener{}
+	for _, l := range []net.Listener{s.l, s.tlsListener, s.unixListener} {
+		if l != nil {
+			ret = append(ret, l)
+		}
+	}
+	return ret
+}
+
+// listenUnix listens on a unix socket, replacing any stale socket left at the path.
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		// like redis, a socket left by a server that did not shutdown cleanly is removed
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (s *Server) serve(l net.Listener) error {
 	for {
-		conn, err := s.l.Accept()
+		conn, err := l.Accept()
 		if err != nil {
 			select {
 			case <-s.ctx.Done():
@@ -71,13 +443,70 @@ func (s *Server) Serve() error {
 			}
 		}
 
+		s.wg.Add(1)
 		go s.handleConnection(conn)
 	}
 }
 
+// Addr returns the address the server is listening on, or "" if it is not listening on a TCP port.
+func (s *Server) Addr() string {
+	if s.l == nil {
+		return ""
+	}
+	return s.l.Addr().String()
+}
+
+// TLSAddr returns the address the server is listening for TLS connections on, or "" if TLS is not enabled.
+func (s *Server) TLSAddr() string {
+	if s.tlsListener == nil {
+		return ""
+	}
+	return s.tlsListener.Addr().String()
+}
+
+// UnixAddr returns the path of the unix socket the server is listening on, or "" if it is not listening on one.
+func (s *Server) UnixAddr() string {
+	if s.unixListener == nil {
+		return ""
+	}
+	return s.unixListener.Addr().String()
+}
+
+// MetricsAddr returns the address metrics are served on, or "" if they are not.
+func (s *Server) MetricsAddr() string {
+	if s.metricsListener == nil {
+		return ""
+	}
+	return s.metricsListener.Addr().String()
+}
+
+// ReloadTLS reads the TLS certificates again, for new connections.
+// If they are invalid, the previous certificates are kept.
+func (s *Server) ReloadTLS() error {
+	if s.tls == nil {
+		return errors.New("TLS is not enabled")
+	}
+	return s.tls.Reload()
+}
+
 // Stops the server.
 func (s *Server) Stop() {
 	s.stopOnce.Do(func() {
+		s.cancel()
+		// replication links are long-lived, don't wait for them
+		s.repl.Close()
+		if s.cluster != nil {
+			s.cluster.Close()
+		}
+
+		// stops accepting connections, then disconnects the clients, so that their handlers exit
+		for _, l := range s.listeners() {
+			l.Close()
+		}
+		for _, c := range s.clients.List() {
+			c.Kill()
+		}
+
 		done := make(chan bool, 2)
 		go func() {
 			// TODO: increase timeout
@@ -97,56 +526,144 @@ func (s *Server) Stop() {
 			log.Info().Msg("server abruptly stopped because of timeout")
 		}
 
-		s.l.Close()
+		if s.metrics != nil {
+			s.metrics.Close()
+		} else if s.metricsListener != nil {
+			// never served
+			s.metricsListener.Close()
+		}
+		if s.ownStore {
+			s.store.Close()
+		}
 	})
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
-	s.wg.Add(1)
 	defer s.wg.Done()
 	defer conn.Close()
 
-	for {
-		// connection loop
+	if tc, ok := conn.(*tls.Conn); ok {
+		// handshakes here rather than on the first read, so that clients cannot hold the connection open without one
+		tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			log.Debug().Err(err).Msg("TLS handshake")
+			return
+		}
+		tc.SetDeadline(time.Time{})
+	}
 
-		buf := make([]byte, 0, 4096)
-		for {
-			// fetches a single command
-			tmp := make([]byte, 2048)
-			isEof := false
+	addr := conn.RemoteAddr().String()
+	if conn.RemoteAddr().Network() == "unix" {
+		// unix socket clients have no address of their own, redis shows the socket's path
+		addr = conn.LocalAddr().String() + ":0"
+	}
+	c := client.New(addr)
+	c.LAddr = conn.LocalAddr().String()
+	c.Store = s.store
+	c.SetKill(func() {
+		// the reads fail, ending this goroutine
+		conn.Close()
+	})
+	s.clients.Add(c)
+	defer s.clients.Remove(c)
+	stats := s.r.Stats()
+	stats.TotalConnectionsReceived.Add(1)
+	stats.ConnectedClients.Add(1)
+	defer stats.ConnectedClients.Add(-1)
+	rd := messages.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	// guards w, which is shared with the published messages
+	var wmu sync.Mutex
+	c.Sub = pubsub.NewSubscriber()
+	defer s.pubsub.Remove(c.Sub)
+	defer s.monitors.Remove(c.Sub)
+	defer s.tracking.Remove(c)
+	go s.writeMessages(conn, w, &wmu, c.Sub)
+	// what a replica told us about itself, before it starts syncing
+	peer := replication.Peer{}
 
-			n, err := conn.Read(tmp)
-			if err != nil {
-				if err == io.EOF {
-					isEof = true
-				} else {
-					log.Err(err).Msg("reading from conn")
-					return
-				}
+	for {
+		commands, err := rd.ReadCommands()
+		if err != nil {
+			if errors.Is(err, messages.ErrProtocol) {
+				log.Debug().Err(err).Msg("protocol error")
+				wmu.Lock()
+				w.WriteString(messages.GetErrorString("ERR Protocol error: " + err.Error()))
+				w.Flush()
+				wmu.Unlock()
+			} else if err != io.EOF {
+				log.Debug().Err(err).Msg("reading from conn")
 			}
+			return
+		}
 
-			buf = append(buf, tmp[:n]...)
-			if len(buf) == 0 && isEof {
-				log.Debug().Msg("connection stopped because len(buf) == 0 && eof")
+		// held while handling the command, so that SUBSCRIBE is confirmed before any messages are written
+		wmu.Lock()
+		c.Record(commands[0], rd.Buffered(), w.Buffered())
+		var reply string
+		name := strings.ToUpper(commands[0])
+		denied, isDenied := "", false
+		if name == "REPLCONF" || name == "PSYNC" || name == "SYNC" {
+			// these do not go through the router, but need the same checks
+			denied, isDenied = s.r.Authorize(c, commands)
+		}
+		switch {
+		case isDenied:
+			reply = denied
+		case name == "REPLCONF":
+			reply = s.repl.ReplConf(&peer, commands)
+		case name == "PSYNC" || name == "SYNC":
+			err := w.Flush()
+			wmu.Unlock()
+			if err != nil {
 				return
 			}
-			req := string(buf)
-			reply, ok := s.r.Handle(req)
-			if ok || isEof {
-				// return the reply
-				reply := []byte(reply)
-				log.Debug().Str("req", req).Bytes("reply", reply).Msg("raw")
-				for len(reply) > 0 {
-					n, err := conn.Write(reply)
-					if err != nil {
-						log.Err(err).Msg("writing to conn")
-						return
-					}
-					reply = reply[n:]
-				}
+			c.Replica = true
+			c.Record(commands[0], 0, 0)
+			// the connection now belongs to the replica
+			s.repl.ServeReplica(conn, rd, commands, peer)
+			return
+		default:
+			reply = s.r.HandleCommands(c, commands)
+		}
+		log.Debug().Strs("commands", commands).Str("reply", reply).Msg("raw")
+
+		if c.Replies() {
+			_, err = w.WriteString(reply)
+		}
+		// only flush once all pipelined requests have been handled
+		if err == nil && (rd.Buffered() == 0 || c.CloseAfterReply) {
+			err = w.Flush()
+		}
+		wmu.Unlock()
+		if err != nil {
+			log.Err(err).Msg("writing to conn")
+			return
+		}
+		if c.CloseAfterReply {
+			return
+		}
+	}
+}
 
-				break
+// writeMessages writes the messages published to the subscriber, until it is removed.
+func (s *Server) writeMessages(conn net.Conn, w *bufio.Writer, wmu *sync.Mutex, sub *pubsub.Subscriber) {
+	for {
+		select {
+		case message := <-sub.Messages():
+			wmu.Lock()
+			_, err := w.WriteString(message)
+			if err == nil && len(sub.Messages()) == 0 {
+				err = w.Flush()
+			}
+			wmu.Unlock()
+			if err != nil {
+				log.Debug().Err(err).Msg("writing message to conn")
 			}
+		case <-sub.Done():
+			// the subscriber may have fallen too far behind, this unblocks the reads too
+			conn.Close()
+			return
 		}
 	}
 }
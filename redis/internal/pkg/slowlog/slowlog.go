@@ -0,0 +1,225 @@
+// Package slowlog implements SLOWLOG, which keeps the latest commands that took longer than a threshold.
+package slowlog
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/commands/slowlog-get/
+
+const SlowLogCommand = "SLOWLOG"
+
+const (
+	// maxArgs and maxArgLen limit the arguments kept for each entry, like redis.
+	maxArgs   = 32
+	maxArgLen = 128
+	// defaultCount is the number of entries returned by SLOWLOG GET, without a count.
+	defaultCount = 10
+)
+
+// Entry is a command that took at least the threshold.
+type Entry struct {
+	ID       int64
+	Time     time.Time
+	Duration time.Duration
+	Args     []string
+	// Addr and Name are of the client that ran the command.
+	Addr string
+	Name string
+}
+
+// SlowLog keeps the latest entries in a ring buffer. To construct one, use `New`.
+type SlowLog struct {
+	mu sync.Mutex
+	// slowerThan is the threshold, commands are never logged if it is negative.
+	slowerThan time.Duration
+	maxLen     int
+	// entries is a ring buffer, next is where the next entry is written.
+	entries []Entry
+	next    int
+	// nextID is the ID of the next entry, IDs are not reused after a reset.
+	nextID int64
+}
+
+// New constructs a SlowLog with redis' defaults: commands slower than 10ms, and the latest 128 of them.
+func New() *SlowLog {
+	return &SlowLog{slowerThan: 10 * time.Millisecond, maxLen: 128}
+}
+
+// SetSlowerThan sets the threshold, negative to stop logging commands (and 0 to log every command).
+func (l *SlowLog) SetSlowerThan(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.slowerThan = d
+}
+
+// SetMaxLen sets the number of entries kept, dropping the oldest if there are more.
+func (l *SlowLog) SetMaxLen(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := l.latest(n)
+	// latest is newest first, the ring buffer is oldest first
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	l.maxLen = n
+	l.entries = entries
+	l.next = len(entries) % max(n, 1)
+}
+
+// Log adds an entry for the command, if it took at least the threshold.
+func (l *SlowLog) Log(commands []string, d time.Duration, addr, name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.slowerThan < 0 || d < l.slowerThan || l.maxLen == 0 {
+		return
+	}
+
+	e := Entry{
+		ID:       l.nextID,
+		Time:     time.Now(),
+		Duration: d,
+		Args:     truncate(redact(commands)),
+		Addr:     addr,
+		Name:     name,
+	}
+	l.nextID++
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, e)
+	} else {
+		l.entries[l.next] = e
+	}
+	l.next = (l.next + 1) % l.maxLen
+}
+
+// redact hides the passwords in the command.
+func redact(commands []string) []string {
+	if len(commands) < 2 {
+		return commands
+	}
+	switch {
+	case strings.EqualFold(commands[0], "AUTH"):
+		ret := []string{commands[0]}
+		for range commands[1:] {
+			ret = append(ret, "(redacted)")
+		}
+		return ret
+	case strings.EqualFold(commands[0], "ACL") && strings.EqualFold(commands[1], "SETUSER"):
+		ret := make([]string, len(commands))
+		for i, arg := range commands {
+			// >password, <password, #hash and !hash
+			if i > 2 && arg != "" && strings.ContainsRune("><#!", rune(arg[0])) {
+				arg = "(redacted)"
+			}
+			ret[i] = arg
+		}
+		return ret
+	}
+	return commands
+}
+
+// truncate limits the number and lengths of the arguments, like redis.
+func truncate(commands []string) []string {
+	n := min(len(commands), maxArgs)
+	ret := make([]string, 0, n)
+	for i, arg := range commands[:n] {
+		if i == maxArgs-1 && len(commands) > maxArgs {
+			ret = append(ret, "... ("+strconv.Itoa(len(commands)-maxArgs+1)+" more arguments)")
+			break
+		}
+		if len(arg) > maxArgLen {
+			arg = arg[:maxArgLen] + "... (" + strconv.Itoa(len(arg)-maxArgLen) + " more bytes)"
+		}
+		ret = append(ret, arg)
+	}
+	return ret
+}
+
+// Get returns up to n of the latest entries (or all of them, if n is negative), newest first.
+func (l *SlowLog) Get(n int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.latest(n)
+}
+
+// latest must be called with l.mu held.
+func (l *SlowLog) latest(n int) []Entry {
+	if n < 0 || n > len(l.entries) {
+		n = len(l.entries)
+	}
+	ret := make([]Entry, 0, n)
+	for i := 1; i <= n; i++ {
+		ret = append(ret, l.entries[(l.next-i+len(l.entries))%len(l.entries)])
+	}
+	return ret
+}
+
+func (l *SlowLog) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
+
+// Reset removes all entries.
+func (l *SlowLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = nil
+	l.next = 0
+}
+
+// SLOWLOG GET [count] | LEN | RESET
+func (l *SlowLog) Command(commands []string) (string, bool) {
+	if len(commands) == 0 || !strings.EqualFold(commands[0], SlowLogCommand) {
+		return "", false
+	}
+
+	if len(commands) < 2 {
+		return messages.GetErrorString("ERR wrong number of arguments for command"), true
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "GET":
+		count := defaultCount
+		if len(args) > 1 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		} else if len(args) == 1 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < -1 {
+				return messages.GetErrorString("ERR count should be greater than or equal to -1"), true
+			}
+			count = n
+		}
+		ret := []messages.Message{}
+		for _, e := range l.Get(count) {
+			ret = append(ret, messages.NewArray([]messages.Message{
+				messages.NewInteger(e.ID),
+				messages.NewInteger(e.Time.Unix()),
+				messages.NewInteger(e.Duration.Microseconds()),
+				messages.NewArrayBulkString(e.Args),
+				messages.NewBulkString(e.Addr),
+				messages.NewBulkString(e.Name),
+			}))
+		}
+		return messages.NewArray(ret).Serialise(), true
+	case "LEN":
+		return messages.NewInteger(int64(l.Len())).Serialise(), true
+	case "RESET":
+		l.Reset()
+		return messages.NewSimpleString("OK").Serialise(), true
+	default:
+		return messages.GetErrorString("ERR unknown subcommand '" + commands[1] + "'. Try SLOWLOG HELP."), true
+	}
+}
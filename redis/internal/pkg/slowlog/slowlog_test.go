@@ -0,0 +1,77 @@
+package slowlog
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func TestLog(t *testing.T) {
+	l := New()
+	l.SetMaxLen(3)
+
+	l.Log([]string{"GET", "fast"}, time.Millisecond, "127.0.0.1:1000", "")
+	for i := range 4 {
+		l.Log([]string{"GET", strconv.Itoa(i)}, time.Second, "127.0.0.1:1000", "worker")
+	}
+
+	EqualO(t, l.Len(), 3)
+	entries := l.Get(-1)
+	EqualO(t, len(entries), 3)
+	// newest first, the oldest was dropped
+	Equal(t, []any{entries[0].Args, entries[2].Args}, []any{[]string{"GET", "3"}, []string{"GET", "1"}})
+	EqualO(t, entries[0].ID, int64(3))
+	EqualO(t, entries[0].Name, "worker")
+	EqualO(t, len(l.Get(2)), 2)
+
+	l.SetMaxLen(2)
+	entries = l.Get(-1)
+	EqualO(t, len(entries), 2)
+	EqualO(t, entries[0].ID, int64(3))
+	l.Log([]string{"GET", "4"}, time.Second, "", "")
+	EqualO(t, l.Get(1)[0].ID, int64(4))
+	EqualO(t, l.Len(), 2)
+
+	l.SetSlowerThan(-1)
+	l.Log([]string{"GET", "5"}, time.Hour, "", "")
+	EqualO(t, l.Get(1)[0].ID, int64(4))
+
+	l.Reset()
+	EqualO(t, l.Len(), 0)
+}
+
+func TestArgs(t *testing.T) {
+	EqualO(t, len(truncate(make([]string, 100))), maxArgs)
+	EqualO(t, truncate(make([]string, 100))[maxArgs-1], "... (69 more arguments)")
+	EqualO(t, truncate([]string{strings.Repeat("a", 130)})[0], strings.Repeat("a", 128)+"... (2 more bytes)")
+
+	Equal(t, []any{redact([]string{"AUTH", "user", "pass"})}, []any{[]string{"AUTH", "(redacted)", "(redacted)"}})
+	Equal(t, []any{redact([]string{"ACL", "SETUSER", "alice", "on", ">secret", "~*"})}, []any{[]string{"ACL", "SETUSER", "alice", "on", "(redacted)", "~*"}})
+}
+
+func TestCommand(t *testing.T) {
+	l := New()
+	l.Log([]string{"SET", "k", "v"}, 20*time.Millisecond, "127.0.0.1:1000", "worker")
+
+	reply, ok := l.Command([]string{"slowlog", "len"})
+	IsTrue(t, ok, "SLOWLOG should be handled")
+	EqualO(t, reply, messages.NewInteger(1).Serialise())
+
+	reply, _ = l.Command([]string{"SLOWLOG", "GET"})
+	IsTrue(t, strings.Contains(reply, ":20000\r\n*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n$14\r\n127.0.0.1:1000\r\n$6\r\nworker\r\n"), "reply=%q", reply)
+
+	reply, _ = l.Command([]string{"SLOWLOG", "GET", "-2"})
+	EqualO(t, reply, messages.GetErrorString("ERR count should be greater than or equal to -1"))
+
+	reply, _ = l.Command([]string{"SLOWLOG", "RESET"})
+	EqualO(t, reply, messages.NewSimpleString("OK").Serialise())
+	reply, _ = l.Command([]string{"SLOWLOG", "GET"})
+	EqualO(t, reply, "*0\r\n")
+
+	_, ok = l.Command([]string{"GET", "k"})
+	IsFalse(t, ok, "GET should not be handled")
+}
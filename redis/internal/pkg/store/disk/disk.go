@@ -2,13 +2,15 @@ package disk
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/rs/zerolog/log"
 )
 
 const (
-	dir      = "data/"
-	filepath = dir + "data.rdb"
+	// DefaultDir and DefaultFilename are where snapshots are saved, unless the dir and dbfilename parameters say otherwise.
+	DefaultDir      = "data"
+	DefaultFilename = "data.rdb"
 )
 
 func exists(path string) bool {
@@ -16,36 +18,47 @@ func exists(path string) bool {
 	return !os.IsNotExist(err)
 }
 
-// Saves data to disk.
-func Save(data []byte) error {
-	log.Info().Str("filepath", filepath).Msg("saving data to disk")
+// Path returns the path of the data file named filename in dir.
+func Path(dir, filename string) string {
+	return filepath.Join(dir, filename)
+}
+
+// DefaultPath returns the path of the data file, with the default dir and filename.
+func DefaultPath() string {
+	return Path(DefaultDir, DefaultFilename)
+}
+
+// Saves data to the file at path, creating its directory if needed.
+func Save(path string, data []byte) error {
+	log.Info().Str("filepath", path).Msg("saving data to disk")
 
+	dir := filepath.Dir(path)
 	// rwxrwxrwx
 	if !exists(dir) {
-		if err := os.Mkdir(dir, 0777); err != nil {
+		if err := os.MkdirAll(dir, 0777); err != nil {
 			log.Error().Err(err).Msg("failed to create data dir on disk")
 			return err
 		}
 	}
 	// rw-rw-rw
-	err := os.WriteFile(filepath, data, 0666)
+	err := os.WriteFile(path, data, 0666)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to save data to disk")
 	}
 	return err
 }
 
-// Loads data from disk.
+// Loads data from the file at path.
 // If the data file is not found, bytes returned is `nil`. Be sure to handle this case!
-func Load() ([]byte, error) {
-	log.Info().Str("filepath", filepath).Msg("loading data from disk")
+func Load(path string) ([]byte, error) {
+	log.Info().Str("filepath", path).Msg("loading data from disk")
 
-	if !exists(filepath) {
-		log.Info().Str("filepath", filepath).Msg("data does not exist on disk")
+	if !exists(path) {
+		log.Info().Str("filepath", path).Msg("data does not exist on disk")
 		return nil, nil
 	}
 
-	data, err := os.ReadFile(filepath)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to load data from disk")
 	}
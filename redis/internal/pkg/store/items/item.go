@@ -15,6 +15,9 @@ type Item interface {
 	LRange(start, stop int) ([]string, bool)
 	LLen() (int64, bool)
 
+	// MemoryUsage estimates the bytes used by the item.
+	MemoryUsage() int64
+
 	// Equal checks for equality.
 	// Should only be used for tests.
 	// It is NOT safe for concurrent use.
@@ -12,6 +12,8 @@ import (
 type List struct {
 	mu   sync.RWMutex
 	list *deque.Deque[string]
+	// size is the number of bytes in all elements, so that MemoryUsage is O(1).
+	size int64
 
 	*AbstractItem
 }
@@ -54,6 +56,7 @@ func DeserialiseList(b []byte) (*List, []byte, error) {
 func (l *List) LPush(strs []string) (int64, bool) {
 	for _, s := range strs {
 		l.list.PushFront(s)
+		l.size += int64(len(s))
 	}
 	return int64(l.list.Len()), true
 }
@@ -61,6 +64,7 @@ func (l *List) LPush(strs []string) (int64, bool) {
 func (l *List) RPush(strs []string) (int64, bool) {
 	for _, s := range strs {
 		l.list.PushBack(s)
+		l.size += int64(len(s))
 	}
 	return int64(l.list.Len()), true
 }
@@ -95,6 +99,16 @@ func (l *List) LLen() (int64, bool) {
 	return int64(l.list.Len()), true
 }
 
+// each element has a header, the deque has a header
+const (
+	listOverhead        = 64
+	listElementOverhead = 16
+)
+
+func (l *List) MemoryUsage() int64 {
+	return listOverhead + int64(l.list.Len())*listElementOverhead + l.size
+}
+
 func (l *List) Equal(other any) bool {
 	o, ok := other.(*List)
 	if !ok {
@@ -70,6 +70,19 @@ func (s *String) Serialise() []byte {
 	panic("ret.ActualType == stringUnknown")
 }
 
+// integers are stored in place of a pointer, strings have a header
+const stringOverhead = 16
+
+func (s *String) MemoryUsage() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.actualType == stringInteger {
+		return 8
+	}
+	return stringOverhead + int64(len(s.str))
+}
+
 func DeserialiseString(b []byte) (*String, []byte, error) {
 	// attempt with string, then integer
 
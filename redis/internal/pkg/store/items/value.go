@@ -2,6 +2,9 @@ package items
 
 import (
 	"bytes"
+	"math/rand"
+	"sync/atomic"
+	"time"
 
 	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
 )
@@ -9,35 +12,54 @@ import (
 type Value struct {
 	item  Item
 	delay *delay.Delay
+
+	// access is when the value was last accessed (unix nanoseconds), for LRU eviction.
+	access atomic.Int64
+	// lfu is the access frequency, for LFU eviction.
+	// The lowest 8 bits are a logarithmic counter, the rest is when the counter was last decremented (unix minutes).
+	lfu atomic.Uint64
+	// accounted is the memory usage the store has accounted for, it is guarded by the store.
+	accounted int64
 }
 
-func NewValue(item Item, delay *delay.Delay) *Value {
+// NewValue returns the value of the item, as if it was accessed now.
+func NewValue(item Item, delay *delay.Delay, now time.Time) *Value {
 	ret := &Value{
 		item:  item,
 		delay: delay,
 	}
+	ret.access.Store(now.UnixNano())
+	ret.lfu.Store(packLFU(now, lfuInitVal))
 
 	return ret
 }
 
-// Item returns item, hasExpired.
+// Item returns item, and false if it has expired by now.
 // The holder of the Value is responsible for taking note that this value has expired.
-func (v *Value) Item() (Item, bool) {
+func (v *Value) Item(now time.Time) (Item, bool) {
 	if v == nil {
 		return nil, false
 	}
-	if v.delay.HasExpired() {
+	if v.delay.HasExpired(now) {
 		return v.item, false
 	}
 	return v.item, true
 }
 
-func (v *Value) HasExpired() bool {
-	return v.delay.HasExpired()
+func (v *Value) HasExpired(now time.Time) bool {
+	return v.delay.HasExpired(now)
 }
 
-func (v *Value) SerialiseExpiry() []byte {
-	if v.delay.HasExpired() || v.delay == nil {
+// Expiry returns the expiry time of the value, and whether it has one at all.
+func (v *Value) Expiry() (time.Time, bool) {
+	if v.delay == nil {
+		return time.Time{}, false
+	}
+	return v.delay.Expiry(), true
+}
+
+func (v *Value) SerialiseExpiry(now time.Time) []byte {
+	if v.delay.HasExpired(now) || v.delay == nil {
 		// if no delay
 		return nil
 	}
@@ -65,3 +87,96 @@ func (v *Value) Equal(other any) bool {
 
 	return v.delay.Equal(o.delay) && v.item.Equal(o.item)
 }
+
+// same as the redis defaults (lfu-log-factor and lfu-decay-time)
+const (
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+	lfuDecayTime = time.Minute
+)
+
+func packLFU(decremented time.Time, counter uint8) uint64 {
+	return uint64(decremented.Unix()/60)<<8 | uint64(counter)
+}
+
+// freq returns the counter after decaying it, without storing it.
+func (v *Value) freq(now time.Time) uint8 {
+	lfu := v.lfu.Load()
+	counter := uint8(lfu & 0xff)
+	decremented := time.Unix(int64(lfu>>8)*60, 0)
+
+	periods := int64(now.Sub(decremented) / lfuDecayTime)
+	if periods >= int64(counter) {
+		return 0
+	}
+	return counter - uint8(max(periods, 0))
+}
+
+// Touch records an access to the value.
+func (v *Value) Touch(now time.Time) {
+	v.access.Store(now.UnixNano())
+
+	counter := v.freq(now)
+	// the counter is logarithmic: the greater it is, the less likely it is to be incremented
+	if counter < 255 {
+		base := max(float64(counter)-lfuInitVal, 0)
+		if rand.Float64() < 1/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	v.lfu.Store(packLFU(now, counter))
+}
+
+// IdleTime returns how long ago the value was last accessed.
+func (v *Value) IdleTime(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, v.access.Load()))
+}
+
+// Freq returns the logarithmic access frequency of the value (0 to 255).
+func (v *Value) Freq(now time.Time) uint8 {
+	return v.freq(now)
+}
+
+// SetIdleTime sets when the value was last accessed, as if it has been idle for d (e.g. RESTORE IDLETIME).
+func (v *Value) SetIdleTime(now time.Time, d time.Duration) {
+	v.access.Store(now.Add(-d).UnixNano())
+}
+
+// SetFreq sets the access frequency of the value (e.g. RESTORE FREQ).
+func (v *Value) SetFreq(now time.Time, freq uint8) {
+	v.lfu.Store(packLFU(now, freq))
+}
+
+// Inherit keeps the access frequency of the value that this value replaces.
+func (v *Value) Inherit(old *Value) {
+	v.lfu.Store(old.lfu.Load())
+}
+
+// overheads of a key in the keyspace, and of an expiry, roughly the same as redis
+const (
+	valueOverhead  = 56
+	expiryOverhead = 24
+)
+
+// MemoryUsage estimates the bytes used by the key and its value.
+func (v *Value) MemoryUsage(key string) int64 {
+	ret := valueOverhead + int64(len(key)) + v.item.MemoryUsage()
+	if v.delay != nil {
+		ret += expiryOverhead
+	}
+	return ret
+}
+
+// Account records the memory usage of the value, returning the change since it was last accounted.
+// It must only be called by the holder of the Value, with the holder's lock held.
+func (v *Value) Account(key string) int64 {
+	usage := v.MemoryUsage(key)
+	delta := usage - v.accounted
+	v.accounted = usage
+	return delta
+}
+
+// Accounted returns the memory usage that was last accounted.
+func (v *Value) Accounted() int64 {
+	return v.accounted
+}
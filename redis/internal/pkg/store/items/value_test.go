@@ -0,0 +1,63 @@
+package items
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+)
+
+func TestValueLFU(t *testing.T) {
+	now := time.Now()
+	v := NewValue(NewString("v"), nil, now)
+	EqualO(t, v.Freq(now), uint8(lfuInitVal))
+
+	for i := 0; i < 1000; i++ {
+		v.Touch(now)
+	}
+	freq := v.Freq(now)
+	// logarithmic: 1000 accesses are far from saturating the counter
+	IsTrue(t, freq > lfuInitVal && freq < 50, "freq=%d", freq)
+
+	// decays by one every period
+	EqualO(t, v.Freq(now.Add(3*lfuDecayTime)), freq-3)
+	EqualO(t, v.Freq(now.Add(1000*lfuDecayTime)), uint8(0))
+
+	// overwriting a value keeps its frequency
+	other := NewValue(NewString("v2"), nil, now)
+	other.Inherit(v)
+	EqualO(t, other.Freq(now), freq)
+}
+
+func TestValueIdleTime(t *testing.T) {
+	now := time.Now()
+	v := NewValue(NewString("v"), nil, now)
+
+	IsTrue(t, v.IdleTime(now.Add(time.Minute)) >= time.Minute, "")
+	v.Touch(now.Add(time.Minute))
+	IsTrue(t, v.IdleTime(now.Add(time.Minute)) == 0, "idle=%v", v.IdleTime(now.Add(time.Minute)))
+}
+
+func TestValueAccount(t *testing.T) {
+	l := NewList()
+	v := NewValue(l, nil, time.Now())
+
+	usage := v.Account("key")
+	EqualO(t, usage, v.MemoryUsage("key"))
+	EqualO(t, v.Account("key"), int64(0))
+
+	l.RPush([]string{"0123456789"})
+	EqualO(t, v.Account("key"), int64(listElementOverhead+10))
+	EqualO(t, v.Accounted(), usage+listElementOverhead+10)
+}
+
+func TestValueSetIdleTimeFreq(t *testing.T) {
+	now := time.Now()
+	v := NewValue(NewString("v"), nil, now)
+
+	v.SetIdleTime(now, time.Hour)
+	EqualO(t, v.IdleTime(now), time.Hour)
+	v.SetFreq(now, 100)
+	EqualO(t, v.Freq(now), uint8(100))
+	EqualO(t, v.Freq(now.Add(2*lfuDecayTime)), uint8(98))
+}
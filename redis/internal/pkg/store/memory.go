@@ -0,0 +1,306 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/latency"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+)
+
+// https://redis.io/docs/latest/develop/reference/eviction/
+
+type Policy string
+
+const (
+	NoEviction     Policy = "noeviction"
+	AllKeysLRU     Policy = "allkeys-lru"
+	AllKeysLFU     Policy = "allkeys-lfu"
+	AllKeysRandom  Policy = "allkeys-random"
+	VolatileLRU    Policy = "volatile-lru"
+	VolatileLFU    Policy = "volatile-lfu"
+	VolatileRandom Policy = "volatile-random"
+	VolatileTTL    Policy = "volatile-ttl"
+)
+
+var policies = []Policy{NoEviction, AllKeysLRU, AllKeysLFU, AllKeysRandom, VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL}
+
+func ParsePolicy(s string) (Policy, error) {
+	for _, p := range policies {
+		if strings.EqualFold(s, string(p)) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("unknown maxmemory policy %q", s)
+}
+
+// volatile policies only evict keys with an expiry.
+func (p Policy) volatile() bool {
+	return strings.HasPrefix(string(p), "volatile-")
+}
+
+// IsLFU returns whether the policy evicts the least frequently used keys.
+func (p Policy) IsLFU() bool {
+	return strings.HasSuffix(string(p), "-lfu")
+}
+
+// ParseMemory parses a number of bytes, with an optional unit (e.g. "100mb").
+func ParseMemory(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		bytes  int64
+	}{
+		// longer suffixes first, "b" is a suffix of all of them
+		{"kb", 1024}, {"mb", 1024 * 1024}, {"gb", 1024 * 1024 * 1024},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	lower := strings.ToLower(s)
+	multiplier := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower = strings.TrimSuffix(lower, u.suffix)
+			multiplier = u.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size %q", s)
+	}
+	return n * multiplier, nil
+}
+
+var OOMErr = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+const (
+	defaultSamples = 5
+	// same as redis
+	evictionPoolSize = 16
+)
+
+// candidate is a key that may be evicted, keys with greater scores are evicted first.
+type candidate struct {
+	key   string
+	score int64
+}
+
+// eviction is the eviction state of the store, it is guarded by the store's lock.
+type eviction struct {
+	// maxMemory is 0 for no limit.
+	maxMemory int64
+	policy    Policy
+	samples   int
+	// pool holds the best candidates seen so far, sorted by ascending score.
+	// Like redis, sampling a few keys at a time but keeping the best ones approximates the true LRU (or LFU) closely.
+	pool []candidate
+}
+
+func newEviction() eviction {
+	return eviction{
+		policy:  NoEviction,
+		samples: defaultSamples,
+	}
+}
+
+// SetMaxMemory sets the memory limit in bytes, 0 for no limit.
+func (s *Store) SetMaxMemory(maxMemory int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eviction.maxMemory = maxMemory
+}
+
+// MaxMemory returns the memory limit in bytes, 0 for no limit.
+func (s *Store) MaxMemory() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.eviction.maxMemory
+}
+
+// SetEvictionPolicy sets how keys are chosen for eviction.
+func (s *Store) SetEvictionPolicy(policy Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eviction.policy = policy
+	// scores are not comparable across policies
+	s.eviction.pool = nil
+}
+
+// SetEvictionSamples sets the number of keys sampled per eviction.
+func (s *Store) SetEvictionSamples(samples int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.eviction.samples = max(samples, 1)
+}
+
+// EvictionPolicy returns how keys are chosen for eviction.
+func (s *Store) EvictionPolicy() Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.eviction.policy
+}
+
+// UsedMemory returns the estimated memory usage of all keys.
+func (s *Store) UsedMemory() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.used
+}
+
+// UpdateUsage accounts for changes to the keys that were modified in place (e.g. LPUSH).
+func (s *Store) UpdateUsage(keys []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		if value, ok := s.values[key]; ok {
+			s.used += value.Account(key)
+		}
+	}
+}
+
+// Evict evicts keys until the memory usage is within the limit, returning the evicted keys.
+// It returns OOMErr if that is not possible.
+func (s *Store) Evict() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &s.eviction
+	if e.maxMemory == 0 || s.used <= e.maxMemory {
+		return nil, nil
+	}
+	if e.policy == NoEviction {
+		return nil, OOMErr
+	}
+
+	var evicted []string
+	start := time.Now()
+	defer func() {
+		s.latency.Load().Add(latency.EvictionCycle, time.Since(start))
+	}()
+	now := s.clock.Now()
+	for s.used > e.maxMemory {
+		key, ok := s.victim(now)
+		if !ok {
+			return evicted, OOMErr
+		}
+		s.delete(key)
+		s.stats.EvictedKeys.Add(1)
+		s.Notify(pubsub.Evicted, "evicted", key)
+		evicted = append(evicted, key)
+	}
+	return evicted, nil
+}
+
+// victim chooses the next key to evict, must be called with s.mu held.
+func (s *Store) victim(now time.Time) (string, bool) {
+	e := &s.eviction
+
+	// samples (roughly) random keys, map iteration starts at a random position
+	sample := func(f func(key string, value *items.Value) bool) {
+		n := 0
+		if e.policy.volatile() {
+			for key := range s.expirySet {
+				if value, ok := s.values[key]; ok && !f(key, value) {
+					return
+				}
+				if n++; n >= e.samples {
+					return
+				}
+			}
+			return
+		}
+		for key, value := range s.values {
+			if !f(key, value) {
+				return
+			}
+			if n++; n >= e.samples {
+				return
+			}
+		}
+	}
+
+	if e.policy == AllKeysRandom || e.policy == VolatileRandom {
+		var ret string
+		found := false
+		sample(func(key string, _ *items.Value) bool {
+			ret, found = key, true
+			return false
+		})
+		return ret, found
+	}
+
+	sample(func(key string, value *items.Value) bool {
+		e.insert(candidate{key, e.score(value, now)})
+		return true
+	})
+
+	// the best candidates are at the end, they may have been deleted (or replaced) since they were sampled
+	for len(e.pool) > 0 {
+		c := e.pool[len(e.pool)-1]
+		e.pool = e.pool[:len(e.pool)-1]
+		if value, ok := s.values[c.key]; ok && (!e.policy.volatile() || hasExpiry(value)) {
+			return c.key, true
+		}
+	}
+	return "", false
+}
+
+func hasExpiry(value *items.Value) bool {
+	_, ok := value.Expiry()
+	return ok
+}
+
+// score is greater for keys that should be evicted first.
+func (e *eviction) score(value *items.Value, now time.Time) int64 {
+	switch e.policy {
+	case AllKeysLFU, VolatileLFU:
+		return 255 - int64(value.Freq(now))
+	case VolatileTTL:
+		// keys that expire sooner are evicted first
+		expiry, _ := value.Expiry()
+		return -expiry.UnixMilli()
+	default:
+		return int64(value.IdleTime(now))
+	}
+}
+
+// insert adds the candidate to the pool, dropping the worst candidate if the pool is full.
+func (e *eviction) insert(c candidate) {
+	for i, p := range e.pool {
+		if p.key == c.key {
+			// the score may have changed
+			e.pool = append(e.pool[:i], e.pool[i+1:]...)
+			break
+		}
+	}
+
+	i := sort.Search(len(e.pool), func(i int) bool {
+		return e.pool[i].score >= c.score
+	})
+	if len(e.pool) >= evictionPoolSize {
+		if i == 0 {
+			// worse than everything in the pool
+			return
+		}
+		// drop the worst candidate to make space
+		e.pool = e.pool[1:]
+		i--
+	}
+	e.pool = append(e.pool, candidate{})
+	copy(e.pool[i+1:], e.pool[i:])
+	e.pool[i] = c
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
+)
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected int64
+		hasError bool
+	}{
+		{"0", 0, false},
+		{"100", 100, false},
+		{"100b", 100, false},
+		{"1k", 1000, false},
+		{"1kb", 1024, false},
+		{"100MB", 100 * 1024 * 1024, false},
+		{"2gb", 2 * 1024 * 1024 * 1024, false},
+		{"-1", 0, true},
+		{"mb", 0, true},
+		{"1tb", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			actual, err := ParseMemory(test.s)
+			if test.hasError {
+				HasError(t, err)
+			} else {
+				NoError(t, err)
+				EqualO(t, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	for _, p := range policies {
+		Equal(t, V(ParsePolicy(string(p))), V(p, nil))
+	}
+	_, err := ParsePolicy("allkeys-fifo")
+	HasError(t, err)
+}
+
+// total is the usage of all values, computed from scratch.
+func total(s *Store) int64 {
+	ret := int64(0)
+	for k, v := range s.values {
+		ret += v.MemoryUsage(k)
+	}
+	return ret
+}
+
+func TestUsedMemory(t *testing.T) {
+	s := newNoExpiry()
+	EqualO(t, s.UsedMemory(), int64(0))
+
+	s.Set("k1", items.NewString("v1"))
+	s.Set("k2", items.NewString("a longer value"))
+	s.SetWithDelay("k3", items.NewString("v3"), delay.NewDelay(time.Now().Add(time.Hour)))
+	EqualO(t, s.UsedMemory(), total(s))
+
+	// overwriting
+	s.Set("k1", items.NewString("another value"))
+	EqualO(t, s.UsedMemory(), total(s))
+
+	// modified in place
+	list := items.NewList()
+	s.Set("l", list)
+	list.RPush([]string{"a", "b", "c"})
+	s.UpdateUsage([]string{"l", "missing"})
+	EqualO(t, s.UsedMemory(), total(s))
+
+	s.DeleteMany([]string{"k1", "l"})
+	EqualO(t, s.UsedMemory(), total(s))
+
+	// expired keys are no longer counted
+	s.SetWithDelay("k4", items.NewString("v4"), delay.NewDelay(time.Now()))
+	s.cleanKeys()
+	EqualO(t, s.UsedMemory(), total(s))
+
+	s.LoadSnapshot(s.Snapshot())
+	EqualO(t, s.UsedMemory(), total(s))
+}
+
+func fill(s *Store, n int, withExpiry func(i int) bool) {
+	for i := 0; i < n; i++ {
+		key := strconv.Itoa(i)
+		if withExpiry(i) {
+			s.SetWithDelay(key, items.NewString("v"), delay.NewDelay(time.Now().Add(time.Duration(i+1)*time.Hour)))
+		} else {
+			s.Set(key, items.NewString("v"))
+		}
+	}
+}
+
+func never(int) bool {
+	return false
+}
+
+func TestEvictNoEviction(t *testing.T) {
+	s := newNoExpiry()
+	fill(s, 10, never)
+
+	s.SetMaxMemory(s.UsedMemory())
+	Equal(t, V(s.Evict()), V([]string(nil), nil))
+
+	s.SetMaxMemory(s.UsedMemory() - 1)
+	_, err := s.Evict()
+	IsTrue(t, err == OOMErr, "%v", err)
+	EqualO(t, len(s.values), 10)
+}
+
+func TestEvictLRU(t *testing.T) {
+	s := newNoExpiry()
+	fill(s, 100, never)
+
+	// recently used keys survive
+	time.Sleep(10 * time.Millisecond)
+	for i := 50; i < 100; i++ {
+		s.Get(strconv.Itoa(i))
+	}
+
+	s.SetEvictionPolicy(AllKeysLRU)
+	s.SetEvictionSamples(10)
+	s.SetMaxMemory(s.UsedMemory() / 2)
+	evicted, err := s.Evict()
+	NoError(t, err)
+	IsTrue(t, s.UsedMemory() <= s.eviction.maxMemory, "used=%d", s.UsedMemory())
+	EqualO(t, s.UsedMemory(), total(s))
+
+	// sampling is approximate, but most evicted keys should be old
+	old := 0
+	for _, key := range evicted {
+		if i, _ := strconv.Atoi(key); i < 50 {
+			old++
+		}
+	}
+	IsTrue(t, old > len(evicted)*3/4, "evicted %d old keys out of %d", old, len(evicted))
+}
+
+func TestEvictLFU(t *testing.T) {
+	s := newNoExpiry()
+	fill(s, 100, never)
+
+	for i := 50; i < 100; i++ {
+		for j := 0; j < 100; j++ {
+			s.Get(strconv.Itoa(i))
+		}
+	}
+
+	s.SetEvictionPolicy(AllKeysLFU)
+	s.SetEvictionSamples(10)
+	s.SetMaxMemory(s.UsedMemory() / 2)
+	evicted, err := s.Evict()
+	NoError(t, err)
+
+	rare := 0
+	for _, key := range evicted {
+		if i, _ := strconv.Atoi(key); i < 50 {
+			rare++
+		}
+	}
+	IsTrue(t, rare > len(evicted)*3/4, "evicted %d rarely used keys out of %d", rare, len(evicted))
+}
+
+func TestEvictVolatile(t *testing.T) {
+	isEven := func(i int) bool {
+		return i%2 == 0
+	}
+
+	for _, policy := range []Policy{VolatileLRU, VolatileLFU, VolatileRandom, VolatileTTL} {
+		t.Run(string(policy), func(t *testing.T) {
+			s := newNoExpiry()
+			fill(s, 20, isEven)
+			s.SetEvictionPolicy(policy)
+
+			s.SetMaxMemory(s.UsedMemory() * 3 / 4)
+			evicted, err := s.Evict()
+			NoError(t, err)
+			for _, key := range evicted {
+				i, _ := strconv.Atoi(key)
+				IsTrue(t, isEven(i), "evicted %s, which has no expiry", key)
+			}
+
+			// only keys without an expiry are left
+			s.SetMaxMemory(1)
+			_, err = s.Evict()
+			IsTrue(t, err == OOMErr, "%v", err)
+			EqualO(t, len(s.values), 10)
+		})
+	}
+}
+
+func TestEvictTTL(t *testing.T) {
+	s := newNoExpiry()
+	fill(s, 20, func(int) bool { return true })
+	s.SetEvictionPolicy(VolatileTTL)
+	s.SetEvictionSamples(20)
+
+	// keys that expire soonest go first
+	s.SetMaxMemory(s.UsedMemory() - 1)
+	Equal(t, V(s.Evict()), V([]string{"0"}, nil))
+}
+
+func TestEvictRandom(t *testing.T) {
+	s := newNoExpiry()
+	fill(s, 20, never)
+	s.SetEvictionPolicy(AllKeysRandom)
+
+	s.SetMaxMemory(1)
+	evicted, err := s.Evict()
+	NoError(t, err)
+	EqualO(t, len(evicted), 20)
+	EqualO(t, s.UsedMemory(), int64(0))
+}
@@ -15,6 +15,16 @@ const (
 	ValueList   ValueType = '1'
 )
 
+func (t ValueType) String() string {
+	switch t {
+	case ValueString:
+		return "string"
+	case ValueList:
+		return "list"
+	}
+	return "unknown"
+}
+
 func GetValueType(b byte) (ValueType, error) {
 	switch ValueType(b) {
 	case ValueString:
@@ -0,0 +1,88 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+)
+
+// A payload is a single serialised item, used to move keys between servers (e.g. DUMP, MIGRATE).
+// It is the value type, the value, the payload version (2 bytes, little endian), then a checksum of them; the expiry is sent separately.
+
+var InvalidPayloadErr = errors.New("DUMP payload version or checksum are wrong")
+
+// payloadVersion is bumped when the serialisation of items changes, older servers reject newer payloads.
+const payloadVersion uint16 = 1
+
+// DumpItem serialises a single item into a payload.
+func DumpItem(item items.Item) []byte {
+	buf := SaveBuffer{}
+	buf.WriteByte(byte(item.ValueType()))
+	buf.Write(item.Serialise())
+	buf.Write(binary.LittleEndian.AppendUint16(nil, payloadVersion))
+	buf.checksum()
+
+	return buf.Bytes()
+}
+
+// RestoreItem deserialises a payload made by `DumpItem`.
+func RestoreItem(payload []byte) (items.Item, error) {
+	buf := NewLoadBuffer(payload)
+
+	valueType, err := buf.valueType()
+	if err != nil {
+		return nil, InvalidPayloadErr
+	}
+	item, err := buf.value(valueType)
+	if err != nil {
+		return nil, InvalidPayloadErr
+	}
+	if !buf.version() || !buf.checksum() {
+		return nil, InvalidPayloadErr
+	}
+
+	return item, nil
+}
+
+// DumpFunctions serialises the function libraries into a payload, for FUNCTION DUMP.
+// It is the libraries, then a checksum.
+func DumpFunctions(codes []string) []byte {
+	buf := SaveBuffer{}
+	for _, code := range codes {
+		buf.function(code)
+	}
+	buf.checksum()
+
+	return buf.Bytes()
+}
+
+// RestoreFunctions deserialises a payload made by `DumpFunctions`.
+func RestoreFunctions(payload []byte) ([]string, error) {
+	buf := NewLoadBuffer(payload)
+
+	for {
+		found, err := buf.function()
+		if err != nil {
+			return nil, InvalidPayloadErr
+		}
+		if !found {
+			break
+		}
+	}
+	if !buf.checksum() {
+		return nil, InvalidPayloadErr
+	}
+
+	return buf.Functions(), nil
+}
+
+// version reads the payload version, returning whether it is one that we can restore.
+func (buf *LoadBuffer) version() bool {
+	if len(buf.b) < 2 {
+		return false
+	}
+	version := binary.LittleEndian.Uint16(buf.b)
+	buf.b = buf.b[2:]
+	return version <= payloadVersion
+}
@@ -3,6 +3,7 @@ package rdb
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
@@ -17,26 +18,36 @@ const redis = "REDIS"
 const version = "LITE" // intentionally not an integer to not collide with redis version numbers
 const magicString = redis + version
 
+// functionMarker starts a function library, they are saved before the keys.
+const functionMarker = "F5"
+
 type SaveBuffer struct {
 	bytes.Buffer
+	// Functions are the codes of the function libraries (see scripting), saved with the keys.
+	Functions []string
 }
 
 func (buf *SaveBuffer) header() {
 	buf.WriteString(magicString)
 }
 
-func (buf *SaveBuffer) value(k string, v *items.Value) {
-	item, ok := v.Item()
+func (buf *SaveBuffer) value(k string, v *items.Value, now time.Time) {
+	item, ok := v.Item(now)
 	if !ok {
 		return
 	}
 
-	buf.Write(v.SerialiseExpiry())
+	buf.Write(v.SerialiseExpiry(now))
 	buf.WriteByte(byte(item.ValueType()))
 	buf.Write(encoding.EncodeString(k))
 	buf.Write(item.Serialise())
 }
 
+func (buf *SaveBuffer) function(code string) {
+	buf.WriteString(functionMarker)
+	buf.Write(encoding.EncodeString(code))
+}
+
 func (buf *SaveBuffer) checksum() {
 	checksum := encoding.GenerateChecksum(buf.Bytes())
 	buf.Write(checksum)
@@ -46,12 +57,16 @@ func (buf *SaveBuffer) eof() {
 	buf.WriteString("FF")
 }
 
+// Save serialises the values that have not expired by now.
 // Make sure to lock the map!
-func (buf *SaveBuffer) Save(values map[string]*items.Value) []byte {
+func (buf *SaveBuffer) Save(values map[string]*items.Value, now time.Time) []byte {
 	buf.header()
 
+	for _, code := range buf.Functions {
+		buf.function(code)
+	}
 	for k, v := range values {
-		buf.value(k, v)
+		buf.value(k, v, now)
 	}
 
 	buf.eof()
@@ -60,30 +75,87 @@ func (buf *SaveBuffer) Save(values map[string]*items.Value) []byte {
 	return buf.Bytes()
 }
 
+// LoadError describes where in a snapshot loading failed.
+type LoadError struct {
+	// Offset is the byte offset (from the start of the snapshot) of the entry that failed to load.
+	Offset int
+	// Key is the key of the entry that failed to load, empty if the key itself could not be decoded.
+	Key string
+	Err error
+}
+
+func (e *LoadError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("offset %d (key %q): %v", e.Offset, e.Key, e.Err)
+}
+
+func (e *LoadError) Unwrap() error {
+	return e.Err
+}
+
+// Entry is a single key-value pair read from a snapshot.
+type Entry struct {
+	// Offset is the byte offset (from the start of the snapshot) where the entry starts.
+	Offset int
+	// Size is the number of bytes the entry takes up in the snapshot.
+	Size  int
+	Key   string
+	Type  encoding.ValueType
+	Value *items.Value
+}
+
 // zero value is NOT usable.
 type LoadBuffer struct {
 	b    []byte
 	full []byte
-	ret  map[string]*items.Value
+	// functions are the codes of the function libraries read so far.
+	functions []string
+	// now is when the loaded values were last accessed.
+	now time.Time
 }
 
 func NewLoadBuffer(b []byte) LoadBuffer {
 	return LoadBuffer{
 		full: b,
 		b:    b,
-		ret:  map[string]*items.Value{},
+		now:  time.Now(),
 	}
 }
 
+// offset is the number of bytes consumed so far.
+func (buf *LoadBuffer) offset() int {
+	return len(buf.full) - len(buf.b)
+}
+
 func (buf *LoadBuffer) header() error {
 	var found bool
 	buf.b, found = bytes.CutPrefix(buf.b, []byte(magicString))
 	if !found {
-		return errors.New("magic string not found")
+		return &LoadError{Offset: buf.offset(), Err: errors.New("magic string not found")}
 	}
 	return nil
 }
 
+// function reads a function library, if there is one next.
+func (buf *LoadBuffer) function() (bool, error) {
+	var found bool
+	var code string
+	var err error
+	start := buf.offset()
+	buf.b, found = bytes.CutPrefix(buf.b, []byte(functionMarker))
+	if !found {
+		return false, nil
+	}
+	code, buf.b, err = encoding.DecodeString(buf.b)
+	if err != nil {
+		return true, &LoadError{Offset: start, Err: fmt.Errorf("function library: %w", err)}
+	}
+	buf.functions = append(buf.functions, code)
+	return true, nil
+}
+
 func (buf *LoadBuffer) expiry() (*delay.Delay, error) {
 	var found bool
 	var usec int64
@@ -140,35 +212,50 @@ func (buf *LoadBuffer) value(valueType encoding.ValueType) (items.Item, error) {
 	return nil, errors.New("cannot deserialise value because value type is unknown")
 }
 
-func (buf *LoadBuffer) item() error {
+func (buf *LoadBuffer) item() (Entry, error) {
+	entry := Entry{Offset: buf.offset()}
+	fail := func(err error) (Entry, error) {
+		return entry, &LoadError{Offset: entry.Offset, Key: entry.Key, Err: err}
+	}
+
 	expiry, err := buf.expiry()
 	if err != nil {
-		return err
+		return fail(err)
 	}
-	valueType, err := buf.valueType()
+	entry.Type, err = buf.valueType()
 	if err != nil {
-		return err
+		return fail(err)
 	}
-	key, err := buf.key()
+	entry.Key, err = buf.key()
 	if err != nil {
-		return err
+		return fail(err)
 	}
-	value, err := buf.value(valueType)
+	value, err := buf.value(entry.Type)
 	if err != nil {
-		return err
+		return fail(err)
 	}
 
-	buf.ret[key] = items.NewValue(value, expiry)
+	entry.Value = items.NewValue(value, expiry, buf.now)
+	entry.Size = buf.offset() - entry.Offset
 
-	return nil
+	return entry, nil
 }
 
-func (buf *LoadBuffer) values() error {
+func (buf *LoadBuffer) values(f func(Entry) error) error {
 	for {
 		if done, err := buf.eof(); done {
 			return err
 		}
-		if err := buf.item(); err != nil {
+		if found, err := buf.function(); err != nil {
+			return err
+		} else if found {
+			continue
+		}
+		entry, err := buf.item()
+		if err != nil {
+			return err
+		}
+		if err := f(entry); err != nil {
 			return err
 		}
 	}
@@ -181,22 +268,45 @@ func (buf *LoadBuffer) checksum() bool {
 
 func (buf *LoadBuffer) eof() (done bool, err error) {
 	var found bool
+	start := buf.offset()
 	buf.b, found = bytes.CutPrefix(buf.b, []byte("FF"))
 	if found {
 		if !buf.checksum() {
-			return true, errors.New("checksum did not match")
+			return true, &LoadError{Offset: start, Err: errors.New("checksum did not match")}
 		}
 		return true, nil
 	}
+	if len(buf.b) == 0 {
+		return true, &LoadError{Offset: start, Err: errors.New("unexpected end of snapshot (missing EOF marker)")}
+	}
 	return false, nil
 }
 
-func (buf *LoadBuffer) Load() (map[string]*items.Value, error) {
+// Walk calls f for every entry in the snapshot, in the order they were saved.
+// Entries are passed to f as soon as they are decoded, so f may be called for some entries before the checksum is verified.
+// Errors from decoding are returned as a *LoadError; errors from f are returned as is.
+func (buf *LoadBuffer) Walk(f func(Entry) error) error {
 	if err := buf.header(); err != nil {
-		return nil, err
+		return err
 	}
-	if err := buf.values(); err != nil {
+	return buf.values(f)
+}
+
+// Functions returns the codes of the function libraries in the snapshot, once it has been walked (or loaded).
+func (buf *LoadBuffer) Functions() []string {
+	return buf.functions
+}
+
+// Load returns the values in the snapshot, as if they were last accessed now.
+func (buf *LoadBuffer) Load(now time.Time) (map[string]*items.Value, error) {
+	buf.now = now
+	ret := map[string]*items.Value{}
+	err := buf.Walk(func(e Entry) error {
+		ret[e.Key] = e.Value
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	return buf.ret, nil
+	return ret, nil
 }
@@ -2,54 +2,58 @@ package rdb
 
 import (
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
 
 	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb/encoding"
 )
 
 func TestSave(t *testing.T) {
 	buf1 := SaveBuffer{}
-	ret1 := buf1.Save(nil)
+	ret1 := buf1.Save(nil, time.Now())
 	IsTrue(t, ret1 != nil, "%+v", string(ret1))
 
 	buf2 := SaveBuffer{}
-	ret2 := buf2.Save(nil)
+	ret2 := buf2.Save(nil, time.Now())
 	IsTrue(t, ret2 != nil, "%+v", string(ret2))
 
 	buf3 := SaveBuffer{}
 	ret3 := buf3.Save(map[string]*items.Value{
-		"k1": items.NewValue(items.NewString("v1"), nil),
-		"k2": items.NewValue(items.NewString("v2"), nil),
-		"k3": items.NewValue(items.NewString("3"), nil),
-		"k4": items.NewValue(items.NewList(), nil),
-		"k5": items.NewValue(items.NewListBuilder().Add([]string{"1", "2", "3"}).Build(), nil),
-	})
+		"k1": items.NewValue(items.NewString("v1"), nil, time.Now()),
+		"k2": items.NewValue(items.NewString("v2"), nil, time.Now()),
+		"k3": items.NewValue(items.NewString("3"), nil, time.Now()),
+		"k4": items.NewValue(items.NewList(), nil, time.Now()),
+		"k5": items.NewValue(items.NewListBuilder().Add([]string{"1", "2", "3"}).Build(), nil, time.Now()),
+	}, time.Now())
 	IsTrue(t, ret3 != nil, "%+v", string(ret3))
 }
 
 func TestLoad(t *testing.T) {
 	buf1 := NewLoadBuffer(nil)
-	Equal(t, V(buf1.Load()), V(map[string]*items.Value(nil), AnyError{}))
+	Equal(t, V(buf1.Load(time.Now())), V(map[string]*items.Value(nil), AnyError{}))
 }
 
 func TestSaveLoad(t *testing.T) {
 	contents := []map[string]*items.Value{
 		{
-			"k1": items.NewValue(items.NewString("v1"), nil),
-			"k2": items.NewValue(items.NewString("v2"), nil),
-			"k3": items.NewValue(items.NewString("3"), nil),
-			"k4": items.NewValue(items.NewList(), nil),
-			"k5": items.NewValue(items.NewListBuilder().Add([]string{"1", "2", "3"}).Build(), nil),
+			"k1": items.NewValue(items.NewString("v1"), nil, time.Now()),
+			"k2": items.NewValue(items.NewString("v2"), nil, time.Now()),
+			"k3": items.NewValue(items.NewString("3"), nil, time.Now()),
+			"k4": items.NewValue(items.NewList(), nil, time.Now()),
+			"k5": items.NewValue(items.NewListBuilder().Add([]string{"1", "2", "3"}).Build(), nil, time.Now()),
 		},
 		{},
 	}
 
 	for _, content := range contents {
 		save := SaveBuffer{}
-		encoded := save.Save(content)
+		encoded := save.Save(content, time.Now())
 
 		load := NewLoadBuffer(encoded)
-		actual, err := load.Load()
+		actual, err := load.Load(time.Now())
 
 		EqualO(t, len(actual), len(content))
 		for k, v1 := range content {
@@ -61,3 +65,112 @@ func TestSaveLoad(t *testing.T) {
 		NoError(t, err)
 	}
 }
+
+func TestLoadError(t *testing.T) {
+	save := SaveBuffer{}
+	encoded := save.Save(map[string]*items.Value{
+		"k1": items.NewValue(items.NewString("v1"), nil, time.Now()),
+	}, time.Now())
+
+	t.Run("bad_checksum", func(t *testing.T) {
+		corrupted := append([]byte{}, encoded...)
+		corrupted[len(corrupted)-1]++
+
+		load := NewLoadBuffer(corrupted)
+		_, err := load.Load(time.Now())
+
+		loadErr, ok := err.(*LoadError)
+		IsTrue(t, ok, "err=%v", err)
+		// "FF" comes after the header and the only entry
+		EqualO(t, loadErr.Offset, len(magicString)+1+3+3)
+	})
+
+	t.Run("truncated_value", func(t *testing.T) {
+		// cut off in the middle of the value of "k1"
+		load := NewLoadBuffer(encoded[:len(magicString)+1+3+2])
+		_, err := load.Load(time.Now())
+
+		loadErr, ok := err.(*LoadError)
+		IsTrue(t, ok, "err=%v", err)
+		EqualO(t, loadErr.Offset, len(magicString))
+		EqualO(t, loadErr.Key, "k1")
+	})
+
+	t.Run("bad_header", func(t *testing.T) {
+		load := NewLoadBuffer([]byte("REDIS0011"))
+		_, err := load.Load(time.Now())
+
+		loadErr, ok := err.(*LoadError)
+		IsTrue(t, ok, "err=%v", err)
+		EqualO(t, loadErr.Offset, 0)
+	})
+}
+
+func TestDumpRestoreItem(t *testing.T) {
+	tests := []items.Item{
+		items.NewString("v1"),
+		items.NewString("3"),
+		items.NewList(),
+		items.NewListBuilder().Add([]string{"1", "2", "3"}).Build(),
+	}
+
+	for _, item := range tests {
+		payload := DumpItem(item)
+		actual, err := RestoreItem(payload)
+		NoError(t, err)
+		IsTrue(t, item.Equal(actual), "expected %+v, but got %+v", item, actual)
+
+		// corrupted payloads are rejected
+		payload[len(payload)-1]++
+		_, err = RestoreItem(payload)
+		HasError(t, err)
+	}
+
+	_, err := RestoreItem(nil)
+	HasError(t, err)
+
+	// payloads from newer versions are rejected, even with a valid checksum
+	buf := SaveBuffer{}
+	buf.WriteByte(byte(encoding.ValueString))
+	buf.Write(items.NewString("v").Serialise())
+	buf.Write([]byte{byte(payloadVersion + 1), 0})
+	buf.checksum()
+	_, err = RestoreItem(buf.Bytes())
+	Equal(t, V(err), V(InvalidPayloadErr), cmpopts.EquateErrors())
+}
+
+func TestSaveLoadFunctions(t *testing.T) {
+	codes := []string{"#!lua name=a\nredis.register_function('f', function() end)", "#!lua name=b\n"}
+	save := SaveBuffer{Functions: codes}
+	encoded := save.Save(map[string]*items.Value{
+		"k1": items.NewValue(items.NewString("v1"), nil, time.Now()),
+	}, time.Now())
+
+	load := NewLoadBuffer(encoded)
+	actual, err := load.Load(time.Now())
+	NoError(t, err)
+	EqualO(t, len(actual), 1)
+	EqualO(t, load.Functions(), codes)
+
+	// the functions are not entries
+	walk := NewLoadBuffer(encoded)
+	n := 0
+	NoError(t, walk.Walk(func(Entry) error {
+		n++
+		return nil
+	}))
+	EqualO(t, n, 1)
+}
+
+func TestDumpRestoreFunctions(t *testing.T) {
+	codes := []string{"a", "b"}
+	payload := DumpFunctions(codes)
+	Equal(t, V(RestoreFunctions(payload)), V(codes, nil))
+	Equal(t, V(RestoreFunctions(DumpFunctions(nil))), V([]string(nil), nil))
+
+	payload[len(payload)-1]++
+	_, err := RestoreFunctions(payload)
+	HasError(t, err)
+	_, err = RestoreFunctions(DumpItem(items.NewString("v")))
+	HasError(t, err)
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"sync/atomic"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/metrics"
+)
+
+// Stats are counters of what happened to keys, since the server started (or CONFIG RESETSTAT).
+type Stats struct {
+	ExpiredKeys    atomic.Int64
+	EvictedKeys    atomic.Int64
+	KeyspaceHits   atomic.Int64
+	KeyspaceMisses atomic.Int64
+
+	// ExpiryCycles times the sweeps of active expiry.
+	ExpiryCycles metrics.Histogram
+	// Saves and Loads time saving the store to, and loading it from, disk.
+	Saves metrics.Histogram
+	Loads metrics.Histogram
+}
+
+// Reset sets all counters to 0.
+func (s *Stats) Reset() {
+	s.ExpiredKeys.Store(0)
+	s.EvictedKeys.Store(0)
+	s.KeyspaceHits.Store(0)
+	s.KeyspaceMisses.Store(0)
+	s.ExpiryCycles.Reset()
+	s.Saves.Reset()
+	s.Loads.Reset()
+}
+
+// Stats returns the counters of the store.
+func (s *Store) Stats() *Stats {
+	return &s.stats
+}
@@ -3,8 +3,12 @@ package store
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/clock"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/latency"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/disk"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
@@ -17,10 +21,52 @@ type Store struct {
 	ctxCancel context.CancelFunc
 	values    map[string]*items.Value
 	expirySet map[string]struct{}
+	// clock tells the time for expiries, access times and snapshots (but not for latencies).
+	clock clock.Clock
+
+	// used is the estimated memory usage of all values.
+	used     int64
+	eviction eviction
+
+	notifier pubsub.Notifier
+	// invalidator is an Invalidator, or nil unless clients track the keys that they cache.
+	invalidator atomic.Value
+	stats       Stats
+	// path is the file (a string) that the store is saved to and loaded from, see `SetPath`.
+	path atomic.Value
+	// lastSave is when the store was last saved to disk (or created), and lastSaveOK is whether that save succeeded.
+	lastSave   atomic.Int64
+	lastSaveOK atomic.Bool
+	// latency is nil unless the latencies of expiry cycles, evictions, saves and loads are monitored.
+	latency atomic.Pointer[latency.Monitor]
+
+	// functions are saved and loaded with the keys, they are guarded by mu.
+	// Until they are set, the libraries loaded from a snapshot are kept in libraries.
+	functions Functions
+	libraries []string
+}
+
+// Functions are the function libraries (see scripting), which are saved in snapshots with the keys.
+type Functions interface {
+	// Libraries returns the code of every library.
+	Libraries() []string
+	// LoadLibraries replaces the libraries with the codes, or returns an error (and keeps them) if any of them are invalid.
+	LoadLibraries(codes []string) error
+}
+
+// Invalidator is told about the keys that the store modifies by itself (when they expire or are evicted), see tracking.
+type Invalidator interface {
+	InvalidateKey(key string)
 }
 
 func New() *Store {
+	return NewWithClock(clock.Real())
+}
+
+// NewWithClock constructs a store whose keys expire by the time of c.
+func NewWithClock(c clock.Clock) *Store {
 	ret := newNoExpiry()
+	ret.clock = c
 
 	go ret.activeExpiry(ret.cleanKeys)
 
@@ -37,26 +83,108 @@ func newNoExpiry() *Store {
 		ctxCancel: cancelFunc,
 		values:    make(map[string]*items.Value),
 		expirySet: make(map[string]struct{}),
+		clock:     clock.Real(),
+		eviction:  newEviction(),
 	}
+	ret.path.Store(disk.DefaultPath())
+	ret.lastSave.Store(ret.clock.Now().Unix())
+	ret.lastSaveOK.Store(true)
 
 	return ret
 }
 
+// Now returns the time of the store's clock, which expiries are relative to.
+func (s *Store) Now() time.Time {
+	return s.clock.Now()
+}
+
 func (s *Store) Get(key string) (items.Item, bool) {
+	value, ok := s.getValue(key, true)
+	if !ok {
+		return nil, false
+	}
+	item, _ := value.Item(s.clock.Now())
+	return item, true
+}
+
+// GetValue is like `Get`, but also returns the expiry of the key.
+func (s *Store) GetValue(key string) (*items.Value, bool) {
+	return s.getValue(key, true)
+}
+
+// Peek is like `GetValue`, but it does not count as an access (for LRU/LFU eviction).
+func (s *Store) Peek(key string) (*items.Value, bool) {
+	return s.getValue(key, false)
+}
+
+func (s *Store) getValue(key string, touch bool) (*items.Value, bool) {
+	value, ok := s.lookup(key)
+	// only accesses count as hits or misses
+	switch {
+	case !touch:
+	case ok:
+		s.stats.KeyspaceHits.Add(1)
+		value.Touch(s.clock.Now())
+	default:
+		s.stats.KeyspaceMisses.Add(1)
+	}
+	return value, ok
+}
+
+// lookup returns the value, deleting it if it has expired.
+func (s *Store) lookup(key string) (*items.Value, bool) {
 	// allows some race condition, but no data races
 	s.mu.RLock()
 	value := s.values[key]
 	s.mu.RUnlock()
-	item, ok := value.Item()
-	if !ok {
+	if value == nil {
+		return nil, false
+	}
+	if value.HasExpired(s.clock.Now()) {
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		delete(s.values, key)
-		delete(s.expirySet, key)
+		// the key may have been set again in the meantime
+		if s.values[key] == value {
+			s.delete(key)
+			s.stats.ExpiredKeys.Add(1)
+			s.Notify(pubsub.Expired, "expired", key)
+		}
 		return nil, false
 	}
+	return value, true
+}
+
+// Exists returns whether the key exists (and has not expired).
+func (s *Store) Exists(key string) bool {
+	_, ok := s.getValue(key, false)
+	return ok
+}
+
+// delete removes the key, must be called with s.mu held.
+func (s *Store) delete(key string) bool {
+	value, ok := s.values[key]
+	if !ok {
+		return false
+	}
+	s.used -= value.Accounted()
+	delete(s.values, key)
+	delete(s.expirySet, key)
+	return true
+}
 
-	return item, ok
+// Keys returns all keys that have not expired, in no particular order.
+func (s *Store) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	ret := make([]string, 0, len(s.values))
+	for k, v := range s.values {
+		if !v.HasExpired(now) {
+			ret = append(ret, k)
+		}
+	}
+	return ret
 }
 
 func (s *Store) Set(key string, item items.Item) error {
@@ -67,7 +195,15 @@ func (s *Store) SetWithDelay(key string, item items.Item, delay *delay.Delay) er
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.values[key] = items.NewValue(item, delay)
+	value := items.NewValue(item, delay, s.clock.Now())
+	if old, ok := s.values[key]; ok {
+		value.Inherit(old)
+		s.delete(key)
+	} else {
+		s.Notify(pubsub.NewKey, "new", key)
+	}
+	s.values[key] = value
+	s.used += value.Account(key)
 	if delay != nil {
 		s.expirySet[key] = struct{}{}
 	}
@@ -76,53 +212,172 @@ func (s *Store) SetWithDelay(key string, item items.Item, delay *delay.Delay) er
 }
 
 // Deletes the specified keys from the store.
-// Returns the number of keys deleted.
-func (s *Store) DeleteMany(keys []string) int64 {
+// Returns the keys that were deleted.
+func (s *Store) DeleteMany(keys []string) []string {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	count := int64(0)
+	deleted := []string{}
 
 	for _, key := range keys {
-		if _, has := s.values[key]; !has {
-			continue
+		if s.delete(key) {
+			deleted = append(deleted, key)
 		}
-		delete(s.values, key)
-		count++
 	}
 
-	return count
+	return deleted
+}
+
+// Notifier returns the notifier for keyspace events.
+func (s *Store) Notifier() *pubsub.Notifier {
+	return &s.notifier
+}
+
+// SetInvalidator tells i about the keys that expire or are evicted.
+func (s *Store) SetInvalidator(i Invalidator) {
+	s.invalidator.Store(i)
+}
+
+// Notify publishes a keyspace event for the key, see `pubsub.Notifier`.
+func (s *Store) Notify(class pubsub.Class, event, key string) {
+	s.notifier.Notify(class, event, key)
+	if class&(pubsub.Expired|pubsub.Evicted) != 0 {
+		if i, ok := s.invalidator.Load().(Invalidator); ok {
+			i.InvalidateKey(key)
+		}
+	}
 }
 
 // LoadFromDisk **overrides** the values in `store` with the values loaded from disk.
 // This method should only be called on application startup / recovery!
 func (s *Store) LoadFromDisk() error {
+	start := time.Now()
+	data, err := disk.Load(s.Path())
+	if data == nil || err != nil {
+		return err
+	}
+
+	err = s.LoadSnapshot(data)
+	if err == nil {
+		d := time.Since(start)
+		s.stats.Loads.Observe(d)
+		s.latency.Load().Add(latency.Load, d)
+	}
+	return err
+}
+
+// SetFunctions saves the function libraries in snapshots, and loads the libraries of the snapshot that was loaded (if any) into f.
+func (s *Store) SetFunctions(f Functions) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data, err := disk.Load()
-	if data == nil || err != nil {
-		return err
+	if s.libraries != nil {
+		if err := f.LoadLibraries(s.libraries); err != nil {
+			return err
+		}
+		s.libraries = nil
 	}
+	s.functions = f
+	return nil
+}
 
+// LoadSnapshot **overrides** the values in `store` (and the function libraries) with the values in the snapshot.
+func (s *Store) LoadSnapshot(data []byte) error {
 	buf := rdb.NewLoadBuffer(data)
-	values, err := buf.Load()
+	values, err := buf.Load(s.clock.Now())
 	if err != nil {
 		return err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.functions == nil {
+		s.libraries = buf.Functions()
+	} else if err := s.functions.LoadLibraries(buf.Functions()); err != nil {
+		return err
+	}
+
 	// overrides existing values!
 	s.values = values
+	s.expirySet = make(map[string]struct{})
+	s.used = 0
+	for k, v := range values {
+		if _, ok := v.Expiry(); ok {
+			s.expirySet[k] = struct{}{}
+		}
+		s.used += v.Account(k)
+	}
 
 	return nil
 }
 
+// SetPath sets the file that the store is saved to (and loaded from), so that stores in the same process do not share it.
+func (s *Store) SetPath(path string) {
+	s.path.Store(path)
+}
+
+// Path returns the file that the store is saved to, see `SetPath`.
+func (s *Store) Path() string {
+	return s.path.Load().(string)
+}
+
 func (s *Store) SaveToDisk() error {
+	start := time.Now()
+	err := disk.Save(s.Path(), s.Snapshot())
+	s.lastSaveOK.Store(err == nil)
+	if err == nil {
+		s.lastSave.Store(s.clock.Now().Unix())
+		d := time.Since(start)
+		s.stats.Saves.Observe(d)
+		s.latency.Load().Add(latency.Save, d)
+	}
+	return err
+}
+
+// SetLatencyMonitor records the latencies of expiry cycles, evictions, saves and loads in m.
+func (s *Store) SetLatencyMonitor(m *latency.Monitor) {
+	s.latency.Store(m)
+}
+
+// LastSave returns when the store was last successfully saved to disk (or created, if it has not been), and whether the most recent save succeeded.
+func (s *Store) LastSave() (time.Time, bool) {
+	return time.Unix(s.lastSave.Load(), 0), s.lastSaveOK.Load()
+}
+
+// Keyspace returns the number of keys, and of keys with an expiry.
+// Keys that have expired, but have not been cleaned yet, are counted.
+func (s *Store) Keyspace() (int, int) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.values), len(s.expirySet)
+}
+
+// TypeCounts returns the number of keys of each type (e.g. "string").
+func (s *Store) TypeCounts() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.clock.Now()
+	ret := map[string]int{}
+	for _, v := range s.values {
+		item, _ := v.Item(now)
+		ret[item.ValueType().String()]++
+	}
+	return ret
+}
+
+// Snapshot serialises the whole store.
+func (s *Store) Snapshot() []byte {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	data := (&rdb.SaveBuffer{}).Save(s.values)
-	return disk.Save(data)
+	buf := &rdb.SaveBuffer{Functions: s.libraries}
+	if s.functions != nil {
+		buf.Functions = s.functions.Libraries()
+	}
+	return buf.Save(s.values, s.clock.Now())
 }
 
 // activeExpiry must be run from a goroutine when the store is constructed.
@@ -144,9 +399,16 @@ func (s *Store) activeExpiry(cleanFunc func()) {
 const cleanKeysQuantity = 20
 
 func (s *Store) cleanKeys() {
+	start := time.Now()
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	defer func() {
+		s.mu.Unlock()
+		d := time.Since(start)
+		s.stats.ExpiryCycles.Observe(d)
+		s.latency.Load().Add(latency.ExpireCycle, d)
+	}()
+
+	now := s.clock.Now()
 	for {
 		iterations := min(len(s.expirySet), cleanKeysQuantity)
 		expiryCount := 0
@@ -165,10 +427,11 @@ func (s *Store) cleanKeys() {
 				// key has been removed in a previous iteration
 				continue
 			}
-			if value.HasExpired() {
+			if value.HasExpired(now) {
 				expiryCount++
-				delete(s.values, key)
-				delete(s.expirySet, key)
+				s.delete(key)
+				s.stats.ExpiredKeys.Add(1)
+				s.Notify(pubsub.Expired, "expired", key)
 			}
 		}
 
@@ -179,35 +442,8 @@ func (s *Store) cleanKeys() {
 	}
 }
 
-// Stops the store, ensuring it can be garbage collected.
-// Stores shouldn't need to be cancelled in production! (only really needed for tests)
-func (s *Store) stop() {
+// Close stops the store (its active expiry), ensuring it can be garbage collected.
+// Stores shouldn't need to be closed in production! (only really needed for tests and embedded servers)
+func (s *Store) Close() {
 	s.ctxCancel()
 }
-
-var (
-	store *Store
-	once  sync.Once
-	mu    sync.Mutex
-)
-
-func GetSingleton() *Store {
-	once.Do(func() {
-		ResetSingleton()
-	})
-
-	return store
-}
-
-// ResetSingleton should only be used in tests.
-func ResetSingleton() *Store {
-	mu.Lock()
-	defer mu.Unlock()
-
-	if store != nil {
-		store.stop()
-	}
-
-	store = New()
-	return store
-}
@@ -2,11 +2,16 @@ package store
 
 import (
 	"strconv"
+	"strings"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/clock"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/rdb"
 	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
 )
 
@@ -94,33 +99,22 @@ func TestStoreGetSetConcurrent(t *testing.T) {
 func TestStoreSetDelay(t *testing.T) {
 	t.Parallel()
 
-	var key string
-	var value string
-	var actual string
+	clk := clock.NewFake(time.Now())
+	store := NewWithClock(clk)
+	defer store.Close()
 
-	store := New()
+	store.SetWithDelay("key", items.NewString("value"), delay.NewDelay(clk.Now().Add(50*time.Millisecond)))
+	item, ok := store.Get("key")
+	IsTrue(t, ok, "expected to get the value before expiry")
+	Equal(t, V(item.Get()), V("value", true))
 
-	key = "key"
-	value = "value"
+	clk.Add(50 * time.Millisecond)
+	_, ok = store.Get("key")
+	IsTrue(t, ok, "expected the value at its expiry")
 
-	store.SetWithDelay(key, items.NewString(value), delay.NewDelay(time.Now().Add(50*time.Millisecond)))
-	item, ok := store.Get(key)
-	if !ok {
-		t.Errorf("expected to get the value before expiry")
-	}
-	actual, ok = item.Get()
-	if !ok {
-		t.Errorf("expected to get the value before expiry")
-	}
-	if actual != value {
-		t.Errorf("expected %q, but got %q", value, actual)
-	}
-
-	time.Sleep(50 * time.Millisecond)
-	_, ok = store.Get(key)
-	if ok {
-		t.Errorf("expected to key to have expired")
-	}
+	clk.Add(time.Millisecond)
+	_, ok = store.Get("key")
+	IsFalse(t, ok, "expected the key to have expired")
 }
 
 func TestStoreExpiryTrigger(t *testing.T) {
@@ -138,7 +132,7 @@ func TestStoreExpiryTrigger(t *testing.T) {
 	})
 
 	time.Sleep(time.Second)
-	store.stop()
+	store.Close()
 
 	actual := result.Load()
 	if actual < 9 || actual > 11 {
@@ -178,6 +172,69 @@ func TestStoreCleanKeys(t *testing.T) {
 	// }
 }
 
+// subscribe makes the store publish events of the classes, returning a subscriber to all of them.
+func subscribe(s *Store, classes pubsub.Class) *pubsub.Subscriber {
+	ps := pubsub.New()
+	sub := pubsub.NewSubscriber()
+	ps.PSubscribe(sub, []string{"__keyevent@0__:*"})
+	s.Notifier().SetPubSub(ps)
+	s.Notifier().SetClasses(pubsub.Keyevent | classes)
+	return sub
+}
+
+// events returns the events (and their keys) that have been published to sub.
+func events(sub *pubsub.Subscriber) []string {
+	ret := []string{}
+	for {
+		select {
+		case m := <-sub.Messages():
+			// *4 $8 pmessage $len pattern $len channel $len key
+			parts := strings.Split(m, "\r\n")
+			ret = append(ret, strings.TrimPrefix(parts[6], "__keyevent@0__:")+" "+parts[8])
+		default:
+			return ret
+		}
+	}
+}
+
+func TestStoreNotify(t *testing.T) {
+	store := newNoExpiry()
+	sub := subscribe(store, pubsub.All|pubsub.NewKey)
+	inv := &fakeInvalidator{}
+	store.SetInvalidator(inv)
+
+	store.Set("k1", items.NewString("v"))
+	store.Set("k1", items.NewString("v"))
+	store.SetWithDelay("k2", items.NewString("v"), delay.NewDelay(time.Now()))
+	store.SetWithDelay("k3", items.NewString("v"), delay.NewDelay(time.Now()))
+	EqualO(t, events(sub), []string{"new k1", "new k2", "new k3"})
+
+	// lazily
+	_, ok := store.Get("k2")
+	IsFalse(t, ok, "")
+	EqualO(t, events(sub), []string{"expired k2"})
+
+	// actively
+	store.cleanKeys()
+	EqualO(t, events(sub), []string{"expired k3"})
+
+	store.SetEvictionPolicy(AllKeysRandom)
+	store.SetMaxMemory(1)
+	store.Evict()
+	EqualO(t, events(sub), []string{"evicted k1"})
+
+	// only the keys that the store modifies by itself are invalidated
+	EqualO(t, inv.keys, []string{"k2", "k3", "k1"})
+}
+
+type fakeInvalidator struct {
+	keys []string
+}
+
+func (i *fakeInvalidator) InvalidateKey(key string) {
+	i.keys = append(i.keys, key)
+}
+
 func TestMapRandomness(t *testing.T) {
 	t.Skip("not an actual test")
 
@@ -196,3 +253,91 @@ func TestMapRandomness(t *testing.T) {
 	// forces Logf logs to be printed
 	t.Fail()
 }
+
+func TestStoreStats(t *testing.T) {
+	store := newNoExpiry()
+	store.Set("k", items.NewString("v"))
+	store.SetWithDelay("expired", items.NewString("v"), delay.NewDelay(time.Now()))
+
+	store.Get("k")
+	store.Get("missing")
+	store.Get("expired")
+	// peeks are not accesses
+	store.Peek("k")
+
+	stats := store.Stats()
+	EqualO(t, stats.KeyspaceHits.Load(), int64(1))
+	EqualO(t, stats.KeyspaceMisses.Load(), int64(2))
+	EqualO(t, stats.ExpiredKeys.Load(), int64(1))
+
+	store.cleanKeys()
+	EqualO(t, stats.ExpiryCycles.Count(), int64(1))
+
+	stats.Reset()
+	EqualO(t, stats.KeyspaceHits.Load(), int64(0))
+	EqualO(t, stats.ExpiredKeys.Load(), int64(0))
+	EqualO(t, stats.ExpiryCycles.Count(), int64(0))
+}
+
+func TestTypeCounts(t *testing.T) {
+	store := newNoExpiry()
+	store.Set("a", items.NewString("v"))
+	store.Set("b", items.NewString("v"))
+	store.Set("l", items.NewList())
+
+	EqualO(t, store.TypeCounts(), map[string]int{"string": 2, "list": 1})
+}
+
+func TestStoreClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2024, time.May, 2, 0, 0, 0, 0, time.UTC))
+	store := newNoExpiry()
+	store.clock = clk
+	store.Set("k", items.NewString("v"))
+	store.SetWithDelay("expiring", items.NewString("v"), delay.NewDelay(clk.Now().Add(time.Hour)))
+
+	clk.Add(2 * time.Hour)
+	EqualO(t, store.Keys(), []string{"k"})
+	buf := rdb.NewLoadBuffer(store.Snapshot())
+	values, err := buf.Load(time.Now())
+	NoError(t, err)
+	EqualO(t, len(values), 1)
+
+	store.cleanKeys()
+	EqualO(t, store.Stats().ExpiredKeys.Load(), int64(1))
+}
+
+// fakeFunctions keeps the libraries it is given.
+type fakeFunctions struct {
+	libraries []string
+}
+
+func (f *fakeFunctions) Libraries() []string {
+	return f.libraries
+}
+
+func (f *fakeFunctions) LoadLibraries(codes []string) error {
+	f.libraries = codes
+	return nil
+}
+
+func TestStoreFunctions(t *testing.T) {
+	store := newNoExpiry()
+	store.Set("k", items.NewString("v"))
+	store.SetFunctions(&fakeFunctions{libraries: []string{"#!lua name=a"}})
+	snapshot := store.Snapshot()
+
+	// the libraries are kept until there is something to load them into
+	other := newNoExpiry()
+	NoError(t, other.LoadSnapshot(snapshot))
+	buf := rdb.NewLoadBuffer(other.Snapshot())
+	_, err := buf.Load(time.Now())
+	NoError(t, err)
+	EqualO(t, buf.Functions(), []string{"#!lua name=a"})
+
+	f := &fakeFunctions{}
+	NoError(t, other.SetFunctions(f))
+	EqualO(t, f.libraries, []string{"#!lua name=a"})
+
+	NoError(t, other.LoadSnapshot(New().Snapshot()))
+	EqualO(t, f.libraries, []string(nil))
+}
@@ -0,0 +1,207 @@
+// Package tlsconfig builds the TLS configuration of the server from redis-style settings, and reloads its certificates.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// AuthClients is whether clients must present a certificate (tls-auth-clients).
+type AuthClients string
+
+const (
+	AuthClientsYes      AuthClients = "yes"
+	AuthClientsNo       AuthClients = "no"
+	AuthClientsOptional AuthClients = "optional"
+)
+
+// ParseAuthClients parses tls-auth-clients (yes, no or optional).
+func ParseAuthClients(s string) (AuthClients, error) {
+	switch a := AuthClients(strings.ToLower(s)); a {
+	case AuthClientsYes, AuthClientsNo, AuthClientsOptional:
+		return a, nil
+	default:
+		return "", fmt.Errorf("invalid tls-auth-clients %q, must be one of yes, no, optional", s)
+	}
+}
+
+func (a AuthClients) clientAuth() tls.ClientAuthType {
+	switch a {
+	case AuthClientsNo:
+		return tls.NoClientCert
+	case AuthClientsOptional:
+		return tls.VerifyClientCertIfGiven
+	default:
+		// like redis, clients are verified unless told otherwise
+		return tls.RequireAndVerifyClientCert
+	}
+}
+
+var protocols = map[string]uint16{
+	"TLSV1.2": tls.VersionTLS12,
+	"TLSV1.3": tls.VersionTLS13,
+}
+
+// ParseProtocols parses tls-protocols (e.g. "TLSv1.2 TLSv1.3"), returning the minimum and maximum versions.
+// An empty string allows TLSv1.2 and TLSv1.3.
+func ParseProtocols(s string) (uint16, uint16, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return tls.VersionTLS12, tls.VersionTLS13, nil
+	}
+
+	minVersion, maxVersion := uint16(0), uint16(0)
+	for _, field := range fields {
+		version, ok := protocols[strings.ToUpper(field)]
+		if !ok {
+			return 0, 0, fmt.Errorf("invalid tls-protocols %q, only TLSv1.2 and TLSv1.3 are supported", field)
+		}
+		if minVersion == 0 || version < minVersion {
+			minVersion = version
+		}
+		maxVersion = max(maxVersion, version)
+	}
+	return minVersion, maxVersion, nil
+}
+
+// ParseCiphers parses tls-ciphers, a colon-separated list of cipher suite names (e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256").
+// These only apply to TLSv1.2, as the TLSv1.3 cipher suites are not configurable.
+// An empty string uses Go's defaults.
+func ParseCiphers(s string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	byName := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		byName[suite.Name] = suite.ID
+	}
+
+	ret := []uint16{}
+	for _, name := range strings.Split(s, ":") {
+		id, ok := byName[strings.ToUpper(name)]
+		if !ok {
+			return nil, fmt.Errorf("invalid tls-ciphers %q, unknown or insecure cipher suite", name)
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
+// Config are the TLS settings, like redis' tls-* settings.
+type Config struct {
+	CertFile string
+	KeyFile  string
+	// CAFile has the certificates that client certificates are verified against, it is required unless AuthClients is no.
+	CAFile      string
+	AuthClients AuthClients
+	// Protocols and Ciphers are parsed with ParseProtocols and ParseCiphers.
+	Protocols string
+	Ciphers   string
+}
+
+// build reads the files, and returns the TLS config.
+func (c Config) build() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading certificate: %w", err)
+	}
+
+	authClients := c.AuthClients
+	if authClients == "" {
+		authClients = AuthClientsYes
+	}
+	var pool *x509.CertPool
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("loading CA: no certificates in %s", c.CAFile)
+		}
+	} else if authClients != AuthClientsNo {
+		return nil, errors.New("tls-ca-cert-file is required to verify client certificates, unless tls-auth-clients is no")
+	}
+
+	minVersion, maxVersion, err := ParseProtocols(c.Protocols)
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := ParseCiphers(c.Ciphers)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   authClients.clientAuth(),
+		ClientCAs:    pool,
+		MinVersion:   minVersion,
+		MaxVersion:   maxVersion,
+		CipherSuites: ciphers,
+	}, nil
+}
+
+// Reloader holds the TLS config, which can be reloaded without affecting existing connections.
+type Reloader struct {
+	// mu serialises Set, so that config and current are from the same call.
+	mu      sync.Mutex
+	config  atomic.Pointer[Config]
+	current atomic.Pointer[tls.Config]
+}
+
+// New reads the files, returning an error if they (or the settings) are invalid.
+func New(config Config) (*Reloader, error) {
+	r := &Reloader{}
+	if err := r.Set(config); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Set replaces the settings, and reloads the files.
+// If anything is invalid, the previous settings are kept.
+func (r *Reloader) Set(config Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := config.build()
+	if err != nil {
+		return err
+	}
+
+	r.config.Store(&config)
+	r.current.Store(current)
+	return nil
+}
+
+// Config returns the current settings.
+func (r *Reloader) Config() Config {
+	return *r.config.Load()
+}
+
+// Reload reads the files again (e.g. after the certificates are renewed).
+// If they are invalid, the previous certificates are kept.
+func (r *Reloader) Reload() error {
+	return r.Set(r.Config())
+}
+
+// TLSConfig returns the config for a listener, which uses the most recently loaded certificates for each new connection.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
@@ -0,0 +1,139 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/tlsconfig/tlstest"
+)
+
+func TestParse(t *testing.T) {
+	a, err := ParseAuthClients("Optional")
+	NoError(t, err)
+	EqualO(t, a, AuthClientsOptional)
+	_, err = ParseAuthClients("maybe")
+	HasError(t, err)
+
+	minVersion, maxVersion, err := ParseProtocols("")
+	NoError(t, err)
+	EqualO(t, minVersion, uint16(tls.VersionTLS12))
+	EqualO(t, maxVersion, uint16(tls.VersionTLS13))
+	minVersion, maxVersion, err = ParseProtocols("tlsv1.3")
+	NoError(t, err)
+	EqualO(t, minVersion, uint16(tls.VersionTLS13))
+	EqualO(t, maxVersion, uint16(tls.VersionTLS13))
+	_, _, err = ParseProtocols("TLSv1.0")
+	HasError(t, err)
+
+	ciphers, err := ParseCiphers("TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:tls_ecdhe_ecdsa_with_aes_256_gcm_sha384")
+	NoError(t, err)
+	EqualO(t, ciphers, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384})
+	_, err = ParseCiphers("TLS_RSA_WITH_RC4_128_SHA")
+	HasError(t, err)
+}
+
+// handshake connects to a listener with the config, returning the common name of the server's certificate.
+func handshake(t *testing.T, r *Reloader, client *tls.Config) (string, error) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", r.TLSConfig())
+	NoError(t, err)
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(*tls.Conn).Handshake()
+		// waits for the client to hang up
+		conn.Read(make([]byte, 1))
+	}()
+
+	conn, err := tls.Dial("tcp", l.Addr().String(), client)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	// with TLSv1.3, a rejected client certificate is only noticed on the next read
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !isTimeout(err) {
+		return "", err
+	}
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, nil
+}
+
+func TestAuthClients(t *testing.T) {
+	files := tlstest.Generate(t, "server")
+	config := Config{CertFile: files.ServerCert, KeyFile: files.ServerKey, CAFile: files.CACert}
+
+	tests := []struct {
+		authClients AuthClients
+		withCert    bool
+		ok          bool
+	}{
+		{AuthClientsYes, true, true},
+		{AuthClientsYes, false, false},
+		{AuthClientsOptional, true, true},
+		{AuthClientsOptional, false, true},
+		{AuthClientsNo, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.authClients), func(t *testing.T) {
+			config.AuthClients = test.authClients
+			r, err := New(config)
+			NoError(t, err)
+
+			_, err = handshake(t, r, files.ClientConfig(t, test.withCert))
+			EqualO(t, err == nil, test.ok)
+		})
+	}
+
+	_, err := New(Config{CertFile: files.ServerCert, KeyFile: files.ServerKey})
+	HasError(t, err)
+	_, err = New(Config{CertFile: files.ServerCert, KeyFile: files.ServerKey, AuthClients: AuthClientsNo})
+	NoError(t, err)
+}
+
+func TestReload(t *testing.T) {
+	files := tlstest.Generate(t, "old")
+	r, err := New(Config{CertFile: files.ServerCert, KeyFile: files.ServerKey, CAFile: files.CACert})
+	NoError(t, err)
+
+	name, err := handshake(t, r, files.ClientConfig(t, true))
+	NoError(t, err)
+	EqualO(t, name, "old")
+
+	// renews the certificates in place
+	renewed := tlstest.Generate(t, "new")
+	for from, to := range map[string]string{
+		renewed.CACert:     files.CACert,
+		renewed.ServerCert: files.ServerCert,
+		renewed.ServerKey:  files.ServerKey,
+	} {
+		data, err := os.ReadFile(from)
+		NoError(t, err)
+		NoError(t, os.WriteFile(to, data, 0o600))
+	}
+	NoError(t, r.Reload())
+
+	name, err = handshake(t, r, renewed.ClientConfig(t, true))
+	NoError(t, err)
+	EqualO(t, name, "new")
+
+	// invalid files keep the previous certificates
+	NoError(t, os.WriteFile(files.ServerKey, []byte("garbage"), 0o600))
+	HasError(t, r.Reload())
+	name, err = handshake(t, r, renewed.ClientConfig(t, true))
+	NoError(t, err)
+	EqualO(t, name, "new")
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
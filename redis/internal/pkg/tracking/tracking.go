@@ -0,0 +1,423 @@
+// Package tracking implements client-side caching: CLIENT TRACKING, and the invalidation messages for the keys that clients cache.
+package tracking
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+// https://redis.io/docs/latest/develop/reference/client-side-caching/
+
+// InvalidateChannel is the channel that RESP2 clients subscribe to, to be sent the invalidations of the clients that redirect to them.
+const InvalidateChannel = "__redis__:invalidate"
+
+var okReply = messages.NewSimpleString("OK").Serialise()
+
+// options are the options of CLIENT TRACKING ON.
+type options struct {
+	// redirect is the ID of the client that is sent the invalidations, 0 for the client itself.
+	redirect int64
+	bcast    bool
+	prefixes []string
+	optIn    bool
+	optOut   bool
+	noLoop   bool
+}
+
+type tracked struct {
+	client *client.Client
+	options
+	// caching is set by CLIENT CACHING, for the next command only.
+	caching bool
+	// keys are the keys that the client may cache, in the default mode.
+	keys map[string]struct{}
+}
+
+// Tracking keeps track of the keys that clients cache. To construct one, use `New`.
+type Tracking struct {
+	clients *client.Registry
+	pubsub  *pubsub.PubSub
+
+	mu      sync.Mutex
+	tracked map[int64]*tracked
+	// keys are the clients (by ID) that may cache each key, in the default mode.
+	// It is the inverse of the keys of the tracked clients, which are removed when they stop tracking.
+	keys map[string]map[int64]struct{}
+}
+
+// New constructs a Tracking whose clients may redirect their invalidations to the clients in reg,
+// RESP2 clients are sent them while they are subscribed to InvalidateChannel in ps.
+func New(reg *client.Registry, ps *pubsub.PubSub) *Tracking {
+	return &Tracking{
+		clients: reg,
+		pubsub:  ps,
+		tracked: make(map[int64]*tracked),
+		keys:    make(map[string]map[int64]struct{}),
+	}
+}
+
+// Command handles the subcommands of CLIENT for tracking: TRACKING, CACHING, GETREDIR and TRACKINGINFO.
+func (t *Tracking) Command(c *client.Client, commands []string) (string, bool) {
+	if len(commands) < 2 || !strings.EqualFold(commands[0], client.ClientCommand) {
+		return "", false
+	}
+
+	args := commands[2:]
+	switch strings.ToUpper(commands[1]) {
+	case "TRACKING":
+		return t.tracking(c, args), true
+	case "CACHING":
+		return t.setCaching(c, args), true
+	case "GETREDIR":
+		if len(args) != 0 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if tr, ok := t.tracked[c.ID]; ok {
+			return messages.NewInteger(tr.redirect).Serialise(), true
+		}
+		return messages.NewInteger(-1).Serialise(), true
+	case "TRACKINGINFO":
+		if len(args) != 0 {
+			return messages.GetErrorString("ERR wrong number of arguments for command"), true
+		}
+		return t.info(c), true
+	}
+	return "", false
+}
+
+// CLIENT TRACKING ON|OFF [REDIRECT client-id] [PREFIX prefix [PREFIX prefix ...]] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func (t *Tracking) tracking(c *client.Client, args []string) string {
+	if len(args) == 0 {
+		return messages.GetErrorString("ERR wrong number of arguments for command")
+	}
+
+	var on bool
+	switch strings.ToUpper(args[0]) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		return messages.GetErrorString("ERR syntax error")
+	}
+
+	var opts options
+	for i := 1; i < len(args); i++ {
+		hasValue := i+1 < len(args)
+		switch strings.ToUpper(args[i]) {
+		case "REDIRECT":
+			if !hasValue {
+				return messages.GetErrorString("ERR syntax error")
+			}
+			i++
+			id, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return messages.GetErrorString("ERR value is not an integer or out of range")
+			}
+			if id != c.ID && t.clients.Get(id) == nil {
+				return messages.GetErrorString("ERR The client ID you want redirect to does not exist")
+			}
+			opts.redirect = id
+		case "PREFIX":
+			if !hasValue {
+				return messages.GetErrorString("ERR syntax error")
+			}
+			i++
+			opts.prefixes = append(opts.prefixes, args[i])
+		case "BCAST":
+			opts.bcast = true
+		case "OPTIN":
+			opts.optIn = true
+		case "OPTOUT":
+			opts.optOut = true
+		case "NOLOOP":
+			opts.noLoop = true
+		default:
+			return messages.GetErrorString("ERR syntax error")
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !on {
+		t.remove(c)
+		c.Tracking = false
+		return okReply
+	}
+
+	if len(opts.prefixes) > 0 && !opts.bcast {
+		return messages.GetErrorString("ERR PREFIX option requires BCAST mode to be enabled")
+	}
+	if opts.optIn && opts.optOut {
+		return messages.GetErrorString("ERR You can't use both OPTIN and OPTOUT")
+	}
+	if opts.bcast && (opts.optIn || opts.optOut) {
+		return messages.GetErrorString("ERR OPTIN and OPTOUT are not compatible with BCAST")
+	}
+
+	keys := make(map[string]struct{})
+	prev, ok := t.tracked[c.ID]
+	if ok {
+		if prev.bcast != opts.bcast {
+			return messages.GetErrorString("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+		}
+		if prev.optIn != opts.optIn || prev.optOut != opts.optOut {
+			return messages.GetErrorString("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+		}
+		// like redis, the prefixes are added to the previous ones
+		opts.prefixes = append(slices.Clone(prev.prefixes), opts.prefixes...)
+		keys = prev.keys
+	}
+	if err := checkPrefixes(opts.prefixes); err != "" {
+		return err
+	}
+
+	t.tracked[c.ID] = &tracked{client: c, options: opts, keys: keys}
+	c.Tracking = true
+	return okReply
+}
+
+// checkPrefixes returns the error reply if any of the prefixes overlap, like redis.
+func checkPrefixes(prefixes []string) string {
+	for i, a := range prefixes {
+		for _, b := range prefixes[i+1:] {
+			if a != b && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a)) {
+				return messages.GetErrorString("ERR Prefix '" + b + "' overlaps with an existing prefix '" + a + "'. Prefixes for a single client must not overlap.")
+			}
+		}
+	}
+	return ""
+}
+
+// CLIENT CACHING YES|NO
+func (t *Tracking) setCaching(c *client.Client, args []string) string {
+	if len(args) != 1 {
+		return messages.GetErrorString("ERR wrong number of arguments for command")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tr, ok := t.tracked[c.ID]
+	if !ok || !(tr.optIn || tr.optOut) {
+		return messages.GetErrorString("ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled")
+	}
+	switch strings.ToUpper(args[0]) {
+	case "YES":
+		if !tr.optIn {
+			return messages.GetErrorString("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+		}
+	case "NO":
+		if !tr.optOut {
+			return messages.GetErrorString("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+		}
+	default:
+		return messages.GetErrorString("ERR syntax error")
+	}
+	tr.caching = true
+	return okReply
+}
+
+// CLIENT TRACKINGINFO
+func (t *Tracking) info(c *client.Client) string {
+	t.mu.Lock()
+	tr, ok := t.tracked[c.ID]
+	var opts options
+	var caching bool
+	if ok {
+		opts, caching = tr.options, tr.caching
+	}
+	t.mu.Unlock()
+
+	flags := []messages.Message{}
+	redirect := int64(-1)
+	if !ok {
+		flags = append(flags, messages.NewBulkString("off"))
+	} else {
+		flags = append(flags, messages.NewBulkString("on"))
+		redirect = opts.redirect
+		switch {
+		case opts.bcast:
+			flags = append(flags, messages.NewBulkString("bcast"))
+		case opts.optIn:
+			flags = append(flags, messages.NewBulkString("optin"))
+			if caching {
+				flags = append(flags, messages.NewBulkString("caching-yes"))
+			}
+		case opts.optOut:
+			flags = append(flags, messages.NewBulkString("optout"))
+			if caching {
+				flags = append(flags, messages.NewBulkString("caching-no"))
+			}
+		}
+		if opts.noLoop {
+			flags = append(flags, messages.NewBulkString("noloop"))
+		}
+		if redirect != 0 && redirect != c.ID && t.clients.Get(redirect) == nil {
+			flags = append(flags, messages.NewBulkString("broken_redirect"))
+		}
+	}
+	prefixes := []messages.Message{}
+	for _, p := range opts.prefixes {
+		prefixes = append(prefixes, messages.NewBulkString(p))
+	}
+
+	pairs := []messages.Message{
+		messages.NewBulkString("flags"), messages.NewArray(flags),
+		messages.NewBulkString("redirect"), messages.NewInteger(redirect),
+		messages.NewBulkString("prefixes"), messages.NewArray(prefixes),
+	}
+	if c.Resp() == 3 {
+		return messages.NewMap(pairs).Serialise()
+	}
+	return messages.NewArray(pairs).Serialise()
+}
+
+// Track is called before the client's command runs, with the keys that it reads.
+// In the default mode, the keys are remembered so that the client is sent their invalidations,
+// including those of writes that run concurrently with the read.
+func (t *Tracking) Track(c *client.Client, commands []string, keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tr, ok := t.tracked[c.ID]
+	if !ok {
+		return
+	}
+
+	if !tr.bcast && (!(tr.optIn || tr.optOut) || tr.optIn == tr.caching) {
+		// OPTIN clients only cache after CLIENT CACHING YES, and OPTOUT clients unless after CLIENT CACHING NO
+		for _, key := range keys {
+			if t.keys[key] == nil {
+				t.keys[key] = make(map[int64]struct{})
+			}
+			t.keys[key][c.ID] = struct{}{}
+			tr.keys[key] = struct{}{}
+		}
+	}
+	if len(commands) < 2 || !strings.EqualFold(commands[0], client.ClientCommand) || !strings.EqualFold(commands[1], "CACHING") {
+		tr.caching = false
+	}
+}
+
+// Invalidate sends the invalidations of the keys, which the writer modified, to the clients that may cache them.
+// writer is nil if the store modified the keys by itself (e.g. when they expire).
+// It never blocks, so it may be called while holding the store's lock.
+func (t *Tracking) Invalidate(writer *client.Client, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	invalidated := make(map[*tracked][]string)
+	for _, key := range keys {
+		for id := range t.keys[key] {
+			tr := t.tracked[id]
+			delete(tr.keys, key)
+			invalidated[tr] = append(invalidated[tr], key)
+		}
+		delete(t.keys, key)
+
+		for _, tr := range t.tracked {
+			if tr.bcast && matchesPrefix(tr.prefixes, key) {
+				invalidated[tr] = append(invalidated[tr], key)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	for tr, keys := range invalidated {
+		if tr.noLoop && tr.client == writer {
+			continue
+		}
+		t.send(tr, keys)
+	}
+}
+
+// InvalidateKey sends the invalidation of the key, which the store modified by itself, see `store.Invalidator`.
+func (t *Tracking) InvalidateKey(key string) {
+	t.Invalidate(nil, []string{key})
+}
+
+// matchesPrefix returns whether the key has any of the prefixes, where no prefixes match every key.
+func matchesPrefix(prefixes []string, key string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends the invalidation to the client, or to the client that it redirects to, like redis:
+// RESP3 clients are sent a push message, and RESP2 clients (that are redirected to) a message on InvalidateChannel if they are subscribed.
+func (t *Tracking) send(tr *tracked, keys []string) {
+	target := tr.client
+	if tr.redirect != 0 && tr.redirect != tr.client.ID {
+		target = t.clients.Get(tr.redirect)
+		if target == nil {
+			if tr.client.Resp() == 3 && tr.client.Sub != nil {
+				tr.client.Sub.Send(messages.NewPush([]messages.Message{
+					messages.NewBulkString("tracking-redir-broken"),
+					messages.NewInteger(tr.redirect),
+				}).Serialise())
+			}
+			return
+		}
+	}
+	if target.Sub == nil {
+		return
+	}
+
+	invalidated := make([]messages.Message, len(keys))
+	for i, key := range keys {
+		invalidated[i] = messages.NewBulkString(key)
+	}
+	switch {
+	case target.Resp() == 3:
+		target.Sub.Send(messages.NewPush([]messages.Message{
+			messages.NewBulkString("invalidate"),
+			messages.NewArray(invalidated),
+		}).Serialise())
+	case target != tr.client && t.pubsub.Subscribed(target.Sub, InvalidateChannel):
+		target.Sub.Send(messages.NewArray([]messages.Message{
+			messages.NewBulkString("message"),
+			messages.NewBulkString(InvalidateChannel),
+			messages.NewArray(invalidated),
+		}).Serialise())
+	}
+}
+
+// Remove stops tracking the client, when it disconnects.
+func (t *Tracking) Remove(c *client.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remove(c)
+}
+
+// remove forgets the client and the keys that it may cache, it must be called with t.mu held.
+func (t *Tracking) remove(c *client.Client) {
+	tr, ok := t.tracked[c.ID]
+	if !ok {
+		return
+	}
+	for key := range tr.keys {
+		delete(t.keys[key], c.ID)
+		if len(t.keys[key]) == 0 {
+			delete(t.keys, key)
+		}
+	}
+	delete(t.tracked, c.ID)
+}
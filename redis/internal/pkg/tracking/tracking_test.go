@@ -0,0 +1,218 @@
+package tracking
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/client"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/pubsub"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/messages"
+)
+
+func newClient(t *testing.T, reg *client.Registry, resp int) *client.Client {
+	t.Helper()
+
+	c := client.New("")
+	c.Sub = pubsub.NewSubscriber()
+	c.SetResp(resp)
+	reg.Add(c)
+	return c
+}
+
+func command(t *testing.T, tr *Tracking, c *client.Client, command string) string {
+	t.Helper()
+
+	reply, ok := tr.Command(c, strings.Split(command, " "))
+	IsTrue(t, ok, "%s should be handled", command)
+	return reply
+}
+
+// pending returns the messages that were sent to the client.
+func pending(c *client.Client) []string {
+	ret := []string{}
+	for len(c.Sub.Messages()) > 0 {
+		ret = append(ret, <-c.Sub.Messages())
+	}
+	return ret
+}
+
+func invalidation(keys ...string) string {
+	invalidated := []messages.Message{}
+	for _, key := range keys {
+		invalidated = append(invalidated, messages.NewBulkString(key))
+	}
+	return messages.NewPush([]messages.Message{messages.NewBulkString("invalidate"), messages.NewArray(invalidated)}).Serialise()
+}
+
+func TestTrackingCommand(t *testing.T) {
+	reg := client.NewRegistry()
+	tr := New(reg, pubsub.New())
+	c := newClient(t, reg, 2)
+	ok := messages.NewSimpleString("OK").Serialise()
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+	}{
+		{"prefix", "CLIENT TRACKING ON PREFIX a", "-ERR PREFIX option requires BCAST mode to be enabled\r\n"},
+		{"optin_optout", "CLIENT TRACKING ON OPTIN OPTOUT", "-ERR You can't use both OPTIN and OPTOUT\r\n"},
+		{"bcast_optin", "CLIENT TRACKING ON BCAST OPTIN", "-ERR OPTIN and OPTOUT are not compatible with BCAST\r\n"},
+		{"redirect", "CLIENT TRACKING ON REDIRECT 999999", "-ERR The client ID you want redirect to does not exist\r\n"},
+		{"overlap", "CLIENT TRACKING ON BCAST PREFIX a PREFIX ab", "-ERR Prefix 'ab' overlaps with an existing prefix 'a'. Prefixes for a single client must not overlap.\r\n"},
+		{"syntax", "CLIENT TRACKING MAYBE", "-ERR syntax error\r\n"},
+		{"unknown", "CLIENT TRACKING ON NOPE", "-ERR syntax error\r\n"},
+		{"caching_off", "CLIENT CACHING YES", "-ERR CLIENT CACHING can be called only when the client is in tracking mode with OPTIN or OPTOUT mode enabled\r\n"},
+		{"getredir_off", "CLIENT GETREDIR", ":-1\r\n"},
+		{"info_off", "CLIENT TRACKINGINFO", "*6\r\n$5\r\nflags\r\n*1\r\n$3\r\noff\r\n$8\r\nredirect\r\n:-1\r\n$8\r\nprefixes\r\n*0\r\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			EqualO(t, command(t, tr, c, test.command), test.expected)
+		})
+	}
+	IsFalse(t, c.Tracking, "invalid options should not enable tracking")
+
+	EqualO(t, command(t, tr, c, "CLIENT TRACKING ON OPTIN NOLOOP"), ok)
+	IsTrue(t, c.Tracking, "tracking should be enabled")
+	EqualO(t, command(t, tr, c, "CLIENT GETREDIR"), ":0\r\n")
+	EqualO(t, command(t, tr, c, "CLIENT CACHING NO"), "-ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.\r\n")
+	EqualO(t, command(t, tr, c, "CLIENT CACHING YES"), ok)
+	c.SetResp(3)
+	EqualO(t, command(t, tr, c, "CLIENT TRACKINGINFO"), "%3\r\n$5\r\nflags\r\n*4\r\n$2\r\non\r\n$5\r\noptin\r\n$11\r\ncaching-yes\r\n$6\r\nnoloop\r\n$8\r\nredirect\r\n:0\r\n$8\r\nprefixes\r\n*0\r\n")
+	EqualO(t, command(t, tr, c, "CLIENT TRACKING ON BCAST"), "-ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.\r\n")
+	EqualO(t, command(t, tr, c, "CLIENT TRACKING OFF"), ok)
+	IsFalse(t, c.Tracking, "tracking should be disabled")
+
+	EqualO(t, command(t, tr, c, "CLIENT TRACKING ON BCAST PREFIX a"), ok)
+	// prefixes are added to the previous ones
+	EqualO(t, command(t, tr, c, "CLIENT TRACKING ON BCAST PREFIX b"), ok)
+	EqualO(t, command(t, tr, c, "CLIENT TRACKING ON BCAST PREFIX bc"), "-ERR Prefix 'bc' overlaps with an existing prefix 'b'. Prefixes for a single client must not overlap.\r\n")
+
+	_, handled := tr.Command(c, []string{"CLIENT", "ID"})
+	IsFalse(t, handled, "CLIENT ID should not be handled")
+}
+
+func TestInvalidate(t *testing.T) {
+	reg := client.NewRegistry()
+	tr := New(reg, pubsub.New())
+	c := newClient(t, reg, 3)
+	writer := newClient(t, reg, 2)
+	command(t, tr, c, "CLIENT TRACKING ON")
+
+	tr.Track(c, []string{"GET", "k"}, []string{"k"})
+	tr.Invalidate(writer, []string{"k", "other"})
+	EqualO(t, pending(c), []string{invalidation("k")})
+	// the key is only invalidated once, until it is read again
+	tr.Invalidate(writer, []string{"k"})
+	EqualO(t, pending(c), []string{})
+
+	// NOLOOP clients are not sent the invalidations of their own writes
+	command(t, tr, c, "CLIENT TRACKING ON NOLOOP")
+	tr.Track(c, []string{"GET", "k"}, []string{"k"})
+	tr.Invalidate(c, []string{"k"})
+	EqualO(t, pending(c), []string{})
+
+	// expired and evicted keys have no writer
+	tr.Track(c, []string{"GET", "k"}, []string{"k"})
+	tr.InvalidateKey("k")
+	EqualO(t, pending(c), []string{invalidation("k")})
+
+	// keys are forgotten when tracking is disabled
+	tr.Track(c, []string{"GET", "k"}, []string{"k"})
+	command(t, tr, c, "CLIENT TRACKING OFF")
+	EqualO(t, len(tr.keys), 0)
+	tr.Invalidate(writer, []string{"k"})
+	EqualO(t, pending(c), []string{})
+
+	// RESP2 clients without a redirect are not sent invalidations
+	command(t, tr, writer, "CLIENT TRACKING ON")
+	tr.Track(writer, []string{"GET", "k"}, []string{"k"})
+	tr.Invalidate(c, []string{"k"})
+	EqualO(t, pending(writer), []string{})
+
+	// and when the client disconnects
+	tr.Track(writer, []string{"MGET", "k", "other"}, []string{"k", "other"})
+	tr.Remove(writer)
+	EqualO(t, len(tr.keys), 0)
+}
+
+func TestInvalidateModes(t *testing.T) {
+	reg := client.NewRegistry()
+	tr := New(reg, pubsub.New())
+	c := newClient(t, reg, 3)
+
+	t.Run("bcast", func(t *testing.T) {
+		command(t, tr, c, "CLIENT TRACKING ON BCAST PREFIX user: PREFIX post:")
+		tr.Invalidate(nil, []string{"user:1", "other", "post:2"})
+		EqualO(t, pending(c), []string{invalidation("user:1", "post:2")})
+		command(t, tr, c, "CLIENT TRACKING OFF")
+
+		command(t, tr, c, "CLIENT TRACKING ON BCAST")
+		tr.Invalidate(nil, []string{"other"})
+		EqualO(t, pending(c), []string{invalidation("other")})
+		command(t, tr, c, "CLIENT TRACKING OFF")
+	})
+
+	t.Run("optin", func(t *testing.T) {
+		command(t, tr, c, "CLIENT TRACKING ON OPTIN")
+		tr.Track(c, []string{"GET", "a"}, []string{"a"})
+		command(t, tr, c, "CLIENT CACHING YES")
+		tr.Track(c, []string{"CLIENT", "CACHING", "YES"}, nil)
+		tr.Track(c, []string{"GET", "b"}, []string{"b"})
+		// CLIENT CACHING only applies to the next command
+		tr.Track(c, []string{"GET", "c"}, []string{"c"})
+		tr.Invalidate(nil, []string{"a", "b", "c"})
+		EqualO(t, pending(c), []string{invalidation("b")})
+		command(t, tr, c, "CLIENT TRACKING OFF")
+	})
+
+	t.Run("optout", func(t *testing.T) {
+		command(t, tr, c, "CLIENT TRACKING ON OPTOUT")
+		tr.Track(c, []string{"GET", "a"}, []string{"a"})
+		command(t, tr, c, "CLIENT CACHING NO")
+		tr.Track(c, []string{"CLIENT", "CACHING", "NO"}, nil)
+		tr.Track(c, []string{"GET", "b"}, []string{"b"})
+		tr.Invalidate(nil, []string{"a", "b"})
+		EqualO(t, pending(c), []string{invalidation("a")})
+		command(t, tr, c, "CLIENT TRACKING OFF")
+	})
+}
+
+func TestRedirect(t *testing.T) {
+	reg := client.NewRegistry()
+	ps := pubsub.New()
+	tr := New(reg, ps)
+	c := newClient(t, reg, 3)
+	redirect := newClient(t, reg, 2)
+	id := strconv.FormatInt(redirect.ID, 10)
+
+	command(t, tr, c, "CLIENT TRACKING ON BCAST REDIRECT "+id)
+	EqualO(t, command(t, tr, c, "CLIENT GETREDIR"), ":"+id+"\r\n")
+
+	// RESP2 clients are only sent the invalidations while they are subscribed to InvalidateChannel
+	tr.Invalidate(nil, []string{"k"})
+	EqualO(t, pending(redirect), []string{})
+	ps.Subscribe(redirect.Sub, []string{"news"})
+	ps.PSubscribe(redirect.Sub, []string{"__redis__:*"})
+	pending(redirect)
+	tr.Invalidate(nil, []string{"k"})
+	EqualO(t, pending(redirect), []string{})
+	ps.Subscribe(redirect.Sub, []string{InvalidateChannel})
+	pending(redirect)
+	tr.Invalidate(nil, []string{"k"})
+	EqualO(t, pending(redirect), []string{"*3\r\n$7\r\nmessage\r\n$20\r\n__redis__:invalidate\r\n*1\r\n$1\r\nk\r\n"})
+	EqualO(t, pending(c), []string{})
+
+	redirect.SetResp(3)
+	tr.Invalidate(nil, []string{"k"})
+	EqualO(t, pending(redirect), []string{invalidation("k")})
+
+	// the client is told when the client that it redirects to disconnects
+	reg.Remove(redirect)
+	tr.Invalidate(nil, []string{"k"})
+	EqualO(t, pending(c), []string{">2\r\n$21\r\ntracking-redir-broken\r\n:" + id + "\r\n"})
+	IsTrue(t, strings.Contains(command(t, tr, c, "CLIENT TRACKINGINFO"), "broken_redirect"), "the redirect should be broken")
+}
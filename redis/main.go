@@ -1,28 +1,91 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"strconv"
+
 	"github.com/rs/zerolog/log"
 
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/config"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/logging"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/rdbcheck"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
 	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/disk"
 )
 
 func main() {
 	logging.Init()
 
+	if len(os.Args) > 1 {
+		// offline tools, these do not start the server
+		switch os.Args[1] {
+		case "check-rdb":
+			os.Exit(rdbcheck.RunCheck(os.Args[2:], os.Stdout, os.Stderr))
+		case "rdb-dump":
+			os.Exit(rdbcheck.RunDump(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
 	// TODO:
 
 	// zerolog display the file + line
 
 	// protocol description: https://redis.io/docs/latest/develop/reference/protocol-spec/#resp-protocol-description
 
-	s := store.GetSingleton()
+	cfg := config.New()
+	if err := cfg.ParseArgs(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "usage: redis-server [/path/to/redis.conf] [--parameter value ...]")
+		log.Fatal().Err(err).Msg("parsing config")
+	}
+	// LOG (if set) is used unless loglevel is given
+	if err := cfg.Bind("loglevel", logging.SetLevel); err != nil {
+		log.Fatal().Err(err).Msg("parsing config")
+	}
+
+	s := store.New()
+	s.SetPath(disk.Path(cfg.Get("dir"), cfg.Get("dbfilename")))
 	if err := s.LoadFromDisk(); err != nil {
-		panic(err)
+		log.Fatal().Err(err).Msg("loading data from disk (inspect the file with `check-rdb`)")
 	}
 
-	router, err := server.New("localhost:6379") // TODO: take port as flag
+	// the parameters that can change at runtime (e.g. maxmemory) are applied by the server
+	opts := []server.Option{server.WithStore(s), server.WithConfig(cfg)}
+	if aclFile := cfg.Get("aclfile"); aclFile != "" {
+		opts = append(opts, server.WithACLFile(aclFile))
+	}
+	if tlsPort := cfg.Int("tls-port"); tlsPort != 0 {
+		tlsConfig, err := server.TLSConfig(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("parsing config")
+		}
+		opts = append(opts, server.WithTLS(fmt.Sprintf("%s:%d", cfg.Get("bind"), tlsPort), tlsConfig))
+	}
+	if unixSocket := cfg.Get("unixsocket"); unixSocket != "" {
+		perm, err := strconv.ParseUint(cfg.Get("unixsocketperm"), 8, 32)
+		if err != nil || perm > 0o777 {
+			log.Fatal().Str("unixsocketperm", cfg.Get("unixsocketperm")).Msg("parsing unixsocketperm, must be in octal (e.g. 700)")
+		}
+		opts = append(opts, server.WithUnixSocket(unixSocket, os.FileMode(perm)))
+	}
+	port := cfg.Int("port")
+	if cfg.Bool("cluster-enabled") {
+		busPort := cfg.Int("cluster-port")
+		if busPort == 0 {
+			busPort = port + 10000
+		}
+		opts = append(opts, server.WithCluster(fmt.Sprintf("%s:%d", cfg.Get("bind"), busPort)))
+	}
+	if metricsPort := cfg.Int("metrics-port"); metricsPort != 0 {
+		opts = append(opts, server.WithMetrics(fmt.Sprintf("%s:%d", cfg.Get("bind"), metricsPort)))
+	}
+
+	addr := ""
+	if port != 0 {
+		addr = fmt.Sprintf("%s:%d", cfg.Get("bind"), port)
+	}
+	router, err := server.New(addr, opts...)
 	if err != nil {
 		log.Fatal().Err(err).Msg("server init")
 	}
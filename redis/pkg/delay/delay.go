@@ -17,12 +17,18 @@ func NewDelay(expiry time.Time) *Delay {
 	return ret
 }
 
-func (d *Delay) HasExpired() bool {
+// HasExpired returns whether the delay has expired by now.
+func (d *Delay) HasExpired(now time.Time) bool {
 	if d == nil {
 		return false
 	}
 
-	return time.Now().After(d.expiry)
+	return now.After(d.expiry)
+}
+
+// Expiry returns the time at which the delay expires.
+func (d *Delay) Expiry() time.Time {
+	return d.expiry
 }
 
 func (d *Delay) Serialise() []byte {
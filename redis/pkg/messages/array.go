@@ -23,6 +23,11 @@ func (r *Array) Serialise() string {
 	return builder.String()
 }
 
+// Items returns the elements of the Array.
+func (r *Array) Items() []Message {
+	return r.items
+}
+
 // GetCommands gets the commands from an Array.
 // The array must only contain BulkString.
 func (r *Array) GetCommands() ([]string, error) {
@@ -46,6 +51,15 @@ func NewArrayBulkString(strs []string) *Array {
 	return NewArray(items)
 }
 
+func NewArraySimpleString(strs []string) *Array {
+	items := make([]Message, len(strs))
+	for i, s := range strs {
+		items[i] = NewSimpleString(s)
+	}
+
+	return NewArray(items)
+}
+
 func NewArray(items []Message) *Array {
 	ret := &Array{
 		len:   uint(len(items)),
@@ -23,6 +23,14 @@ func (r *BulkString) Serialise() string {
 	return fmt.Sprintf("$%d\r\n%s\r\n", r.len, r.str)
 }
 
+// String returns the data, or "" for the null bulk string.
+func (r *BulkString) String() string {
+	if r == nil {
+		return ""
+	}
+	return r.str
+}
+
 func NewNullBulkString() *BulkString {
 	return nil
 }
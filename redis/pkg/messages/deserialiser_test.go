@@ -55,6 +55,9 @@ func TestSerialise(t *testing.T) {
 
 		{"integer_1", &Integer{420}, ":420\r\n"},
 		{"integer_2", &Integer{-420}, ":-420\r\n"},
+
+		{"push_1", NewPush([]Message{&BulkString{10, "invalidate"}, NewArrayBulkString([]string{"k"})}), ">2\r\n$10\r\ninvalidate\r\n*1\r\n$1\r\nk\r\n"},
+		{"map_1", NewMap([]Message{&BulkString{5, "proto"}, &Integer{3}}), "%1\r\n$5\r\nproto\r\n:3\r\n"},
 	}
 
 	for _, test := range tests {
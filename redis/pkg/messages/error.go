@@ -16,6 +16,10 @@ func (r *Error) Serialise() string {
 	return fmt.Sprintf("-%s\r\n", r.str)
 }
 
+func (r *Error) Error() string {
+	return r.str
+}
+
 func NewError(str string) *Error {
 	return &Error{str: str}
 }
@@ -23,6 +23,10 @@ func (r *Integer) Serialise() string {
 	return fmt.Sprintf(":%s%d\r\n", sign, value)
 }
 
+func (r *Integer) Value() int64 {
+	return r.value
+}
+
 func NewInteger(value int64) *Integer {
 	return &Integer{value: value}
 }
@@ -0,0 +1,28 @@
+package messages
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Map is a RESP3 map, of its keys and values in order.
+type Map struct {
+	pairs []Message
+}
+
+func (r *Map) Serialise() string {
+	// %<number-of-entries>\r\n<key-1><value-1>...<key-n><value-n>
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf("%%%d\r\n", len(r.pairs)/2))
+	for _, item := range r.pairs {
+		builder.WriteString(item.Serialise())
+	}
+
+	return builder.String()
+}
+
+// NewMap returns the map of the keys and values, which alternate (key, value, key, value, ...).
+func NewMap(pairs []Message) *Map {
+	return &Map{pairs: pairs}
+}
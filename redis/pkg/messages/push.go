@@ -0,0 +1,27 @@
+package messages
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Push is a RESP3 out-of-band message (e.g. a client tracking invalidation), which is not a reply to a command.
+type Push struct {
+	items []Message
+}
+
+func (r *Push) Serialise() string {
+	// ><number-of-elements>\r\n<element-1>...<element-n>
+
+	builder := strings.Builder{}
+	builder.WriteString(fmt.Sprintf(">%d\r\n", len(r.items)))
+	for _, item := range r.items {
+		builder.WriteString(item.Serialise())
+	}
+
+	return builder.String()
+}
+
+func NewPush(items []Message) *Push {
+	return &Push{items: items}
+}
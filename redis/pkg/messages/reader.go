@@ -0,0 +1,189 @@
+package messages
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrProtocol is returned (wrapped) by Reader when the stream does not follow the protocol.
+// The stream cannot be recovered after this, so the connection should be closed.
+var ErrProtocol = errors.New("protocol error")
+
+// maxBulkLength is the largest bulk string accepted (same as redis' proto-max-bulk-len).
+const maxBulkLength = 512 * 1024 * 1024
+
+// Reader reads messages from a stream, one at a time.
+// Unlike `Deserialise`, the stream may contain many messages (e.g. pipelined requests), and messages may be split across reads.
+type Reader struct {
+	r *bufio.Reader
+	// n is the number of bytes consumed so far.
+	n int64
+}
+
+func NewReader(r io.Reader) *Reader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Reader{r: br}
+}
+
+// Buffered returns the number of bytes that can be read without blocking.
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// Consumed returns the total number of bytes consumed by the reader.
+func (r *Reader) Consumed() int64 {
+	return r.n
+}
+
+// Bufio returns the underlying reader, for callers that need to read raw bytes off the stream.
+// Bytes read directly are not counted by `Consumed`.
+func (r *Reader) Bufio() *bufio.Reader {
+	return r.r
+}
+
+func protocolError(msg string) error {
+	return errors.Join(ErrProtocol, errors.New(msg))
+}
+
+// readLine reads up to CRLF, returning the line without CRLF.
+func (r *Reader) readLine() (string, error) {
+	line, err := r.r.ReadString(LF)
+	r.n += int64(len(line))
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != CR {
+		return "", protocolError("line must end with CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+func (r *Reader) readInteger() (int64, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(line, 10, 64)
+	if err != nil {
+		return 0, protocolError("invalid integer")
+	}
+	return v, nil
+}
+
+// ReadMessage reads a single message off the stream.
+// Returns io.EOF if the stream ended cleanly before a message.
+func (r *Reader) ReadMessage() (Message, error) {
+	prefix, err := r.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	r.n++
+
+	switch prefix {
+	case '+':
+		line, err := r.readLine()
+		if err != nil {
+			return nil, eofIsUnexpected(err)
+		}
+		return NewSimpleString(line), nil
+	case '-':
+		line, err := r.readLine()
+		if err != nil {
+			return nil, eofIsUnexpected(err)
+		}
+		return NewError(line), nil
+	case ':':
+		v, err := r.readInteger()
+		if err != nil {
+			return nil, eofIsUnexpected(err)
+		}
+		return NewInteger(v), nil
+	case '$':
+		length, err := r.readInteger()
+		if err != nil {
+			return nil, eofIsUnexpected(err)
+		}
+		if length == -1 {
+			return NewNullBulkString(), nil
+		}
+		if length < 0 || length > maxBulkLength {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, length+2)
+		n, err := io.ReadFull(r.r, buf)
+		r.n += int64(n)
+		if err != nil {
+			return nil, eofIsUnexpected(err)
+		}
+		if string(buf[length:]) != CRLF {
+			return nil, protocolError("bulk string does not have CRLF after the specified length")
+		}
+		return NewBulkString(string(buf[:length])), nil
+	case '*':
+		length, err := r.readInteger()
+		if err != nil {
+			return nil, eofIsUnexpected(err)
+		}
+		if length < 0 {
+			return nil, protocolError("invalid multibulk length")
+		}
+		items := make([]Message, length)
+		for i := range items {
+			items[i], err = r.ReadMessage()
+			if err != nil {
+				return nil, eofIsUnexpected(err)
+			}
+		}
+		return NewArray(items), nil
+	}
+
+	// inline command, e.g. from telnet
+	if err := r.r.UnreadByte(); err != nil {
+		return nil, err
+	}
+	r.n--
+	line, err := r.r.ReadString(LF)
+	r.n += int64(len(line))
+	if err != nil {
+		return nil, eofIsUnexpected(err)
+	}
+	return NewArrayBulkString(strings.Fields(line)), nil
+}
+
+// ReadCommands reads a single request off the stream.
+// Empty requests (e.g. blank inline commands) are skipped.
+func (r *Reader) ReadCommands() ([]string, error) {
+	for {
+		msg, err := r.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		array, ok := msg.(*Array)
+		if !ok {
+			return nil, protocolError("request must be an array")
+		}
+		commands, err := array.GetCommands()
+		if err != nil {
+			return nil, errors.Join(ErrProtocol, err)
+		}
+		if len(commands) > 0 {
+			return commands, nil
+		}
+	}
+}
+
+func eofIsUnexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
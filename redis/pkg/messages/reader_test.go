@@ -0,0 +1,66 @@
+package messages
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReaderReadCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		stream   string
+		expected [][]string
+		err      error
+	}{
+		{"single", "*1\r\n$4\r\nping\r\n", [][]string{{"ping"}}, io.EOF},
+		{"pipelined", "*1\r\n$4\r\nping\r\n*2\r\n$3\r\nget\r\n$1\r\nk\r\n", [][]string{{"ping"}, {"get", "k"}}, io.EOF},
+		{"inline", "PING\r\nget  k\r\n\r\n", [][]string{{"PING"}, {"get", "k"}}, io.EOF},
+		{"binary_safe", "*1\r\n$4\r\na\r\nb\r\n", [][]string{{"a\r\nb"}}, io.EOF},
+		{"truncated", "*2\r\n$3\r\nget\r\n$1\r\n", nil, io.ErrUnexpectedEOF},
+		{"bad_length", "*1\r\n$4\r\npingxx\r\n", nil, ErrProtocol},
+		{"not_array", "+OK\r\n", nil, ErrProtocol},
+		{"not_bulk_strings", "*1\r\n:1\r\n", nil, ErrProtocol},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewReader(strings.NewReader(test.stream))
+
+			var actual [][]string
+			var err error
+			for {
+				var commands []string
+				commands, err = r.ReadCommands()
+				if err != nil {
+					break
+				}
+				actual = append(actual, commands)
+			}
+
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected err %v, but got %v", test.err, err)
+			}
+			if !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("expected %q, but got %q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReaderConsumed(t *testing.T) {
+	first := "*1\r\n$4\r\nping\r\n"
+	second := "*2\r\n$3\r\nget\r\n$1\r\nk\r\n"
+	r := NewReader(strings.NewReader(first + second))
+
+	r.ReadCommands()
+	if r.Consumed() != int64(len(first)) {
+		t.Errorf("expected %v, but got %v", len(first), r.Consumed())
+	}
+	r.ReadCommands()
+	if r.Consumed() != int64(len(first+second)) {
+		t.Errorf("expected %v, but got %v", len(first+second), r.Consumed())
+	}
+}
@@ -16,6 +16,10 @@ func (r *SimpleString) Serialise() string {
 	return fmt.Sprintf("+%s\r\n", r.str)
 }
 
+func (r *SimpleString) String() string {
+	return r.str
+}
+
 func NewSimpleString(str string) *SimpleString {
 	return &SimpleString{str}
 }
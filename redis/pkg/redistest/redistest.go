@@ -0,0 +1,193 @@
+// Package redistest runs a server in-process, with its own store, for the tests of programs that use redis.
+//
+//	s, err := redistest.Run()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//	s.Set("k", "v")
+//	cli := redis.NewClient(&redis.Options{Addr: s.Addr()})
+package redistest
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/clock"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/server"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/disk"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/items"
+	"github.com/seetohjinwei/ccfyi/redis/pkg/delay"
+)
+
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrWrongType   = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+// Server is a server listening on a random port of localhost. Servers do not share any keys.
+type Server struct {
+	srv   *server.Server
+	store *store.Store
+	// dir holds the snapshots that SAVE writes, it is removed by Close.
+	dir string
+	// clock is the time of the keys, moved by FastForward.
+	clock *clock.Offset
+}
+
+// Run starts a server, which must be closed with `Close`.
+func Run() (*Server, error) {
+	dir, err := os.MkdirTemp("", "redistest")
+	if err != nil {
+		return nil, err
+	}
+	clk := &clock.Offset{}
+	st := store.NewWithClock(clk)
+	st.SetPath(disk.Path(dir, disk.DefaultFilename))
+	srv, err := server.New("127.0.0.1:0", server.WithStore(st))
+	if err != nil {
+		st.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	go func() {
+		// returns once the server is closed
+		srv.Serve()
+	}()
+
+	return &Server{srv: srv, store: st, dir: dir, clock: clk}, nil
+}
+
+// RunT starts a server, failing the test if it cannot, and closes it when the test ends.
+func RunT(t testing.TB) *Server {
+	t.Helper()
+
+	s, err := Run()
+	if err != nil {
+		t.Fatalf("starting redistest server: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Addr returns the address to connect to, e.g. "127.0.0.1:54321".
+func (s *Server) Addr() string {
+	return s.srv.Addr()
+}
+
+// Close stops the server, and forgets its keys (including those that were saved).
+func (s *Server) Close() {
+	s.srv.Stop()
+	s.store.Close()
+	os.RemoveAll(s.dir)
+}
+
+// Set sets the key to the string value, removing any TTL (like SET).
+func (s *Server) Set(key, value string) {
+	s.store.Set(key, items.NewString(value))
+}
+
+// Seed sets each key to its string value.
+func (s *Server) Seed(values map[string]string) {
+	for key, value := range values {
+		s.Set(key, value)
+	}
+}
+
+// Get returns the string value of the key.
+func (s *Server) Get(key string) (string, error) {
+	item, ok := s.store.Get(key)
+	if !ok {
+		return "", ErrKeyNotFound
+	}
+	value, ok := item.Get()
+	if !ok {
+		return "", ErrWrongType
+	}
+	return value, nil
+}
+
+// RPush appends the values to the list at the key, creating it if needed, and returns its new length.
+func (s *Server) RPush(key string, values ...string) (int, error) {
+	list, err := s.List(key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return 0, err
+	}
+	list = append(list, values...)
+
+	var d *delay.Delay
+	if value, ok := s.store.Peek(key); ok {
+		if expiry, ok := value.Expiry(); ok {
+			d = delay.NewDelay(expiry)
+		}
+	}
+	// a new list, rather than pushing to the one that clients may be reading
+	s.store.SetWithDelay(key, items.NewListBuilder().Add(list).Build(), d)
+	return len(list), nil
+}
+
+// List returns the elements of the list at the key.
+func (s *Server) List(key string) ([]string, error) {
+	item, ok := s.store.Get(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	list, ok := item.LRange(0, -1)
+	if !ok {
+		return nil, ErrWrongType
+	}
+	return list, nil
+}
+
+// SetTTL expires the key after ttl.
+func (s *Server) SetTTL(key string, ttl time.Duration) error {
+	item, ok := s.store.Get(key)
+	if !ok {
+		return ErrKeyNotFound
+	}
+	return s.store.SetWithDelay(key, item, delay.NewDelay(s.store.Now().Add(ttl)))
+}
+
+// TTL returns how long until the key expires, or 0 if it does not exist or has no TTL.
+func (s *Server) TTL(key string) time.Duration {
+	value, ok := s.store.Peek(key)
+	if !ok {
+		return 0
+	}
+	expiry, ok := value.Expiry()
+	if !ok {
+		return 0
+	}
+	return expiry.Sub(s.store.Now())
+}
+
+// FastForward moves time forward by d for the keys, expiring the keys that would have expired by then.
+func (s *Server) FastForward(d time.Duration) {
+	s.clock.Add(d)
+}
+
+// Exists returns whether the key exists.
+func (s *Server) Exists(key string) bool {
+	return s.store.Exists(key)
+}
+
+// Del deletes the key, returning whether it existed.
+func (s *Server) Del(key string) bool {
+	return len(s.store.DeleteMany([]string{key})) > 0
+}
+
+// Keys returns every key, sorted.
+func (s *Server) Keys() []string {
+	keys := s.store.Keys()
+	slices.Sort(keys)
+	return keys
+}
+
+// FlushAll deletes every key.
+func (s *Server) FlushAll() {
+	s.store.DeleteMany(s.store.Keys())
+}
@@ -0,0 +1,118 @@
+package redistest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/redis/go-redis/v9"
+
+	. "github.com/seetohjinwei/ccfyi/redis/internal/pkg/assert"
+	"github.com/seetohjinwei/ccfyi/redis/internal/pkg/store/disk"
+)
+
+func newClient(t *testing.T, s *Server) *redis.Client {
+	cli := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	t.Cleanup(func() {
+		cli.Close()
+	})
+	return cli
+}
+
+func TestRun(t *testing.T) {
+	s := RunT(t)
+	cli := newClient(t, s)
+	ctx := context.Background()
+
+	s.Seed(map[string]string{"a": "1", "b": "2"})
+	Equal(t, V(cli.Get(ctx, "a").Result()), V("1", nil))
+	NoError(t, cli.Set(ctx, "c", "3", 0).Err())
+	Equal(t, V(s.Get("c")), V("3", nil))
+	EqualO(t, s.Keys(), []string{"a", "b", "c"})
+
+	IsTrue(t, s.Del("a"), "")
+	IsFalse(t, s.Exists("a"), "")
+	Equal(t, V(s.Get("a")), V("", ErrKeyNotFound), cmpopts.EquateErrors())
+
+	s.FlushAll()
+	Equal(t, V(cli.Exists(ctx, "b", "c").Result()), V(int64(0), nil))
+}
+
+func TestIsolation(t *testing.T) {
+	s1 := RunT(t)
+	s2 := RunT(t)
+	ctx := context.Background()
+
+	IsTrue(t, s1.Addr() != s2.Addr(), "addr=%s", s1.Addr())
+	s1.Set("k", "1")
+	NoError(t, newClient(t, s2).Set(ctx, "k", "2", 0).Err())
+
+	Equal(t, V(s1.Get("k")), V("1", nil))
+	Equal(t, V(newClient(t, s1).Get(ctx, "k").Result()), V("1", nil))
+	Equal(t, V(s2.Get("k")), V("2", nil))
+
+	// snapshots are saved to a directory of the server's own
+	NoError(t, newClient(t, s1).Save(ctx).Err())
+	_, err := os.Stat(filepath.Join(s1.dir, disk.DefaultFilename))
+	NoError(t, err)
+	_, err = os.Stat(filepath.Join(s2.dir, disk.DefaultFilename))
+	IsTrue(t, os.IsNotExist(err), "err=%v", err)
+	s1.Close()
+	_, err = os.Stat(s1.dir)
+	IsTrue(t, os.IsNotExist(err), "err=%v", err)
+}
+
+func TestList(t *testing.T) {
+	s := RunT(t)
+	cli := newClient(t, s)
+	ctx := context.Background()
+
+	Equal(t, V(s.RPush("l", "a", "b")), V(2, nil))
+	NoError(t, cli.RPush(ctx, "l", "c").Err())
+	Equal(t, V(s.List("l")), V([]string{"a", "b", "c"}, nil))
+
+	s.Set("s", "v")
+	Equal(t, V(s.RPush("s", "a")), V(0, ErrWrongType), cmpopts.EquateErrors())
+	Equal(t, V(s.List("s")), V([]string(nil), ErrWrongType), cmpopts.EquateErrors())
+	Equal(t, V(s.Get("l")), V("", ErrWrongType), cmpopts.EquateErrors())
+}
+
+func TestFastForward(t *testing.T) {
+	s := RunT(t)
+	cli := newClient(t, s)
+	ctx := context.Background()
+
+	s.Set("k", "v")
+	NoError(t, s.SetTTL("k", time.Minute))
+	NoError(t, cli.Set(ctx, "other", "v", time.Hour).Err())
+	IsTrue(t, s.TTL("k") > 59*time.Second, "ttl=%v", s.TTL("k"))
+
+	s.FastForward(30 * time.Second)
+	IsTrue(t, s.TTL("k") <= 30*time.Second, "ttl=%v", s.TTL("k"))
+	Equal(t, V(cli.Get(ctx, "k").Result()), V("v", nil))
+
+	s.FastForward(31 * time.Second)
+	IsFalse(t, s.Exists("k"), "")
+	Equal(t, V(cli.Exists(ctx, "k").Result()), V(int64(0), nil))
+	IsTrue(t, s.Exists("other"), "")
+	EqualO(t, s.TTL("missing"), time.Duration(0))
+	HasError(t, s.SetTTL("missing", time.Second))
+}
+
+func TestCloseConnected(t *testing.T) {
+	s, err := Run()
+	NoError(t, err)
+	cli := redis.NewClient(&redis.Options{Addr: s.Addr(), MaxRetries: -1})
+	defer cli.Close()
+	ctx := context.Background()
+	NoError(t, cli.Set(ctx, "k", "v", 0).Err())
+
+	// the connected client is disconnected, rather than waited for
+	start := time.Now()
+	s.Close()
+	IsTrue(t, time.Since(start) < 500*time.Millisecond, "Close took %v", time.Since(start))
+	HasError(t, cli.Get(ctx, "k").Err())
+}